@@ -24,6 +24,10 @@ import (
 	autoscaling "k8s.io/api/autoscaling/v1"
 
 	corev1 "k8s.io/api/core/v1"
+
+	networkingv1 "k8s.io/api/networking/v1"
+
+	rbacv1 "k8s.io/api/rbac/v1"
 )
 
 // CustomPodAutoscalerConfig defines the configuration options that can be passed to the CustomPodAutoscaler
@@ -32,6 +36,99 @@ type CustomPodAutoscalerConfig struct {
 	Value string `json:"value"`
 }
 
+// APIHealthCheck defines how the operator checks that the HTTP API of the autoscaler is serving
+type APIHealthCheck struct {
+	// Path requested from the autoscaler HTTP API, any 2xx response is healthy
+	Path string `json:"path"`
+	// Port of the autoscaler HTTP API, defaults to 5000
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port,omitempty"`
+	// PeriodSeconds is how often the HTTP API is checked, defaults to 30
+	// +kubebuilder:validation:Minimum=1
+	PeriodSeconds int32 `json:"periodSeconds,omitempty"`
+}
+
+// ScaleTargetCleanup defines how the scale target is cleaned up when the CPA is deleted
+type ScaleTargetCleanup struct {
+	// Replicas the scale target is restored to if autoscaling is paused when the CPA is deleted, if not set the
+	// replicas set while paused are left unchanged
+	// +kubebuilder:validation:Minimum=0
+	Replicas *int32 `json:"replicas,omitempty"`
+}
+
+// MetricsRBACMode defines the access to the metrics APIs granted by the provisioned Role
+type MetricsRBACMode string
+
+const (
+	// MetricsRBACModeFull grants all verbs on all resources in the metrics APIs
+	MetricsRBACModeFull MetricsRBACMode = "Full"
+	// MetricsRBACModeReadOnly only grants get and list on resources in the metrics APIs
+	MetricsRBACModeReadOnly MetricsRBACMode = "ReadOnly"
+)
+
+// RBACMode summarizes the RBAC resources provisioned by the operator for the autoscaler
+type RBACMode string
+
+const (
+	// RBACModeProvisionedRole is used when the operator provisions a namespaced Role and a RoleBinding binding it to
+	// the autoscaler ServiceAccount
+	RBACModeProvisionedRole RBACMode = "ProvisionedNamespacedRole"
+	// RBACModeBoundExistingRole is used when the operator provisions a RoleBinding binding an existing Role, not
+	// provisioned by the operator, to the autoscaler ServiceAccount
+	RBACModeBoundExistingRole RBACMode = "BoundExistingRole"
+	// RBACModeProvisionedRoleUnbound is used when the operator provisions a Role but not a RoleBinding, so the Role
+	// must be bound to the autoscaler ServiceAccount separately
+	RBACModeProvisionedRoleUnbound RBACMode = "ProvisionedRoleUnbound"
+	// RBACModeSkipped is used when the operator provisions no RBAC resources, either because they are disabled or
+	// because the ServiceAccount is not provisioned by the operator
+	RBACModeSkipped RBACMode = "Skipped"
+)
+
+// Condition types reported in the CustomPodAutoscaler status
+const (
+	// ConditionRequiredLabels reports if the CPA has all of the labels the operator requires before provisioning
+	ConditionRequiredLabels = "RequiredLabels"
+	// ConditionCrashLooping reports if the autoscaler Pod has restarted more times than the crash looping threshold
+	ConditionCrashLooping = "CrashLooping"
+	// ConditionLargeEnvVars reports if the environment variables of a provisioned container exceed the size threshold
+	// of the operator
+	ConditionLargeEnvVars = "LargeEnvVars"
+	// ConditionAPIReady reports if the HTTP API of the autoscaler Pod is serving, only set if an API health check is
+	// configured
+	ConditionAPIReady = "APIReady"
+	// ConditionTargetUpdating reports if setting the paused replicas of a StatefulSet scale target is deferred until
+	// a rolling update of the StatefulSet completes
+	ConditionTargetUpdating = "TargetUpdating"
+	// ConditionParked reports if the CPA is no longer reconciled after repeatedly failing to reconcile, the CPA is
+	// reconciled again once its spec changes
+	ConditionParked = "Parked"
+	// ConditionResourcesProvisioned reports if all of the resources of the CPA were provisioned, resources are
+	// provisioned in dependency order so if a resource fails the resources depending on it are not provisioned
+	ConditionResourcesProvisioned = "ResourcesProvisioned"
+	// ConditionImageNotAllowed reports if a container image of the CPA is not from a registry allowed by the operator,
+	// the CPA is not provisioned until all of its images are from allowed registries
+	ConditionImageNotAllowed = "ImageNotAllowed"
+	// ConditionRoleInsufficient reports if the existing Role bound to the autoscaler does not grant the access the
+	// autoscaler needs to manage its scale target, only set if validating the existing Role is enabled
+	ConditionRoleInsufficient = "RoleInsufficient"
+	// ConditionConfigSecretMissing reports if a Secret or Secret key referenced by the environment variables of a
+	// container does not exist, the Pod is not provisioned until all of the referenced Secrets and keys exist
+	ConditionConfigSecretMissing = "ConfigSecretMissing"
+	// ConditionQuotaExceeded reports if creating the Pod would exceed a ResourceQuota of the namespace, the Pod is not
+	// provisioned until there is quota available. Only set if the operator is checking ResourceQuotas
+	ConditionQuotaExceeded = "QuotaExceeded"
+	// ConditionTargetNotScalable reports if a custom resource scale target does not implement the scale subresource,
+	// so the operator cannot set its replicas while autoscaling is paused
+	ConditionTargetNotScalable = "TargetNotScalable"
+	// ConditionResourcesAboveCeiling reports if the resources of the autoscaler container are above the resource ceiling
+	// of the operator, depending on the operator the resources are clamped to the ceiling or the Pod is not provisioned
+	ConditionResourcesAboveCeiling = "ResourcesAboveCeiling"
+	// ConditionTargetForbidden reports if the operator is forbidden from accessing a custom resource scale target, so
+	// the operator cannot set its replicas while autoscaling is paused until its RBAC grants access to the resource
+	ConditionTargetForbidden = "TargetForbidden"
+)
+
 // CustomPodAutoscalerSpec defines the desired state of CustomPodAutoscaler
 type CustomPodAutoscalerSpec struct {
 	// The image of the Custom Pod Autoscaler
@@ -46,10 +143,248 @@ type CustomPodAutoscalerSpec struct {
 	ProvisionPod              *bool                       `json:"provisionPod,omitempty"`
 	RoleRequiresMetricsServer *bool                       `json:"roleRequiresMetricsServer,omitempty"`
 	RoleRequiresArgoRollouts  *bool                       `json:"roleRequiresArgoRollouts,omitempty"`
+	// ConfigOverlays are configuration options for each environment keyed by environment name, the overlay for the
+	// environment the operator is running in is merged onto Config, overlay options take precedence over Config
+	// options with the same name
+	ConfigOverlays map[string][]CustomPodAutoscalerConfig `json:"configOverlays,omitempty"`
+	// TemplateConfigValues expands Config values as Go templates when the Pod is provisioned, allowing values to
+	// reference the .Name, .Namespace and .ScaleTargetRef of the CPA. If not set values are used as they are, so
+	// values containing literal braces are not changed
+	TemplateConfigValues *bool `json:"templateConfigValues,omitempty"`
+	// ActiveDeadlineSeconds applied to the provisioned Pod if the template does not set it, the Pod is stopped
+	// once it has been active for this duration
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+	// GeneratePodName provisions the Pod using a generated name (the template name, or the CPA name, followed by a
+	// random suffix) to avoid name collisions, the generated name is tracked in the status
+	GeneratePodName *bool `json:"generatePodName,omitempty"`
+	// SchedulerName applied to the provisioned Pod if the template does not set it, the Pod is scheduled by this
+	// scheduler rather than the default scheduler
+	SchedulerName string `json:"schedulerName,omitempty"`
+	// PreemptionPolicy applied to the provisioned Pod if the template does not set it, set to Never so the autoscaler
+	// Pod does not preempt lower priority Pods. Defaults to PreemptLowerPriority if not set
+	// +kubebuilder:validation:Enum=Never;PreemptLowerPriority
+	PreemptionPolicy *corev1.PreemptionPolicy `json:"preemptionPolicy,omitempty"`
+	// MetricsRBACMode is the access to the metrics APIs granted by the provisioned Role if it requires the metrics
+	// server, defaults to Full
+	// +kubebuilder:validation:Enum=ReadOnly;Full
+	MetricsRBACMode MetricsRBACMode `json:"metricsRBACMode,omitempty"`
+	// ConfigFiles are files (filename to content) provided to the autoscaler, the operator provisions a ConfigMap
+	// holding the files and mounts it into each container at ConfigFilesMountPath
+	ConfigFiles map[string]string `json:"configFiles,omitempty"`
+	// ConfigFilesMountPath is the path ConfigFiles are mounted at in each container, defaults to /etc/cpa/config
+	ConfigFilesMountPath string `json:"configFilesMountPath,omitempty"`
+	// SecretConfig are configuration options that should not be stored in plain text, the operator provisions a Secret
+	// holding the options and injects them into each container as environment variables
+	SecretConfig map[string]string `json:"secretConfig,omitempty"`
+	// PodRecreateCooldownSeconds is the minimum time between the operator recreating the Pod, changes made within
+	// the cooldown are applied once the cooldown has passed
+	PodRecreateCooldownSeconds *int64 `json:"podRecreateCooldownSeconds,omitempty"`
+	// RestartSchedule is a standard cron expression (for example "0 3 * * *") the autoscaler Pod is restarted on, to
+	// clear any state accumulated by the autoscaler. A restart is skipped if the Pod has been recreated since it was
+	// due, such as for a config change
+	RestartSchedule string `json:"restartSchedule,omitempty"`
+	// MaxPodAge is the maximum age of the autoscaler Pod (for example "24h"), once the Pod is older it is recreated to
+	// clear any state accumulated by the autoscaler, such as leaked memory. The age is skipped if the Pod has been
+	// recreated for another reason, such as a config change or a restart
+	MaxPodAge *metav1.Duration `json:"maxPodAge,omitempty"`
+	// InjectIdentityEnvVars injects the UID and generation of the CPA into each container as the cpaUID and
+	// cpaGeneration environment variables
+	InjectIdentityEnvVars *bool `json:"injectIdentityEnvVars,omitempty"`
+	// InjectResourceEnvVars injects the CPU and memory requests and limits of the autoscaler container (the first
+	// container in the template) into it as the cpaCpuRequest, cpaCpuLimit, cpaMemRequest and cpaMemLimit environment
+	// variables using the downward API, with CPU in millicores and memory in bytes
+	InjectResourceEnvVars *bool `json:"injectResourceEnvVars,omitempty"`
+	// InjectCorrelationID injects a correlation ID into each container as the cpaCorrelationID environment variable, the
+	// ID is derived from the UID of the CPA so it is stable across reconciles and Pod restarts, allowing logs from the
+	// autoscaler to be correlated with operator events and logs for the CPA
+	InjectCorrelationID *bool `json:"injectCorrelationID,omitempty"`
+	// InitialStabilizationSeconds is injected into each container as the initialStabilizationSeconds environment
+	// variable, for the autoscaler to hold off scaling for this long after it is provisioned while metrics stabilize.
+	// A config option of the same name takes precedence
+	// +kubebuilder:validation:Minimum=0
+	InitialStabilizationSeconds *int32 `json:"initialStabilizationSeconds,omitempty"`
+	// StartupProbe applied to the autoscaler container (the first container in the template) if the template does
+	// not set it, allowing slow starting autoscalers time to initialize before other probes are run
+	StartupProbe *corev1.Probe `json:"startupProbe,omitempty"`
+	// SchedulingGates applied to the provisioned Pod if the template does not set any, holding the Pod pending
+	// until the gates are removed. Clusters that do not support scheduling gates ignore this field
+	// +listType=map
+	// +listMapKey=name
+	SchedulingGates []corev1.PodSchedulingGate `json:"schedulingGates,omitempty"`
+	// Resources are the default resource requests and limits of the autoscaler container (the first container in
+	// the template), any resource (such as cpu, memory or ephemeral-storage) not set in the template is set from these
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// Overhead applied to the provisioned Pod if the template does not set it, this must match the overhead of the
+	// RuntimeClass used by the Pod
+	Overhead corev1.ResourceList `json:"overhead,omitempty"`
+	// RuntimeClassName applied to the provisioned Pod if the template does not set it, running the autoscaler under
+	// the container runtime of the RuntimeClass (such as a sandboxed runtime). The Pod overhead is set from the
+	// RuntimeClass unless Overhead is set, in which case it must match the overhead of the RuntimeClass
+	RuntimeClassName *string `json:"runtimeClassName,omitempty"`
+	// ReadinessGates applied to the provisioned Pod if the template does not set any, the Pod is only ready once the
+	// conditions of the gates are set to True by an external controller, such as a service mesh
+	ReadinessGates []corev1.PodReadinessGate `json:"readinessGates,omitempty"`
+	// HostAliases applied to the provisioned Pod if the template does not set any, adding entries to the hosts file
+	// of the Pod
+	HostAliases []corev1.HostAlias `json:"hostAliases,omitempty"`
+	// Sysctls applied to the security context of the provisioned Pod if the template does not set any, for
+	// autoscalers that need tuned kernel parameters such as network settings. Unsafe sysctls are only allowed on
+	// nodes configured to allow them
+	Sysctls []corev1.Sysctl `json:"sysctls,omitempty"`
+	// Hostname applied to the provisioned Pod if the template does not set it, if not set the hostname of the Pod is
+	// its name
+	Hostname string `json:"hostname,omitempty"`
+	// Subdomain applied to the provisioned Pod if the template does not set it, combined with a headless Service of the
+	// same name in the namespace the Pod has the stable DNS name <hostname>.<subdomain>.<namespace>.svc
+	Subdomain string `json:"subdomain,omitempty"`
+	// ShareProcessNamespace shares a single process namespace between the containers of the provisioned Pod if the
+	// template does not set shareProcessNamespace, for debug sidecars that need to see the autoscaler process.
+	// Defaults to false
+	ShareProcessNamespace bool `json:"shareProcessNamespace,omitempty"`
+	// NodeFailureTolerationSeconds adds tolerations for the node.kubernetes.io/not-ready and
+	// node.kubernetes.io/unreachable taints to the provisioned Pod, keeping the autoscaler bound to its node for this
+	// many seconds during transient node failures. Taints already tolerated by the template are not changed
+	// +kubebuilder:validation:Minimum=0
+	NodeFailureTolerationSeconds *int64 `json:"nodeFailureTolerationSeconds,omitempty"`
+	// ScaleTargetAntiAffinity adds a preferred pod anti-affinity to the provisioned Pod against the Pods of the scale
+	// target, resolved from the selector of the scale target's scale subresource, so a single node failure is less
+	// likely to take out both the autoscaler and the workload it scales. Defaults to false
+	ScaleTargetAntiAffinity *bool `json:"scaleTargetAntiAffinity,omitempty"`
+	// MaxProvisionRetries is the number of consecutive times provisioning a resource (such as the Pod, ServiceAccount
+	// or Role) can fail before the CPA is parked with the Parked condition, a parked CPA is not retried until its spec
+	// changes. If not set provisioning is retried indefinitely
+	// +kubebuilder:validation:Minimum=1
+	MaxProvisionRetries *int32 `json:"maxProvisionRetries,omitempty"`
+	// Command is the entrypoint of the autoscaler container (the first container in the template), applied if the
+	// template does not set a command
+	Command []string `json:"command,omitempty"`
+	// Args are the arguments to the entrypoint of the autoscaler container (the first container in the template),
+	// applied if the template does not set any arguments
+	Args []string `json:"args,omitempty"`
+	// ImagePullPolicy is the image pull policy of the autoscaler container (the container named by
+	// AutoscalerContainerName), applied if the template does not set a pull policy. The pull policies of other
+	// containers, such as sidecars, are left to the template
+	// +kubebuilder:validation:Enum=Always;Never;IfNotPresent
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// AutoscalerContainerName is the name of the autoscaler container in the template that the ImagePullPolicy is
+	// applied to, for templates that list sidecars before the autoscaler container. If not set the first container in
+	// the template is the autoscaler container
+	AutoscalerContainerName string `json:"autoscalerContainerName,omitempty"`
+	// Lifecycle is the lifecycle of the autoscaler container (the first container in the template), such as a preStop
+	// hook to shut down cleanly when the Pod is terminated, applied if the template does not set a lifecycle
+	Lifecycle *corev1.Lifecycle `json:"lifecycle,omitempty"`
+	// HostNetwork runs the provisioned Pod in the host network namespace, for autoscalers that gather host level
+	// metrics. The Pod DNS policy is set to ClusterFirstWithHostNet unless the template sets a DNS policy
+	HostNetwork bool `json:"hostNetwork,omitempty"`
+	// HostPID runs the provisioned Pod in the host process ID namespace
+	HostPID bool `json:"hostPID,omitempty"`
+	// HostIPC runs the provisioned Pod in the host IPC namespace
+	HostIPC bool `json:"hostIPC,omitempty"`
+	// AdditionalRoleBindingSubjects are added to the subjects of the provisioned RoleBinding alongside the
+	// provisioned ServiceAccount, binding the provisioned Role to other identities such as the ServiceAccount of a
+	// sidecar. Subjects must be a ServiceAccount, User or Group, ServiceAccounts default to the CPA namespace
+	AdditionalRoleBindingSubjects []rbacv1.Subject `json:"additionalRoleBindingSubjects,omitempty"`
+	// UseProjectedToken provisions the Pod with a projected service account token volume, providing a short-lived
+	// token in place of the automatically mounted service account token, which is disabled
+	UseProjectedToken *bool `json:"useProjectedToken,omitempty"`
+	// ProjectedTokenAudience is the intended audience of the projected service account token, defaults to the
+	// audience of the API server
+	ProjectedTokenAudience string `json:"projectedTokenAudience,omitempty"`
+	// ProjectedTokenExpirationSeconds is the requested lifetime of the projected service account token, the token is
+	// rotated before it expires. Defaults to 3600
+	// +kubebuilder:validation:Minimum=600
+	ProjectedTokenExpirationSeconds *int64 `json:"projectedTokenExpirationSeconds,omitempty"`
+	// MountScratchVolume mounts an emptyDir volume into each container at ScratchVolumeMountPath, providing writable
+	// scratch space for autoscalers running with a read-only root filesystem
+	MountScratchVolume *bool `json:"mountScratchVolume,omitempty"`
+	// ScratchVolumeMountPath is the path the scratch volume is mounted at in each container, defaults to /tmp
+	ScratchVolumeMountPath string `json:"scratchVolumeMountPath,omitempty"`
+	// ContainerPorts are the ports exposed by the autoscaler container (the first container in the template),
+	// applied if the template does not set any ports. Defaults to the autoscaler HTTP API port, named http on port
+	// 5000
+	// +listType=map
+	// +listMapKey=containerPort
+	// +listMapKey=protocol
+	ContainerPorts []corev1.ContainerPort `json:"containerPorts,omitempty"`
+	// APIHealthCheck enables the operator periodically querying the HTTP API of the autoscaler Pod, reporting if the
+	// API is serving with the APIReady condition
+	APIHealthCheck *APIHealthCheck `json:"apiHealthCheck,omitempty"`
+	// WaitForTargetUpdate defers setting the paused replicas of a StatefulSet scale target while a rolling update of
+	// the StatefulSet is in progress, including partitioned updates, to avoid conflicting with the StatefulSet
+	// controller. If not set the paused replicas are set during updates
+	WaitForTargetUpdate *bool `json:"waitForTargetUpdate,omitempty"`
+	// ScaleTargetCleanup adds a finalizer to the CPA so the scale target is cleaned up before the CPA is deleted,
+	// removing the managed pause annotation and optionally restoring the replicas of a paused scale target. If not set
+	// the scale target is left as it is when the CPA is deleted
+	ScaleTargetCleanup *ScaleTargetCleanup `json:"scaleTargetCleanup,omitempty"`
+	// ProvisionServiceMonitor provisions a headless Service selecting the autoscaler Pod and a Prometheus Operator
+	// ServiceMonitor scraping /metrics on the first port of the Service. Only provisioned if the ServiceMonitor CRD
+	// is installed in the cluster
+	ProvisionServiceMonitor *bool `json:"provisionServiceMonitor,omitempty"`
+	// ValidateExistingRole checks the existing Role bound to the autoscaler when the Role is not provisioned by the
+	// operator, reporting with the RoleInsufficient condition if the Role does not grant the access the autoscaler
+	// needs to manage its scale target. Provisioning is not blocked by an insufficient Role
+	ValidateExistingRole *bool `json:"validateExistingRole,omitempty"`
+	// ProvisionNetworkPolicy provisions a NetworkPolicy selecting the autoscaler Pod that denies all egress except DNS,
+	// the Kubernetes API server and the rules in NetworkPolicyEgress
+	ProvisionNetworkPolicy *bool `json:"provisionNetworkPolicy,omitempty"`
+	// NetworkPolicyEgress are egress rules added to the provisioned NetworkPolicy, allowing the autoscaler to reach
+	// other targets such as a metrics endpoint
+	NetworkPolicyEgress []networkingv1.NetworkPolicyEgressRule `json:"networkPolicyEgress,omitempty"`
+	// AttachPullSecretsToSA sets the imagePullSecrets of the template as the imagePullSecrets of the provisioned
+	// ServiceAccount, so the pull secrets apply to every Pod using the ServiceAccount. Has no effect if the
+	// ServiceAccount is not provisioned by the operator
+	AttachPullSecretsToSA *bool `json:"attachPullSecretsToSA,omitempty"`
 }
 
 // CustomPodAutoscalerStatus defines the observed state of CustomPodAutoscaler
-type CustomPodAutoscalerStatus struct{}
+type CustomPodAutoscalerStatus struct {
+	// PodName is the name of the provisioned Pod when using a generated Pod name
+	PodName string `json:"podName,omitempty"`
+	// LastPodRecreateTime is the last time the operator recreated the Pod, used to apply the Pod recreate cooldown
+	LastPodRecreateTime *metav1.Time `json:"lastPodRecreateTime,omitempty"`
+	// PodProvisionedTime is when the current autoscaler Pod was created, used with initialStabilizationSeconds to know
+	// when the autoscaler is warmed up
+	PodProvisionedTime *metav1.Time `json:"podProvisionedTime,omitempty"`
+	// LastScheduledRestartTime is the last time the operator handled a restart on the restart schedule, the next
+	// restart is due at the next activation of the schedule after this time
+	LastScheduledRestartTime *metav1.Time `json:"lastScheduledRestartTime,omitempty"`
+	// LastRestartRequest is the last value of the restart annotation handled by the operator, the Pod is only
+	// restarted when the annotation changes to a different value
+	LastRestartRequest string `json:"lastRestartRequest,omitempty"`
+	// LastDebugRequest is the last value of the debug annotation handled by the operator, a debug container is only
+	// attached when the annotation changes to a different value
+	LastDebugRequest string `json:"lastDebugRequest,omitempty"`
+	// ScaleTargetPaused is true while autoscaling is paused and the replicas of the scale target are set by the
+	// operator
+	ScaleTargetPaused bool `json:"scaleTargetPaused,omitempty"`
+	// TargetObservedVersion is the resourceVersion of the scale target observed in the last reconcile, empty if the
+	// scale target did not exist. A change in the version shows the scale target changed, or was recreated, since
+	// the autoscaler was provisioned
+	TargetObservedVersion string `json:"targetObservedVersion,omitempty"`
+	// PausedSince is when autoscaling was paused, cleared once autoscaling is resumed. Used to report how long
+	// autoscaling was paused for
+	PausedSince *metav1.Time `json:"pausedSince,omitempty"`
+	// PodRestartCount is the total number of restarts of the containers in the autoscaler Pod
+	PodRestartCount int32 `json:"podRestartCount,omitempty"`
+	// PlanHash is a hash of the resources provisioned by the last full reconcile, reconciling the resources is skipped
+	// while they are unchanged and healthy
+	PlanHash string `json:"planHash,omitempty"`
+	// LastFullReconcileTime is the last time all of the provisioned resources were reconciled
+	LastFullReconcileTime *metav1.Time `json:"lastFullReconcileTime,omitempty"`
+	// RBACMode summarizes the RBAC resources the operator provisioned for the autoscaler in the last reconcile
+	RBACMode RBACMode `json:"rbacMode,omitempty"`
+	// ReconcileFailures is the number of consecutive reconciles of the CPA that have failed, only tracked if the
+	// operator parks repeatedly failing CPAs
+	ReconcileFailures int32 `json:"reconcileFailures,omitempty"`
+	// ProvisionFailures is the number of consecutive times provisioning a resource has failed, keyed by the kind of
+	// the resource (for example v1/Pod). Only tracked if maxProvisionRetries is set
+	ProvisionFailures map[string]int32 `json:"provisionFailures,omitempty"`
+	// Conditions describe the current state of the CPA
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
 
 // CustomPodAutoscaler is the Schema for the custompodautoscalers API
 // +kubebuilder:object:root=true
@@ -22,17 +22,34 @@ package v1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *APIHealthCheck) DeepCopyInto(out *APIHealthCheck) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new APIHealthCheck.
+func (in *APIHealthCheck) DeepCopy() *APIHealthCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(APIHealthCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CustomPodAutoscaler) DeepCopyInto(out *CustomPodAutoscaler) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CustomPodAutoscaler.
@@ -140,6 +157,227 @@ func (in *CustomPodAutoscalerSpec) DeepCopyInto(out *CustomPodAutoscalerSpec) {
 		*out = new(bool)
 		**out = **in
 	}
+	if in.ConfigOverlays != nil {
+		in, out := &in.ConfigOverlays, &out.ConfigOverlays
+		*out = make(map[string][]CustomPodAutoscalerConfig, len(*in))
+		for key, val := range *in {
+			var outVal []CustomPodAutoscalerConfig
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				inVal := (*in)[key]
+				in, out := &inVal, &outVal
+				*out = make([]CustomPodAutoscalerConfig, len(*in))
+				copy(*out, *in)
+			}
+			(*out)[key] = outVal
+		}
+	}
+	if in.TemplateConfigValues != nil {
+		in, out := &in.TemplateConfigValues, &out.TemplateConfigValues
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ActiveDeadlineSeconds != nil {
+		in, out := &in.ActiveDeadlineSeconds, &out.ActiveDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.GeneratePodName != nil {
+		in, out := &in.GeneratePodName, &out.GeneratePodName
+		*out = new(bool)
+		**out = **in
+	}
+	if in.PreemptionPolicy != nil {
+		in, out := &in.PreemptionPolicy, &out.PreemptionPolicy
+		*out = new(corev1.PreemptionPolicy)
+		**out = **in
+	}
+	if in.ConfigFiles != nil {
+		in, out := &in.ConfigFiles, &out.ConfigFiles
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.SecretConfig != nil {
+		in, out := &in.SecretConfig, &out.SecretConfig
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.PodRecreateCooldownSeconds != nil {
+		in, out := &in.PodRecreateCooldownSeconds, &out.PodRecreateCooldownSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.MaxPodAge != nil {
+		in, out := &in.MaxPodAge, &out.MaxPodAge
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.InjectIdentityEnvVars != nil {
+		in, out := &in.InjectIdentityEnvVars, &out.InjectIdentityEnvVars
+		*out = new(bool)
+		**out = **in
+	}
+	if in.InjectResourceEnvVars != nil {
+		in, out := &in.InjectResourceEnvVars, &out.InjectResourceEnvVars
+		*out = new(bool)
+		**out = **in
+	}
+	if in.InjectCorrelationID != nil {
+		in, out := &in.InjectCorrelationID, &out.InjectCorrelationID
+		*out = new(bool)
+		**out = **in
+	}
+	if in.InitialStabilizationSeconds != nil {
+		in, out := &in.InitialStabilizationSeconds, &out.InitialStabilizationSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.StartupProbe != nil {
+		in, out := &in.StartupProbe, &out.StartupProbe
+		*out = new(corev1.Probe)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SchedulingGates != nil {
+		in, out := &in.SchedulingGates, &out.SchedulingGates
+		*out = make([]corev1.PodSchedulingGate, len(*in))
+		copy(*out, *in)
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(corev1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Overhead != nil {
+		in, out := &in.Overhead, &out.Overhead
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.RuntimeClassName != nil {
+		in, out := &in.RuntimeClassName, &out.RuntimeClassName
+		*out = new(string)
+		**out = **in
+	}
+	if in.ReadinessGates != nil {
+		in, out := &in.ReadinessGates, &out.ReadinessGates
+		*out = make([]corev1.PodReadinessGate, len(*in))
+		copy(*out, *in)
+	}
+	if in.HostAliases != nil {
+		in, out := &in.HostAliases, &out.HostAliases
+		*out = make([]corev1.HostAlias, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Sysctls != nil {
+		in, out := &in.Sysctls, &out.Sysctls
+		*out = make([]corev1.Sysctl, len(*in))
+		copy(*out, *in)
+	}
+	if in.NodeFailureTolerationSeconds != nil {
+		in, out := &in.NodeFailureTolerationSeconds, &out.NodeFailureTolerationSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.ScaleTargetAntiAffinity != nil {
+		in, out := &in.ScaleTargetAntiAffinity, &out.ScaleTargetAntiAffinity
+		*out = new(bool)
+		**out = **in
+	}
+	if in.MaxProvisionRetries != nil {
+		in, out := &in.MaxProvisionRetries, &out.MaxProvisionRetries
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Command != nil {
+		in, out := &in.Command, &out.Command
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Lifecycle != nil {
+		in, out := &in.Lifecycle, &out.Lifecycle
+		*out = new(corev1.Lifecycle)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AdditionalRoleBindingSubjects != nil {
+		in, out := &in.AdditionalRoleBindingSubjects, &out.AdditionalRoleBindingSubjects
+		*out = make([]rbacv1.Subject, len(*in))
+		copy(*out, *in)
+	}
+	if in.UseProjectedToken != nil {
+		in, out := &in.UseProjectedToken, &out.UseProjectedToken
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ProjectedTokenExpirationSeconds != nil {
+		in, out := &in.ProjectedTokenExpirationSeconds, &out.ProjectedTokenExpirationSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.MountScratchVolume != nil {
+		in, out := &in.MountScratchVolume, &out.MountScratchVolume
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ContainerPorts != nil {
+		in, out := &in.ContainerPorts, &out.ContainerPorts
+		*out = make([]corev1.ContainerPort, len(*in))
+		copy(*out, *in)
+	}
+	if in.APIHealthCheck != nil {
+		in, out := &in.APIHealthCheck, &out.APIHealthCheck
+		*out = new(APIHealthCheck)
+		**out = **in
+	}
+	if in.WaitForTargetUpdate != nil {
+		in, out := &in.WaitForTargetUpdate, &out.WaitForTargetUpdate
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ScaleTargetCleanup != nil {
+		in, out := &in.ScaleTargetCleanup, &out.ScaleTargetCleanup
+		*out = new(ScaleTargetCleanup)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ProvisionServiceMonitor != nil {
+		in, out := &in.ProvisionServiceMonitor, &out.ProvisionServiceMonitor
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ValidateExistingRole != nil {
+		in, out := &in.ValidateExistingRole, &out.ValidateExistingRole
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ProvisionNetworkPolicy != nil {
+		in, out := &in.ProvisionNetworkPolicy, &out.ProvisionNetworkPolicy
+		*out = new(bool)
+		**out = **in
+	}
+	if in.NetworkPolicyEgress != nil {
+		in, out := &in.NetworkPolicyEgress, &out.NetworkPolicyEgress
+		*out = make([]networkingv1.NetworkPolicyEgressRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AttachPullSecretsToSA != nil {
+		in, out := &in.AttachPullSecretsToSA, &out.AttachPullSecretsToSA
+		*out = new(bool)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CustomPodAutoscalerSpec.
@@ -155,6 +393,40 @@ func (in *CustomPodAutoscalerSpec) DeepCopy() *CustomPodAutoscalerSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CustomPodAutoscalerStatus) DeepCopyInto(out *CustomPodAutoscalerStatus) {
 	*out = *in
+	if in.LastPodRecreateTime != nil {
+		in, out := &in.LastPodRecreateTime, &out.LastPodRecreateTime
+		*out = (*in).DeepCopy()
+	}
+	if in.PodProvisionedTime != nil {
+		in, out := &in.PodProvisionedTime, &out.PodProvisionedTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastScheduledRestartTime != nil {
+		in, out := &in.LastScheduledRestartTime, &out.LastScheduledRestartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.PausedSince != nil {
+		in, out := &in.PausedSince, &out.PausedSince
+		*out = (*in).DeepCopy()
+	}
+	if in.LastFullReconcileTime != nil {
+		in, out := &in.LastFullReconcileTime, &out.LastFullReconcileTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ProvisionFailures != nil {
+		in, out := &in.ProvisionFailures, &out.ProvisionFailures
+		*out = make(map[string]int32, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CustomPodAutoscalerStatus.
@@ -167,6 +439,26 @@ func (in *CustomPodAutoscalerStatus) DeepCopy() *CustomPodAutoscalerStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScaleTargetCleanup) DeepCopyInto(out *ScaleTargetCleanup) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScaleTargetCleanup.
+func (in *ScaleTargetCleanup) DeepCopy() *ScaleTargetCleanup {
+	if in == nil {
+		return nil
+	}
+	out := new(ScaleTargetCleanup)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodMeta) DeepCopyInto(out *PodMeta) {
 	*out = *in
@@ -0,0 +1,128 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit provides an audit trail of the changes the operator makes to resources, written as JSON records
+// separate from the standard operator logs.
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/clock"
+)
+
+// ActorOperator is the actor recorded for changes made by the operator
+const ActorOperator = "operator"
+
+// Action is a change made by the operator to a resource
+type Action string
+
+// Actions recorded in the audit trail
+const (
+	ActionCreate   Action = "create"
+	ActionUpdate   Action = "update"
+	ActionDelete   Action = "delete"
+	ActionAdopt    Action = "adopt"
+	ActionScale    Action = "scale"
+	ActionAnnotate Action = "annotate"
+)
+
+// Results recorded in the audit trail
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+)
+
+// Record is a single audit record, the JSON schema of records is stable so any changes must be backwards compatible
+type Record struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Actor     string            `json:"actor"`
+	CPA       CPAReference      `json:"cpa"`
+	Action    Action            `json:"action"`
+	Resource  ResourceReference `json:"resource"`
+	Result    string            `json:"result"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// CPAReference identifies the CPA that a change was made for
+type CPAReference struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// ResourceReference identifies the resource that was changed
+type ResourceReference struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// Logger writes audit records as JSON lines. A nil Logger is valid and records nothing, so auditing can be disabled
+// by not setting a Logger.
+type Logger struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+	clock   clock.PassiveClock
+	log     logr.Logger
+}
+
+// NewLogger returns a Logger that writes audit records to the writer provided, timestamped using the clock. Any
+// failures to write records are reported to the log provided.
+func NewLogger(writer io.Writer, clock clock.PassiveClock, log logr.Logger) *Logger {
+	return &Logger{
+		encoder: json.NewEncoder(writer),
+		clock:   clock,
+		log:     log,
+	}
+}
+
+// Record writes an audit record of the action taken on a resource for the CPA, the record is marked as an error if
+// the error provided is not nil
+func (l *Logger) Record(cpa metav1.Object, action Action, kind string, name string, err error) {
+	if l == nil {
+		return
+	}
+
+	record := Record{
+		Timestamp: l.clock.Now().UTC(),
+		Actor:     ActorOperator,
+		CPA: CPAReference{
+			Namespace: cpa.GetNamespace(),
+			Name:      cpa.GetName(),
+		},
+		Action: action,
+		Resource: ResourceReference{
+			Kind: kind,
+			Name: name,
+		},
+		Result: ResultSuccess,
+	}
+	if err != nil {
+		record.Result = ResultError
+		record.Error = err.Error()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	encodeErr := l.encoder.Encode(record)
+	if encodeErr != nil {
+		l.log.Error(encodeErr, "failed to write audit record", "Action", action, "Kind", kind, "Name", name)
+	}
+}
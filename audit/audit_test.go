@@ -0,0 +1,81 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/audit"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestRecord(t *testing.T) {
+	var tests = []struct {
+		description string
+		expected    string
+		action      audit.Action
+		kind        string
+		name        string
+		err         error
+	}{
+		{
+			"Successful change",
+			`{"timestamp":"2024-03-01T22:30:00Z","actor":"operator","cpa":{"namespace":"test-namespace","name":"test"},"action":"create","resource":{"kind":"v1/Pod","name":"test-pod"},"result":"success"}` + "\n",
+			audit.ActionCreate,
+			"v1/Pod",
+			"test-pod",
+			nil,
+		},
+		{
+			"Failed change",
+			`{"timestamp":"2024-03-01T22:30:00Z","actor":"operator","cpa":{"namespace":"test-namespace","name":"test"},"action":"scale","resource":{"kind":"apps/v1/Deployment","name":"test-deployment"},"result":"error","error":"fail to scale"}` + "\n",
+			audit.ActionScale,
+			"apps/v1/Deployment",
+			"test-deployment",
+			errors.New("fail to scale"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := audit.NewLogger(&buf, clocktesting.NewFakePassiveClock(time.Date(2024, time.March, 1, 22, 30, 0, 0, time.UTC)), logr.Discard())
+			logger.Record(&custompodautoscalercomv1.CustomPodAutoscaler{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			}, test.action, test.kind, test.name, test.err)
+
+			if !cmp.Equal(test.expected, buf.String()) {
+				t.Errorf("Record mismatch (-want +got):\n%s", cmp.Diff(test.expected, buf.String()))
+			}
+		})
+	}
+}
+
+func TestRecordNilLogger(t *testing.T) {
+	var logger *audit.Logger
+	// Auditing is disabled with a nil logger, recording should do nothing
+	logger.Record(&custompodautoscalercomv1.CustomPodAutoscaler{}, audit.ActionCreate, "v1/Pod", "test", nil)
+}
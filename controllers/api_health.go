@@ -0,0 +1,214 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+)
+
+const (
+	// defaultAPIHealthCheckPeriodSeconds is how often the autoscaler HTTP API is checked if no period is set
+	defaultAPIHealthCheckPeriodSeconds = 30
+	// apiHealthCheckTimeout is how long a request to the autoscaler HTTP API can take before the API is reported as
+	// not serving
+	apiHealthCheckTimeout = 5 * time.Second
+)
+
+// APIHealthReconciler checks that the HTTP API of autoscaler Pods is serving, reporting the result in the APIReady
+// condition of the CPA that owns the Pod. Only CPAs with an API health check configured are checked, each check is
+// requeued so the API is checked periodically.
+type APIHealthReconciler struct {
+	client.Client
+	Log logr.Logger
+	// HTTPClient is used to query the autoscaler HTTP API, if not set a client with a 5 second timeout is used
+	HTTPClient *http.Client
+	// ShardSelector limits the CPAs checked to those with labels matching the selector, if not set every CPA is
+	// checked
+	ShardSelector labels.Selector
+	// EnvironmentFilter limits the CPAs checked to those with the environment annotation set to this value, if not set
+	// every CPA is checked
+	EnvironmentFilter string
+}
+
+// APIHealthPred is the predicate that filters events for autoscaler Pods, only Pods owned by a CPA are reconciled when
+// they are created or their IP address or readiness changes.
+var APIHealthPred = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldPod, ok := e.ObjectOld.(*corev1.Pod)
+		if !ok {
+			return false
+		}
+		newPod, ok := e.ObjectNew.(*corev1.Pod)
+		if !ok {
+			return false
+		}
+		_, owned := cpaOwnerName(newPod)
+		return owned && (oldPod.Status.PodIP != newPod.Status.PodIP || podReady(oldPod) != podReady(newPod))
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return false
+	},
+	CreateFunc: func(e event.CreateEvent) bool {
+		_, owned := cpaOwnerName(e.Object)
+		return owned
+	},
+	GenericFunc: func(e event.GenericEvent) bool {
+		return false
+	},
+}
+
+// Reconcile checks the HTTP API of the Pod and updates the APIReady condition of the CPA that owns the Pod
+func (r *APIHealthReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	reqLogger := r.Log.WithValues("Request", req.NamespacedName)
+
+	pod := &corev1.Pod{}
+	err := r.Client.Get(ctx, req.NamespacedName, pod)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	if !pod.DeletionTimestamp.IsZero() {
+		// Pod being deleted, the API is checked on the Pod that replaces it
+		return ctrl.Result{}, nil
+	}
+
+	cpaName, owned := cpaOwnerName(pod)
+	if !owned {
+		return ctrl.Result{}, nil
+	}
+
+	instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+	err = r.Client.Get(ctx, types.NamespacedName{Name: cpaName, Namespace: pod.Namespace}, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	if !inShard(r.ShardSelector, instance) || !inEnvironment(r.EnvironmentFilter, instance) {
+		return ctrl.Result{}, nil
+	}
+
+	healthCheck := instance.Spec.APIHealthCheck
+	if healthCheck == nil {
+		return ctrl.Result{}, nil
+	}
+
+	condition := metav1.Condition{
+		Type:               custompodautoscalercomv1.ConditionAPIReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "APIServing",
+		Message:            fmt.Sprintf("Autoscaler Pod %s is serving its HTTP API", pod.Name),
+		ObservedGeneration: instance.Generation,
+	}
+	if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "PodNotRunning"
+		condition.Message = fmt.Sprintf("Autoscaler Pod %s is not running", pod.Name)
+	} else {
+		err = r.checkAPI(ctx, pod, healthCheck)
+		if err != nil {
+			condition.Status = metav1.ConditionFalse
+			condition.Reason = "APINotServing"
+			condition.Message = fmt.Sprintf("Autoscaler Pod %s is not serving its HTTP API: %s", pod.Name, err)
+		}
+	}
+
+	periodSeconds := healthCheck.PeriodSeconds
+	if periodSeconds <= 0 {
+		periodSeconds = defaultAPIHealthCheckPeriodSeconds
+	}
+	result := ctrl.Result{RequeueAfter: time.Duration(periodSeconds) * time.Second}
+
+	if !meta.SetStatusCondition(&instance.Status.Conditions, condition) {
+		return result, nil
+	}
+
+	reqLogger.Info("Updating autoscaler API readiness", "Kind", "custompodautoscaler.com/v1/CustomPodAutoscaler", "Namespace", instance.GetNamespace(), "Name", instance.GetName(), "Ready", condition.Status)
+	err = r.Client.Status().Update(ctx, instance)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return result, nil
+}
+
+// checkAPI requests the health check path from the HTTP API of the Pod, returning an error unless the API responds
+// with a 2xx status
+func (r *APIHealthReconciler) checkAPI(ctx context.Context, pod *corev1.Pod, healthCheck *custompodautoscalercomv1.APIHealthCheck) error {
+	port := healthCheck.Port
+	if port == 0 {
+		port = defaultAPIPort
+	}
+	url := fmt.Sprintf("http://%s%s", net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(port))), healthCheck.Path)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := r.httpClient().Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("GET %s responded with status %d", healthCheck.Path, response.StatusCode)
+	}
+
+	return nil
+}
+
+func (r *APIHealthReconciler) httpClient() *http.Client {
+	if r.HTTPClient == nil {
+		return &http.Client{Timeout: apiHealthCheckTimeout}
+	}
+	return r.HTTPClient
+}
+
+// SetupWithManager sets up the API health controller with the Manager
+func (r *APIHealthReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("custompodautoscaler-api-health").
+		For(&corev1.Pod{}).
+		WithEventFilter(APIHealthPred).
+		Complete(r)
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestAPIHealthReconcile(t *testing.T) {
+	var tests = []struct {
+		description       string
+		expectedCondition *metav1.Condition
+		expectedRequeue   time.Duration
+		statusCode        int
+		podIP             string
+		healthCheck       *custompodautoscalercomv1.APIHealthCheck
+	}{
+		{
+			"No health check configured, no condition",
+			nil,
+			0,
+			http.StatusOK,
+			"127.0.0.1",
+			nil,
+		},
+		{
+			"API serving",
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionAPIReady,
+				Status:             metav1.ConditionTrue,
+				Reason:             "APIServing",
+				Message:            "Autoscaler Pod test is serving its HTTP API",
+				ObservedGeneration: 1,
+			},
+			30 * time.Second,
+			http.StatusOK,
+			"127.0.0.1",
+			&custompodautoscalercomv1.APIHealthCheck{
+				Path: "/healthz",
+			},
+		},
+		{
+			"API not serving, error status",
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionAPIReady,
+				Status:             metav1.ConditionFalse,
+				Reason:             "APINotServing",
+				Message:            "Autoscaler Pod test is not serving its HTTP API: GET /healthz responded with status 500",
+				ObservedGeneration: 1,
+			},
+			10 * time.Second,
+			http.StatusInternalServerError,
+			"127.0.0.1",
+			&custompodautoscalercomv1.APIHealthCheck{
+				Path:          "/healthz",
+				PeriodSeconds: 10,
+			},
+		},
+		{
+			"Pod has no IP, not running",
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionAPIReady,
+				Status:             metav1.ConditionFalse,
+				Reason:             "PodNotRunning",
+				Message:            "Autoscaler Pod test is not running",
+				ObservedGeneration: 1,
+			},
+			30 * time.Second,
+			http.StatusOK,
+			"",
+			&custompodautoscalercomv1.APIHealthCheck{
+				Path: "/healthz",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/healthz" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.WriteHeader(test.statusCode)
+			}))
+			defer server.Close()
+
+			healthCheck := test.healthCheck
+			if healthCheck != nil {
+				_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				portNumber, err := strconv.Atoi(port)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				healthCheck = healthCheck.DeepCopy()
+				healthCheck.Port = int32(portNumber)
+			}
+
+			fclient := fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+				s := runtime.NewScheme()
+				utilruntime.Must(clientgoscheme.AddToScheme(s))
+				s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+				return s
+			}()).WithRuntimeObjects(
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:       "test",
+						Namespace:  "test-namespace",
+						Generation: 1,
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						APIHealthCheck: healthCheck,
+					},
+				},
+				&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+						OwnerReferences: []metav1.OwnerReference{
+							{
+								APIVersion: "custompodautoscaler.com/v1",
+								Kind:       "CustomPodAutoscaler",
+								Name:       "test",
+							},
+						},
+					},
+					Status: corev1.PodStatus{
+						Phase: corev1.PodRunning,
+						PodIP: test.podIP,
+					},
+				},
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build()
+
+			reconciler := &controllers.APIHealthReconciler{
+				Client:     fclient,
+				Log:        logr.Discard(),
+				HTTPClient: server.Client(),
+			}
+			result, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expectedRequeue, result.RequeueAfter) {
+				t.Errorf("Requeue mismatch (-want +got):\n%s", cmp.Diff(test.expectedRequeue, result.RequeueAfter))
+			}
+
+			cpa := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err = fclient.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, cpa)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			condition := meta.FindStatusCondition(cpa.Status.Conditions, custompodautoscalercomv1.ConditionAPIReady)
+			if !cmp.Equal(test.expectedCondition, condition, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")) {
+				t.Errorf("Condition mismatch (-want +got):\n%s", cmp.Diff(test.expectedCondition, condition, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")))
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"k8s.io/client-go/rest"
+)
+
+// ClientRateLimits are the client-side rate limits of the clients the operator uses to talk to the Kubernetes API, on
+// large clusters the client-go defaults can throttle the operator. Zero values leave the existing limits unchanged
+type ClientRateLimits struct {
+	// QPS is the maximum sustained queries per second to the Kubernetes API
+	QPS float32
+	// Burst is the maximum burst of queries to the Kubernetes API above the QPS
+	Burst int
+}
+
+// Apply sets the rate limits on the config used to build a client
+func (l ClientRateLimits) Apply(config *rest.Config) {
+	if l.QPS > 0 {
+		config.QPS = l.QPS
+	}
+	if l.Burst > 0 {
+		config.Burst = l.Burst
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	"k8s.io/client-go/rest"
+)
+
+func TestClientRateLimitsApply(t *testing.T) {
+	var tests = []struct {
+		description string
+		expected    *rest.Config
+		config      *rest.Config
+		rateLimits  controllers.ClientRateLimits
+	}{
+		{
+			"No rate limits set, config unchanged",
+			&rest.Config{
+				QPS:   20,
+				Burst: 30,
+			},
+			&rest.Config{
+				QPS:   20,
+				Burst: 30,
+			},
+			controllers.ClientRateLimits{},
+		},
+		{
+			"QPS and burst set, applied to config",
+			&rest.Config{
+				QPS:   100,
+				Burst: 200,
+			},
+			&rest.Config{
+				QPS:   20,
+				Burst: 30,
+			},
+			controllers.ClientRateLimits{
+				QPS:   100,
+				Burst: 200,
+			},
+		},
+		{
+			"Only QPS set, burst unchanged",
+			&rest.Config{
+				QPS:   50,
+				Burst: 30,
+			},
+			&rest.Config{
+				QPS:   20,
+				Burst: 30,
+			},
+			controllers.ClientRateLimits{
+				QPS: 50,
+			},
+		},
+		{
+			"Only burst set, QPS unchanged",
+			&rest.Config{
+				QPS:   20,
+				Burst: 75,
+			},
+			&rest.Config{
+				QPS:   20,
+				Burst: 30,
+			},
+			controllers.ClientRateLimits{
+				Burst: 75,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			test.rateLimits.Apply(test.config)
+			if !cmp.Equal(test.expected, test.config) {
+				t.Errorf("Config mismatch (-want +got):\n%s", cmp.Diff(test.expected, test.config))
+			}
+		})
+	}
+}
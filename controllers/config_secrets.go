@@ -0,0 +1,130 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+)
+
+// configSecretRequeueDelay is how long to wait before checking again if the Secrets referenced by the Pod exist, the
+// Secrets are not owned by the CPA so creating them does not trigger a reconcile
+const configSecretRequeueDelay = 30 * time.Second
+
+// secretReference is a Secret referenced by an environment variable of a container, key is empty if the whole Secret
+// is referenced with envFrom
+type secretReference struct {
+	name string
+	key  string
+}
+
+// podSecretReferences returns the Secrets and Secret keys referenced by the environment variables of the containers
+// and init containers of the Pod, in the order they are referenced. Optional references and references to the Secret
+// provisioned by the operator are not included
+func podSecretReferences(pod *corev1.Pod, provisionedSecret string) []secretReference {
+	references := []secretReference{}
+	seen := map[secretReference]bool{}
+	add := func(reference secretReference, optional *bool) {
+		if reference.name == provisionedSecret || (optional != nil && *optional) || seen[reference] {
+			return
+		}
+		seen[reference] = true
+		references = append(references, reference)
+	}
+
+	for _, container := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.SecretRef != nil {
+				add(secretReference{name: envFrom.SecretRef.Name}, envFrom.SecretRef.Optional)
+			}
+		}
+		for _, env := range container.Env {
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+				add(secretReference{name: env.ValueFrom.SecretKeyRef.Name, key: env.ValueFrom.SecretKeyRef.Key}, env.ValueFrom.SecretKeyRef.Optional)
+			}
+		}
+	}
+	return references
+}
+
+// checkConfigSecrets sets the ConfigSecretMissing condition, reporting any Secrets or Secret keys referenced by the Pod
+// that do not exist, returning the missing references. The condition is only set if the Pod references any Secrets
+func (r *CustomPodAutoscalerReconciler) checkConfigSecrets(ctx context.Context, instance *custompodautoscalercomv1.CustomPodAutoscaler, pod *corev1.Pod, provisionedSecret string) ([]string, error) {
+	references := podSecretReferences(pod, provisionedSecret)
+
+	missing := []string{}
+	secrets := map[string]*corev1.Secret{}
+	for _, reference := range references {
+		secret, fetched := secrets[reference.name]
+		if !fetched {
+			secret = &corev1.Secret{}
+			err := r.Client.Get(ctx, types.NamespacedName{Name: reference.name, Namespace: pod.Namespace}, secret)
+			if err != nil {
+				if !errors.IsNotFound(err) {
+					return nil, err
+				}
+				secret = nil
+			}
+			secrets[reference.name] = secret
+		}
+
+		if secret == nil {
+			if !fetched {
+				missing = append(missing, fmt.Sprintf("Secret %s", reference.name))
+			}
+			continue
+		}
+		if reference.key == "" {
+			continue
+		}
+		if _, exists := secret.Data[reference.key]; !exists {
+			missing = append(missing, fmt.Sprintf("key %s in Secret %s", reference.key, reference.name))
+		}
+	}
+
+	if len(references) == 0 {
+		meta.RemoveStatusCondition(&instance.Status.Conditions, custompodautoscalercomv1.ConditionConfigSecretMissing)
+	} else {
+		condition := metav1.Condition{
+			Type:               custompodautoscalercomv1.ConditionConfigSecretMissing,
+			Status:             metav1.ConditionFalse,
+			Reason:             "SecretsFound",
+			Message:            "All Secrets referenced by the Pod exist",
+			ObservedGeneration: instance.Generation,
+		}
+		if len(missing) > 0 {
+			condition.Status = metav1.ConditionTrue
+			condition.Reason = "SecretMissing"
+			condition.Message = fmt.Sprintf("Secrets referenced by the Pod not found (%s), not provisioning the Pod until "+
+				"they exist", strings.Join(missing, ", "))
+		}
+		if meta.SetStatusCondition(&instance.Status.Conditions, condition) && condition.Status == metav1.ConditionTrue && r.Recorder != nil {
+			r.Recorder.Event(instance, corev1.EventTypeWarning, custompodautoscalercomv1.ConditionConfigSecretMissing, condition.Message)
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,289 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileConfigSecrets(t *testing.T) {
+	apiKeyEnv := corev1.EnvVar{
+		Name: "API_KEY",
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "autoscaler-credentials"},
+				Key:                  "api-key",
+			},
+		},
+	}
+
+	var tests = []struct {
+		description         string
+		expectedCondition   *metav1.Condition
+		expectedEvents      []string
+		expectedProvisioned bool
+		expectedResult      reconcile.Result
+		container           corev1.Container
+		secretConfig        map[string]string
+		secrets             []runtime.Object
+	}{
+		{
+			"No Secrets referenced, no condition and provisioned",
+			nil,
+			[]string{},
+			true,
+			reconcile.Result{},
+			corev1.Container{
+				Name: "test container",
+			},
+			nil,
+			nil,
+		},
+		{
+			"Referenced Secret does not exist, condition true, warning event, not provisioned and requeued",
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionConfigSecretMissing,
+				Status:             metav1.ConditionTrue,
+				Reason:             "SecretMissing",
+				Message:            "Secrets referenced by the Pod not found (Secret autoscaler-credentials), not provisioning the Pod until they exist",
+				ObservedGeneration: 1,
+			},
+			[]string{
+				"Warning ConfigSecretMissing Secrets referenced by the Pod not found (Secret autoscaler-credentials), not provisioning the Pod until they exist",
+			},
+			false,
+			reconcile.Result{RequeueAfter: 30 * time.Second},
+			corev1.Container{
+				Name: "test container",
+				Env:  []corev1.EnvVar{apiKeyEnv},
+			},
+			nil,
+			nil,
+		},
+		{
+			"Referenced Secret key does not exist, condition true, not provisioned and requeued",
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionConfigSecretMissing,
+				Status:             metav1.ConditionTrue,
+				Reason:             "SecretMissing",
+				Message:            "Secrets referenced by the Pod not found (key api-key in Secret autoscaler-credentials), not provisioning the Pod until they exist",
+				ObservedGeneration: 1,
+			},
+			[]string{
+				"Warning ConfigSecretMissing Secrets referenced by the Pod not found (key api-key in Secret autoscaler-credentials), not provisioning the Pod until they exist",
+			},
+			false,
+			reconcile.Result{RequeueAfter: 30 * time.Second},
+			corev1.Container{
+				Name: "test container",
+				Env:  []corev1.EnvVar{apiKeyEnv},
+			},
+			nil,
+			[]runtime.Object{
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "autoscaler-credentials", Namespace: "test-namespace"},
+					Data:       map[string][]byte{"other-key": []byte("value")},
+				},
+			},
+		},
+		{
+			"Secret referenced with envFrom does not exist, not provisioned and requeued",
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionConfigSecretMissing,
+				Status:             metav1.ConditionTrue,
+				Reason:             "SecretMissing",
+				Message:            "Secrets referenced by the Pod not found (Secret autoscaler-env), not provisioning the Pod until they exist",
+				ObservedGeneration: 1,
+			},
+			[]string{
+				"Warning ConfigSecretMissing Secrets referenced by the Pod not found (Secret autoscaler-env), not provisioning the Pod until they exist",
+			},
+			false,
+			reconcile.Result{RequeueAfter: 30 * time.Second},
+			corev1.Container{
+				Name: "test container",
+				EnvFrom: []corev1.EnvFromSource{
+					{
+						SecretRef: &corev1.SecretEnvSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "autoscaler-env"},
+						},
+					},
+				},
+			},
+			nil,
+			nil,
+		},
+		{
+			"Optional Secret reference does not exist, no condition and provisioned",
+			nil,
+			[]string{},
+			true,
+			reconcile.Result{},
+			corev1.Container{
+				Name: "test container",
+				Env: []corev1.EnvVar{
+					{
+						Name: "API_KEY",
+						ValueFrom: &corev1.EnvVarSource{
+							SecretKeyRef: &corev1.SecretKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "autoscaler-credentials"},
+								Key:                  "api-key",
+								Optional:             boolPtr(true),
+							},
+						},
+					},
+				},
+			},
+			nil,
+			nil,
+		},
+		{
+			"Referenced Secret and key exist, condition false and provisioned",
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionConfigSecretMissing,
+				Status:             metav1.ConditionFalse,
+				Reason:             "SecretsFound",
+				Message:            "All Secrets referenced by the Pod exist",
+				ObservedGeneration: 1,
+			},
+			[]string{},
+			true,
+			reconcile.Result{},
+			corev1.Container{
+				Name: "test container",
+				Env:  []corev1.EnvVar{apiKeyEnv},
+			},
+			nil,
+			[]runtime.Object{
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "autoscaler-credentials", Namespace: "test-namespace"},
+					Data:       map[string][]byte{"api-key": []byte("value")},
+				},
+			},
+		},
+		{
+			"Secret provisioned for secretConfig not checked, no condition and provisioned",
+			nil,
+			[]string{},
+			true,
+			reconcile.Result{},
+			corev1.Container{
+				Name: "test container",
+			},
+			map[string]string{
+				"apiKey": "value",
+			},
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			scheme.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+			scheme.AddKnownTypes(corev1.SchemeGroupVersion, &corev1.Secret{})
+
+			objs := append([]runtime.Object{
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:       "test",
+						Namespace:  "test-namespace",
+						Generation: 1,
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						Template: custompodautoscalercomv1.PodTemplateSpec{
+							Spec: custompodautoscalercomv1.PodSpec{
+								Containers: []corev1.Container{test.container},
+							},
+						},
+						SecretConfig: test.secretConfig,
+					},
+				},
+			}, test.secrets...)
+
+			fclient := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objs...).
+				WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build()
+
+			provisioned := false
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fclient,
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: noopK8sReconciler(func(obj metav1.Object, kind string) {
+					if kind == "v1/Pod" {
+						provisioned = true
+					}
+				}),
+				Log:      logr.Discard(),
+				Recorder: recorder,
+			}
+
+			result, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expectedResult, result) {
+				t.Errorf("Result mismatch (-want +got):\n%s", cmp.Diff(test.expectedResult, result))
+			}
+
+			if !cmp.Equal(test.expectedProvisioned, provisioned) {
+				t.Errorf("Provisioned mismatch (-want +got):\n%s", cmp.Diff(test.expectedProvisioned, provisioned))
+			}
+
+			cpa := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err = fclient.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, cpa)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			condition := meta.FindStatusCondition(cpa.Status.Conditions, custompodautoscalercomv1.ConditionConfigSecretMissing)
+			if !cmp.Equal(test.expectedCondition, condition, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")) {
+				t.Errorf("Condition mismatch (-want +got):\n%s", cmp.Diff(test.expectedCondition, condition, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")))
+			}
+
+			close(recorder.Events)
+			events := []string{}
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			if !cmp.Equal(test.expectedEvents, events) {
+				t.Errorf("Events mismatch (-want +got):\n%s", cmp.Diff(test.expectedEvents, events))
+			}
+		})
+	}
+}
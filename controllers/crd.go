@@ -0,0 +1,46 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/discovery"
+
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+)
+
+// customPodAutoscalerResource is the resource name the CustomPodAutoscaler CRD is served under
+const customPodAutoscalerResource = "custompodautoscalers"
+
+// CheckCRDServed checks that the CustomPodAutoscaler CRD is served at the API version the operator reconciles, if it
+// is not the operator would silently never reconcile anything (for example if an older CRD version is installed)
+func CheckCRDServed(discoveryClient discovery.DiscoveryInterface) error {
+	groupVersion := custompodautoscalercomv1.GroupVersion.String()
+	resources, err := discoveryClient.ServerResourcesForGroupVersion(groupVersion)
+	if err != nil {
+		return fmt.Errorf("CustomPodAutoscaler CRD version %s is not served, check the installed CRD matches the operator version: %w", groupVersion, err)
+	}
+
+	for _, resource := range resources.APIResources {
+		if resource.Name == customPodAutoscalerResource {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("CustomPodAutoscaler CRD version %s is not served, check the installed CRD matches the operator version", groupVersion)
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestCheckCRDServed(t *testing.T) {
+	var tests = []struct {
+		description string
+		expectedErr string
+		resources   []*metav1.APIResourceList
+	}{
+		{
+			"CRD version not served",
+			`CustomPodAutoscaler CRD version custompodautoscaler.com/v1 is not served, check the installed CRD matches the operator version: the server could not find the requested resource, GroupVersion "custompodautoscaler.com/v1" not found`,
+			[]*metav1.APIResourceList{
+				{
+					GroupVersion: "custompodautoscaler.com/v1alpha1",
+					APIResources: []metav1.APIResource{
+						{
+							Name: "custompodautoscalers",
+							Kind: "CustomPodAutoscaler",
+						},
+					},
+				},
+			},
+		},
+		{
+			"CRD version served without CustomPodAutoscaler resource",
+			`CustomPodAutoscaler CRD version custompodautoscaler.com/v1 is not served, check the installed CRD matches the operator version`,
+			[]*metav1.APIResourceList{
+				{
+					GroupVersion: "custompodautoscaler.com/v1",
+					APIResources: []metav1.APIResource{},
+				},
+			},
+		},
+		{
+			"CRD version served",
+			"",
+			[]*metav1.APIResourceList{
+				{
+					GroupVersion: "custompodautoscaler.com/v1alpha1",
+					APIResources: []metav1.APIResource{
+						{
+							Name: "custompodautoscalers",
+							Kind: "CustomPodAutoscaler",
+						},
+					},
+				},
+				{
+					GroupVersion: "custompodautoscaler.com/v1",
+					APIResources: []metav1.APIResource{
+						{
+							Name: "custompodautoscalers",
+							Kind: "CustomPodAutoscaler",
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			discoveryClient := &fakediscovery.FakeDiscovery{
+				Fake: &k8stesting.Fake{
+					Resources: test.resources,
+				},
+			}
+			err := controllers.CheckCRDServed(discoveryClient)
+			errMessage := ""
+			if err != nil {
+				errMessage = err.Error()
+			}
+			if !cmp.Equal(test.expectedErr, errMessage) {
+				t.Errorf("Error mismatch (-want +got):\n%s", cmp.Diff(test.expectedErr, errMessage))
+			}
+		})
+	}
+}
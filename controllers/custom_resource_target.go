@@ -0,0 +1,198 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/trace"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+)
+
+// scaleSubresource is the name of the subresource used to scale a resource
+const scaleSubresource = "scale"
+
+// customResourceTarget returns if the scale target is a custom resource, resolved through discovery and scaled through
+// the dynamic client. Built in scale targets are scaled through the scale client, as are custom resources if the
+// reconciler has no discovery client
+func (r *CustomPodAutoscalerReconciler) customResourceTarget(gv schema.GroupVersion) bool {
+	return r.DiscoveryClient != nil && gv.Group != "" && gv.Group != appsv1.GroupName
+}
+
+// scaleTargetResource resolves the resource of the scale target kind through discovery, returning if the resource
+// implements the scale subresource
+func (r *CustomPodAutoscalerReconciler) scaleTargetResource(gv schema.GroupVersion, kind string) (schema.GroupVersionResource, bool, error) {
+	resources, err := r.DiscoveryClient.ServerResourcesForGroupVersion(gv.String())
+	if err != nil {
+		return schema.GroupVersionResource{}, false, err
+	}
+
+	resource := ""
+	for _, apiResource := range resources.APIResources {
+		// Subresources are listed as resource/subresource with the kind of the subresource
+		if apiResource.Kind == kind && !strings.Contains(apiResource.Name, "/") {
+			resource = apiResource.Name
+			break
+		}
+	}
+	if resource == "" {
+		return schema.GroupVersionResource{}, false, fmt.Errorf("scale target kind %s is not served by %s", kind, gv)
+	}
+
+	scalable := false
+	for _, apiResource := range resources.APIResources {
+		if apiResource.Name == resource+"/"+scaleSubresource {
+			scalable = true
+			break
+		}
+	}
+	return gv.WithResource(resource), scalable, nil
+}
+
+// checkTargetScalable sets the TargetNotScalable condition, reporting if the custom resource scale target does not
+// implement the scale subresource so the replicas cannot be set by the operator
+func (r *CustomPodAutoscalerReconciler) checkTargetScalable(ctx context.Context, instance *custompodautoscalercomv1.CustomPodAutoscaler, gvr schema.GroupVersionResource, scalable bool) error {
+	scaleTargetRef := instance.Spec.ScaleTargetRef
+	condition := metav1.Condition{
+		Type:               custompodautoscalercomv1.ConditionTargetNotScalable,
+		Status:             metav1.ConditionFalse,
+		Reason:             "ScaleSubresource",
+		Message:            fmt.Sprintf("%s %s implements the scale subresource", scaleTargetRef.Kind, scaleTargetRef.Name),
+		ObservedGeneration: instance.Generation,
+	}
+	if !scalable {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "NoScaleSubresource"
+		condition.Message = fmt.Sprintf("%s %s does not implement the scale subresource (%s/%s is not served), so the "+
+			"operator cannot set its replicas", scaleTargetRef.Kind, scaleTargetRef.Name, gvr.Resource, scaleSubresource)
+	}
+
+	if !meta.SetStatusCondition(&instance.Status.Conditions, condition) {
+		return nil
+	}
+
+	if !scalable && r.Recorder != nil {
+		r.Recorder.Event(instance, corev1.EventTypeWarning, custompodautoscalercomv1.ConditionTargetNotScalable, condition.Message)
+	}
+	return r.Client.Status().Update(ctx, instance)
+}
+
+// checkTargetForbidden sets the TargetForbidden condition, reporting if accessing the custom resource scale target
+// failed because the operator is forbidden from accessing it. Other errors leave the condition unchanged, as they do
+// not show if the operator has access
+func (r *CustomPodAutoscalerReconciler) checkTargetForbidden(ctx context.Context, instance *custompodautoscalercomv1.CustomPodAutoscaler, accessErr error) error {
+	if accessErr != nil && !errors.IsForbidden(accessErr) {
+		return nil
+	}
+
+	scaleTargetRef := instance.Spec.ScaleTargetRef
+	condition := metav1.Condition{
+		Type:               custompodautoscalercomv1.ConditionTargetForbidden,
+		Status:             metav1.ConditionFalse,
+		Reason:             "AccessAllowed",
+		Message:            fmt.Sprintf("Operator has access to %s %s", scaleTargetRef.Kind, scaleTargetRef.Name),
+		ObservedGeneration: instance.Generation,
+	}
+	if accessErr != nil {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "AccessForbidden"
+		condition.Message = fmt.Sprintf("Operator is forbidden from accessing %s %s, so it cannot set its replicas until "+
+			"the operator RBAC grants access to it: %s", scaleTargetRef.Kind, scaleTargetRef.Name, accessErr)
+	}
+
+	if !meta.SetStatusCondition(&instance.Status.Conditions, condition) {
+		return nil
+	}
+
+	if accessErr != nil && r.Recorder != nil {
+		r.Recorder.Event(instance, corev1.EventTypeWarning, custompodautoscalercomv1.ConditionTargetForbidden, condition.Message)
+	}
+	return r.Client.Status().Update(ctx, instance)
+}
+
+// scaleCustomResource sets the replica count of a custom resource scale target through its scale subresource using
+// the dynamic client, returns if the scale target was scaled. Returns false without scaling if the scale target does
+// not implement the scale subresource
+func (r *CustomPodAutoscalerReconciler) scaleCustomResource(ctx context.Context, reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler, gv schema.GroupVersion, replicas int32, minimum bool) (scaled bool, err error) {
+	scaleTargetRef := instance.Spec.ScaleTargetRef
+	ctx, span := r.tracer().Start(ctx, "ScaleCustomResource", trace.WithAttributes(
+		kindAttribute.String(scaleTargetRef.Kind),
+		nameAttribute.String(scaleTargetRef.Name),
+	))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	gvr, scalable, err := r.scaleTargetResource(gv, scaleTargetRef.Kind)
+	if err != nil {
+		return false, err
+	}
+
+	err = r.checkTargetScalable(ctx, instance, gvr, scalable)
+	if err != nil {
+		return false, err
+	}
+	if !scalable {
+		reqLogger.Info("Scale target does not implement the scale subresource, unable to set replicas", "Kind", scaleTargetRef.Kind, "Namespace", instance.Namespace, "Name", scaleTargetRef.Name)
+		return false, nil
+	}
+
+	resources := r.DynamicClient.Resource(gvr).Namespace(instance.Namespace)
+	return r.scaleSubresource(ctx, reqLogger, resources, gv.String()+"/"+scaleTargetRef.Kind, instance.Namespace, scaleTargetRef.Name, replicas, minimum)
+}
+
+// scaleSubresource sets the replica count of a resource through its scale subresource using the dynamic client, if
+// minimum is true the replicas are only set if the resource has fewer replicas, returns if the resource was scaled
+func (r *CustomPodAutoscalerReconciler) scaleSubresource(ctx context.Context, reqLogger logr.Logger, resources dynamic.ResourceInterface, kind string, namespace string, name string, replicas int32, minimum bool) (bool, error) {
+	scale, err := resources.Get(ctx, name, metav1.GetOptions{}, scaleSubresource)
+	if err != nil {
+		return false, err
+	}
+
+	if minimum {
+		currentReplicas, _, err := unstructured.NestedInt64(scale.Object, "spec", "replicas")
+		if err != nil {
+			return false, err
+		}
+		if currentReplicas >= int64(replicas) {
+			reqLogger.Info("Scale target replicas at or above paused minimum replicas, leaving unchanged", "Kind", kind, "Namespace", namespace, "Name", name, "Replicas", currentReplicas)
+			return false, nil
+		}
+	}
+
+	err = unstructured.SetNestedField(scale.Object, int64(replicas), "spec", "replicas")
+	if err != nil {
+		return false, err
+	}
+
+	_, err = resources.Update(ctx, scale, metav1.UpdateOptions{
+		FieldManager: r.FieldManager,
+	}, scaleSubresource)
+	return err == nil, err
+}
@@ -0,0 +1,307 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcilePausedCustomResource(t *testing.T) {
+	equateErrorMessage := cmp.Comparer(func(x, y error) bool {
+		if x == nil || y == nil {
+			return x == nil && y == nil
+		}
+		return x.Error() == y.Error()
+	})
+
+	widget := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "example.com/v1",
+			"kind":       "Widget",
+			"metadata": map[string]interface{}{
+				"name":      "test-widget",
+				"namespace": "test-namespace",
+			},
+			"spec": map[string]interface{}{
+				"replicas": int64(1),
+			},
+		},
+	}
+
+	var tests = []struct {
+		description             string
+		expectedErr             error
+		expectedScaleReplicas   []int64
+		expectedPaused          bool
+		expectedNotScalable     metav1.ConditionStatus
+		expectedForbidden       metav1.ConditionStatus
+		resources               []*metav1.APIResourceList
+		annotations             map[string]string
+		scaleSubresourceReplica int64
+		forbidden               bool
+	}{
+		{
+			"Custom resource kind not served, fail",
+			errors.New("scale target kind Widget is not served by example.com/v1"),
+			[]int64{},
+			false,
+			"",
+			"",
+			[]*metav1.APIResourceList{
+				{
+					GroupVersion: "example.com/v1",
+					APIResources: []metav1.APIResource{
+						{Name: "gadgets", Kind: "Gadget", Namespaced: true},
+					},
+				},
+			},
+			map[string]string{
+				controllers.PausedReplicasAnnotation: "5",
+			},
+			1,
+			false,
+		},
+		{
+			"Custom resource without scale subresource, not scaled",
+			nil,
+			[]int64{},
+			false,
+			metav1.ConditionTrue,
+			"",
+			[]*metav1.APIResourceList{
+				{
+					GroupVersion: "example.com/v1",
+					APIResources: []metav1.APIResource{
+						{Name: "widgets", Kind: "Widget", Namespaced: true},
+						{Name: "widgets/status", Kind: "Widget", Namespaced: true},
+					},
+				},
+			},
+			map[string]string{
+				controllers.PausedReplicasAnnotation: "5",
+			},
+			1,
+			false,
+		},
+		{
+			"Custom resource with scale subresource, scaled to paused replicas",
+			nil,
+			[]int64{5},
+			true,
+			metav1.ConditionFalse,
+			metav1.ConditionFalse,
+			[]*metav1.APIResourceList{
+				{
+					GroupVersion: "example.com/v1",
+					APIResources: []metav1.APIResource{
+						{Name: "widgets", Kind: "Widget", Namespaced: true},
+						{Name: "widgets/scale", Kind: "Scale", Group: "autoscaling", Version: "v1", Namespaced: true},
+					},
+				},
+			},
+			map[string]string{
+				controllers.PausedReplicasAnnotation: "5",
+			},
+			1,
+			false,
+		},
+		{
+			"Custom resource with scale subresource, at or above paused minimum replicas, not scaled",
+			nil,
+			[]int64{},
+			true,
+			metav1.ConditionFalse,
+			metav1.ConditionFalse,
+			[]*metav1.APIResourceList{
+				{
+					GroupVersion: "example.com/v1",
+					APIResources: []metav1.APIResource{
+						{Name: "widgets", Kind: "Widget", Namespaced: true},
+						{Name: "widgets/scale", Kind: "Scale", Group: "autoscaling", Version: "v1", Namespaced: true},
+					},
+				},
+			},
+			map[string]string{
+				controllers.PausedMinReplicasAnnotation: "5",
+			},
+			7,
+			false,
+		},
+		{
+			"Custom resource operator forbidden from accessing, fail and report forbidden",
+			apierrors.NewForbidden(schema.GroupResource{Group: "example.com", Resource: "widgets"}, "test-widget",
+				errors.New("operator not granted access")),
+			[]int64{},
+			false,
+			metav1.ConditionFalse,
+			metav1.ConditionTrue,
+			[]*metav1.APIResourceList{
+				{
+					GroupVersion: "example.com/v1",
+					APIResources: []metav1.APIResource{
+						{Name: "widgets", Kind: "Widget", Namespaced: true},
+						{Name: "widgets/scale", Kind: "Scale", Group: "autoscaling", Version: "v1", Namespaced: true},
+					},
+				},
+			},
+			map[string]string{
+				controllers.PausedReplicasAnnotation: "5",
+			},
+			1,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			fclient := fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+				s := runtime.NewScheme()
+				utilruntime.Must(clientgoscheme.AddToScheme(s))
+				s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+				s.AddKnownTypeWithName(schema.GroupVersionKind{
+					Group:   "example.com",
+					Version: "v1",
+					Kind:    "Widget",
+				}, &unstructured.Unstructured{})
+				return s
+			}()).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).WithRuntimeObjects(
+				widget.DeepCopy(),
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:        "test",
+						Namespace:   "test-namespace",
+						Annotations: test.annotations,
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{
+							APIVersion: "example.com/v1",
+							Kind:       "Widget",
+							Name:       "test-widget",
+						},
+					},
+				},
+			).Build()
+
+			scaleReplicas := []int64{}
+			dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), widget.DeepCopy())
+			dynamicClient.PrependReactor("get", "widgets", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+				if action.GetSubresource() != "scale" {
+					return false, nil, nil
+				}
+				if test.forbidden {
+					return true, nil, apierrors.NewForbidden(schema.GroupResource{Group: "example.com", Resource: "widgets"},
+						"test-widget", errors.New("operator not granted access"))
+				}
+				return true, &unstructured.Unstructured{
+					Object: map[string]interface{}{
+						"apiVersion": "autoscaling/v1",
+						"kind":       "Scale",
+						"metadata": map[string]interface{}{
+							"name":      "test-widget",
+							"namespace": "test-namespace",
+						},
+						"spec": map[string]interface{}{
+							"replicas": test.scaleSubresourceReplica,
+						},
+					},
+				}, nil
+			})
+			dynamicClient.PrependReactor("update", "widgets", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+				if action.GetSubresource() != "scale" {
+					t.Errorf("Expected Widget to be scaled using the scale subresource, got subresource %q", action.GetSubresource())
+				}
+				scale := action.(k8stesting.UpdateAction).GetObject().(*unstructured.Unstructured)
+				replicas, _, _ := unstructured.NestedInt64(scale.Object, "spec", "replicas")
+				scaleReplicas = append(scaleReplicas, replicas)
+				return true, scale, nil
+			})
+
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client:        fclient,
+				Scheme:        runtime.NewScheme(),
+				Log:           logr.Discard(),
+				DynamicClient: dynamicClient,
+				DiscoveryClient: &fakediscovery.FakeDiscovery{
+					Fake: &k8stesting.Fake{
+						Resources: test.resources,
+					},
+				},
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if !cmp.Equal(err, test.expectedErr, equateErrorMessage) {
+				t.Errorf("Error mismatch (-want +got):\n%s", cmp.Diff(test.expectedErr, err, equateErrorMessage))
+				return
+			}
+
+			if !cmp.Equal(test.expectedScaleReplicas, scaleReplicas) {
+				t.Errorf("Scale replicas mismatch (-want +got):\n%s", cmp.Diff(test.expectedScaleReplicas, scaleReplicas))
+			}
+
+			instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err = fclient.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, instance)
+			if err != nil {
+				t.Fatalf("Unexpected error getting CPA: %v", err)
+			}
+
+			if !cmp.Equal(test.expectedPaused, instance.Status.ScaleTargetPaused) {
+				t.Errorf("Scale target paused mismatch (-want +got):\n%s", cmp.Diff(test.expectedPaused, instance.Status.ScaleTargetPaused))
+			}
+
+			notScalable := metav1.ConditionStatus("")
+			if condition := meta.FindStatusCondition(instance.Status.Conditions, custompodautoscalercomv1.ConditionTargetNotScalable); condition != nil {
+				notScalable = condition.Status
+			}
+			if !cmp.Equal(test.expectedNotScalable, notScalable) {
+				t.Errorf("Target not scalable mismatch (-want +got):\n%s", cmp.Diff(test.expectedNotScalable, notScalable))
+			}
+
+			forbidden := metav1.ConditionStatus("")
+			if condition := meta.FindStatusCondition(instance.Status.Conditions, custompodautoscalercomv1.ConditionTargetForbidden); condition != nil {
+				forbidden = condition.Status
+			}
+			if !cmp.Equal(test.expectedForbidden, forbidden) {
+				t.Errorf("Target forbidden mismatch (-want +got):\n%s", cmp.Diff(test.expectedForbidden, forbidden))
+			}
+		})
+	}
+}
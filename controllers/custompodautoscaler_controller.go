@@ -18,32 +18,53 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/types"
 
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/restmapper"
 	k8sscale "k8s.io/client-go/scale"
+	"k8s.io/client-go/tools/record"
 
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/utils/clock"
 
 	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/audit"
 	rbacv1 "k8s.io/api/rbac/v1"
 )
 
@@ -51,6 +72,35 @@ const (
 	managedByLabel           = "app.kubernetes.io/managed-by"
 	OwnedByLabel             = "v1.custompodautoscaler.com/owned-by"
 	PausedReplicasAnnotation = "v1.custompodautoscaler.com/paused-replicas"
+	// ManagedPauseAnnotation is set on the scale target while its replicas are set by the operator because
+	// autoscaling is paused
+	ManagedPauseAnnotation = "v1.custompodautoscaler.com/managed-pause"
+	// PausedMinReplicasAnnotation pauses autoscaling, raising the replica count of the scale target to the value set
+	// if it is lower and leaving higher replica counts unchanged
+	PausedMinReplicasAnnotation = "v1.custompodautoscaler.com/paused-min-replicas"
+	// PauseUntilAnnotation pauses autoscaling until the RFC3339 time set, after which autoscaling is resumed
+	PauseUntilAnnotation = "v1.custompodautoscaler.com/pause-until"
+	// PodSpecHashAnnotation is a hash of the provisioned Pod, an existing Pod is only recreated if the hash has changed
+	PodSpecHashAnnotation = "v1.custompodautoscaler.com/pod-spec-hash"
+	// SecretConfigHashAnnotation is a hash of the SecretConfig provisioned for the Pod, so the Pod is recreated when
+	// the SecretConfig changes
+	SecretConfigHashAnnotation = "v1.custompodautoscaler.com/secret-config-hash"
+	// RestartAnnotation restarts the autoscaler Pod each time its value changes, usually set to the current time in
+	// the same way as kubectl rollout restart
+	RestartAnnotation = "v1.custompodautoscaler.com/restart"
+)
+
+const (
+	argoRolloutsGroup    = "argoproj.io"
+	argoRolloutKind      = "Rollout"
+	argoRolloutsResource = "rollouts"
+	statefulSetKind      = "StatefulSet"
+	// targetUpdatingRequeueDelay is how long to wait before checking again if a StatefulSet scale target has
+	// finished updating, or if an aborted Argo Rollout scale target is no longer aborted
+	targetUpdatingRequeueDelay = 15 * time.Second
+	// rolloutAbortedReason is the reason of the event recorded while setting the paused replicas of an aborted Argo
+	// Rollout is deferred
+	rolloutAbortedReason = "RolloutAborted"
 )
 
 type K8sReconciler interface {
@@ -72,12 +122,106 @@ type CustomPodAutoscalerReconciler struct {
 	Scheme                       *runtime.Scheme
 	KubernetesResourceReconciler K8sReconciler
 	ScalingClient                k8sscale.ScalesGetter
+	DynamicClient                dynamic.Interface
+	// FieldManager is the name used to attribute changes made by the operator to scale targets
+	FieldManager string
+	// Tracer is used to trace reconciles, if not set reconciles are not traced
+	Tracer trace.Tracer
+	// RequiredLabels are the label keys every CPA must have before it is provisioned, their values are copied onto
+	// all provisioned resources
+	RequiredLabels []string
+	// Environment selects the config overlay merged onto the config of each CPA, if not set no overlay is applied
+	Environment string
+	// DefaultAnnotations are added to all provisioned resources, annotations set in the Pod template take precedence
+	DefaultAnnotations map[string]string
+	// MaintenanceWindow is a recurring window during which provisioning is deferred until the window closes, if not
+	// set changes are always made
+	MaintenanceWindow *MaintenanceWindow
+	// Clock is used to evaluate the maintenance window, if not set the real clock is used
+	Clock clock.PassiveClock
+	// AuditLogger records the changes made while pausing autoscaling, if not set no audit records are written
+	AuditLogger *audit.Logger
+	// Recorder records events for CPAs, if not set no events are recorded
+	Recorder record.EventRecorder
+	// EnvVarsSizeThreshold is the size in bytes above which the environment variables of a provisioned container are
+	// reported as too large, if zero the size is not checked
+	EnvVarsSizeThreshold int
+	// ReconcileLogs captures the reconcile log lines of each CPA, if not set no log lines are captured
+	ReconcileLogs *ReconcileLogs
+	// FullReconcileInterval enables skipping reconciling the provisioned resources while they are unchanged since the
+	// last full reconcile and the Pod is ready, a full reconcile is still run at least once per interval. If zero
+	// every reconcile reconciles all of the provisioned resources
+	FullReconcileInterval time.Duration
+	// ShardSelector limits the CPAs reconciled to those with labels matching the selector, allowing CPAs to be split
+	// between multiple operator instances. If not set every CPA is reconciled
+	ShardSelector labels.Selector
+	// EnvironmentFilter limits the CPAs reconciled to those with the environment annotation set to this value,
+	// allowing operators for different environments to share a cluster. If not set every CPA is reconciled
+	EnvironmentFilter string
+	// ProxyEnvVars are injected into every provisioned container, such as HTTP_PROXY for clusters behind an egress
+	// proxy. Environment variables set in the template or the CPA config take precedence
+	ProxyEnvVars []corev1.EnvVar
+	// MaxReconcileFailures is the number of consecutive failed reconciles after which a CPA is parked, a parked CPA
+	// is not reconciled again until its spec changes. If zero CPAs are never parked
+	MaxReconcileFailures int
+	// TargetKindReconciles counts reconciles labelled by the kind of the scale target, if not set the
+	// ReconcilesByTargetKind counter is used
+	TargetKindReconciles *prometheus.CounterVec
+	// ServiceMonitorServed is set if the Prometheus Operator ServiceMonitor CRD is installed, CPAs requesting a
+	// ServiceMonitor only have one provisioned if it is
+	ServiceMonitorServed bool
+	// AllowedImageRegistries are the registries container images of a CPA must be pulled from, CPAs with images from
+	// other registries are not provisioned. If not set images from any registry are allowed
+	AllowedImageRegistries []string
+	// PauseMetrics tracks the number of CPAs with autoscaling paused and how long pauses last, if not set pauses are
+	// not tracked in metrics
+	PauseMetrics *PauseMetrics
+	// CheckResourceQuota enables checking the ResourceQuotas of the namespace before creating the Pod, if creating the
+	// Pod would exceed a quota the Pod is not provisioned and the QuotaExceeded condition is set
+	CheckResourceQuota bool
+	// ScaleTargetRoleRules enables adding rules to the provisioned Role for scale targets the default Role does not
+	// cover, such as targets in other API groups, granting access to the scale target and its scale subresource
+	ScaleTargetRoleRules bool
+	// NamespaceSecurityProfiles map namespaces to the securityContext defaults applied to Pods provisioned in them,
+	// the first profile with a selector matching the labels of the namespace is used. If not set no defaults are applied
+	NamespaceSecurityProfiles []NamespaceSecurityProfile
+	// NamespaceReader is used to read the namespace of each CPA to match the NamespaceSecurityProfiles, reading from
+	// the API server rather than the cache so the operator does not need to watch namespaces, which is not possible
+	// when the cache is limited to a single namespace. If not set the Client is used
+	NamespaceReader client.Reader
+	// RBACPropagationDelay is how long to wait after creating the ServiceAccount, Role or RoleBinding before
+	// provisioning the Pod, for clusters where RBAC changes take time to propagate. If zero the Pod is provisioned in
+	// the same reconcile as the RBAC resources
+	RBACPropagationDelay time.Duration
+	// DebugContainerImage is the image of the ephemeral debug container attached to the autoscaler Pod when requested
+	// with the debug annotation. If not set debug requests are ignored
+	DebugContainerImage string
+	// DiscoveryClient resolves the resources of custom resource scale targets, which are then scaled through their
+	// scale subresource with the dynamic client. If not set custom resources are scaled through the scaling client
+	DiscoveryClient discovery.DiscoveryInterface
+	// PodDiscoveryLabels are added to every provisioned autoscaler Pod so external systems can select autoscaler Pods
+	// across CPAs, taking precedence over labels set in the Pod template. If not set no labels are added
+	PodDiscoveryLabels map[string]string
+	// MetricLabels are the keys of CPA labels whose values are added as labels to the reconcile counter, so reconciles
+	// can be broken down by team or tenant. TargetKindReconciles must be created with NewReconcilesByTargetKind for the
+	// same keys. If not set reconciles are only labelled by the kind of the scale target
+	MetricLabels []string
+	// ResourceCeiling is the maximum of each resource the autoscaler container may request or be limited to, resources
+	// above it are handled according to ResourceCeilingMode. If not set resources are not limited
+	ResourceCeiling corev1.ResourceList
+	// ResourceCeilingMode is whether resources above the ResourceCeiling are clamped to the ceiling or stop the Pod
+	// being provisioned, defaults to clamping
+	ResourceCeilingMode ResourceCeilingMode
 }
 
-// PrimaryPred is the predicate that filters events for the CustomPodAutoscaler primary resource.
+// PrimaryPred is the predicate that filters events for the CustomPodAutoscaler primary resource. Updates are only
+// reconciled if the spec (generation), annotations or labels have changed, so status updates made by the operator do
+// not trigger another reconcile.
 var PrimaryPred = predicate.Funcs{
 	UpdateFunc: func(e event.UpdateEvent) bool {
-		return true
+		return predicate.GenerationChangedPredicate{}.Update(e) ||
+			predicate.AnnotationChangedPredicate{}.Update(e) ||
+			predicate.LabelChangedPredicate{}.Update(e)
 	},
 	DeleteFunc: func(e event.DeleteEvent) bool {
 		return true
@@ -111,8 +255,27 @@ var SecondaryPred = predicate.Funcs{
 // and what is in the CustomPodAutoscaler.Spec
 // The Controller will requeue the Request to be processed again if the returned error is non-nil or
 // Result.Requeue is true, otherwise upon completion it will remove the work from the queue.
-func (r *CustomPodAutoscalerReconciler) Reconcile(context context.Context, req ctrl.Request) (ctrl.Result, error) {
-	reqLogger := r.Log.WithValues("Request", req.NamespacedName)
+func (r *CustomPodAutoscalerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, span := r.tracer().Start(ctx, "Reconcile", trace.WithAttributes(
+		cpaNameAttribute.String(req.Name),
+		cpaNamespaceAttribute.String(req.Namespace),
+	))
+	result, err := r.reconcileCPA(ctx, req)
+	result, err = r.trackReconcileFailures(ctx, req, result, err)
+	if err != nil {
+		span.SetAttributes(cpaResultAttribute.String("error"))
+	} else if result.Requeue || result.RequeueAfter > 0 {
+		span.SetAttributes(cpaResultAttribute.String("requeue"))
+	} else {
+		span.SetAttributes(cpaResultAttribute.String("success"))
+	}
+	endSpan(span, err)
+	return result, err
+}
+
+func (r *CustomPodAutoscalerReconciler) reconcileCPA(context context.Context, req ctrl.Request) (ctrl.Result, error) {
+	reqLogger := r.ReconcileLogs.Logger(r.Log, req.NamespacedName).WithValues("Request", req.NamespacedName)
+	span := trace.SpanFromContext(context)
 
 	// Fetch the CustomPodAutoscaler instance
 	instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
@@ -122,264 +285,534 @@ func (r *CustomPodAutoscalerReconciler) Reconcile(context context.Context, req c
 			// Request object not found, could have been deleted after reconcile request.
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
+			span.SetAttributes(cpaActionAttribute.String(actionNotFound))
+			r.ReconcileLogs.Remove(req.NamespacedName)
+			r.PauseMetrics.Remove(req.NamespacedName)
 			return reconcile.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
 		return reconcile.Result{}, err
 	}
 
+	if instance.Spec.InjectCorrelationID != nil && *instance.Spec.InjectCorrelationID {
+		// Log the correlation ID injected into the autoscaler so operator logs can be matched to the autoscaler logs
+		reqLogger = reqLogger.WithValues("CorrelationID", correlationID(instance))
+	}
+
+	if !inShard(r.ShardSelector, instance) {
+		// CPA is reconciled by the operator instance of another shard, events for resources owned by the CPA can
+		// still be received so these are ignored here
+		span.SetAttributes(cpaActionAttribute.String(actionOtherShard))
+		r.ReconcileLogs.Remove(req.NamespacedName)
+		r.PauseMetrics.Remove(req.NamespacedName)
+		return reconcile.Result{}, nil
+	}
+
+	if !inEnvironment(r.EnvironmentFilter, instance) {
+		// CPA is reconciled by the operator instance of another environment, events for resources owned by the CPA
+		// can still be received so these are ignored here
+		span.SetAttributes(cpaActionAttribute.String(actionOtherEnvironment))
+		r.ReconcileLogs.Remove(req.NamespacedName)
+		r.PauseMetrics.Remove(req.NamespacedName)
+		return reconcile.Result{}, nil
+	}
+
+	r.countReconcile(instance)
+
+	if instance.DeletionTimestamp != nil && controllerutil.ContainsFinalizer(instance, ScaleTargetCleanupFinalizer) {
+		// Cleaned up before checking if the CPA is parked, so a parked CPA can still be deleted
+		reqLogger.Info("Custom Pod Autoscaler marked for deletion, cleaning up scale target", "Kind", "custompodautoscaler.com/v1/CustomPodAutoscaler", "Namespace", instance.GetNamespace(), "Name", instance.GetName())
+		span.SetAttributes(cpaActionAttribute.String(actionDeleting))
+		return r.cleanupScaleTarget(context, reqLogger, instance)
+	}
+
+	if r.MaxReconcileFailures > 0 || instance.Spec.MaxProvisionRetries != nil {
+		parked := meta.FindStatusCondition(instance.Status.Conditions, custompodautoscalercomv1.ConditionParked)
+		if parked != nil && parked.Status == metav1.ConditionTrue {
+			if parked.ObservedGeneration == instance.Generation {
+				reqLogger.V(1).Info("Custom Pod Autoscaler parked after repeated reconcile failures, waiting for a spec change", "Kind", "custompodautoscaler.com/v1/CustomPodAutoscaler", "Namespace", instance.GetNamespace(), "Name", instance.GetName())
+				span.SetAttributes(cpaActionAttribute.String(actionParked))
+				return reconcile.Result{}, nil
+			}
+
+			// The spec has changed since the CPA was parked, resume reconciling
+			reqLogger.Info("Custom Pod Autoscaler spec changed, resuming parked reconcile", "Kind", "custompodautoscaler.com/v1/CustomPodAutoscaler", "Namespace", instance.GetNamespace(), "Name", instance.GetName())
+			meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionParked,
+				Status:             metav1.ConditionFalse,
+				Reason:             "SpecChanged",
+				Message:            "Spec changed since the CPA was parked, reconciling resumed",
+				ObservedGeneration: instance.Generation,
+			})
+			instance.Status.ReconcileFailures = 0
+			instance.Status.ProvisionFailures = nil
+			err = r.Client.Status().Update(context, instance)
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+		}
+	}
+
 	if instance.DeletionTimestamp != nil {
 		reqLogger.Info("Custom Pod Autoscaler marked for deletion, ignoring reconcilation of dependencies ", "Kind", "custompodautoscaler.com/v1/CustomPodAutoscaler", "Namespace", instance.GetNamespace(), "Name", instance.GetName())
+		span.SetAttributes(cpaActionAttribute.String(actionDeleting))
 		return reconcile.Result{}, nil
 	}
 
+	err = r.syncScaleTargetCleanupFinalizer(context, instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
 	// Check the presence of "v1.custompodautoscaler.com/paused-replicas" annotation on the CPA pod
 	// Pauses autoscaling (deletes autoscaling pod) and manually sets replica count of scale target
 	// Mimics functionality of https://keda.sh/docs/2.11/concepts/scaling-deployments/#pause-autoscaling
 	pausedReplicasCount, pausedAnnotationFound := instance.GetAnnotations()[PausedReplicasAnnotation]
-	if pausedAnnotationFound {
-		// Get paused replicas count from annotation metadata
-		pausedReplicasCountInt64, err := strconv.ParseInt(pausedReplicasCount, 10, 32)
-		pausedReplicasCountInt32 := int32(pausedReplicasCountInt64)
+
+	// The "v1.custompodautoscaler.com/paused-min-replicas" annotation sets a replica floor rather than an exact replica
+	// count while paused, an exact count set with the paused-replicas annotation takes precedence
+	pausedMinReplicas := false
+	if !pausedAnnotationFound {
+		pausedReplicasCount, pausedAnnotationFound = instance.GetAnnotations()[PausedMinReplicasAnnotation]
+		pausedMinReplicas = pausedAnnotationFound
+	}
+
+	// Check the presence of "v1.custompodautoscaler.com/pause-until" annotation on the CPA, pausing autoscaling
+	// until the RFC3339 time provided and then automatically resuming. The replica count is only set if the
+	// paused-replicas annotation is also present
+	pauseRemaining := time.Duration(0)
+	pauseUntil, pauseUntilFound := instance.GetAnnotations()[PauseUntilAnnotation]
+	if pauseUntilFound {
+		deadline, err := time.Parse(time.RFC3339, pauseUntil)
 		if err != nil {
 			return reconcile.Result{}, err
 		}
+		pauseRemaining = deadline.Sub(r.clock().Now())
+	}
+
+	if pauseRemaining > 0 || (pausedAnnotationFound && !pauseUntilFound) {
+		span.SetAttributes(cpaActionAttribute.String(actionPause))
 
-		// Use the reconciler client to delete the pod that normally does the scaling
-		// This should be done first so the autoscaler does not override
-		// the scaling changes made by the operator
-		if err := r.Client.Delete(context, instance); err != nil {
+		err := r.markPaused(context, instance)
+		if err != nil {
 			return reconcile.Result{}, err
 		}
 
-		// scaleTargetRef is the pod or service that is being autoscaled
-		// ScaleTargetRef{} = CrossVersionObjectReference{Kind string, Name string, APIVersion string}
-		// https://github.com/kubernetes/api/blob/v0.27.4/autoscaling/v1/types.go
-		scaleTargetRef := instance.Spec.ScaleTargetRef
+		if !pausedAnnotationFound {
+			// No replica count to set, only stop the autoscaler until the pause ends
+			err := r.deleteAutoscalerPods(context, instance)
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+			return reconcile.Result{RequeueAfter: pauseRemaining}, nil
+		}
 
-		// ex. ParseGroupVersion("custompodautoscaler.com/v1")
-		//     = GroupVersion{Group: "custompodautoscaler.com", Version: "v1"}
-		// https://github.com/kubernetes/apimachinery/blob/v0.27.3/pkg/runtime/schema/group_version.go
-		resourceGV, err := schema.ParseGroupVersion(scaleTargetRef.APIVersion)
-		if err != nil {
-			return reconcile.Result{}, err
+		result, err := r.pauseScaleTarget(context, reqLogger, instance, pausedReplicasCount, pausedMinReplicas)
+		if err != nil || !pauseUntilFound {
+			return result, err
 		}
+		// Requeue sooner if setting the paused replicas has been deferred
+		if result.RequeueAfter > 0 && result.RequeueAfter < pauseRemaining {
+			return result, nil
+		}
+		// Requeue once the pause ends to resume autoscaling
+		return reconcile.Result{RequeueAfter: pauseRemaining}, nil
+	}
 
-		targetGR := schema.GroupResource{
-			Group:    resourceGV.Group,    // ex. "custompodautoscaler.com"
-			Resource: scaleTargetRef.Kind, // ex. "CustomPodAutoscaler"
+	// Defer provisioning changes during the maintenance window, requeuing once the window has closed. Pausing
+	// autoscaling is still applied as it is an explicit request to stop autoscaling
+	if r.MaintenanceWindow != nil {
+		remaining := r.MaintenanceWindow.Remaining(r.clock().Now())
+		if remaining > 0 {
+			reqLogger.Info("In maintenance window, deferring provisioning", "Kind", "custompodautoscaler.com/v1/CustomPodAutoscaler", "Namespace", instance.GetNamespace(), "Name", instance.GetName(), "RequeueAfter", remaining)
+			span.SetAttributes(cpaActionAttribute.String(actionMaintenance))
+			return reconcile.Result{RequeueAfter: remaining}, nil
 		}
+	}
+
+	span.SetAttributes(cpaActionAttribute.String(actionProvision))
+
+	err = r.markResumed(context, instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
 
-		// Get the scale request for a resource (https://github.com/kubernetes/api/blob/v0.27.4/autoscaling/v1/types.go)
-		// https://github.com/kubernetes/client-go/blob/master/scale/client.go
-		scaleResource, err := r.ScalingClient.Scales(instance.Namespace).Get(context, targetGR, scaleTargetRef.Name, metav1.GetOptions{})
+	// Autoscaling has been resumed, clean up the managed pause annotation on the scale target
+	if instance.Status.ScaleTargetPaused {
+		result, err := r.setScaleTargetPaused(context, instance, false)
 		if err != nil {
-			return reconcile.Result{}, err
+			return result, err
 		}
+	}
 
-		// Set new target replicas
-		scaleResource.Spec.Replicas = pausedReplicasCountInt32
+	// Provisioning is blocked until the CPA has all of the labels required by the operator
+	_, missingLabels := r.requiredLabels(instance)
+	if len(r.RequiredLabels) > 0 {
+		condition := metav1.Condition{
+			Type:               custompodautoscalercomv1.ConditionRequiredLabels,
+			Status:             metav1.ConditionTrue,
+			Reason:             "RequiredLabelsPresent",
+			Message:            "All required labels are present",
+			ObservedGeneration: instance.Generation,
+		}
+		if len(missingLabels) > 0 {
+			condition.Status = metav1.ConditionFalse
+			condition.Reason = "MissingRequiredLabels"
+			condition.Message = fmt.Sprintf("Missing required labels: %s", strings.Join(missingLabels, ", "))
+		}
 
-		// Update the resource with new replica count
-		// https://github.com/kubernetes/client-go/blob/master/scale/client.go
-		_, err = r.ScalingClient.Scales(instance.Namespace).Update(context, targetGR, scaleResource, metav1.UpdateOptions{})
-		if err != nil {
-			return reconcile.Result{}, err
+		if meta.SetStatusCondition(&instance.Status.Conditions, condition) {
+			err = r.Client.Status().Update(context, instance)
+			if err != nil {
+				return reconcile.Result{}, err
+			}
 		}
 
-		// Return and don't requeue
-		return reconcile.Result{}, nil
+		if len(missingLabels) > 0 {
+			reqLogger.Info("Custom Pod Autoscaler is missing required labels, skipping provisioning", "Kind", "custompodautoscaler.com/v1/CustomPodAutoscaler", "Namespace", instance.GetNamespace(), "Name", instance.GetName(), "MissingLabels", missingLabels)
+			return reconcile.Result{}, nil
+		}
 	}
 
-	if instance.Spec.ProvisionRole == nil {
-		defaultVal := true
-		instance.Spec.ProvisionRole = &defaultVal
-	}
-	if instance.Spec.ProvisionRoleBinding == nil {
-		defaultVal := true
-		instance.Spec.ProvisionRoleBinding = &defaultVal
-	}
-	if instance.Spec.ProvisionServiceAccount == nil {
-		defaultVal := true
-		instance.Spec.ProvisionServiceAccount = &defaultVal
-	}
-	if instance.Spec.ProvisionPod == nil {
-		defaultVal := true
-		instance.Spec.ProvisionPod = &defaultVal
+	// Conditions set by the checks before provisioning are written with the rest of the status, rather than each check
+	// updating the status
+	original := instance.Status.DeepCopy()
+
+	plan, exceeded, err := r.provisioningPlan(context, reqLogger, instance)
+	if err != nil {
+		return ctrl.Result{}, err
 	}
-	if instance.Spec.RoleRequiresMetricsServer == nil {
-		defaultVal := false
-		instance.Spec.RoleRequiresMetricsServer = &defaultVal
+	restartSchedule, err := parseRestartSchedule(instance)
+	if err != nil {
+		return ctrl.Result{}, errors.NewBadRequest(err.Error())
 	}
-	if instance.Spec.RoleRequiresArgoRollouts == nil {
-		defaultVal := false
-		instance.Spec.RoleRequiresArgoRollouts = &defaultVal
+
+	// Provisioning is blocked until all of the images of the CPA are from registries allowed by the operator
+	if len(r.AllowedImageRegistries) > 0 {
+		images := r.checkImageRegistries(instance, plan.Pod)
+		if len(images) > 0 {
+			reqLogger.Info("Custom Pod Autoscaler uses images from registries that are not allowed, skipping provisioning", "Kind", "custompodautoscaler.com/v1/CustomPodAutoscaler", "Namespace", instance.GetNamespace(), "Name", instance.GetName(), "Images", images)
+			return reconcile.Result{}, r.updateChangedStatus(context, instance, original)
+		}
 	}
 
-	// Parse scaleTargetRef
-	scaleTargetRef, err := json.Marshal(instance.Spec.ScaleTargetRef)
-	if err != nil {
-		// Should not occur, panic
-		panic(err)
+	// Resources of the autoscaler container above the ceiling set by the operator have either been lowered to the
+	// ceiling or block provisioning until they are within it
+	if len(r.ResourceCeiling) > 0 {
+		r.checkResourceCeiling(instance, exceeded)
+		if len(exceeded) > 0 && r.ResourceCeilingMode == ResourceCeilingModeReject {
+			reqLogger.Info("Custom Pod Autoscaler resources are above the resource ceiling, skipping provisioning", "Kind", "custompodautoscaler.com/v1/CustomPodAutoscaler", "Namespace", instance.GetNamespace(), "Name", instance.GetName(), "Resources", exceeded)
+			return reconcile.Result{}, r.updateChangedStatus(context, instance, original)
+		}
 	}
 
-	labels := map[string]string{
-		managedByLabel: "custom-pod-autoscaler-operator",
-		OwnedByLabel:   instance.Name,
+	// Large environment variables can make the Pod fail to be created with errors that are difficult to diagnose,
+	// so report them before provisioning
+	r.checkEnvVarsSize(instance, plan.Pod)
+
+	// An existing Role that is missing permissions only fails once the autoscaler runs, so report it up front
+	if !*instance.Spec.ProvisionRole && instance.Spec.ValidateExistingRole != nil && *instance.Spec.ValidateExistingRole {
+		err = r.checkExistingRole(context, instance)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
 	}
 
-	// Define a new Service Account object
-	var serviceAccount *corev1.ServiceAccount
-	if !(*instance.Spec.ProvisionServiceAccount) {
-		if instance.Spec.Template.Spec.ServiceAccountName != "" {
-			serviceAccount = &corev1.ServiceAccount{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      instance.Spec.Template.Spec.ServiceAccountName,
-					Namespace: instance.Namespace,
-					Labels:    labels,
-				},
-			}
-		} else {
-			return ctrl.Result{}, errors.NewBadRequest("ServiceAccount not provided in the CustomPodAutoscaler spec")
+	// Skip reconciling the provisioned resources if nothing has changed since the last full reconcile, requeuing
+	// for the next full reconcile
+	planHash := plan.hash()
+	resyncRemaining, err := r.fullReconcileRemaining(context, instance, plan, planHash)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if resyncRemaining > 0 && restartSchedule != nil {
+		// A restart that is due is not skipped, otherwise requeue in time for the next restart
+		restartIn := restartRemaining(instance, restartSchedule, r.clock().Now())
+		if restartIn < resyncRemaining {
+			resyncRemaining = restartIn
 		}
-	} else {
-		serviceAccount = &corev1.ServiceAccount{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      instance.Name,
-				Namespace: instance.Namespace,
-				Labels:    labels,
-			},
+	}
+	if resyncRemaining > 0 && instance.Spec.MaxPodAge != nil && instance.Status.PodProvisionedTime != nil {
+		// A Pod that has reached the maximum Pod age is not skipped, otherwise requeue in time to restart it
+		ageIn := podAgeRemaining(instance, instance.Status.PodProvisionedTime.Time, r.clock().Now())
+		if ageIn < resyncRemaining {
+			resyncRemaining = ageIn
 		}
 	}
+	if resyncRemaining > 0 && restartRequested(instance) {
+		// A restart request is handled once the Pod is reconciled, so is not skipped
+		resyncRemaining = 0
+	}
+	if resyncRemaining > 0 && r.debugRequested(instance) {
+		// A debug request is handled once the Pod is reconciled, so is not skipped
+		resyncRemaining = 0
+	}
+	if resyncRemaining > 0 {
+		reqLogger.V(1).Info("Provisioned resources unchanged and Pod ready, skipping reconcile", "Kind", "custompodautoscaler.com/v1/CustomPodAutoscaler", "Namespace", instance.GetNamespace(), "Name", instance.GetName(), "RequeueAfter", resyncRemaining)
+		span.SetAttributes(cpaActionAttribute.String(actionUnchanged))
+		return reconcile.Result{RequeueAfter: resyncRemaining}, r.updateChangedStatus(context, instance, original)
+	}
 
 	if *instance.Spec.ProvisionServiceAccount {
-		result, err := r.KubernetesResourceReconciler.Reconcile(reqLogger, instance, serviceAccount, *instance.Spec.ProvisionServiceAccount, true, "v1/ServiceAccount")
+		// RBAC changes can take time to propagate to every API server, so check if the RBAC resources are being created
+		// to defer creating the Pod until they have propagated
+		rbacCreated := false
+		if r.RBACPropagationDelay > 0 {
+			rbacCreated, err = r.rbacMissing(context, plan)
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+		}
+
+		result, err := r.reconcileResource(context, reqLogger, instance, plan.ServiceAccount, *instance.Spec.ProvisionServiceAccount, true, "v1/ServiceAccount")
 		if err != nil {
 			return result, err
 		}
 
-		role := &rbacv1.Role{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      instance.Name,
-				Namespace: instance.Namespace,
-				Labels:    labels,
-			},
-			Rules: []rbacv1.PolicyRule{
-				{
-					APIGroups: []string{""},
-					Resources: []string{"pods", "replicationcontrollers", "replicationcontrollers/scale"},
-					Verbs:     []string{"*"},
-				},
-				{
-					APIGroups: []string{"apps"},
-					Resources: []string{"deployments", "deployments/scale", "replicasets", "replicasets/scale", "statefulsets", "statefulsets/scale"},
-					Verbs:     []string{"*"},
-				},
-			},
+		result, err = r.reconcileResource(context, reqLogger, instance, plan.Role, *instance.Spec.ProvisionRole, true, "v1/Role")
+		if err != nil {
+			return result, err
 		}
 
-		if *instance.Spec.RoleRequiresMetricsServer {
-			role.Rules = append(role.Rules, rbacv1.PolicyRule{
-				APIGroups: []string{"metrics.k8s.io", "custom.metrics.k8s.io", "external.metrics.k8s.io"},
-				Resources: []string{"*"},
-				Verbs:     []string{"*"},
-			})
+		result, err = r.reconcileResource(context, reqLogger, instance, plan.RoleBinding, *instance.Spec.ProvisionRoleBinding, true, "v1/RoleBinding")
+		if err != nil {
+			return result, err
 		}
 
-		if *instance.Spec.RoleRequiresArgoRollouts {
-			role.Rules = append(role.Rules, rbacv1.PolicyRule{
-				APIGroups: []string{"argoproj.io"},
-				Resources: []string{"rollouts", "rollouts/scale"},
-				Verbs:     []string{"*"},
-			})
+		if rbacCreated {
+			reqLogger.Info("RBAC resources created, requeueing to allow them to propagate before provisioning the Pod", "Kind", "custompodautoscaler.com/v1/CustomPodAutoscaler", "Namespace", instance.GetNamespace(), "Name", instance.GetName(), "RequeueAfter", r.RBACPropagationDelay)
+			return reconcile.Result{RequeueAfter: r.RBACPropagationDelay}, r.updateChangedStatus(context, instance, original)
 		}
+	}
 
-		result, err = r.KubernetesResourceReconciler.Reconcile(reqLogger, instance, role, *instance.Spec.ProvisionRole, true, "v1/Role")
+	if plan.ConfigMap != nil {
+		result, err := r.reconcileResource(context, reqLogger, instance, plan.ConfigMap, true, true, "v1/ConfigMap")
 		if err != nil {
 			return result, err
 		}
+	}
 
-		// Define a new Role Binding object
-		roleBinding := &rbacv1.RoleBinding{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      instance.Name,
-				Namespace: instance.Namespace,
-				Labels:    labels,
-			},
-			Subjects: []rbacv1.Subject{
-				{
-					Kind:      "ServiceAccount",
-					Name:      instance.Name,
-					Namespace: instance.Namespace,
-				},
-			},
-			RoleRef: rbacv1.RoleRef{
-				Kind:     "Role",
-				Name:     instance.Name,
-				APIGroup: "rbac.authorization.k8s.io",
-			},
+	if plan.Secret != nil {
+		result, err := r.reconcileResource(context, reqLogger, instance, plan.Secret, true, true, "v1/Secret")
+		if err != nil {
+			return result, err
 		}
-		result, err = r.KubernetesResourceReconciler.Reconcile(reqLogger, instance, roleBinding, *instance.Spec.ProvisionRoleBinding, true, "v1/RoleBinding")
+	}
+
+	// The NetworkPolicy is provisioned before the Pod so the Pod never runs without its egress restricted
+	if plan.NetworkPolicy != nil {
+		result, err := r.reconcileResource(context, reqLogger, instance, plan.NetworkPolicy, true, true, "networking.k8s.io/v1/NetworkPolicy")
 		if err != nil {
 			return result, err
 		}
 	}
 
-	// Set up Pod labels, if labels are provided in the template Pod Spec the labels are merged
-	// with the CPA managed-by label, otherwise only the managed-by label is added
-	var podLabels map[string]string
-	if instance.Spec.Template.ObjectMeta.Labels == nil {
-		podLabels = map[string]string{}
-	} else {
-		podLabels = instance.Spec.Template.ObjectMeta.Labels
-	}
-	podLabels[managedByLabel] = "custom-pod-autoscaler-operator"
-	podLabels[OwnedByLabel] = instance.Name
-
-	// Set up ObjectMeta, if no name or namespaces are provided in the template PodSpec then
-	// the CPA name and namespace are used
-	objectMeta := instance.Spec.Template.ObjectMeta
-	if objectMeta.Name == "" {
-		objectMeta.Name = instance.Name
-	}
-	if objectMeta.Namespace == "" {
-		objectMeta.Namespace = instance.Namespace
-	}
-	objectMeta.Labels = podLabels
-
-	// Set up the PodSpec template
-	podSpec := instance.Spec.Template.Spec
-	// Inject environment variables to every Container specified by the PodSpec
-	containers := []corev1.Container{}
-	for _, container := range podSpec.Containers {
-		// If no environment variables specified by the template PodSpec, set up empty env vars
-		// slice
-		var envVars []corev1.EnvVar
-		if container.Env == nil {
-			envVars = []corev1.EnvVar{}
-		} else {
-			envVars = container.Env
+	// A Pod referencing a Secret or Secret key that does not exist is stuck failing to start its containers, so wait
+	// for the Secrets to exist before provisioning the Pod
+	if *instance.Spec.ProvisionPod {
+		provisionedSecret := ""
+		if plan.Secret != nil {
+			provisionedSecret = plan.Secret.Name
+		}
+		missing, err := r.checkConfigSecrets(context, instance, plan.Pod, provisionedSecret)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if len(missing) > 0 {
+			reqLogger.Info("Secrets referenced by the Pod not found, requeueing", "Kind", "v1/Pod", "Namespace", plan.Pod.Namespace, "Name", plan.Pod.Name, "Missing", missing, "RequeueAfter", configSecretRequeueDelay)
+			return reconcile.Result{RequeueAfter: configSecretRequeueDelay}, r.updateChangedStatus(context, instance, original)
+		}
+	}
+
+	// Creating a Pod that exceeds a ResourceQuota is rejected by the API server, report the exceeded quotas with a
+	// condition rather than failing to create the Pod and requeue until there is quota available
+	if *instance.Spec.ProvisionPod && r.CheckResourceQuota {
+		exceeded, err := r.checkResourceQuota(context, instance, plan.Pod)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if len(exceeded) > 0 {
+			reqLogger.Info("Creating the Pod would exceed ResourceQuotas, requeueing", "Kind", "v1/Pod", "Namespace", plan.Pod.Namespace, "Name", plan.Pod.Name, "Exceeded", exceeded, "RequeueAfter", quotaRequeueDelay)
+			return reconcile.Result{RequeueAfter: quotaRequeueDelay}, r.updateChangedStatus(context, instance, original)
+		}
+	}
+
+	// A generated Pod name is only reused while the Pod exists, once the Pod has been deleted (such as to recreate it
+	// for a change or a restart) a new name is generated for the replacement Pod
+	if instance.Spec.GeneratePodName != nil && *instance.Spec.GeneratePodName && *instance.Spec.ProvisionPod && plan.Pod.Name != "" {
+		missing, err := r.podMissing(context, plan.Pod)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if missing {
+			plan.Pod.Name = ""
+			instance.Status.PodName = ""
+		}
+	}
+
+	// Reconciling an existing Pod that has changed recreates it, if the Pod was recreated within the recreate
+	// cooldown skip reconciling the Pod and requeue once the cooldown has passed
+	cooldownRemaining, recreating, err := r.podRecreateCooldown(context, instance, plan.Pod)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if cooldownRemaining > 0 {
+		reqLogger.Info("Pod recreated within cooldown, requeueing", "Kind", "v1/Pod", "Namespace", plan.Pod.Namespace, "Name", plan.Pod.Name, "RequeueAfter", cooldownRemaining)
+		return reconcile.Result{RequeueAfter: cooldownRemaining}, r.updateChangedStatus(context, instance, original)
+	}
+
+	// Restart the Pod on the restart schedule, deleting the existing Pod so it is recreated
+	restartIn := time.Duration(0)
+	restartStatusChanged := false
+	if restartSchedule != nil && *instance.Spec.ProvisionPod {
+		restartIn, restartStatusChanged, err = r.scheduledRestart(context, reqLogger, instance, restartSchedule, plan.Pod)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	// Restart the Pod if requested with the restart annotation, deleting the existing Pod so it is recreated
+	if *instance.Spec.ProvisionPod {
+		requestedRestart, err := r.requestedRestart(context, reqLogger, instance, plan.Pod)
+		if err != nil {
+			return reconcile.Result{}, err
 		}
-		// Inject in configuration, such as namespace, target ref and configuration
-		// options as environment variables
-		envVars = append(envVars, cpaEnvVars(instance, string(scaleTargetRef))...)
-		container.Env = envVars
-		containers = append(containers, container)
+		restartStatusChanged = restartStatusChanged || requestedRestart
 	}
-	// Update PodSpec to use the modified containers, and to point to the provisioned service account
-	podSpec.Containers = containers
-	podSpec.ServiceAccountName = serviceAccount.Name
 
-	// Define Pod object with ObjectMeta and modified PodSpec
-	pod := &corev1.Pod{
-		ObjectMeta: metav1.ObjectMeta(objectMeta),
-		Spec:       corev1.PodSpec(podSpec),
+	// Restart the Pod once it is older than the maximum Pod age, after the other restarts so a Pod that was just
+	// restarted is not restarted again
+	if instance.Spec.MaxPodAge != nil && *instance.Spec.ProvisionPod {
+		err = r.maxPodAgeRestart(context, reqLogger, instance, plan.Pod)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
 	}
-	result, err := r.KubernetesResourceReconciler.Reconcile(reqLogger, instance, pod, *instance.Spec.ProvisionPod, false, "v1/Pod")
+
+	result, err := r.reconcileResource(context, reqLogger, instance, plan.Pod, *instance.Spec.ProvisionPod, false, "v1/Pod")
 	if err != nil {
 		return result, err
 	}
 
+	// Track the generated Pod name in the status so the Pod can be found in future reconciles, saved as soon as the Pod
+	// is created so a later failure in this reconcile does not lead to another Pod being generated
+	if instance.Spec.GeneratePodName != nil && *instance.Spec.GeneratePodName && plan.Pod.Name != instance.Status.PodName {
+		instance.Status.PodName = plan.Pod.Name
+		err = r.updateStatus(context, instance)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		original = instance.Status.DeepCopy()
+	}
+	if restartIn > 0 && (result.RequeueAfter == 0 || restartIn < result.RequeueAfter) {
+		result.RequeueAfter = restartIn
+	}
+
+	// Requeue in time to restart the Pod once it reaches the maximum Pod age, a Pod without a creation time has only
+	// just been created
+	if instance.Spec.MaxPodAge != nil && *instance.Spec.ProvisionPod {
+		ageIn := instance.Spec.MaxPodAge.Duration
+		if !plan.Pod.CreationTimestamp.IsZero() {
+			ageIn = podAgeRemaining(instance, plan.Pod.CreationTimestamp.Time, r.clock().Now())
+		}
+		if ageIn > 0 && (result.RequeueAfter == 0 || ageIn < result.RequeueAfter) {
+			result.RequeueAfter = ageIn
+		}
+	}
+
+	// Attach a debug container to the Pod if requested with the debug annotation
+	debugStatusChanged := false
+	if *instance.Spec.ProvisionPod {
+		debugStatusChanged, err = r.requestedDebugContainer(context, reqLogger, instance, plan.Pod)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	// The Service and ServiceMonitor can only be provisioned if the Prometheus Operator CRDs are installed
+	if plan.ServiceMonitor != nil {
+		if r.ServiceMonitorServed {
+			result, err = r.reconcileResource(context, reqLogger, instance, plan.Service, true, true, "v1/Service")
+			if err != nil {
+				return result, err
+			}
+
+			err = r.reconcileServiceMonitor(context, reqLogger, instance, plan.ServiceMonitor)
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+		} else {
+			reqLogger.Info("ServiceMonitor CRD not installed, skipping provisioning the Service and ServiceMonitor", "Kind", "custompodautoscaler.com/v1/CustomPodAutoscaler", "Namespace", instance.GetNamespace(), "Name", instance.GetName())
+		}
+	}
+
+	statusChanged := meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+		Type:               custompodautoscalercomv1.ConditionResourcesProvisioned,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Provisioned",
+		Message:            "All resources were reconciled",
+		ObservedGeneration: instance.Generation,
+	})
+
+	if restartStatusChanged || debugStatusChanged {
+		statusChanged = true
+	}
+
+	// Track when the Pod was recreated to apply the recreate cooldown in future reconciles
+	if recreating {
+		now := metav1.NewTime(r.clock().Now())
+		instance.Status.LastPodRecreateTime = &now
+		statusChanged = true
+	}
+
+	// Track when the current Pod was created so the autoscaler warm-up can be reasoned about, the creation time is only
+	// known if the Pod was reconciled
+	if *instance.Spec.ProvisionPod && !plan.Pod.CreationTimestamp.IsZero() &&
+		(instance.Status.PodProvisionedTime == nil || !instance.Status.PodProvisionedTime.Equal(&plan.Pod.CreationTimestamp)) {
+		provisioned := plan.Pod.CreationTimestamp
+		instance.Status.PodProvisionedTime = &provisioned
+		statusChanged = true
+	}
+
+	// Track the version of the scale target so changes to the scale target, such as it being recreated, can be
+	// diagnosed. The version is only used for diagnosis so failing to read it does not fail the reconcile
+	if r.ScalingClient != nil {
+		targetVersion, err := r.scaleTargetVersion(context, instance)
+		if err != nil {
+			reqLogger.V(1).Info("Failed to get scale target version", "Error", err, "Kind", instance.Spec.ScaleTargetRef.Kind, "Namespace", instance.Namespace, "Name", instance.Spec.ScaleTargetRef.Name)
+		} else if instance.Status.TargetObservedVersion != targetVersion {
+			instance.Status.TargetObservedVersion = targetVersion
+			statusChanged = true
+		}
+	}
+
+	// Report the RBAC resources provisioned so the effective RBAC of the autoscaler is visible in the status
+	if rbacMode := plan.rbacMode(); instance.Status.RBACMode != rbacMode {
+		instance.Status.RBACMode = rbacMode
+		statusChanged = true
+	}
+
+	// Every resource was provisioned, so no resource is failing
+	if len(instance.Status.ProvisionFailures) > 0 {
+		instance.Status.ProvisionFailures = nil
+		statusChanged = true
+	}
+
+	// Track the resources reconciled so unchanged resources can be skipped in future reconciles
+	if r.FullReconcileInterval > 0 {
+		now := metav1.NewTime(r.clock().Now())
+		instance.Status.PlanHash = planHash
+		instance.Status.LastFullReconcileTime = &now
+		statusChanged = true
+	}
+
+	if statusChanged || !apiequality.Semantic.DeepEqual(original, &instance.Status) {
+		err = r.Client.Status().Update(context, instance)
+		if err != nil {
+			return result, err
+		}
+	}
+
 	// Clean up any orphaned pods (e.g. renaming pod, old pod should be deleted)
 	err = r.KubernetesResourceReconciler.PodCleanup(reqLogger, instance)
 	if err != nil {
@@ -389,90 +822,1035 @@ func (r *CustomPodAutoscalerReconciler) Reconcile(context context.Context, req c
 	return result, nil
 }
 
-// cpaEnvVars builds a list of environment variables from the Spec
-func cpaEnvVars(cr *custompodautoscalercomv1.CustomPodAutoscaler, scaleTargetRef string) []corev1.EnvVar {
-	envVars := []corev1.EnvVar{
-		{
-			Name:  "scaleTargetRef",
-			Value: scaleTargetRef,
-		},
-		{
-			Name:  "namespace",
-			Value: cr.Namespace,
-		},
-	}
-	envVars = append(envVars, createEnvVarsFromConfig(cr.Spec.Config)...)
-	return envVars
+// scaleArgoRollout sets the replica count of an Argo Rollout using the Rollout's scale subresource. Argo Rollouts
+// still honours scaling events while a Rollout is paused, so the replicas are set without resuming the Rollout. If
+// minimum is true the replicas are only set if the Rollout has fewer replicas, returns if the Rollout was scaled
+func (r *CustomPodAutoscalerReconciler) scaleArgoRollout(context context.Context, reqLogger logr.Logger, namespace string, gv schema.GroupVersion, name string, replicas int32, minimum bool) (scaled bool, err error) {
+	context, span := r.tracer().Start(context, "ScaleArgoRollout", trace.WithAttributes(
+		kindAttribute.String(argoRolloutKind),
+		nameAttribute.String(name),
+	))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	kind := gv.String() + "/" + argoRolloutKind
+	rollouts := r.DynamicClient.Resource(gv.WithResource(argoRolloutsResource)).Namespace(namespace)
+	return r.scaleSubresource(context, reqLogger, rollouts, kind, namespace, name, replicas, minimum)
 }
 
-// createEnvVarsFromConfig converts CPA config to environment variables
-func createEnvVarsFromConfig(configs []custompodautoscalercomv1.CustomPodAutoscalerConfig) []corev1.EnvVar {
-	envVars := []corev1.EnvVar{}
-	for _, config := range configs {
-		envVars = append(envVars, corev1.EnvVar{
-			Name:  config.Name,
-			Value: config.Value,
-		})
+// argoRolloutAborted returns if the update of the Argo Rollout has been aborted
+func (r *CustomPodAutoscalerReconciler) argoRolloutAborted(ctx context.Context, namespace string, gv schema.GroupVersion, name string) (bool, error) {
+	rollout, err := r.DynamicClient.Resource(gv.WithResource(argoRolloutsResource)).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
 	}
-	return envVars
-}
 
-// SetupWithManager sets up the CustomPodAutoscaler controller, setting up watches with the
-// manager provided
-func (r *CustomPodAutoscalerReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&custompodautoscalercomv1.CustomPodAutoscaler{}).
-		WithEventFilter(PrimaryPred).
-		Owns(&corev1.Pod{}, builder.WithPredicates(SecondaryPred)).
-		Owns(&corev1.ServiceAccount{}, builder.WithPredicates(SecondaryPred)).
-		Owns(&rbacv1.Role{}, builder.WithPredicates(SecondaryPred)).
-		Owns(&rbacv1.RoleBinding{}, builder.WithPredicates(SecondaryPred)).
-		Complete(r)
+	aborted, _, err := unstructured.NestedBool(rollout.Object, "status", "abort")
+	if err != nil {
+		return false, err
+	}
+	return aborted, nil
 }
 
-// SetupScalingClient sets up a client for the CPA reconciler to use for manually
-// setting the replicas count of a scale target pod while the autoscaler is paused.
-// Functionality is based on the setup for a regular CPA autoscaler in main()
-func SetupScalingClient() (k8sscale.ScalesGetter, error) {
-
-	// InClusterConfig returns a config object which uses the service account
-	// kubernetes gives to pods. It's intended for clients that expect to be
-	// running inside a pod running on kubernetes. It will return ErrNotInCluster
-	// if called from a process not running in a kubernetes environment.
-	// https://github.com/kubernetes/client-go/blob/master/rest/config.go
-	clusterConfig, err := rest.InClusterConfig()
+// pauseScaleTarget deletes the autoscaler Pods and sets the replica count of the scale target to the paused replicas
+// count provided, if minimum is true the replica count is only set if the current replica count is lower
+func (r *CustomPodAutoscalerReconciler) pauseScaleTarget(context context.Context, reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler, pausedReplicasCount string, minimum bool) (reconcile.Result, error) {
+	// Get paused replicas count from annotation metadata
+	pausedReplicasCountInt64, err := strconv.ParseInt(pausedReplicasCount, 10, 32)
+	pausedReplicasCountInt32 := int32(pausedReplicasCountInt64)
 	if err != nil {
-		return nil, err
+		return reconcile.Result{}, err
 	}
 
-	// NewForConfig creates a new ScalesGetter which resolves kinds
-	// to resources using the given RESTMapper, and API paths using
-	// the given dynamic.APIPathResolverFunc.
-	// https://github.com/kubernetes/client-go/blob/master/scale/client.go
-	clientset, err := kubernetes.NewForConfig(clusterConfig)
-	if err != nil {
-		return nil, err
+	// Use the reconciler client to delete the pod that normally does the scaling
+	// This should be done first so the autoscaler does not override
+	// the scaling changes made by the operator
+	if err := r.deleteAutoscalerPods(context, instance); err != nil {
+		return reconcile.Result{}, err
 	}
 
-	// GetAPIGroupResources uses the provided discovery client to gather
-	// discovery information and populate a slice of APIGroupResources
-	// APIGroupResources{Group metav1.APIGroup, VersionedResources map[string][]metav1.APIResource}
-	// https://github.com/kubernetes/client-go/blob/master/restmapper/discovery.go
-	groupResources, err := restmapper.GetAPIGroupResources(clientset.Discovery())
+	// scaleTargetRef is the pod or service that is being autoscaled
+	// ScaleTargetRef{} = CrossVersionObjectReference{Kind string, Name string, APIVersion string}
+	// https://github.com/kubernetes/api/blob/v0.27.4/autoscaling/v1/types.go
+	scaleTargetRef := instance.Spec.ScaleTargetRef
+
+	// ex. ParseGroupVersion("custompodautoscaler.com/v1")
+	//     = GroupVersion{Group: "custompodautoscaler.com", Version: "v1"}
+	// https://github.com/kubernetes/apimachinery/blob/v0.27.3/pkg/runtime/schema/group_version.go
+	resourceGV, err := schema.ParseGroupVersion(scaleTargetRef.APIVersion)
 	if err != nil {
-		return nil, err
+		return reconcile.Result{}, err
 	}
 
-	// Set up a client for scaling
-	// https://github.com/kubernetes/client-go/blob/master/scale/client.go
-	scaleClient := k8sscale.New(
-		clientset.RESTClient(),
-		restmapper.NewDiscoveryRESTMapper(groupResources),
-		dynamic.LegacyAPIPathResolverFunc,
-		k8sscale.NewDiscoveryScaleKindResolver(
-			clientset.Discovery(),
-		),
-	)
-
-	return scaleClient, err
+	// Scaling a StatefulSet during a rolling update can conflict with the StatefulSet controller, so if enabled the
+	// paused replicas are only set once the update has completed
+	if instance.Spec.WaitForTargetUpdate != nil && *instance.Spec.WaitForTargetUpdate &&
+		resourceGV.Group == appsv1.GroupName && scaleTargetRef.Kind == statefulSetKind {
+		updating, err := r.checkStatefulSetUpdating(context, instance)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if updating {
+			reqLogger.Info("StatefulSet update in progress, waiting to set paused replicas", "Kind", scaleTargetRef.Kind, "Namespace", instance.Namespace, "Name", scaleTargetRef.Name, "RequeueAfter", targetUpdatingRequeueDelay)
+			return reconcile.Result{RequeueAfter: targetUpdatingRequeueDelay}, nil
+		}
+	}
+
+	// Argo Rollouts are scaled through the dynamic client using the scale subresource
+	if resourceGV.Group == argoRolloutsGroup && scaleTargetRef.Kind == argoRolloutKind {
+		// An aborted Rollout is waiting for its update to be retried or rolled back, scaling it would only resize the
+		// stable ReplicaSet while the abort is being dealt with, so the paused replicas are set once the abort is cleared
+		aborted, err := r.argoRolloutAborted(context, instance.Namespace, resourceGV, scaleTargetRef.Name)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if aborted {
+			reqLogger.Info("Rollout is aborted, waiting to set paused replicas", "Kind", scaleTargetRef.Kind, "Namespace", instance.Namespace, "Name", scaleTargetRef.Name, "RequeueAfter", targetUpdatingRequeueDelay)
+			if r.Recorder != nil {
+				r.Recorder.Eventf(instance, corev1.EventTypeWarning, rolloutAbortedReason,
+					"Rollout %s is aborted, paused replicas are set once the abort is cleared", scaleTargetRef.Name)
+			}
+			return reconcile.Result{RequeueAfter: targetUpdatingRequeueDelay}, nil
+		}
+
+		scaled, err := r.scaleArgoRollout(context, reqLogger, instance.Namespace, resourceGV, scaleTargetRef.Name, pausedReplicasCountInt32, minimum)
+		if scaled || err != nil {
+			r.AuditLogger.Record(instance, audit.ActionScale, scaleTargetRef.APIVersion+"/"+scaleTargetRef.Kind, scaleTargetRef.Name, err)
+		}
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+
+		return r.setScaleTargetPaused(context, instance, true)
+	}
+
+	// Other custom resources are resolved through discovery and scaled through the dynamic client, so any custom
+	// resource implementing the scale subresource can be paused, including those installed after the operator started
+	if r.customResourceTarget(resourceGV) {
+		scaled, err := r.scaleCustomResource(context, reqLogger, instance, resourceGV, pausedReplicasCountInt32, minimum)
+		if scaled || err != nil {
+			r.AuditLogger.Record(instance, audit.ActionScale, scaleTargetRef.APIVersion+"/"+scaleTargetRef.Kind, scaleTargetRef.Name, err)
+		}
+
+		result := reconcile.Result{}
+		if err == nil {
+			// The replicas of a scale target without the scale subresource are not set by the operator, so it is not
+			// marked as paused
+			if meta.IsStatusConditionTrue(instance.Status.Conditions, custompodautoscalercomv1.ConditionTargetNotScalable) {
+				return reconcile.Result{}, nil
+			}
+			result, err = r.setScaleTargetPaused(context, instance, true)
+		}
+
+		// The operator RBAC only grants access to built in scale targets by default, so report if it has not been
+		// extended to grant access to the custom resource
+		statusErr := r.checkTargetForbidden(context, instance, err)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		return result, statusErr
+	}
+
+	targetGR := schema.GroupResource{
+		Group:    resourceGV.Group,    // ex. "custompodautoscaler.com"
+		Resource: scaleTargetRef.Kind, // ex. "CustomPodAutoscaler"
+	}
+
+	// Get the scale request for a resource (https://github.com/kubernetes/api/blob/v0.27.4/autoscaling/v1/types.go)
+	// https://github.com/kubernetes/client-go/blob/master/scale/client.go
+	_, getSpan := r.tracer().Start(context, "GetScale", trace.WithAttributes(
+		kindAttribute.String(scaleTargetRef.Kind),
+		nameAttribute.String(scaleTargetRef.Name),
+	))
+	scaleResource, err := r.ScalingClient.Scales(instance.Namespace).Get(context, targetGR, scaleTargetRef.Name, metav1.GetOptions{})
+	endSpan(getSpan, err)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if minimum && scaleResource.Spec.Replicas >= pausedReplicasCountInt32 {
+		reqLogger.Info("Scale target replicas at or above paused minimum replicas, leaving unchanged", "Kind", scaleTargetRef.Kind, "Namespace", instance.Namespace, "Name", scaleTargetRef.Name, "Replicas", scaleResource.Spec.Replicas)
+		return r.setScaleTargetPaused(context, instance, true)
+	}
+
+	// Set new target replicas
+	scaleResource.Spec.Replicas = pausedReplicasCountInt32
+
+	// Update the resource with new replica count
+	// https://github.com/kubernetes/client-go/blob/master/scale/client.go
+	_, updateSpan := r.tracer().Start(context, "UpdateScale", trace.WithAttributes(
+		kindAttribute.String(scaleTargetRef.Kind),
+		nameAttribute.String(scaleTargetRef.Name),
+	))
+	_, err = r.ScalingClient.Scales(instance.Namespace).Update(context, targetGR, scaleResource, metav1.UpdateOptions{
+		FieldManager: r.FieldManager,
+	})
+	endSpan(updateSpan, err)
+	r.AuditLogger.Record(instance, audit.ActionScale, scaleTargetRef.APIVersion+"/"+scaleTargetRef.Kind, scaleTargetRef.Name, err)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	return r.setScaleTargetPaused(context, instance, true)
+}
+
+// checkStatefulSetUpdating checks if the StatefulSet scale target has a rolling update in progress, reporting it in
+// the TargetUpdating condition
+func (r *CustomPodAutoscalerReconciler) checkStatefulSetUpdating(ctx context.Context, instance *custompodautoscalercomv1.CustomPodAutoscaler) (bool, error) {
+	statefulSet := &appsv1.StatefulSet{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: instance.Spec.ScaleTargetRef.Name, Namespace: instance.Namespace}, statefulSet)
+	if err != nil {
+		return false, err
+	}
+
+	updating := statefulSetUpdating(statefulSet)
+	condition := metav1.Condition{
+		Type:               custompodautoscalercomv1.ConditionTargetUpdating,
+		Status:             metav1.ConditionFalse,
+		Reason:             "TargetNotUpdating",
+		Message:            fmt.Sprintf("StatefulSet %s has no update in progress", statefulSet.Name),
+		ObservedGeneration: instance.Generation,
+	}
+	if updating {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "StatefulSetUpdating"
+		condition.Message = fmt.Sprintf("StatefulSet %s has an update in progress from revision %s to %s, waiting to "+
+			"set paused replicas", statefulSet.Name, statefulSet.Status.CurrentRevision, statefulSet.Status.UpdateRevision)
+	}
+
+	if meta.SetStatusCondition(&instance.Status.Conditions, condition) {
+		err = r.Client.Status().Update(ctx, instance)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return updating, nil
+}
+
+// statefulSetUpdating returns if a rolling update of the StatefulSet is in progress, either not yet observed by the
+// StatefulSet controller or with Pods not yet updated to the update revision. A partitioned update is in progress
+// until every Pod has been updated, including the Pods held at the current revision by the partition
+func statefulSetUpdating(statefulSet *appsv1.StatefulSet) bool {
+	if statefulSet.Status.ObservedGeneration < statefulSet.Generation {
+		return true
+	}
+	return statefulSet.Status.UpdateRevision != "" && statefulSet.Status.CurrentRevision != statefulSet.Status.UpdateRevision
+}
+
+// deleteAutoscalerPods deletes the Pods provisioned for the CustomPodAutoscaler
+func (r *CustomPodAutoscalerReconciler) deleteAutoscalerPods(ctx context.Context, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+	pods := &corev1.PodList{}
+	err := r.Client.List(ctx, pods,
+		client.MatchingLabels{OwnedByLabel: instance.Name},
+		client.InNamespace(instance.Namespace))
+	if err != nil {
+		return err
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !metav1.IsControlledBy(pod, instance) {
+			continue
+		}
+
+		err = r.Client.Delete(ctx, pod)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		r.AuditLogger.Record(instance, audit.ActionDelete, "v1/Pod", pod.Name, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// clock returns the clock used by the reconciler, falling back to the real clock if none is set
+func (r *CustomPodAutoscalerReconciler) clock() clock.PassiveClock {
+	if r.Clock == nil {
+		return clock.RealClock{}
+	}
+	return r.Clock
+}
+
+// fullReconcileRemaining returns how long until the next full reconcile is due if the provisioned resources are
+// unchanged since the last full reconcile, all exist, and the Pod is ready, otherwise zero
+func (r *CustomPodAutoscalerReconciler) fullReconcileRemaining(ctx context.Context, instance *custompodautoscalercomv1.CustomPodAutoscaler, plan *ProvisioningPlan, planHash string) (time.Duration, error) {
+	if r.FullReconcileInterval <= 0 || instance.Status.LastFullReconcileTime == nil || instance.Status.PlanHash != planHash {
+		return 0, nil
+	}
+
+	remaining := instance.Status.LastFullReconcileTime.Add(r.FullReconcileInterval).Sub(r.clock().Now())
+	if remaining <= 0 {
+		return 0, nil
+	}
+
+	// Only resources the operator provisions need to exist
+	expected := []client.Object{}
+	if plan.ProvisionServiceAccount {
+		expected = append(expected, plan.ServiceAccount)
+		if plan.ProvisionRole {
+			expected = append(expected, plan.Role)
+		}
+		if plan.ProvisionRoleBinding {
+			expected = append(expected, plan.RoleBinding)
+		}
+	}
+	if plan.ConfigMap != nil {
+		expected = append(expected, plan.ConfigMap)
+	}
+	if plan.Secret != nil {
+		expected = append(expected, plan.Secret)
+	}
+	if plan.NetworkPolicy != nil {
+		expected = append(expected, plan.NetworkPolicy)
+	}
+	// The Service and ServiceMonitor are only provisioned if the Prometheus Operator CRDs are installed
+	serviceMonitor := plan.ServiceMonitor != nil && r.ServiceMonitorServed
+	if serviceMonitor {
+		expected = append(expected, plan.Service)
+	}
+	if plan.ProvisionPod {
+		// A generated Pod name is only known once the Pod has been created
+		if plan.Pod.Name == "" {
+			return 0, nil
+		}
+		expected = append(expected, plan.Pod)
+	}
+
+	for _, planned := range expected {
+		existing := planned.DeepCopyObject().(client.Object)
+		err := r.Client.Get(ctx, client.ObjectKeyFromObject(planned), existing)
+		if errors.IsNotFound(err) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if existing.GetDeletionTimestamp() != nil {
+			return 0, nil
+		}
+		if pod, ok := existing.(*corev1.Pod); ok && !podReady(pod) {
+			return 0, nil
+		}
+	}
+
+	// The ServiceMonitor is provisioned through the dynamic client, as its type is not known to the operator
+	if serviceMonitor {
+		serviceMonitors := r.DynamicClient.Resource(serviceMonitorGroupVersion.WithResource(serviceMonitorsResource)).Namespace(plan.ServiceMonitor.GetNamespace())
+		existing, err := serviceMonitors.Get(ctx, plan.ServiceMonitor.GetName(), metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if existing.GetDeletionTimestamp() != nil {
+			return 0, nil
+		}
+	}
+
+	return remaining, nil
+}
+
+// podReady returns if the Pod has the Ready condition
+func podReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// updateStatus updates the status of the CPA. The instance has had defaults applied while planning, so a copy is
+// updated so the response does not overwrite them
+func (r *CustomPodAutoscalerReconciler) updateStatus(ctx context.Context, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+	updated := instance.DeepCopy()
+	err := r.Client.Status().Update(ctx, updated)
+	if err != nil {
+		return err
+	}
+	instance.ResourceVersion = updated.ResourceVersion
+	return nil
+}
+
+// updateChangedStatus updates the status of the CPA only if it has changed from the original status
+func (r *CustomPodAutoscalerReconciler) updateChangedStatus(ctx context.Context, instance *custompodautoscalercomv1.CustomPodAutoscaler, original *custompodautoscalercomv1.CustomPodAutoscalerStatus) error {
+	if apiequality.Semantic.DeepEqual(original, &instance.Status) {
+		return nil
+	}
+	return r.updateStatus(ctx, instance)
+}
+
+// checkEnvVarsSize sets the LargeEnvVars condition of the CPA, recording a warning event if the environment variables
+// of any container in the Pod have become larger than the size threshold
+func (r *CustomPodAutoscalerReconciler) checkEnvVarsSize(instance *custompodautoscalercomv1.CustomPodAutoscaler, pod *corev1.Pod) {
+	if r.EnvVarsSizeThreshold <= 0 {
+		return
+	}
+
+	largestContainer, largestSize := "", 0
+	for _, container := range pod.Spec.Containers {
+		size := envVarsSize(container.Env)
+		if size > largestSize {
+			largestContainer, largestSize = container.Name, size
+		}
+	}
+
+	condition := metav1.Condition{
+		Type:               custompodautoscalercomv1.ConditionLargeEnvVars,
+		Status:             metav1.ConditionFalse,
+		Reason:             "EnvVarsWithinThreshold",
+		Message:            fmt.Sprintf("Environment variables are within the %d byte threshold", r.EnvVarsSizeThreshold),
+		ObservedGeneration: instance.Generation,
+	}
+	if largestSize > r.EnvVarsSizeThreshold {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "EnvVarsExceedThreshold"
+		condition.Message = fmt.Sprintf("Environment variables of container %s are %d bytes, exceeding the %d byte "+
+			"threshold, provide large configuration using configFiles instead", largestContainer, largestSize,
+			r.EnvVarsSizeThreshold)
+	}
+
+	if meta.SetStatusCondition(&instance.Status.Conditions, condition) && condition.Status == metav1.ConditionTrue && r.Recorder != nil {
+		r.Recorder.Event(instance, corev1.EventTypeWarning, custompodautoscalercomv1.ConditionLargeEnvVars, condition.Message)
+	}
+}
+
+// envVarsSize returns the size in bytes of the names and values of the environment variables
+func envVarsSize(envVars []corev1.EnvVar) int {
+	size := 0
+	for _, envVar := range envVars {
+		size += len(envVar.Name) + len(envVar.Value)
+	}
+	return size
+}
+
+// requiredLabels returns the values of the labels required by the operator that are set on the CPA, and the keys of
+// any required labels that are missing
+func (r *CustomPodAutoscalerReconciler) requiredLabels(instance *custompodautoscalercomv1.CustomPodAutoscaler) (map[string]string, []string) {
+	labels := map[string]string{}
+	missing := []string{}
+	for _, key := range r.RequiredLabels {
+		value, exists := instance.GetLabels()[key]
+		if !exists {
+			missing = append(missing, key)
+			continue
+		}
+		labels[key] = value
+	}
+	return labels, missing
+}
+
+// setScaleTargetPaused sets the managed pause annotation on the scale target while autoscaling is paused, so other
+// tools know the replicas were set by the operator, and removes it once autoscaling is resumed. Whether the scale
+// target is paused is tracked in the status so the annotation is only removed once
+func (r *CustomPodAutoscalerReconciler) setScaleTargetPaused(ctx context.Context, instance *custompodautoscalercomv1.CustomPodAutoscaler, paused bool) (reconcile.Result, error) {
+	scaleTargetRef := instance.Spec.ScaleTargetRef
+
+	target := &unstructured.Unstructured{}
+	target.SetAPIVersion(scaleTargetRef.APIVersion)
+	target.SetKind(scaleTargetRef.Kind)
+	err := r.Client.Get(ctx, types.NamespacedName{Name: scaleTargetRef.Name, Namespace: instance.Namespace}, target)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return reconcile.Result{}, err
+		}
+		// Scale target no longer exists, nothing to annotate or clean up, so it is not tracked as paused
+		paused = false
+	} else {
+		_, annotated := target.GetAnnotations()[ManagedPauseAnnotation]
+		if annotated != paused {
+			// Setting the annotation to null in a merge patch removes it
+			var value interface{}
+			if paused {
+				value = "true"
+			}
+			patch, err := json.Marshal(map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]interface{}{
+						ManagedPauseAnnotation: value,
+					},
+				},
+			})
+			if err != nil {
+				// Should not occur, panic
+				panic(err)
+			}
+
+			err = r.Client.Patch(ctx, target, client.RawPatch(types.MergePatchType, patch), client.FieldOwner(r.FieldManager))
+			r.AuditLogger.Record(instance, audit.ActionAnnotate, scaleTargetRef.APIVersion+"/"+scaleTargetRef.Kind, scaleTargetRef.Name, err)
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+		}
+	}
+
+	if instance.Status.ScaleTargetPaused != paused {
+		instance.Status.ScaleTargetPaused = paused
+		err = r.Client.Status().Update(ctx, instance)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// scaleTargetSelector returns the selector of the Pods managed by the scale target, read from the scale subresource of
+// the scale target. Returns nil if the scale target does not exist yet or does not report a selector
+func (r *CustomPodAutoscalerReconciler) scaleTargetSelector(ctx context.Context, reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) (*metav1.LabelSelector, error) {
+	scaleTargetRef := instance.Spec.ScaleTargetRef
+	resourceGV, err := schema.ParseGroupVersion(scaleTargetRef.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	targetGR := schema.GroupResource{
+		Group:    resourceGV.Group,
+		Resource: scaleTargetRef.Kind,
+	}
+
+	_, getSpan := r.tracer().Start(ctx, "GetScale", trace.WithAttributes(
+		kindAttribute.String(scaleTargetRef.Kind),
+		nameAttribute.String(scaleTargetRef.Name),
+	))
+	scaleResource, err := r.ScalingClient.Scales(instance.Namespace).Get(ctx, targetGR, scaleTargetRef.Name, metav1.GetOptions{})
+	endSpan(getSpan, err)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			reqLogger.Info("Scale target not found, skipping anti-affinity with the scale target", "Kind", scaleTargetRef.Kind, "Namespace", instance.Namespace, "Name", scaleTargetRef.Name)
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if scaleResource.Status.Selector == "" {
+		reqLogger.Info("Scale target does not report a selector, skipping anti-affinity with the scale target", "Kind", scaleTargetRef.Kind, "Namespace", instance.Namespace, "Name", scaleTargetRef.Name)
+		return nil, nil
+	}
+
+	selector, err := metav1.ParseToLabelSelector(scaleResource.Status.Selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(selector.MatchExpressions) == 0 {
+		selector.MatchExpressions = nil
+	}
+	return selector, nil
+}
+
+// scaleTargetVersion returns the resourceVersion of the scale target, read from the scale subresource of the scale
+// target. Returns an empty version if the scale target does not exist
+func (r *CustomPodAutoscalerReconciler) scaleTargetVersion(ctx context.Context, instance *custompodautoscalercomv1.CustomPodAutoscaler) (string, error) {
+	scaleTargetRef := instance.Spec.ScaleTargetRef
+	resourceGV, err := schema.ParseGroupVersion(scaleTargetRef.APIVersion)
+	if err != nil {
+		return "", err
+	}
+
+	targetGR := schema.GroupResource{
+		Group:    resourceGV.Group,
+		Resource: scaleTargetRef.Kind,
+	}
+
+	_, getSpan := r.tracer().Start(ctx, "GetScale", trace.WithAttributes(
+		kindAttribute.String(scaleTargetRef.Kind),
+		nameAttribute.String(scaleTargetRef.Name),
+	))
+	scaleResource, err := r.ScalingClient.Scales(instance.Namespace).Get(ctx, targetGR, scaleTargetRef.Name, metav1.GetOptions{})
+	endSpan(getSpan, err)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return scaleResource.ResourceVersion, nil
+}
+
+// provisioningPlan returns the plan of the resources to provision for the CPA with the configuration of the operator
+// applied, such as the required labels, default annotations, proxy env vars, security profile and resource ceiling.
+// The plan served by the debug endpoint is built the same way so it matches what is provisioned. Returns the resources
+// of the autoscaler container that were above the resource ceiling, which have been lowered to the ceiling unless the
+// ceiling is enforced by rejecting the CPA
+func (r *CustomPodAutoscalerReconciler) provisioningPlan(ctx context.Context, reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) (*ProvisioningPlan, []string, error) {
+	applyConfigOverlay(instance, r.Environment)
+	plan, err := newProvisioningPlan(instance)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(plan.IgnoredFeatureGates) > 0 {
+		reqLogger.Info("Ignoring unknown feature gates", "Kind", "custompodautoscaler.com/v1/CustomPodAutoscaler", "Namespace", instance.GetNamespace(), "Name", instance.GetName(), "FeatureGates", plan.IgnoredFeatureGates)
+	}
+
+	requiredLabels, _ := r.requiredLabels(instance)
+	plan.addLabels(requiredLabels)
+	plan.addDefaultAnnotations(r.DefaultAnnotations)
+	plan.addPodLabels(r.PodDiscoveryLabels)
+	plan.addProxyEnvVars(r.ProxyEnvVars)
+	if len(r.NamespaceSecurityProfiles) > 0 {
+		profile, err := r.namespaceSecurityProfile(ctx, instance.Namespace)
+		if err != nil {
+			return nil, nil, err
+		}
+		plan.addSecurityProfile(profile)
+	}
+	if r.ScaleTargetRoleRules {
+		err = plan.addScaleTargetRules(instance)
+		if err != nil {
+			return nil, nil, errors.NewBadRequest(err.Error())
+		}
+	}
+	if instance.Spec.ScaleTargetAntiAffinity != nil && *instance.Spec.ScaleTargetAntiAffinity {
+		selector, err := r.scaleTargetSelector(ctx, reqLogger, instance)
+		if err != nil {
+			return nil, nil, err
+		}
+		if selector != nil {
+			plan.addScaleTargetAntiAffinity(selector)
+		}
+	}
+
+	var exceeded []string
+	if len(r.ResourceCeiling) > 0 {
+		exceeded = resourcesAboveCeiling(plan.Pod, r.ResourceCeiling)
+		if len(exceeded) > 0 && r.ResourceCeilingMode != ResourceCeilingModeReject {
+			plan.clampResources(r.ResourceCeiling)
+		}
+	}
+
+	return plan, exceeded, nil
+}
+
+// podMissing returns if the Pod does not exist
+func (r *CustomPodAutoscalerReconciler) podMissing(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	err := r.Client.Get(ctx, types.NamespacedName{Name: pod.Name, Namespace: pod.Namespace}, &corev1.Pod{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// markPaused records that autoscaling of the CPA is paused, tracking when the pause started in the status
+func (r *CustomPodAutoscalerReconciler) markPaused(ctx context.Context, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+	r.PauseMetrics.Paused(types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace})
+
+	if instance.Status.PausedSince != nil {
+		return nil
+	}
+
+	now := metav1.NewTime(r.clock().Now())
+	instance.Status.PausedSince = &now
+	return r.Client.Status().Update(ctx, instance)
+}
+
+// markResumed records that autoscaling of the CPA is not paused, if the CPA was paused the pause duration is reported
+// and the pause start time is cleared from the status
+func (r *CustomPodAutoscalerReconciler) markResumed(ctx context.Context, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+	cpa := types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}
+	if instance.Status.PausedSince == nil {
+		r.PauseMetrics.Remove(cpa)
+		return nil
+	}
+
+	r.PauseMetrics.Resumed(cpa, r.clock().Now().Sub(instance.Status.PausedSince.Time))
+	instance.Status.PausedSince = nil
+	return r.Client.Status().Update(ctx, instance)
+}
+
+// podRecreateCooldown checks if reconciling the Pod will recreate an existing Pod, returning the time remaining in the
+// Pod recreate cooldown if the Pod was last recreated within the cooldown. The cooldown is only applied if set in the
+// CustomPodAutoscaler spec
+func (r *CustomPodAutoscalerReconciler) podRecreateCooldown(ctx context.Context, instance *custompodautoscalercomv1.CustomPodAutoscaler, pod *corev1.Pod) (time.Duration, bool, error) {
+	if instance.Spec.PodRecreateCooldownSeconds == nil || !*instance.Spec.ProvisionPod || pod.Name == "" {
+		return 0, false, nil
+	}
+
+	existingPod := &corev1.Pod{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: pod.Name, Namespace: pod.Namespace}, existingPod)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// No existing Pod to recreate
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	if !existingPod.DeletionTimestamp.IsZero() {
+		// Pod already being deleted, will not be recreated by this reconcile
+		return 0, false, nil
+	}
+
+	if existingPod.Annotations[PodSpecHashAnnotation] == pod.Annotations[PodSpecHashAnnotation] {
+		// Pod has not changed, will not be recreated by this reconcile
+		return 0, false, nil
+	}
+
+	if instance.Status.LastPodRecreateTime != nil {
+		cooldown := time.Duration(*instance.Spec.PodRecreateCooldownSeconds) * time.Second
+		remaining := instance.Status.LastPodRecreateTime.Add(cooldown).Sub(r.clock().Now())
+		if remaining > 0 {
+			return remaining, false, nil
+		}
+	}
+
+	return 0, true, nil
+}
+
+// trackReconcileFailures counts the consecutive failed reconciles of the CPA, once the count reaches the maximum the
+// CPA is parked with the Parked condition and no longer requeued until its spec changes. A successful reconcile resets
+// the count
+func (r *CustomPodAutoscalerReconciler) trackReconcileFailures(ctx context.Context, req ctrl.Request, result ctrl.Result, reconcileErr error) (ctrl.Result, error) {
+	if _, parked := reconcileErr.(*provisionParkedError); parked {
+		// Parked after repeatedly failing to provision a resource, stop requeuing until the spec changes
+		return reconcile.Result{}, nil
+	}
+
+	if r.MaxReconcileFailures <= 0 {
+		return result, reconcileErr
+	}
+
+	reqLogger := r.ReconcileLogs.Logger(r.Log, req.NamespacedName).WithValues("Request", req.NamespacedName)
+
+	instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+	err := r.Client.Get(ctx, req.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) || reconcileErr != nil {
+			return result, reconcileErr
+		}
+		return result, err
+	}
+
+	if reconcileErr == nil {
+		parked := meta.IsStatusConditionTrue(instance.Status.Conditions, custompodautoscalercomv1.ConditionParked)
+		if instance.Status.ReconcileFailures == 0 || parked {
+			return result, nil
+		}
+		instance.Status.ReconcileFailures = 0
+		return result, r.Client.Status().Update(ctx, instance)
+	}
+
+	instance.Status.ReconcileFailures++
+	if int(instance.Status.ReconcileFailures) < r.MaxReconcileFailures {
+		err = r.Client.Status().Update(ctx, instance)
+		if err != nil {
+			reqLogger.Error(err, "Failed to update reconcile failure count", "Kind", "custompodautoscaler.com/v1/CustomPodAutoscaler", "Namespace", instance.GetNamespace(), "Name", instance.GetName())
+		}
+		return result, reconcileErr
+	}
+
+	condition := metav1.Condition{
+		Type:   custompodautoscalercomv1.ConditionParked,
+		Status: metav1.ConditionTrue,
+		Reason: "ReconcileFailing",
+		Message: fmt.Sprintf("Reconcile failed %d consecutive times, parked until the spec changes, last error: %s",
+			instance.Status.ReconcileFailures, reconcileErr),
+		ObservedGeneration: instance.Generation,
+	}
+	meta.SetStatusCondition(&instance.Status.Conditions, condition)
+	err = r.Client.Status().Update(ctx, instance)
+	if err != nil {
+		// Not parked, so the failed reconcile is retried
+		reqLogger.Error(err, "Failed to park Custom Pod Autoscaler", "Kind", "custompodautoscaler.com/v1/CustomPodAutoscaler", "Namespace", instance.GetNamespace(), "Name", instance.GetName())
+		return result, reconcileErr
+	}
+
+	reqLogger.Error(reconcileErr, "Custom Pod Autoscaler parked after repeated reconcile failures", "Kind", "custompodautoscaler.com/v1/CustomPodAutoscaler", "Namespace", instance.GetNamespace(), "Name", instance.GetName(), "Failures", instance.Status.ReconcileFailures)
+	if r.Recorder != nil {
+		r.Recorder.Event(instance, corev1.EventTypeWarning, custompodautoscalercomv1.ConditionParked, condition.Message)
+	}
+
+	// Parked, stop requeuing until the spec changes
+	return reconcile.Result{}, nil
+}
+
+// reconcileResource reconciles a secondary resource of the CustomPodAutoscaler, tracing it as a child span of the
+// reconcile. Resources are reconciled in dependency order (ServiceAccount, Role, RoleBinding, ConfigMap, Secret then
+// Pod), so if the resource fails it is reported in the ResourcesProvisioned condition as the dependency that stopped
+// the remaining resources from being reconciled
+func (r *CustomPodAutoscalerReconciler) reconcileResource(
+	ctx context.Context,
+	reqLogger logr.Logger,
+	instance *custompodautoscalercomv1.CustomPodAutoscaler,
+	obj metav1.Object,
+	shouldProvision bool,
+	updatable bool,
+	kind string,
+) (reconcile.Result, error) {
+	_, span := r.tracer().Start(ctx, "ReconcileResource", trace.WithAttributes(
+		kindAttribute.String(kind),
+		nameAttribute.String(obj.GetName()),
+	))
+	result, err := r.KubernetesResourceReconciler.Reconcile(reqLogger, instance, obj, shouldProvision, updatable, kind)
+	endSpan(span, err)
+	if err != nil {
+		parked := r.reportResourceFailed(ctx, reqLogger, instance, obj, kind, err)
+		if parked {
+			return result, &provisionParkedError{err: err}
+		}
+	}
+	return result, err
+}
+
+// provisionParkedError is returned when a resource fails to provision and the CPA has been parked as a result, so the
+// failed reconcile is not retried until the spec changes
+type provisionParkedError struct {
+	err error
+}
+
+func (e *provisionParkedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *provisionParkedError) Unwrap() error {
+	return e.err
+}
+
+// reportResourceFailed sets the ResourcesProvisioned condition to false naming the resource that failed to reconcile,
+// failing to update the status is logged so the reconcile error is still returned. If the CPA limits provisioning
+// retries the consecutive failures of the resource are counted, once the limit is reached the CPA is parked with the
+// Parked condition and true is returned
+func (r *CustomPodAutoscalerReconciler) reportResourceFailed(
+	ctx context.Context,
+	reqLogger logr.Logger,
+	instance *custompodautoscalercomv1.CustomPodAutoscaler,
+	obj metav1.Object,
+	kind string,
+	reconcileErr error,
+) bool {
+	// The reason is the kind without the group and version, for example ServiceAccountFailed
+	resourceKind := kind[strings.LastIndex(kind, "/")+1:]
+	condition := metav1.Condition{
+		Type:   custompodautoscalercomv1.ConditionResourcesProvisioned,
+		Status: metav1.ConditionFalse,
+		Reason: resourceKind + "Failed",
+		Message: fmt.Sprintf("Failed to reconcile %s %s, resources depending on it were not reconciled: %s", kind,
+			obj.GetName(), reconcileErr),
+		ObservedGeneration: instance.Generation,
+	}
+	changed := meta.SetStatusCondition(&instance.Status.Conditions, condition)
+
+	var parked *metav1.Condition
+	if instance.Spec.MaxProvisionRetries != nil {
+		// Resources are provisioned in order and stop at the first failure, so only the failing resource is counted
+		failures := instance.Status.ProvisionFailures[kind] + 1
+		instance.Status.ProvisionFailures = map[string]int32{kind: failures}
+		changed = true
+
+		if failures >= *instance.Spec.MaxProvisionRetries {
+			parked = &metav1.Condition{
+				Type:   custompodautoscalercomv1.ConditionParked,
+				Status: metav1.ConditionTrue,
+				Reason: "ProvisionFailing",
+				Message: fmt.Sprintf("Failed to provision %s %s %d consecutive times, parked until the spec changes, last "+
+					"error: %s", kind, obj.GetName(), failures, reconcileErr),
+				ObservedGeneration: instance.Generation,
+			}
+			meta.SetStatusCondition(&instance.Status.Conditions, *parked)
+		}
+	}
+
+	if !changed {
+		return false
+	}
+
+	err := r.updateStatus(ctx, instance)
+	if err != nil {
+		// Not parked, so the failed reconcile is retried
+		reqLogger.Error(err, "Failed to report failed resource", "Kind", "custompodautoscaler.com/v1/CustomPodAutoscaler", "Namespace", instance.GetNamespace(), "Name", instance.GetName())
+		return false
+	}
+
+	if parked == nil {
+		return false
+	}
+
+	reqLogger.Error(reconcileErr, "Custom Pod Autoscaler parked after repeatedly failing to provision a resource", "Kind", kind, "Namespace", obj.GetNamespace(), "Name", obj.GetName(), "Failures", instance.Status.ProvisionFailures[kind])
+	if r.Recorder != nil {
+		r.Recorder.Event(instance, corev1.EventTypeWarning, custompodautoscalercomv1.ConditionParked, parked.Message)
+	}
+	return true
+}
+
+// cpaEnvVars builds a list of environment variables from the Spec
+func cpaEnvVars(cr *custompodautoscalercomv1.CustomPodAutoscaler, scaleTargetRef string) ([]corev1.EnvVar, error) {
+	envVars := []corev1.EnvVar{
+		{
+			Name:  "scaleTargetRef",
+			Value: scaleTargetRef,
+		},
+		{
+			Name:  "namespace",
+			Value: cr.Namespace,
+		},
+	}
+	if cr.Spec.InjectIdentityEnvVars != nil && *cr.Spec.InjectIdentityEnvVars {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "cpaUID",
+			Value: string(cr.UID),
+		}, corev1.EnvVar{
+			Name:  "cpaGeneration",
+			Value: strconv.FormatInt(cr.Generation, 10),
+		})
+	}
+	if cr.Spec.InjectCorrelationID != nil && *cr.Spec.InjectCorrelationID {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "cpaCorrelationID",
+			Value: correlationID(cr),
+		})
+	}
+	if cr.Spec.InitialStabilizationSeconds != nil && !hasConfig(cr.Spec.Config, "initialStabilizationSeconds") {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "initialStabilizationSeconds",
+			Value: strconv.FormatInt(int64(*cr.Spec.InitialStabilizationSeconds), 10),
+		})
+	}
+	var templateContext *configTemplateContext
+	if cr.Spec.TemplateConfigValues != nil && *cr.Spec.TemplateConfigValues {
+		templateContext = &configTemplateContext{
+			Name:           cr.Name,
+			Namespace:      cr.Namespace,
+			ScaleTargetRef: cr.Spec.ScaleTargetRef,
+		}
+	}
+	configEnvVars, err := createEnvVarsFromConfig(cr.Spec.Config, templateContext)
+	if err != nil {
+		return nil, err
+	}
+	envVars = append(envVars, configEnvVars...)
+	return envVars, nil
+}
+
+// hasConfig checks if a config option with the name provided is set
+func hasConfig(configs []custompodautoscalercomv1.CustomPodAutoscalerConfig, name string) bool {
+	for _, config := range configs {
+		if config.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// correlationID derives the correlation ID of the CPA from its UID, the ID only changes if the CPA is recreated
+func correlationID(cr *custompodautoscalercomv1.CustomPodAutoscaler) string {
+	hash := sha256.Sum256([]byte(cr.UID))
+	return hex.EncodeToString(hash[:8])
+}
+
+// configTemplateContext is the data config values are expanded against when templating config values
+type configTemplateContext struct {
+	Name           string
+	Namespace      string
+	ScaleTargetRef autoscalingv1.CrossVersionObjectReference
+}
+
+// createEnvVarsFromConfig converts CPA config to environment variables, if a template context is provided each value
+// is expanded as a Go template against it
+func createEnvVarsFromConfig(configs []custompodautoscalercomv1.CustomPodAutoscalerConfig, templateContext *configTemplateContext) ([]corev1.EnvVar, error) {
+	envVars := []corev1.EnvVar{}
+	for _, config := range configs {
+		value := config.Value
+		if templateContext != nil {
+			tmpl, err := template.New(config.Name).Option("missingkey=error").Parse(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid template in config value %s: %w", config.Name, err)
+			}
+			var expanded strings.Builder
+			err = tmpl.Execute(&expanded, templateContext)
+			if err != nil {
+				return nil, fmt.Errorf("failed to expand template in config value %s: %w", config.Name, err)
+			}
+			value = expanded.String()
+		}
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  config.Name,
+			Value: value,
+		})
+	}
+	return envVars, nil
+}
+
+// SetupWithManager sets up the CustomPodAutoscaler controller, setting up watches with the
+// manager provided
+func (r *CustomPodAutoscalerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&custompodautoscalercomv1.CustomPodAutoscaler{}, builder.WithPredicates(ShardPredicate(r.ShardSelector), EnvironmentPredicate(r.EnvironmentFilter))).
+		WithEventFilter(PrimaryPred).
+		Owns(&corev1.Pod{}, builder.WithPredicates(SecondaryPred)).
+		Owns(&corev1.ServiceAccount{}, builder.WithPredicates(SecondaryPred)).
+		Owns(&rbacv1.Role{}, builder.WithPredicates(SecondaryPred)).
+		Owns(&rbacv1.RoleBinding{}, builder.WithPredicates(SecondaryPred)).
+		Owns(&corev1.ConfigMap{}, builder.WithPredicates(SecondaryPred)).
+		Owns(&corev1.Secret{}, builder.WithPredicates(SecondaryPred)).
+		Owns(&corev1.Service{}, builder.WithPredicates(SecondaryPred)).
+		Owns(&networkingv1.NetworkPolicy{}, builder.WithPredicates(SecondaryPred)).
+		Complete(r)
+}
+
+// SetupScalingClient sets up a client for the CPA reconciler to use for manually
+// setting the replicas count of a scale target pod while the autoscaler is paused.
+// Functionality is based on the setup for a regular CPA autoscaler in main()
+func SetupScalingClient(rateLimits ClientRateLimits) (k8sscale.ScalesGetter, error) {
+
+	// InClusterConfig returns a config object which uses the service account
+	// kubernetes gives to pods. It's intended for clients that expect to be
+	// running inside a pod running on kubernetes. It will return ErrNotInCluster
+	// if called from a process not running in a kubernetes environment.
+	// https://github.com/kubernetes/client-go/blob/master/rest/config.go
+	clusterConfig, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	rateLimits.Apply(clusterConfig)
+
+	// NewForConfig creates a new ScalesGetter which resolves kinds
+	// to resources using the given RESTMapper, and API paths using
+	// the given dynamic.APIPathResolverFunc.
+	// https://github.com/kubernetes/client-go/blob/master/scale/client.go
+	clientset, err := kubernetes.NewForConfig(clusterConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// GetAPIGroupResources uses the provided discovery client to gather
+	// discovery information and populate a slice of APIGroupResources
+	// APIGroupResources{Group metav1.APIGroup, VersionedResources map[string][]metav1.APIResource}
+	// https://github.com/kubernetes/client-go/blob/master/restmapper/discovery.go
+	groupResources, err := restmapper.GetAPIGroupResources(clientset.Discovery())
+	if err != nil {
+		return nil, err
+	}
+
+	// Set up a client for scaling
+	// https://github.com/kubernetes/client-go/blob/master/scale/client.go
+	scaleClient := k8sscale.New(
+		clientset.RESTClient(),
+		restmapper.NewDiscoveryRESTMapper(groupResources),
+		dynamic.LegacyAPIPathResolverFunc,
+		k8sscale.NewDiscoveryScaleKindResolver(
+			clientset.Discovery(),
+		),
+	)
+
+	return scaleClient, err
+}
+
+// SetupDynamicClient sets up a dynamic client for the CPA reconciler to use for managing scale targets that are
+// not built in Kubernetes resources, such as Argo Rollouts.
+func SetupDynamicClient(rateLimits ClientRateLimits) (dynamic.Interface, error) {
+	clusterConfig, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	rateLimits.Apply(clusterConfig)
+
+	return dynamic.NewForConfig(clusterConfig)
 }
@@ -19,6 +19,7 @@ package controllers_test
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -26,23 +27,38 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
 	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	k8sreconcile "github.com/jthomperoo/custom-pod-autoscaler-operator/reconcile"
+	appsv1 "k8s.io/api/apps/v1"
 	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/dynamic"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	k8sscale "k8s.io/client-go/scale"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	scaleFake "k8s.io/client-go/scale/fake"
 	k8stesting "k8s.io/client-go/testing"
+	clocktesting "k8s.io/utils/clock/testing"
 )
 
 func boolPtr(val bool) *bool {
@@ -60,11 +76,81 @@ func TestPrimaryPredicate(t *testing.T) {
 		t.Errorf("Boolean mismatch (-want +got):\n%s", cmp.Diff(result, true))
 		return
 	}
-	result = controllers.PrimaryPred.Update(event.UpdateEvent{})
+	result = controllers.PrimaryPred.Update(event.UpdateEvent{
+		ObjectOld: &custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Generation: 1,
+			},
+		},
+		ObjectNew: &custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Generation: 2,
+			},
+		},
+	})
+	if !cmp.Equal(result, true) {
+		t.Errorf("Boolean mismatch (-want +got):\n%s", cmp.Diff(result, true))
+		return
+	}
+	result = controllers.PrimaryPred.Update(event.UpdateEvent{
+		ObjectOld: &custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Generation: 1,
+			},
+		},
+		ObjectNew: &custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Generation: 1,
+				Annotations: map[string]string{
+					controllers.PausedReplicasAnnotation: "5",
+				},
+			},
+		},
+	})
+	if !cmp.Equal(result, true) {
+		t.Errorf("Boolean mismatch (-want +got):\n%s", cmp.Diff(result, true))
+		return
+	}
+	// Label only update
+	result = controllers.PrimaryPred.Update(event.UpdateEvent{
+		ObjectOld: &custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Generation: 1,
+			},
+		},
+		ObjectNew: &custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Generation: 1,
+				Labels: map[string]string{
+					"team": "test",
+				},
+			},
+		},
+	})
 	if !cmp.Equal(result, true) {
 		t.Errorf("Boolean mismatch (-want +got):\n%s", cmp.Diff(result, true))
 		return
 	}
+	// Status only update
+	result = controllers.PrimaryPred.Update(event.UpdateEvent{
+		ObjectOld: &custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Generation: 1,
+			},
+		},
+		ObjectNew: &custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Generation: 1,
+			},
+			Status: custompodautoscalercomv1.CustomPodAutoscalerStatus{
+				PodName: "test-abcde",
+			},
+		},
+	})
+	if !cmp.Equal(result, false) {
+		t.Errorf("Boolean mismatch (-want +got):\n%s", cmp.Diff(result, false))
+		return
+	}
 	result = controllers.PrimaryPred.Generic(event.GenericEvent{})
 	if !cmp.Equal(result, false) {
 		t.Errorf("Boolean mismatch (-want +got):\n%s", cmp.Diff(result, false))
@@ -271,7 +357,7 @@ func TestReconcile(t *testing.T) {
 						Namespace: "test-namespace",
 					},
 				},
-			).Build(),
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
 			reconcile.Request{
 				NamespacedName: types.NamespacedName{
 					Name:      "test",
@@ -318,7 +404,7 @@ func TestReconcile(t *testing.T) {
 						Namespace: "test-namespace",
 					},
 				},
-			).Build(),
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
 			reconcile.Request{
 				NamespacedName: types.NamespacedName{
 					Name:      "test",
@@ -365,7 +451,7 @@ func TestReconcile(t *testing.T) {
 						Namespace: "test-namespace",
 					},
 				},
-			).Build(),
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
 			reconcile.Request{
 				NamespacedName: types.NamespacedName{
 					Name:      "test",
@@ -410,7 +496,7 @@ func TestReconcile(t *testing.T) {
 						Namespace: "test-namespace",
 					},
 				},
-			).Build(),
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
 			reconcile.Request{
 				NamespacedName: types.NamespacedName{
 					Name:      "test",
@@ -468,7 +554,7 @@ func TestReconcile(t *testing.T) {
 						Namespace: "test-namespace",
 					},
 				},
-			).Build(),
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
 			reconcile.Request{
 				NamespacedName: types.NamespacedName{
 					Name:      "test",
@@ -546,7 +632,7 @@ func TestReconcile(t *testing.T) {
 						Namespace: "test-namespace",
 					},
 				},
-			).Build(),
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
 			reconcile.Request{
 				NamespacedName: types.NamespacedName{
 					Name:      "test",
@@ -638,7 +724,7 @@ func TestReconcile(t *testing.T) {
 						},
 					},
 				},
-			).Build(),
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
 			reconcile.Request{
 				NamespacedName: types.NamespacedName{
 					Name:      "test",
@@ -732,7 +818,7 @@ func TestReconcile(t *testing.T) {
 						},
 					},
 				},
-			).Build(),
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
 			reconcile.Request{
 				NamespacedName: types.NamespacedName{
 					Name:      "test",
@@ -778,6 +864,93 @@ func TestReconcile(t *testing.T) {
 			}(),
 			nil,
 		},
+		{
+			"Successfully reconcile without modifying the template labels in the CPA spec",
+			reconcile.Result{},
+			nil,
+			fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+				s := runtime.NewScheme()
+				s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+					},
+				})
+				return s
+			}()).WithRuntimeObjects(
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						Template: custompodautoscalercomv1.PodTemplateSpec{
+							Spec: custompodautoscalercomv1.PodSpec{
+								Containers: []corev1.Container{
+									{
+										Name: "test container",
+									},
+								},
+							},
+							ObjectMeta: custompodautoscalercomv1.PodMeta{
+								Labels: map[string]string{
+									"test-label": "test",
+								},
+							},
+						},
+					},
+				},
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+			reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			},
+			func() *fakek8sReconciler {
+				reconciler := &fakek8sReconciler{}
+				reconciler.reconcile = func(
+					reqLogger logr.Logger,
+					instance *custompodautoscalercomv1.CustomPodAutoscaler,
+					obj metav1.Object,
+					shouldProvision bool,
+					updatable bool,
+					kind string,
+				) (reconcile.Result, error) {
+					pod, ok := obj.(*corev1.Pod)
+					if ok {
+						expectedTemplateLabels := map[string]string{
+							"test-label": "test",
+						}
+
+						if !cmp.Equal(expectedTemplateLabels, instance.Spec.Template.ObjectMeta.Labels) {
+							t.Errorf("Template labels mismatch (-want +got):\n%s",
+								cmp.Diff(expectedTemplateLabels, instance.Spec.Template.ObjectMeta.Labels))
+							return reconcile.Result{}, nil
+						}
+
+						expectedPodLabels := map[string]string{
+							"test-label":                   "test",
+							"app.kubernetes.io/managed-by": "custom-pod-autoscaler-operator",
+							controllers.OwnedByLabel:       "test",
+						}
+
+						if !cmp.Equal(expectedPodLabels, pod.Labels) {
+							t.Errorf("Pod labels mismatch (-want +got):\n%s",
+								cmp.Diff(expectedPodLabels, pod.Labels))
+							return reconcile.Result{}, nil
+						}
+						return reconcile.Result{}, nil
+					}
+					return reconcile.Result{}, nil
+				}
+				reconciler.podCleanup = func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+					return nil
+				}
+				return reconciler
+			}(),
+			nil,
+		},
 		{
 			"Successfully reconcile with env vars set in pod spec and no config env vars",
 			reconcile.Result{},
@@ -815,7 +988,7 @@ func TestReconcile(t *testing.T) {
 						},
 					},
 				},
-			).Build(),
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
 			reconcile.Request{
 				NamespacedName: types.NamespacedName{
 					Name:      "test",
@@ -897,7 +1070,7 @@ func TestReconcile(t *testing.T) {
 						Namespace: "test-namespace",
 					},
 				},
-			).Build(),
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
 			reconcile.Request{
 				NamespacedName: types.NamespacedName{
 					Name:      "test",
@@ -955,7 +1128,7 @@ func TestReconcile(t *testing.T) {
 						Namespace: "test-namespace",
 					},
 				},
-			).Build(),
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
 			reconcile.Request{
 				NamespacedName: types.NamespacedName{
 					Name:      "test",
@@ -987,6 +1160,7 @@ func TestReconcile(t *testing.T) {
 			nil,
 			fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
 				s := runtime.NewScheme()
+				utilruntime.Must(clientgoscheme.AddToScheme(s))
 				s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      "test",
@@ -994,7 +1168,7 @@ func TestReconcile(t *testing.T) {
 					},
 				})
 				return s
-			}()).WithRuntimeObjects(
+			}()).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).WithRuntimeObjects(
 				&custompodautoscalercomv1.CustomPodAutoscaler{
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      "test",
@@ -1004,6 +1178,11 @@ func TestReconcile(t *testing.T) {
 						},
 					},
 					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{
+							APIVersion: "apps/v1",
+							Kind:       "Deployment",
+							Name:       "test-deployment",
+						},
 						Template: custompodautoscalercomv1.PodTemplateSpec{
 							Spec: custompodautoscalercomv1.PodSpec{
 								Containers: []corev1.Container{
@@ -1015,7 +1194,13 @@ func TestReconcile(t *testing.T) {
 						},
 					},
 				},
-			).Build(),
+				&appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test-deployment",
+						Namespace: "test-namespace",
+					},
+				},
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
 			reconcile.Request{
 				NamespacedName: types.NamespacedName{
 					Name:      "test",
@@ -1052,6 +1237,7 @@ func TestReconcile(t *testing.T) {
 			errors.New(`Failed Get API call`),
 			fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
 				s := runtime.NewScheme()
+				utilruntime.Must(clientgoscheme.AddToScheme(s))
 				s.AddKnownTypes(custompodautoscalercomv1.GroupVersion,
 					&custompodautoscalercomv1.CustomPodAutoscaler{
 						ObjectMeta: metav1.ObjectMeta{
@@ -1060,7 +1246,7 @@ func TestReconcile(t *testing.T) {
 						},
 					})
 				return s
-			}()).WithRuntimeObjects(
+			}()).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).WithRuntimeObjects(
 				&custompodautoscalercomv1.CustomPodAutoscaler{
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      "test",
@@ -1081,7 +1267,7 @@ func TestReconcile(t *testing.T) {
 						},
 					},
 				},
-			).Build(),
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
 			reconcile.Request{
 				NamespacedName: types.NamespacedName{
 					Name:      "test",
@@ -1111,6 +1297,7 @@ func TestReconcile(t *testing.T) {
 			errors.New(`Failed Update API call`),
 			fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
 				s := runtime.NewScheme()
+				utilruntime.Must(clientgoscheme.AddToScheme(s))
 				s.AddKnownTypes(custompodautoscalercomv1.GroupVersion,
 					&custompodautoscalercomv1.CustomPodAutoscaler{
 						ObjectMeta: metav1.ObjectMeta{
@@ -1119,7 +1306,7 @@ func TestReconcile(t *testing.T) {
 						},
 					})
 				return s
-			}()).WithRuntimeObjects(
+			}()).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).WithRuntimeObjects(
 				&custompodautoscalercomv1.CustomPodAutoscaler{
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      "test",
@@ -1140,7 +1327,7 @@ func TestReconcile(t *testing.T) {
 						},
 					},
 				},
-			).Build(),
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
 			reconcile.Request{
 				NamespacedName: types.NamespacedName{
 					Name:      "test",
@@ -1238,3 +1425,7675 @@ func TestReconcile(t *testing.T) {
 		})
 	}
 }
+
+func TestReconcilePausedArgoRollout(t *testing.T) {
+	equateErrorMessage := cmp.Comparer(func(x, y error) bool {
+		if x == nil || y == nil {
+			return x == nil && y == nil
+		}
+		return x.Error() == y.Error()
+	})
+
+	rollout := func(paused bool, aborted bool) *unstructured.Unstructured {
+		return &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "argoproj.io/v1alpha1",
+				"kind":       "Rollout",
+				"metadata": map[string]interface{}{
+					"name":      "test-rollout",
+					"namespace": "test-namespace",
+				},
+				"spec": map[string]interface{}{
+					"replicas": int64(1),
+					"paused":   paused,
+				},
+				"status": map[string]interface{}{
+					"abort": aborted,
+				},
+			},
+		}
+	}
+
+	scaleReactors := func(t *testing.T, dynamicClient *dynamicfake.FakeDynamicClient, updateErr error) *dynamicfake.FakeDynamicClient {
+		dynamicClient.PrependReactor("get", "rollouts", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			if action.GetSubresource() != "scale" {
+				return false, nil, nil
+			}
+			return true, &unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"apiVersion": "autoscaling/v1",
+					"kind":       "Scale",
+					"metadata": map[string]interface{}{
+						"name":      "test-rollout",
+						"namespace": "test-namespace",
+					},
+					"spec": map[string]interface{}{
+						"replicas": int64(1),
+					},
+				},
+			}, nil
+		})
+		dynamicClient.PrependReactor("update", "rollouts", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+			if action.GetSubresource() != "scale" {
+				t.Errorf("Expected Rollout to be scaled using the scale subresource, got subresource %q", action.GetSubresource())
+			}
+			if updateErr != nil {
+				return true, nil, updateErr
+			}
+			scale := action.(k8stesting.UpdateAction).GetObject().(*unstructured.Unstructured)
+			replicas, _, _ := unstructured.NestedInt64(scale.Object, "spec", "replicas")
+			if !cmp.Equal(int64(5), replicas) {
+				t.Errorf("Replicas mismatch (-want +got):\n%s", cmp.Diff(int64(5), replicas))
+			}
+			return true, scale, nil
+		})
+		return dynamicClient
+	}
+
+	var tests = []struct {
+		description    string
+		expected       reconcile.Result
+		expectedErr    error
+		expectedEvents []string
+		dynamicClient  func(t *testing.T) dynamic.Interface
+	}{
+		{
+			"Fail to get Rollout",
+			reconcile.Result{},
+			errors.New("Failed to get Rollout"),
+			[]string{},
+			func(t *testing.T) dynamic.Interface {
+				dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+				dynamicClient.PrependReactor("get", "rollouts", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+					return true, nil, errors.New("Failed to get Rollout")
+				})
+				return dynamicClient
+			},
+		},
+		{
+			"Fail to update Rollout scale",
+			reconcile.Result{},
+			errors.New("Failed to update scale"),
+			[]string{},
+			func(t *testing.T) dynamic.Interface {
+				return scaleReactors(t, dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), rollout(false, false)), errors.New("Failed to update scale"))
+			},
+		},
+		{
+			"Successfully set replicas of Rollout",
+			reconcile.Result{},
+			nil,
+			[]string{},
+			func(t *testing.T) dynamic.Interface {
+				return scaleReactors(t, dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), rollout(false, false)), nil)
+			},
+		},
+		{
+			"Successfully set replicas of paused Rollout",
+			reconcile.Result{},
+			nil,
+			[]string{},
+			func(t *testing.T) dynamic.Interface {
+				return scaleReactors(t, dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), rollout(true, false)), nil)
+			},
+		},
+		{
+			"Aborted Rollout, replicas not set, warning event and requeued",
+			reconcile.Result{RequeueAfter: 15 * time.Second},
+			nil,
+			[]string{
+				"Warning RolloutAborted Rollout test-rollout is aborted, paused replicas are set once the abort is cleared",
+			},
+			func(t *testing.T) dynamic.Interface {
+				dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), rollout(false, true))
+				dynamicClient.PrependReactor("update", "rollouts", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+					t.Errorf("Expected aborted Rollout not to be scaled")
+					return true, nil, nil
+				})
+				return dynamicClient
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			client := fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+				s := runtime.NewScheme()
+				utilruntime.Must(clientgoscheme.AddToScheme(s))
+				s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+				s.AddKnownTypeWithName(schema.GroupVersionKind{
+					Group:   "argoproj.io",
+					Version: "v1alpha1",
+					Kind:    "Rollout",
+				}, &unstructured.Unstructured{})
+				return s
+			}()).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).WithRuntimeObjects(
+				rollout(false, false),
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+						Annotations: map[string]string{
+							controllers.PausedReplicasAnnotation: "5",
+						},
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{
+							APIVersion: "argoproj.io/v1alpha1",
+							Kind:       "Rollout",
+							Name:       "test-rollout",
+						},
+					},
+				},
+			).Build()
+
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client:        client,
+				Scheme:        runtime.NewScheme(),
+				Log:           logr.Discard(),
+				DynamicClient: test.dynamicClient(t),
+				Recorder:      recorder,
+			}
+			result, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if !cmp.Equal(err, test.expectedErr, equateErrorMessage) {
+				t.Errorf("Error mismatch (-want +got):\n%s", cmp.Diff(test.expectedErr, err, equateErrorMessage))
+				return
+			}
+
+			if !cmp.Equal(result, test.expected) {
+				t.Errorf("Result mismatch (-want +got):\n%s", cmp.Diff(result, test.expected))
+			}
+
+			close(recorder.Events)
+			events := []string{}
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			if !cmp.Equal(test.expectedEvents, events) {
+				t.Errorf("Events mismatch (-want +got):\n%s", cmp.Diff(test.expectedEvents, events))
+			}
+		})
+	}
+}
+
+func TestReconcilePauseDeletesAutoscalerPods(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+
+	ownerReference := metav1.OwnerReference{
+		APIVersion: "custompodautoscaler.com/v1",
+		Kind:       "CustomPodAutoscaler",
+		Name:       "test",
+		UID:        "test-uid",
+		Controller: boolPtr(true),
+	}
+
+	fclient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			&custompodautoscalercomv1.CustomPodAutoscaler{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test-namespace",
+					UID:       "test-uid",
+					Annotations: map[string]string{
+						controllers.PausedReplicasAnnotation: "5",
+					},
+				},
+				Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+					ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{
+						APIVersion: "apps/v1",
+						Kind:       "Deployment",
+						Name:       "test-deployment",
+					},
+				},
+			},
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "test",
+					Namespace:       "test-namespace",
+					Labels:          map[string]string{controllers.OwnedByLabel: "test"},
+					OwnerReferences: []metav1.OwnerReference{ownerReference},
+				},
+			},
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "not-controlled",
+					Namespace: "test-namespace",
+					Labels:    map[string]string{controllers.OwnedByLabel: "test"},
+				},
+			},
+			&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-deployment",
+					Namespace: "test-namespace",
+				},
+			},
+		).
+		WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).
+		Build()
+
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
+		Client: fclient,
+		Scheme: scheme,
+		ScalingClient: &scaleFake.FakeScaleClient{
+			Fake: k8stesting.Fake{
+				ReactionChain: []k8stesting.Reactor{
+					&k8stesting.SimpleReactor{
+						Resource: "*",
+						Verb:     "*",
+						Reaction: func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+							return true, &autoscalingv1.Scale{}, nil
+						},
+					},
+				},
+			},
+		},
+		Log: logr.Discard(),
+	}
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "test",
+			Namespace: "test-namespace",
+		},
+	}
+
+	_, err := reconciler.Reconcile(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The CustomPodAutoscaler must be kept so autoscaling can be resumed
+	err = fclient.Get(context.Background(), request.NamespacedName, &custompodautoscalercomv1.CustomPodAutoscaler{})
+	if err != nil {
+		t.Fatalf("Unexpected error getting CPA: %v", err)
+	}
+
+	podExists := func(name string) bool {
+		err := fclient.Get(context.Background(), types.NamespacedName{Name: name, Namespace: "test-namespace"}, &corev1.Pod{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			t.Fatalf("Unexpected error getting pod: %v", err)
+		}
+		return err == nil
+	}
+
+	if podExists("test") {
+		t.Errorf("Autoscaler Pod not deleted when paused")
+	}
+	if !podExists("not-controlled") {
+		t.Errorf("Pod not controlled by the CPA deleted when paused")
+	}
+}
+
+func int32Ptr(val int32) *int32 {
+	return &val
+}
+
+func stringPtr(val string) *string {
+	return &val
+}
+
+func containerRestartPolicyPtr(val corev1.ContainerRestartPolicy) *corev1.ContainerRestartPolicy {
+	return &val
+}
+
+func int64Ptr(val int64) *int64 {
+	return &val
+}
+
+func preemptionPolicyPtr(val corev1.PreemptionPolicy) *corev1.PreemptionPolicy {
+	return &val
+}
+
+func mountPropagationModePtr(val corev1.MountPropagationMode) *corev1.MountPropagationMode {
+	return &val
+}
+
+func TestReconcileProvisionedPod(t *testing.T) {
+	var tests = []struct {
+		description string
+		expected    interface{}
+		spec        custompodautoscalercomv1.CustomPodAutoscalerSpec
+		actual      func(pod *corev1.Pod) interface{}
+	}{
+		{
+			"No active deadline set",
+			(*int64)(nil),
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.ActiveDeadlineSeconds
+			},
+		},
+		{
+			"Active deadline from spec applied when template omits it",
+			int64Ptr(60),
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				ActiveDeadlineSeconds: int64Ptr(60),
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.ActiveDeadlineSeconds
+			},
+		},
+		{
+			"Active deadline from template takes precedence over spec",
+			int64Ptr(120),
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						ActiveDeadlineSeconds: int64Ptr(120),
+					},
+				},
+				ActiveDeadlineSeconds: int64Ptr(60),
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.ActiveDeadlineSeconds
+			},
+		},
+		{
+			"No scheduler name set",
+			"",
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.SchedulerName
+			},
+		},
+		{
+			"Scheduler name from spec applied when template omits it",
+			"gpu-scheduler",
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				SchedulerName: "gpu-scheduler",
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.SchedulerName
+			},
+		},
+		{
+			"Scheduler name from template takes precedence over spec",
+			"batch-scheduler",
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						SchedulerName: "batch-scheduler",
+					},
+				},
+				SchedulerName: "gpu-scheduler",
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.SchedulerName
+			},
+		},
+		{
+			"No preemption policy set",
+			(*corev1.PreemptionPolicy)(nil),
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.PreemptionPolicy
+			},
+		},
+		{
+			"Preemption policy from spec applied when template omits it",
+			preemptionPolicyPtr(corev1.PreemptNever),
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				PreemptionPolicy: preemptionPolicyPtr(corev1.PreemptNever),
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.PreemptionPolicy
+			},
+		},
+		{
+			"Preemption policy from template takes precedence over spec",
+			preemptionPolicyPtr(corev1.PreemptLowerPriority),
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						PreemptionPolicy: preemptionPolicyPtr(corev1.PreemptLowerPriority),
+					},
+				},
+				PreemptionPolicy: preemptionPolicyPtr(corev1.PreemptNever),
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.PreemptionPolicy
+			},
+		},
+		{
+			"Template volume mount propagation preserved",
+			[]corev1.VolumeMount{
+				{
+					Name:             "host-metrics",
+					MountPath:        "/host/metrics",
+					MountPropagation: mountPropagationModePtr(corev1.MountPropagationHostToContainer),
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "autoscaler",
+								VolumeMounts: []corev1.VolumeMount{
+									{
+										Name:             "host-metrics",
+										MountPath:        "/host/metrics",
+										MountPropagation: mountPropagationModePtr(corev1.MountPropagationHostToContainer),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Containers[0].VolumeMounts
+			},
+		},
+		{
+			"Template volume mount propagation preserved when merged with operator volume mounts",
+			[]corev1.VolumeMount{
+				{
+					Name:             "host-metrics",
+					MountPath:        "/host/metrics",
+					MountPropagation: mountPropagationModePtr(corev1.MountPropagationHostToContainer),
+				},
+				{
+					Name:      "cpa-scratch",
+					MountPath: "/tmp",
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "autoscaler",
+								VolumeMounts: []corev1.VolumeMount{
+									{
+										Name:             "host-metrics",
+										MountPath:        "/host/metrics",
+										MountPropagation: mountPropagationModePtr(corev1.MountPropagationHostToContainer),
+									},
+								},
+							},
+						},
+					},
+				},
+				MountScratchVolume: boolPtr(true),
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Containers[0].VolumeMounts
+			},
+		},
+		{
+			"No startup probe set",
+			(*corev1.Probe)(nil),
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Containers[0].StartupProbe
+			},
+		},
+		{
+			"Startup probe from spec applied when template omits it",
+			&corev1.Probe{
+				ProbeHandler: corev1.ProbeHandler{
+					Exec: &corev1.ExecAction{
+						Command: []string{"cat", "/tmp/ready"},
+					},
+				},
+				FailureThreshold: 30,
+				PeriodSeconds:    10,
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				StartupProbe: &corev1.Probe{
+					ProbeHandler: corev1.ProbeHandler{
+						Exec: &corev1.ExecAction{
+							Command: []string{"cat", "/tmp/ready"},
+						},
+					},
+					FailureThreshold: 30,
+					PeriodSeconds:    10,
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Containers[0].StartupProbe
+			},
+		},
+		{
+			"Startup probe from template takes precedence over spec",
+			&corev1.Probe{
+				FailureThreshold: 5,
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "autoscaler",
+								StartupProbe: &corev1.Probe{
+									FailureThreshold: 5,
+								},
+							},
+						},
+					},
+				},
+				StartupProbe: &corev1.Probe{
+					FailureThreshold: 30,
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Containers[0].StartupProbe
+			},
+		},
+		{
+			"Startup probe from spec only applied to the autoscaler container",
+			(*corev1.Probe)(nil),
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "autoscaler",
+							},
+						},
+					},
+				},
+				StartupProbe: &corev1.Probe{
+					FailureThreshold: 30,
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Containers[1].StartupProbe
+			},
+		},
+		{
+			"No default resources set",
+			corev1.ResourceRequirements{},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Containers[0].Resources
+			},
+		},
+		{
+			"Default resources including ephemeral storage applied when template omits them",
+			corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceMemory:           resource.MustParse("64Mi"),
+					corev1.ResourceEphemeralStorage: resource.MustParse("100Mi"),
+				},
+				Limits: corev1.ResourceList{
+					corev1.ResourceEphemeralStorage: resource.MustParse("1Gi"),
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Resources: &corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceMemory:           resource.MustParse("64Mi"),
+						corev1.ResourceEphemeralStorage: resource.MustParse("100Mi"),
+					},
+					Limits: corev1.ResourceList{
+						corev1.ResourceEphemeralStorage: resource.MustParse("1Gi"),
+					},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Containers[0].Resources
+			},
+		},
+		{
+			"Default resources merged with template resources, template takes precedence",
+			corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceMemory:           resource.MustParse("128Mi"),
+					corev1.ResourceEphemeralStorage: resource.MustParse("100Mi"),
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "autoscaler",
+								Resources: corev1.ResourceRequirements{
+									Requests: corev1.ResourceList{
+										corev1.ResourceMemory: resource.MustParse("128Mi"),
+									},
+								},
+							},
+						},
+					},
+				},
+				Resources: &corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceMemory:           resource.MustParse("64Mi"),
+						corev1.ResourceEphemeralStorage: resource.MustParse("100Mi"),
+					},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Containers[0].Resources
+			},
+		},
+		{
+			"GPU resources set in the template preserved alongside default resources",
+			corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceMemory:                 resource.MustParse("64Mi"),
+					corev1.ResourceName("nvidia.com/gpu"): resource.MustParse("1"),
+				},
+				Limits: corev1.ResourceList{
+					corev1.ResourceMemory:                 resource.MustParse("256Mi"),
+					corev1.ResourceName("nvidia.com/gpu"): resource.MustParse("1"),
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "autoscaler",
+								Resources: corev1.ResourceRequirements{
+									Requests: corev1.ResourceList{
+										corev1.ResourceName("nvidia.com/gpu"): resource.MustParse("1"),
+									},
+									Limits: corev1.ResourceList{
+										corev1.ResourceName("nvidia.com/gpu"): resource.MustParse("1"),
+									},
+								},
+							},
+						},
+					},
+				},
+				Resources: &corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceMemory: resource.MustParse("64Mi"),
+					},
+					Limits: corev1.ResourceList{
+						corev1.ResourceMemory: resource.MustParse("256Mi"),
+					},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Containers[0].Resources
+			},
+		},
+		{
+			"GPU resources from default resources applied when template omits them",
+			corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{
+					corev1.ResourceName("nvidia.com/gpu"): resource.MustParse("2"),
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Resources: &corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{
+						corev1.ResourceName("nvidia.com/gpu"): resource.MustParse("2"),
+					},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Containers[0].Resources
+			},
+		},
+		{
+			"GPU resources set in the template take precedence over default resources",
+			corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{
+					corev1.ResourceName("nvidia.com/gpu"): resource.MustParse("1"),
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "autoscaler",
+								Resources: corev1.ResourceRequirements{
+									Limits: corev1.ResourceList{
+										corev1.ResourceName("nvidia.com/gpu"): resource.MustParse("1"),
+									},
+								},
+							},
+						},
+					},
+				},
+				Resources: &corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{
+						corev1.ResourceName("nvidia.com/gpu"): resource.MustParse("2"),
+					},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Containers[0].Resources
+			},
+		},
+		{
+			"Default resources only applied to the autoscaler container",
+			corev1.ResourceRequirements{},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "autoscaler",
+							},
+						},
+					},
+				},
+				Resources: &corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceEphemeralStorage: resource.MustParse("100Mi"),
+					},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Containers[1].Resources
+			},
+		},
+		{
+			"No overhead set",
+			corev1.ResourceList(nil),
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Overhead
+			},
+		},
+		{
+			"Overhead from spec applied when template omits it",
+			corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("250m"),
+				corev1.ResourceMemory: resource.MustParse("120Mi"),
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Overhead: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("250m"),
+					corev1.ResourceMemory: resource.MustParse("120Mi"),
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Overhead
+			},
+		},
+		{
+			"Overhead from template takes precedence over spec",
+			corev1.ResourceList{
+				corev1.ResourceCPU: resource.MustParse("100m"),
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Overhead: corev1.ResourceList{
+							corev1.ResourceCPU: resource.MustParse("100m"),
+						},
+					},
+				},
+				Overhead: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("250m"),
+					corev1.ResourceMemory: resource.MustParse("120Mi"),
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Overhead
+			},
+		},
+		{
+			"No runtime class set",
+			(*string)(nil),
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.RuntimeClassName
+			},
+		},
+		{
+			"Runtime class from spec applied when template omits it",
+			stringPtr("gvisor"),
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				RuntimeClassName: stringPtr("gvisor"),
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.RuntimeClassName
+			},
+		},
+		{
+			"Runtime class from template takes precedence over spec",
+			stringPtr("kata"),
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						RuntimeClassName: stringPtr("kata"),
+					},
+				},
+				RuntimeClassName: stringPtr("gvisor"),
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.RuntimeClassName
+			},
+		},
+		{
+			"Runtime class and overhead from spec both applied",
+			corev1.PodSpec{
+				RuntimeClassName: stringPtr("gvisor"),
+				Overhead: corev1.ResourceList{
+					corev1.ResourceCPU: resource.MustParse("250m"),
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				RuntimeClassName: stringPtr("gvisor"),
+				Overhead: corev1.ResourceList{
+					corev1.ResourceCPU: resource.MustParse("250m"),
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return corev1.PodSpec{
+					RuntimeClassName: pod.Spec.RuntimeClassName,
+					Overhead:         pod.Spec.Overhead,
+				}
+			},
+		},
+		{
+			"Native sidecar init container retains restart policy and receives injected env",
+			[]corev1.Container{
+				{
+					Name:          "proxy",
+					RestartPolicy: containerRestartPolicyPtr(corev1.ContainerRestartPolicyAlways),
+					Env: []corev1.EnvVar{
+						{
+							Name:  "PROXY_PORT",
+							Value: "15001",
+						},
+						{
+							Name:  "scaleTargetRef",
+							Value: `{"kind":"","name":""}`,
+						},
+						{
+							Name:  "namespace",
+							Value: "test-namespace",
+						},
+						{
+							Name:  "interval",
+							Value: "15000",
+						},
+					},
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						InitContainers: []corev1.Container{
+							{
+								Name:          "proxy",
+								RestartPolicy: containerRestartPolicyPtr(corev1.ContainerRestartPolicyAlways),
+								Env: []corev1.EnvVar{
+									{
+										Name:  "PROXY_PORT",
+										Value: "15001",
+									},
+								},
+							},
+						},
+					},
+				},
+				Config: []custompodautoscalercomv1.CustomPodAutoscalerConfig{
+					{
+						Name:  "interval",
+						Value: "15000",
+					},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.InitContainers
+			},
+		},
+		{
+			"Init container without a restart policy left unchanged",
+			[]corev1.Container{
+				{
+					Name:    "migrate",
+					Command: []string{"migrate"},
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						InitContainers: []corev1.Container{
+							{
+								Name:    "migrate",
+								Command: []string{"migrate"},
+							},
+						},
+					},
+				},
+				Config: []custompodautoscalercomv1.CustomPodAutoscalerConfig{
+					{
+						Name:  "interval",
+						Value: "15000",
+					},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.InitContainers
+			},
+		},
+		{
+			"No readiness gates set",
+			[]corev1.PodReadinessGate(nil),
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.ReadinessGates
+			},
+		},
+		{
+			"Readiness gates from spec applied when template omits them",
+			[]corev1.PodReadinessGate{
+				{ConditionType: "mesh.example.com/ready"},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				ReadinessGates: []corev1.PodReadinessGate{
+					{ConditionType: "mesh.example.com/ready"},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.ReadinessGates
+			},
+		},
+		{
+			"Readiness gates from template take precedence over spec",
+			[]corev1.PodReadinessGate{
+				{ConditionType: "template.example.com/ready"},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						ReadinessGates: []corev1.PodReadinessGate{
+							{ConditionType: "template.example.com/ready"},
+						},
+					},
+				},
+				ReadinessGates: []corev1.PodReadinessGate{
+					{ConditionType: "mesh.example.com/ready"},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.ReadinessGates
+			},
+		},
+		{
+			"No sysctls set",
+			(*corev1.PodSecurityContext)(nil),
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.SecurityContext
+			},
+		},
+		{
+			"Sysctls from spec applied, other security context options from template kept",
+			&corev1.PodSecurityContext{
+				RunAsNonRoot: boolPtr(true),
+				Sysctls: []corev1.Sysctl{
+					{Name: "net.ipv4.ip_local_port_range", Value: "1024 65535"},
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						SecurityContext: &corev1.PodSecurityContext{
+							RunAsNonRoot: boolPtr(true),
+						},
+					},
+				},
+				Sysctls: []corev1.Sysctl{
+					{Name: "net.ipv4.ip_local_port_range", Value: "1024 65535"},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.SecurityContext
+			},
+		},
+		{
+			"Sysctls from template take precedence over spec",
+			&corev1.PodSecurityContext{
+				Sysctls: []corev1.Sysctl{
+					{Name: "net.ipv4.tcp_syncookies", Value: "1"},
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						SecurityContext: &corev1.PodSecurityContext{
+							Sysctls: []corev1.Sysctl{
+								{Name: "net.ipv4.tcp_syncookies", Value: "1"},
+							},
+						},
+					},
+				},
+				Sysctls: []corev1.Sysctl{
+					{Name: "net.ipv4.ip_local_port_range", Value: "1024 65535"},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.SecurityContext
+			},
+		},
+		{
+			"No hostname or subdomain set",
+			[]string{"", ""},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			func(pod *corev1.Pod) interface{} {
+				return []string{pod.Spec.Hostname, pod.Spec.Subdomain}
+			},
+		},
+		{
+			"Hostname and subdomain from spec applied when template omits them",
+			[]string{"autoscaler-0", "test"},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Hostname:  "autoscaler-0",
+				Subdomain: "test",
+			},
+			func(pod *corev1.Pod) interface{} {
+				return []string{pod.Spec.Hostname, pod.Spec.Subdomain}
+			},
+		},
+		{
+			"Hostname and subdomain from template take precedence over spec",
+			[]string{"template-host", "template-subdomain"},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Hostname:  "template-host",
+						Subdomain: "template-subdomain",
+					},
+				},
+				Hostname:  "autoscaler-0",
+				Subdomain: "test",
+			},
+			func(pod *corev1.Pod) interface{} {
+				return []string{pod.Spec.Hostname, pod.Spec.Subdomain}
+			},
+		},
+		{
+			"Process namespace not shared by default",
+			(*bool)(nil),
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.ShareProcessNamespace
+			},
+		},
+		{
+			"Share process namespace from spec applied when template omits it",
+			boolPtr(true),
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				ShareProcessNamespace: true,
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.ShareProcessNamespace
+			},
+		},
+		{
+			"Share process namespace from template takes precedence over spec",
+			boolPtr(false),
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						ShareProcessNamespace: boolPtr(false),
+					},
+				},
+				ShareProcessNamespace: true,
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.ShareProcessNamespace
+			},
+		},
+		{
+			"No node failure tolerations set",
+			[]corev1.Toleration(nil),
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Tolerations
+			},
+		},
+		{
+			"Node failure tolerations added with configured duration",
+			[]corev1.Toleration{
+				{
+					Key:      "example.com/dedicated",
+					Operator: corev1.TolerationOpExists,
+				},
+				{
+					Key:               "node.kubernetes.io/not-ready",
+					Operator:          corev1.TolerationOpExists,
+					Effect:            corev1.TaintEffectNoExecute,
+					TolerationSeconds: int64Ptr(900),
+				},
+				{
+					Key:               "node.kubernetes.io/unreachable",
+					Operator:          corev1.TolerationOpExists,
+					Effect:            corev1.TaintEffectNoExecute,
+					TolerationSeconds: int64Ptr(900),
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Tolerations: []corev1.Toleration{
+							{
+								Key:      "example.com/dedicated",
+								Operator: corev1.TolerationOpExists,
+							},
+						},
+					},
+				},
+				NodeFailureTolerationSeconds: int64Ptr(900),
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Tolerations
+			},
+		},
+		{
+			"Node failure tolerations from template take precedence",
+			[]corev1.Toleration{
+				{
+					Key:               "node.kubernetes.io/not-ready",
+					Operator:          corev1.TolerationOpExists,
+					Effect:            corev1.TaintEffectNoExecute,
+					TolerationSeconds: int64Ptr(60),
+				},
+				{
+					Key:               "node.kubernetes.io/unreachable",
+					Operator:          corev1.TolerationOpExists,
+					Effect:            corev1.TaintEffectNoExecute,
+					TolerationSeconds: int64Ptr(900),
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Tolerations: []corev1.Toleration{
+							{
+								Key:               "node.kubernetes.io/not-ready",
+								Operator:          corev1.TolerationOpExists,
+								Effect:            corev1.TaintEffectNoExecute,
+								TolerationSeconds: int64Ptr(60),
+							},
+						},
+					},
+				},
+				NodeFailureTolerationSeconds: int64Ptr(900),
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Tolerations
+			},
+		},
+		{
+			"No host aliases set",
+			[]corev1.HostAlias(nil),
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.HostAliases
+			},
+		},
+		{
+			"Host aliases from spec applied when template omits them",
+			[]corev1.HostAlias{
+				{
+					IP:        "10.0.0.10",
+					Hostnames: []string{"metrics.internal", "metrics"},
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				HostAliases: []corev1.HostAlias{
+					{
+						IP:        "10.0.0.10",
+						Hostnames: []string{"metrics.internal", "metrics"},
+					},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.HostAliases
+			},
+		},
+		{
+			"Host aliases from template take precedence over spec",
+			[]corev1.HostAlias{
+				{
+					IP:        "10.0.0.20",
+					Hostnames: []string{"template.internal"},
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						HostAliases: []corev1.HostAlias{
+							{
+								IP:        "10.0.0.20",
+								Hostnames: []string{"template.internal"},
+							},
+						},
+					},
+				},
+				HostAliases: []corev1.HostAlias{
+					{
+						IP:        "10.0.0.10",
+						Hostnames: []string{"metrics.internal", "metrics"},
+					},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.HostAliases
+			},
+		},
+		{
+			"Default HTTP API port applied when template and spec omit ports",
+			[]corev1.ContainerPort{
+				{
+					Name:          "http",
+					ContainerPort: 5000,
+					Protocol:      corev1.ProtocolTCP,
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Containers[0].Ports
+			},
+		},
+		{
+			"Container ports from spec applied when template omits them",
+			[]corev1.ContainerPort{
+				{
+					Name:          "http",
+					ContainerPort: 8080,
+					Protocol:      corev1.ProtocolTCP,
+				},
+				{
+					Name:          "metrics",
+					ContainerPort: 9090,
+					Protocol:      corev1.ProtocolTCP,
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				ContainerPorts: []corev1.ContainerPort{
+					{
+						Name:          "http",
+						ContainerPort: 8080,
+						Protocol:      corev1.ProtocolTCP,
+					},
+					{
+						Name:          "metrics",
+						ContainerPort: 9090,
+						Protocol:      corev1.ProtocolTCP,
+					},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Containers[0].Ports
+			},
+		},
+		{
+			"Container ports from template take precedence over spec",
+			[]corev1.ContainerPort{
+				{
+					Name:          "api",
+					ContainerPort: 7000,
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "autoscaler",
+								Ports: []corev1.ContainerPort{
+									{
+										Name:          "api",
+										ContainerPort: 7000,
+									},
+								},
+							},
+						},
+					},
+				},
+				ContainerPorts: []corev1.ContainerPort{
+					{
+						Name:          "http",
+						ContainerPort: 8080,
+						Protocol:      corev1.ProtocolTCP,
+					},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Containers[0].Ports
+			},
+		},
+		{
+			"Command and args from spec applied when template omits them",
+			corev1.Container{
+				Name:    "test container",
+				Command: []string{"/cpa/custom-pod-autoscaler"},
+				Args:    []string{"--log-level", "debug"},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Command: []string{"/cpa/custom-pod-autoscaler"},
+				Args:    []string{"--log-level", "debug"},
+			},
+			func(pod *corev1.Pod) interface{} {
+				container := pod.Spec.Containers[0]
+				return corev1.Container{
+					Name:    container.Name,
+					Command: container.Command,
+					Args:    container.Args,
+				}
+			},
+		},
+		{
+			"Command and args from template take precedence over spec",
+			corev1.Container{
+				Name:    "autoscaler",
+				Command: []string{"/template/entrypoint"},
+				Args:    []string{"--template"},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name:    "autoscaler",
+								Command: []string{"/template/entrypoint"},
+								Args:    []string{"--template"},
+							},
+						},
+					},
+				},
+				Command: []string{"/cpa/custom-pod-autoscaler"},
+				Args:    []string{"--log-level", "debug"},
+			},
+			func(pod *corev1.Pod) interface{} {
+				container := pod.Spec.Containers[0]
+				return corev1.Container{
+					Name:    container.Name,
+					Command: container.Command,
+					Args:    container.Args,
+				}
+			},
+		},
+		{
+			"Args from spec applied when template only sets command",
+			corev1.Container{
+				Name:    "autoscaler",
+				Command: []string{"/template/entrypoint"},
+				Args:    []string{"--log-level", "debug"},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name:    "autoscaler",
+								Command: []string{"/template/entrypoint"},
+							},
+						},
+					},
+				},
+				Command: []string{"/cpa/custom-pod-autoscaler"},
+				Args:    []string{"--log-level", "debug"},
+			},
+			func(pod *corev1.Pod) interface{} {
+				container := pod.Spec.Containers[0]
+				return corev1.Container{
+					Name:    container.Name,
+					Command: container.Command,
+					Args:    container.Args,
+				}
+			},
+		},
+		{
+			"Command and args only applied to the first container",
+			[]corev1.Container{
+				{
+					Name: "test container",
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "autoscaler",
+							},
+						},
+					},
+				},
+				Command: []string{"/cpa/custom-pod-autoscaler"},
+				Args:    []string{"--log-level", "debug"},
+			},
+			func(pod *corev1.Pod) interface{} {
+				containers := []corev1.Container{}
+				for _, container := range pod.Spec.Containers[1:] {
+					containers = append(containers, corev1.Container{
+						Name:    container.Name,
+						Command: container.Command,
+						Args:    container.Args,
+					})
+				}
+				return containers
+			},
+		},
+		{
+			"Image pull policy from spec applied to the autoscaler container when template omits it",
+			corev1.PullAlways,
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				ImagePullPolicy: corev1.PullAlways,
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Containers[0].ImagePullPolicy
+			},
+		},
+		{
+			"Image pull policy from template takes precedence over spec",
+			corev1.PullNever,
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name:            "autoscaler",
+								ImagePullPolicy: corev1.PullNever,
+							},
+						},
+					},
+				},
+				ImagePullPolicy: corev1.PullAlways,
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Containers[0].ImagePullPolicy
+			},
+		},
+		{
+			"Image pull policy only applied to the autoscaler container, sidecar pull policies left to the template",
+			[]corev1.PullPolicy{corev1.PullAlways, corev1.PullIfNotPresent, ""},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "autoscaler",
+							},
+							{
+								Name:            "sidecar",
+								ImagePullPolicy: corev1.PullIfNotPresent,
+							},
+						},
+					},
+				},
+				ImagePullPolicy: corev1.PullAlways,
+			},
+			func(pod *corev1.Pod) interface{} {
+				pullPolicies := []corev1.PullPolicy{}
+				for _, container := range pod.Spec.Containers {
+					pullPolicies = append(pullPolicies, container.ImagePullPolicy)
+				}
+				return pullPolicies
+			},
+		},
+		{
+			"Image pull policy applied to the container named by autoscalerContainerName, sidecar listed first left to the template",
+			[]corev1.PullPolicy{"", corev1.PullAlways, ""},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "sidecar",
+							},
+							{
+								Name: "autoscaler",
+							},
+						},
+					},
+				},
+				AutoscalerContainerName: "autoscaler",
+				ImagePullPolicy:         corev1.PullAlways,
+			},
+			func(pod *corev1.Pod) interface{} {
+				pullPolicies := []corev1.PullPolicy{}
+				for _, container := range pod.Spec.Containers {
+					pullPolicies = append(pullPolicies, container.ImagePullPolicy)
+				}
+				return pullPolicies
+			},
+		},
+		{
+			"Lifecycle from spec applied to the autoscaler container when template omits it",
+			&corev1.Lifecycle{
+				PreStop: &corev1.LifecycleHandler{
+					Exec: &corev1.ExecAction{
+						Command: []string{"/deregister"},
+					},
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Lifecycle: &corev1.Lifecycle{
+					PreStop: &corev1.LifecycleHandler{
+						Exec: &corev1.ExecAction{
+							Command: []string{"/deregister"},
+						},
+					},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Containers[0].Lifecycle
+			},
+		},
+		{
+			"Lifecycle from template takes precedence over spec",
+			&corev1.Lifecycle{
+				PreStop: &corev1.LifecycleHandler{
+					Sleep: &corev1.SleepAction{
+						Seconds: 5,
+					},
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "autoscaler",
+								Lifecycle: &corev1.Lifecycle{
+									PreStop: &corev1.LifecycleHandler{
+										Sleep: &corev1.SleepAction{
+											Seconds: 5,
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+				Lifecycle: &corev1.Lifecycle{
+					PreStop: &corev1.LifecycleHandler{
+						Exec: &corev1.ExecAction{
+							Command: []string{"/deregister"},
+						},
+					},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Containers[0].Lifecycle
+			},
+		},
+		{
+			"Lifecycle only applied to the autoscaler container",
+			(*corev1.Lifecycle)(nil),
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "autoscaler",
+							},
+						},
+					},
+				},
+				Lifecycle: &corev1.Lifecycle{
+					PreStop: &corev1.LifecycleHandler{
+						Exec: &corev1.ExecAction{
+							Command: []string{"/deregister"},
+						},
+					},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.Containers[1].Lifecycle
+			},
+		},
+		{
+			"Lifecycle from spec survives environment variable injection",
+			corev1.Container{
+				Name: "autoscaler",
+				Env: []corev1.EnvVar{
+					{
+						Name:  "interval",
+						Value: "5000",
+					},
+				},
+				Lifecycle: &corev1.Lifecycle{
+					PreStop: &corev1.LifecycleHandler{
+						Exec: &corev1.ExecAction{
+							Command: []string{"/deregister"},
+						},
+					},
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "autoscaler",
+							},
+						},
+					},
+				},
+				Config: []custompodautoscalercomv1.CustomPodAutoscalerConfig{
+					{
+						Name:  "interval",
+						Value: "5000",
+					},
+				},
+				Lifecycle: &corev1.Lifecycle{
+					PreStop: &corev1.LifecycleHandler{
+						Exec: &corev1.ExecAction{
+							Command: []string{"/deregister"},
+						},
+					},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				container := pod.Spec.Containers[0]
+				env := []corev1.EnvVar{}
+				for _, envVar := range container.Env {
+					if envVar.Name == "interval" {
+						env = append(env, envVar)
+					}
+				}
+				return corev1.Container{
+					Name:      container.Name,
+					Env:       env,
+					Lifecycle: container.Lifecycle,
+				}
+			},
+		},
+		{
+			"Host namespaces not used by default",
+			corev1.PodSpec{},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			func(pod *corev1.Pod) interface{} {
+				return corev1.PodSpec{
+					HostNetwork: pod.Spec.HostNetwork,
+					HostPID:     pod.Spec.HostPID,
+					HostIPC:     pod.Spec.HostIPC,
+					DNSPolicy:   pod.Spec.DNSPolicy,
+				}
+			},
+		},
+		{
+			"Host namespaces from spec applied, DNS policy set for host network",
+			corev1.PodSpec{
+				HostNetwork: true,
+				HostPID:     true,
+				HostIPC:     true,
+				DNSPolicy:   corev1.DNSClusterFirstWithHostNet,
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				HostNetwork: true,
+				HostPID:     true,
+				HostIPC:     true,
+			},
+			func(pod *corev1.Pod) interface{} {
+				return corev1.PodSpec{
+					HostNetwork: pod.Spec.HostNetwork,
+					HostPID:     pod.Spec.HostPID,
+					HostIPC:     pod.Spec.HostIPC,
+					DNSPolicy:   pod.Spec.DNSPolicy,
+				}
+			},
+		},
+		{
+			"Host network from spec applied, DNS policy from template kept",
+			corev1.PodSpec{
+				HostNetwork: true,
+				DNSPolicy:   corev1.DNSDefault,
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						DNSPolicy: corev1.DNSDefault,
+					},
+				},
+				HostNetwork: true,
+			},
+			func(pod *corev1.Pod) interface{} {
+				return corev1.PodSpec{
+					HostNetwork: pod.Spec.HostNetwork,
+					HostPID:     pod.Spec.HostPID,
+					HostIPC:     pod.Spec.HostIPC,
+					DNSPolicy:   pod.Spec.DNSPolicy,
+				}
+			},
+		},
+		{
+			"Host namespaces from template kept when spec does not enable them",
+			corev1.PodSpec{
+				HostPID: true,
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						HostPID: true,
+					},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return corev1.PodSpec{
+					HostNetwork: pod.Spec.HostNetwork,
+					HostPID:     pod.Spec.HostPID,
+					HostIPC:     pod.Spec.HostIPC,
+					DNSPolicy:   pod.Spec.DNSPolicy,
+				}
+			},
+		},
+		{
+			"Resource env vars not injected by default",
+			map[string][]corev1.EnvVar{
+				"test container": {},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			func(pod *corev1.Pod) interface{} {
+				envVars := map[string][]corev1.EnvVar{}
+				for _, container := range pod.Spec.Containers {
+					envVars[container.Name] = []corev1.EnvVar{}
+					for _, envVar := range container.Env {
+						if envVar.ValueFrom != nil {
+							envVars[container.Name] = append(envVars[container.Name], envVar)
+						}
+					}
+				}
+				return envVars
+			},
+		},
+		{
+			"Resource env vars injected into the first container if enabled",
+			map[string][]corev1.EnvVar{
+				"autoscaler": {
+					{
+						Name: "cpaCpuRequest",
+						ValueFrom: &corev1.EnvVarSource{
+							ResourceFieldRef: &corev1.ResourceFieldSelector{
+								ContainerName: "autoscaler",
+								Resource:      "requests.cpu",
+								Divisor:       resource.MustParse("1m"),
+							},
+						},
+					},
+					{
+						Name: "cpaCpuLimit",
+						ValueFrom: &corev1.EnvVarSource{
+							ResourceFieldRef: &corev1.ResourceFieldSelector{
+								ContainerName: "autoscaler",
+								Resource:      "limits.cpu",
+								Divisor:       resource.MustParse("1m"),
+							},
+						},
+					},
+					{
+						Name: "cpaMemRequest",
+						ValueFrom: &corev1.EnvVarSource{
+							ResourceFieldRef: &corev1.ResourceFieldSelector{
+								ContainerName: "autoscaler",
+								Resource:      "requests.memory",
+								Divisor:       resource.MustParse("1"),
+							},
+						},
+					},
+					{
+						Name: "cpaMemLimit",
+						ValueFrom: &corev1.EnvVarSource{
+							ResourceFieldRef: &corev1.ResourceFieldSelector{
+								ContainerName: "autoscaler",
+								Resource:      "limits.memory",
+								Divisor:       resource.MustParse("1"),
+							},
+						},
+					},
+				},
+				"test container": {},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "autoscaler",
+							},
+						},
+					},
+				},
+				InjectResourceEnvVars: boolPtr(true),
+			},
+			func(pod *corev1.Pod) interface{} {
+				envVars := map[string][]corev1.EnvVar{}
+				for _, container := range pod.Spec.Containers {
+					envVars[container.Name] = []corev1.EnvVar{}
+					for _, envVar := range container.Env {
+						if envVar.ValueFrom != nil {
+							envVars[container.Name] = append(envVars[container.Name], envVar)
+						}
+					}
+				}
+				return envVars
+			},
+		},
+		{
+			"No scheduling gates set",
+			[]corev1.PodSchedulingGate(nil),
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.SchedulingGates
+			},
+		},
+		{
+			"Scheduling gates from spec applied when template omits them",
+			[]corev1.PodSchedulingGate{
+				{
+					Name: "example.com/quota",
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				SchedulingGates: []corev1.PodSchedulingGate{
+					{
+						Name: "example.com/quota",
+					},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.SchedulingGates
+			},
+		},
+		{
+			"Scheduling gates from template take precedence over spec",
+			[]corev1.PodSchedulingGate{
+				{
+					Name: "example.com/template",
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						SchedulingGates: []corev1.PodSchedulingGate{
+							{
+								Name: "example.com/template",
+							},
+						},
+					},
+				},
+				SchedulingGates: []corev1.PodSchedulingGate{
+					{
+						Name: "example.com/quota",
+					},
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return pod.Spec.SchedulingGates
+			},
+		},
+		{
+			"No config files, no volumes mounted",
+			[]interface{}{
+				[]corev1.Volume(nil),
+				[]corev1.VolumeMount(nil),
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			func(pod *corev1.Pod) interface{} {
+				return []interface{}{
+					pod.Spec.Volumes,
+					pod.Spec.Containers[0].VolumeMounts,
+				}
+			},
+		},
+		{
+			"Config files mounted at default path",
+			[]interface{}{
+				[]corev1.Volume{
+					{
+						Name: "cpa-config-files",
+						VolumeSource: corev1.VolumeSource{
+							ConfigMap: &corev1.ConfigMapVolumeSource{
+								LocalObjectReference: corev1.LocalObjectReference{
+									Name: "test-config",
+								},
+							},
+						},
+					},
+				},
+				[]corev1.VolumeMount{
+					{
+						Name:      "cpa-config-files",
+						MountPath: "/etc/cpa/config",
+						ReadOnly:  true,
+					},
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				ConfigFiles: map[string]string{
+					"config.yaml": "interval: 10000",
+				},
+			},
+			func(pod *corev1.Pod) interface{} {
+				return []interface{}{
+					pod.Spec.Volumes,
+					pod.Spec.Containers[0].VolumeMounts,
+				}
+			},
+		},
+		{
+			"Config files mounted at custom path alongside template volumes",
+			[]interface{}{
+				[]corev1.Volume{
+					{
+						Name: "cache",
+						VolumeSource: corev1.VolumeSource{
+							EmptyDir: &corev1.EmptyDirVolumeSource{},
+						},
+					},
+					{
+						Name: "cpa-config-files",
+						VolumeSource: corev1.VolumeSource{
+							ConfigMap: &corev1.ConfigMapVolumeSource{
+								LocalObjectReference: corev1.LocalObjectReference{
+									Name: "test-config",
+								},
+							},
+						},
+					},
+				},
+				[]corev1.VolumeMount{
+					{
+						Name:      "cache",
+						MountPath: "/cache",
+					},
+					{
+						Name:      "cpa-config-files",
+						MountPath: "/autoscaler/config",
+						ReadOnly:  true,
+					},
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Volumes: []corev1.Volume{
+							{
+								Name: "cache",
+								VolumeSource: corev1.VolumeSource{
+									EmptyDir: &corev1.EmptyDirVolumeSource{},
+								},
+							},
+						},
+						Containers: []corev1.Container{
+							{
+								Name: "autoscaler",
+								VolumeMounts: []corev1.VolumeMount{
+									{
+										Name:      "cache",
+										MountPath: "/cache",
+									},
+								},
+							},
+						},
+					},
+				},
+				ConfigFiles: map[string]string{
+					"config.yaml": "interval: 10000",
+				},
+				ConfigFilesMountPath: "/autoscaler/config",
+			},
+			func(pod *corev1.Pod) interface{} {
+				return []interface{}{
+					pod.Spec.Volumes,
+					pod.Spec.Containers[0].VolumeMounts,
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			spec := test.spec
+			spec.Template.Spec.Containers = append(spec.Template.Spec.Containers, corev1.Container{
+				Name: "test container",
+			})
+
+			var pod *corev1.Pod
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+					s := runtime.NewScheme()
+					s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+					return s
+				}()).WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test",
+							Namespace: "test-namespace",
+						},
+						Spec: spec,
+					},
+				).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						provisionedPod, ok := obj.(*corev1.Pod)
+						if ok {
+							pod = provisionedPod
+						}
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log: logr.Discard(),
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if pod == nil {
+				t.Fatalf("Pod was not provisioned")
+			}
+
+			actual := test.actual(pod)
+			if !cmp.Equal(test.expected, actual) {
+				t.Errorf("Pod mismatch (-want +got):\n%s", cmp.Diff(test.expected, actual))
+			}
+		})
+	}
+}
+
+func TestReconcileGeneratePodName(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+
+	cpa := func(name string) *custompodautoscalercomv1.CustomPodAutoscaler {
+		return &custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "test-namespace",
+			},
+			Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					ObjectMeta: custompodautoscalercomv1.PodMeta{
+						Name: "autoscaler",
+					},
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "test container",
+							},
+						},
+					},
+				},
+				GeneratePodName: boolPtr(true),
+			},
+		}
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(cpa("first"), cpa("second")).
+		WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).
+		Build()
+
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
+		Client: client,
+		Scheme: scheme,
+		KubernetesResourceReconciler: &k8sreconcile.KubernetesResourceReconciler{
+			Client:               client,
+			Scheme:               scheme,
+			ControllerReferencer: controllerutil.SetControllerReference,
+		},
+		Log: logr.Discard(),
+	}
+
+	for _, name := range []string{"first", "second"} {
+		_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      name,
+				Namespace: "test-namespace",
+			},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error reconciling %s: %v", name, err)
+		}
+	}
+
+	pods := &corev1.PodList{}
+	err := client.List(context.Background(), pods)
+	if err != nil {
+		t.Fatalf("Unexpected error listing pods: %v", err)
+	}
+
+	if !cmp.Equal(2, len(pods.Items)) {
+		t.Fatalf("Pod count mismatch (-want +got):\n%s", cmp.Diff(2, len(pods.Items)))
+	}
+
+	for _, name := range []string{"first", "second"} {
+		instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+		err := client.Get(context.Background(), types.NamespacedName{Name: name, Namespace: "test-namespace"}, instance)
+		if err != nil {
+			t.Fatalf("Unexpected error getting %s: %v", name, err)
+		}
+
+		if !strings.HasPrefix(instance.Status.PodName, "autoscaler-") {
+			t.Errorf("Expected generated pod name with prefix autoscaler- for %s, got %q", name, instance.Status.PodName)
+		}
+
+		pod := &corev1.Pod{}
+		err = client.Get(context.Background(), types.NamespacedName{Name: instance.Status.PodName, Namespace: "test-namespace"}, pod)
+		if err != nil {
+			t.Fatalf("Unexpected error getting pod for %s: %v", name, err)
+		}
+
+		if !cmp.Equal(name, pod.Labels[controllers.OwnedByLabel]) {
+			t.Errorf("Owned by label mismatch (-want +got):\n%s", cmp.Diff(name, pod.Labels[controllers.OwnedByLabel]))
+		}
+	}
+
+	// Changing the CPA and reconciling again should find the existing Pod using the name tracked in the status and
+	// replace it, leaving the other CPA's Pod untouched
+	instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+	err = client.Get(context.Background(), types.NamespacedName{Name: "first", Namespace: "test-namespace"}, instance)
+	if err != nil {
+		t.Fatalf("Unexpected error getting first: %v", err)
+	}
+	instance.Spec.Template.Spec.Containers[0].Image = "test-image:v2"
+	err = client.Update(context.Background(), instance)
+	if err != nil {
+		t.Fatalf("Unexpected error updating first: %v", err)
+	}
+
+	_, err = reconciler.Reconcile(context.Background(), reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "first",
+			Namespace: "test-namespace",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error reconciling first: %v", err)
+	}
+
+	pods = &corev1.PodList{}
+	err = client.List(context.Background(), pods)
+	if err != nil {
+		t.Fatalf("Unexpected error listing pods: %v", err)
+	}
+
+	if !cmp.Equal(1, len(pods.Items)) {
+		t.Fatalf("Pod count mismatch (-want +got):\n%s", cmp.Diff(1, len(pods.Items)))
+	}
+
+	if !cmp.Equal("second", pods.Items[0].Labels[controllers.OwnedByLabel]) {
+		t.Errorf("Owned by label mismatch (-want +got):\n%s", cmp.Diff("second", pods.Items[0].Labels[controllers.OwnedByLabel]))
+	}
+
+	// Once the old Pod has been deleted the replacement Pod is created with a newly generated name rather than reusing
+	// the old name
+	oldPodName := instance.Status.PodName
+	_, err = reconciler.Reconcile(context.Background(), reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "first",
+			Namespace: "test-namespace",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error reconciling first: %v", err)
+	}
+
+	err = client.Get(context.Background(), types.NamespacedName{Name: "first", Namespace: "test-namespace"}, instance)
+	if err != nil {
+		t.Fatalf("Unexpected error getting first: %v", err)
+	}
+
+	if !strings.HasPrefix(instance.Status.PodName, "autoscaler-") || instance.Status.PodName == oldPodName {
+		t.Errorf("Expected newly generated pod name with prefix autoscaler-, got %q (old name %q)", instance.Status.PodName, oldPodName)
+	}
+
+	pod := &corev1.Pod{}
+	err = client.Get(context.Background(), types.NamespacedName{Name: instance.Status.PodName, Namespace: "test-namespace"}, pod)
+	if err != nil {
+		t.Fatalf("Unexpected error getting recreated pod: %v", err)
+	}
+
+	if !cmp.Equal("test-image:v2", pod.Spec.Containers[0].Image) {
+		t.Errorf("Image mismatch (-want +got):\n%s", cmp.Diff("test-image:v2", pod.Spec.Containers[0].Image))
+	}
+}
+
+func TestReconcileGeneratePodNameLaterFailure(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+
+	fclient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(&custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "test-namespace",
+			},
+			Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					ObjectMeta: custompodautoscalercomv1.PodMeta{
+						Name: "autoscaler",
+					},
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "test container",
+							},
+						},
+					},
+				},
+				GeneratePodName:         boolPtr(true),
+				ProvisionServiceMonitor: boolPtr(true),
+			},
+		}).
+		WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).
+		Build()
+
+	podsCreated := 0
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
+		Client: fclient,
+		Scheme: scheme,
+		KubernetesResourceReconciler: &fakek8sReconciler{
+			reconcile: func(
+				reqLogger logr.Logger,
+				instance *custompodautoscalercomv1.CustomPodAutoscaler,
+				obj metav1.Object,
+				shouldProvision bool,
+				updatable bool,
+				kind string,
+			) (reconcile.Result, error) {
+				switch kind {
+				case "v1/Pod":
+					if obj.GetName() == "" {
+						podsCreated++
+						obj.SetName(obj.GetGenerateName() + "generated")
+						return reconcile.Result{}, fclient.Create(context.Background(), obj.(*corev1.Pod))
+					}
+				case "v1/Service":
+					return reconcile.Result{}, errors.New("fail to reconcile Service")
+				}
+				return reconcile.Result{}, nil
+			},
+			podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+				return nil
+			},
+		},
+		Log:                  logr.Discard(),
+		ServiceMonitorServed: true,
+	}
+
+	// The Service fails after the Pod is created in each reconcile, the generated Pod name is saved once the Pod is
+	// created so the Pod is found again rather than another Pod being generated
+	for i := 0; i < 2; i++ {
+		_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      "test",
+				Namespace: "test-namespace",
+			},
+		})
+		if err == nil {
+			t.Fatalf("Expected error reconciling the Service")
+		}
+	}
+
+	if !cmp.Equal(1, podsCreated) {
+		t.Errorf("Pods created mismatch (-want +got):\n%s", cmp.Diff(1, podsCreated))
+	}
+
+	instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+	err := fclient.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, instance)
+	if err != nil {
+		t.Fatalf("Unexpected error getting CPA: %v", err)
+	}
+
+	if !cmp.Equal("autoscaler-generated", instance.Status.PodName) {
+		t.Errorf("Pod name mismatch (-want +got):\n%s", cmp.Diff("autoscaler-generated", instance.Status.PodName))
+	}
+}
+
+func TestReconcileOwnerReferences(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+
+	fclient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(&custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "test-namespace",
+				UID:       "testuid",
+			},
+			Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "test container",
+							},
+						},
+					},
+				},
+			},
+		}).
+		WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).
+		Build()
+
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
+		Client: fclient,
+		Scheme: scheme,
+		KubernetesResourceReconciler: &k8sreconcile.KubernetesResourceReconciler{
+			Client:               fclient,
+			Scheme:               scheme,
+			ControllerReferencer: controllerutil.SetControllerReference,
+		},
+		Log: logr.Discard(),
+	}
+
+	_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "test",
+			Namespace: "test-namespace",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error reconciling: %v", err)
+	}
+
+	var tests = []struct {
+		description string
+		obj         client.Object
+	}{
+		{
+			"Service account",
+			&corev1.ServiceAccount{},
+		},
+		{
+			"Role",
+			&rbacv1.Role{},
+		},
+		{
+			"Role binding",
+			&rbacv1.RoleBinding{},
+		},
+		{
+			"Pod",
+			&corev1.Pod{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := fclient.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, test.obj)
+			if err != nil {
+				t.Fatalf("Unexpected error getting provisioned resource: %v", err)
+			}
+
+			controllerRefs := 0
+			for _, ownerRef := range test.obj.GetOwnerReferences() {
+				if ownerRef.Controller != nil && *ownerRef.Controller {
+					controllerRefs++
+				}
+			}
+			if !cmp.Equal(1, controllerRefs) {
+				t.Fatalf("Controller owner reference count mismatch (-want +got):\n%s", cmp.Diff(1, controllerRefs))
+			}
+
+			controllerRef := metav1.GetControllerOf(test.obj)
+			if !cmp.Equal("test", controllerRef.Name) || !cmp.Equal(types.UID("testuid"), controllerRef.UID) {
+				t.Errorf("Controller owner reference does not point at the CPA: %+v", controllerRef)
+			}
+			if controllerRef.BlockOwnerDeletion == nil || !*controllerRef.BlockOwnerDeletion {
+				t.Errorf("Controller owner reference does not block owner deletion: %+v", controllerRef)
+			}
+		})
+	}
+}
+
+func TestReconcileMetricsRBACMode(t *testing.T) {
+	var tests = []struct {
+		description string
+		expected    rbacv1.PolicyRule
+		mode        custompodautoscalercomv1.MetricsRBACMode
+	}{
+		{
+			"Default to full access",
+			rbacv1.PolicyRule{
+				APIGroups: []string{"metrics.k8s.io", "custom.metrics.k8s.io", "external.metrics.k8s.io"},
+				Resources: []string{"*"},
+				Verbs:     []string{"*"},
+			},
+			"",
+		},
+		{
+			"Full access",
+			rbacv1.PolicyRule{
+				APIGroups: []string{"metrics.k8s.io", "custom.metrics.k8s.io", "external.metrics.k8s.io"},
+				Resources: []string{"*"},
+				Verbs:     []string{"*"},
+			},
+			custompodautoscalercomv1.MetricsRBACModeFull,
+		},
+		{
+			"Read only access",
+			rbacv1.PolicyRule{
+				APIGroups: []string{"metrics.k8s.io", "custom.metrics.k8s.io", "external.metrics.k8s.io"},
+				Resources: []string{"*"},
+				Verbs:     []string{"get", "list"},
+			},
+			custompodautoscalercomv1.MetricsRBACModeReadOnly,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var role *rbacv1.Role
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+					s := runtime.NewScheme()
+					s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+					return s
+				}()).WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test",
+							Namespace: "test-namespace",
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							RoleRequiresMetricsServer: boolPtr(true),
+							MetricsRBACMode:           test.mode,
+						},
+					},
+				).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						provisionedRole, ok := obj.(*rbacv1.Role)
+						if ok {
+							role = provisionedRole
+						}
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log: logr.Discard(),
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if role == nil {
+				t.Fatalf("Role was not provisioned")
+			}
+
+			actual := role.Rules[len(role.Rules)-1]
+			if !cmp.Equal(test.expected, actual) {
+				t.Errorf("Rule mismatch (-want +got):\n%s", cmp.Diff(test.expected, actual))
+			}
+		})
+	}
+}
+
+func TestReconcileScaleTargetRoleRules(t *testing.T) {
+	var tests = []struct {
+		description          string
+		expected             []rbacv1.PolicyRule
+		scaleTargetRoleRules bool
+		scaleTargetRef       autoscalingv1.CrossVersionObjectReference
+	}{
+		{
+			"Disabled, Knative Service target, no rules added",
+			[]rbacv1.PolicyRule{},
+			false,
+			autoscalingv1.CrossVersionObjectReference{
+				APIVersion: "serving.knative.dev/v1",
+				Kind:       "Service",
+				Name:       "test-service",
+			},
+		},
+		{
+			"Enabled, Deployment target covered by the default Role, no rules added",
+			[]rbacv1.PolicyRule{},
+			true,
+			autoscalingv1.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       "test-deployment",
+			},
+		},
+		{
+			"Enabled, Knative Service target, rules added for the target and its scale subresource",
+			[]rbacv1.PolicyRule{
+				{
+					APIGroups:     []string{"serving.knative.dev"},
+					Resources:     []string{"services"},
+					ResourceNames: []string{"test-service"},
+					Verbs:         []string{"get"},
+				},
+				{
+					APIGroups:     []string{"serving.knative.dev"},
+					Resources:     []string{"services/scale"},
+					ResourceNames: []string{"test-service"},
+					Verbs:         []string{"get", "update"},
+				},
+			},
+			true,
+			autoscalingv1.CrossVersionObjectReference{
+				APIVersion: "serving.knative.dev/v1",
+				Kind:       "Service",
+				Name:       "test-service",
+			},
+		},
+		{
+			"Enabled, Argo Rollout target without the Argo Rollouts rule, rules added",
+			[]rbacv1.PolicyRule{
+				{
+					APIGroups:     []string{"argoproj.io"},
+					Resources:     []string{"rollouts"},
+					ResourceNames: []string{"test-rollout"},
+					Verbs:         []string{"get"},
+				},
+				{
+					APIGroups:     []string{"argoproj.io"},
+					Resources:     []string{"rollouts/scale"},
+					ResourceNames: []string{"test-rollout"},
+					Verbs:         []string{"get", "update"},
+				},
+			},
+			true,
+			autoscalingv1.CrossVersionObjectReference{
+				APIVersion: "argoproj.io/v1alpha1",
+				Kind:       "Rollout",
+				Name:       "test-rollout",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var role *rbacv1.Role
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+					s := runtime.NewScheme()
+					s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+					return s
+				}()).WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test",
+							Namespace: "test-namespace",
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							ScaleTargetRef: test.scaleTargetRef,
+						},
+					},
+				).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						provisionedRole, ok := obj.(*rbacv1.Role)
+						if ok {
+							role = provisionedRole
+						}
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log:                  logr.Discard(),
+				ScaleTargetRoleRules: test.scaleTargetRoleRules,
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if role == nil {
+				t.Fatalf("Role was not provisioned")
+			}
+
+			// The first two rules are the default core and apps rules
+			actual := role.Rules[2:]
+			if !cmp.Equal(test.expected, actual) {
+				t.Errorf("Rules mismatch (-want +got):\n%s", cmp.Diff(test.expected, actual))
+			}
+		})
+	}
+}
+
+func TestReconcileScaleTargetAntiAffinity(t *testing.T) {
+	targetTerm := corev1.WeightedPodAffinityTerm{
+		Weight: 100,
+		PodAffinityTerm: corev1.PodAffinityTerm{
+			LabelSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app":  "test-app",
+					"tier": "web",
+				},
+			},
+			TopologyKey: "kubernetes.io/hostname",
+		},
+	}
+	templateTerm := corev1.WeightedPodAffinityTerm{
+		Weight: 50,
+		PodAffinityTerm: corev1.PodAffinityTerm{
+			LabelSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app": "other-autoscaler",
+				},
+			},
+			TopologyKey: "kubernetes.io/hostname",
+		},
+	}
+
+	var tests = []struct {
+		description  string
+		expected     *corev1.Affinity
+		antiAffinity *bool
+		affinity     *corev1.Affinity
+		scaleErr     error
+		selector     string
+	}{
+		{
+			"Not enabled, no anti-affinity",
+			nil,
+			nil,
+			nil,
+			nil,
+			"app=test-app,tier=web",
+		},
+		{
+			"Enabled, anti-affinity against the resolved scale target labels",
+			&corev1.Affinity{
+				PodAntiAffinity: &corev1.PodAntiAffinity{
+					PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{targetTerm},
+				},
+			},
+			boolPtr(true),
+			nil,
+			nil,
+			"app=test-app,tier=web",
+		},
+		{
+			"Enabled, template anti-affinity kept and scale target term appended",
+			&corev1.Affinity{
+				PodAntiAffinity: &corev1.PodAntiAffinity{
+					PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{templateTerm, targetTerm},
+				},
+			},
+			boolPtr(true),
+			&corev1.Affinity{
+				PodAntiAffinity: &corev1.PodAntiAffinity{
+					PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{templateTerm},
+				},
+			},
+			nil,
+			"app=test-app,tier=web",
+		},
+		{
+			"Enabled, scale target does not report a selector, no anti-affinity",
+			nil,
+			boolPtr(true),
+			nil,
+			nil,
+			"",
+		},
+		{
+			"Enabled, scale target not found, no anti-affinity",
+			nil,
+			boolPtr(true),
+			nil,
+			apierrors.NewNotFound(schema.GroupResource{Group: "apps", Resource: "Deployment"}, "test-deployment"),
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var pod *corev1.Pod
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+					s := runtime.NewScheme()
+					s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+					return s
+				}()).WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test",
+							Namespace: "test-namespace",
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							Template: custompodautoscalercomv1.PodTemplateSpec{
+								Spec: custompodautoscalercomv1.PodSpec{
+									Containers: []corev1.Container{
+										{
+											Name: "test container",
+										},
+									},
+									Affinity: test.affinity,
+								},
+							},
+							ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{
+								APIVersion: "apps/v1",
+								Kind:       "Deployment",
+								Name:       "test-deployment",
+							},
+							ScaleTargetAntiAffinity: test.antiAffinity,
+						},
+					},
+				).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						provisionedPod, ok := obj.(*corev1.Pod)
+						if ok {
+							pod = provisionedPod
+						}
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				ScalingClient: &scaleFake.FakeScaleClient{
+					Fake: k8stesting.Fake{
+						ReactionChain: []k8stesting.Reactor{
+							&k8stesting.SimpleReactor{
+								Resource: "*",
+								Verb:     "get",
+								Reaction: func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+									if test.scaleErr != nil {
+										return true, nil, test.scaleErr
+									}
+									return true, &autoscalingv1.Scale{
+										Status: autoscalingv1.ScaleStatus{
+											Selector: test.selector,
+										},
+									}, nil
+								},
+							},
+						},
+					},
+				},
+				Log: logr.Discard(),
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if pod == nil {
+				t.Fatalf("Pod was not provisioned")
+			}
+
+			if !cmp.Equal(test.expected, pod.Spec.Affinity) {
+				t.Errorf("Affinity mismatch (-want +got):\n%s", cmp.Diff(test.expected, pod.Spec.Affinity))
+			}
+		})
+	}
+}
+
+func TestReconcileConfigFiles(t *testing.T) {
+	var tests = []struct {
+		description string
+		expected    *corev1.ConfigMap
+		configFiles map[string]string
+	}{
+		{
+			"No config files, no ConfigMap provisioned",
+			nil,
+			nil,
+		},
+		{
+			"ConfigMap provisioned with config files",
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-config",
+					Namespace: "test-namespace",
+					Labels: map[string]string{
+						"app.kubernetes.io/managed-by": "custom-pod-autoscaler-operator",
+						controllers.OwnedByLabel:       "test",
+					},
+				},
+				Data: map[string]string{
+					"config.yaml": "interval: 10000",
+					"evaluate.py": "print('evaluate')",
+				},
+			},
+			map[string]string{
+				"config.yaml": "interval: 10000",
+				"evaluate.py": "print('evaluate')",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var configMap *corev1.ConfigMap
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+					s := runtime.NewScheme()
+					s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+					return s
+				}()).WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test",
+							Namespace: "test-namespace",
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							ConfigFiles: test.configFiles,
+						},
+					},
+				).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						provisionedConfigMap, ok := obj.(*corev1.ConfigMap)
+						if ok {
+							configMap = provisionedConfigMap
+						}
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log: logr.Discard(),
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expected, configMap) {
+				t.Errorf("ConfigMap mismatch (-want +got):\n%s", cmp.Diff(test.expected, configMap))
+			}
+		})
+	}
+}
+
+func TestReconcileSecretConfig(t *testing.T) {
+	var tests = []struct {
+		description     string
+		expectedSecret  *corev1.Secret
+		expectedEnvFrom []corev1.EnvFromSource
+		secretConfig    map[string]string
+	}{
+		{
+			"No secret config, no Secret provisioned",
+			nil,
+			nil,
+			nil,
+		},
+		{
+			"Secret provisioned with secret config and injected into containers",
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-secret-config",
+					Namespace: "test-namespace",
+					Labels: map[string]string{
+						"app.kubernetes.io/managed-by": "custom-pod-autoscaler-operator",
+						controllers.OwnedByLabel:       "test",
+					},
+				},
+				Type: corev1.SecretTypeOpaque,
+				Data: map[string][]byte{
+					"apiToken": []byte("secret-token"),
+				},
+			},
+			[]corev1.EnvFromSource{
+				{
+					SecretRef: &corev1.SecretEnvSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "test-secret-config",
+						},
+					},
+				},
+			},
+			map[string]string{
+				"apiToken": "secret-token",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var secret *corev1.Secret
+			var pod *corev1.Pod
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+					s := runtime.NewScheme()
+					s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+					return s
+				}()).WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test",
+							Namespace: "test-namespace",
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							Template: custompodautoscalercomv1.PodTemplateSpec{
+								Spec: custompodautoscalercomv1.PodSpec{
+									Containers: []corev1.Container{
+										{
+											Name: "test container",
+										},
+									},
+								},
+							},
+							SecretConfig: test.secretConfig,
+						},
+					},
+				).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						switch provisioned := obj.(type) {
+						case *corev1.Secret:
+							secret = provisioned
+						case *corev1.Pod:
+							pod = provisioned
+						}
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log: logr.Discard(),
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expectedSecret, secret) {
+				t.Errorf("Secret mismatch (-want +got):\n%s", cmp.Diff(test.expectedSecret, secret))
+			}
+
+			if !cmp.Equal(test.expectedEnvFrom, pod.Spec.Containers[0].EnvFrom) {
+				t.Errorf("EnvFrom mismatch (-want +got):\n%s", cmp.Diff(test.expectedEnvFrom, pod.Spec.Containers[0].EnvFrom))
+			}
+
+			_, hasHash := pod.Annotations[controllers.SecretConfigHashAnnotation]
+			if !cmp.Equal(test.secretConfig != nil, hasHash) {
+				t.Errorf("Secret config hash annotation mismatch (-want +got):\n%s", cmp.Diff(test.secretConfig != nil, hasHash))
+			}
+		})
+	}
+}
+
+func TestReconcileServiceAccountDeleted(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+
+	fclient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(&custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "test-namespace",
+			},
+			Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						ImagePullSecrets: []corev1.LocalObjectReference{
+							{
+								Name: "test-pull-secret",
+							},
+						},
+						Containers: []corev1.Container{
+							{
+								Name: "test container",
+							},
+						},
+					},
+				},
+			},
+		}).
+		WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).
+		Build()
+
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
+		Client: fclient,
+		Scheme: scheme,
+		KubernetesResourceReconciler: &k8sreconcile.KubernetesResourceReconciler{
+			Client:               fclient,
+			Scheme:               scheme,
+			ControllerReferencer: controllerutil.SetControllerReference,
+		},
+		Log: logr.Discard(),
+	}
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "test",
+			Namespace: "test-namespace",
+		},
+	}
+
+	_, err := reconciler.Reconcile(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	pod := &corev1.Pod{}
+	err = fclient.Get(context.Background(), request.NamespacedName, pod)
+	if err != nil {
+		t.Fatalf("Unexpected error getting pod: %v", err)
+	}
+
+	// Delete the ServiceAccount out-of-band, the delete event triggers another reconcile
+	err = fclient.Delete(context.Background(), &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "test-namespace",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error deleting service account: %v", err)
+	}
+
+	_, err = reconciler.Reconcile(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	serviceAccount := &corev1.ServiceAccount{}
+	err = fclient.Get(context.Background(), request.NamespacedName, serviceAccount)
+	if err != nil {
+		t.Fatalf("Service account not recreated: %v", err)
+	}
+
+	expectedLabels := map[string]string{
+		"app.kubernetes.io/managed-by": "custom-pod-autoscaler-operator",
+		controllers.OwnedByLabel:       "test",
+	}
+	if !cmp.Equal(expectedLabels, serviceAccount.Labels) {
+		t.Errorf("Service account labels mismatch (-want +got):\n%s", cmp.Diff(expectedLabels, serviceAccount.Labels))
+	}
+
+	// The Pod has not changed so should be left running rather than recreated
+	existingPod := &corev1.Pod{}
+	err = fclient.Get(context.Background(), request.NamespacedName, existingPod)
+	if err != nil {
+		t.Fatalf("Pod not running after service account recreated: %v", err)
+	}
+
+	if !cmp.Equal(pod.UID, existingPod.UID) {
+		t.Errorf("Pod recreated (-want +got):\n%s", cmp.Diff(pod.UID, existingPod.UID))
+	}
+
+	expectedPullSecrets := []corev1.LocalObjectReference{
+		{
+			Name: "test-pull-secret",
+		},
+	}
+	if !cmp.Equal(expectedPullSecrets, existingPod.Spec.ImagePullSecrets) {
+		t.Errorf("Pod pull secrets mismatch (-want +got):\n%s",
+			cmp.Diff(expectedPullSecrets, existingPod.Spec.ImagePullSecrets))
+	}
+}
+
+func TestReconcileAttachPullSecretsToSA(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+
+	fclient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(&custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "test-namespace",
+			},
+			Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						ImagePullSecrets: []corev1.LocalObjectReference{
+							{
+								Name: "test-pull-secret",
+							},
+						},
+						Containers: []corev1.Container{
+							{
+								Name: "test container",
+							},
+						},
+					},
+				},
+				AttachPullSecretsToSA: boolPtr(true),
+			},
+		}).
+		WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).
+		Build()
+
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
+		Client: fclient,
+		Scheme: scheme,
+		KubernetesResourceReconciler: &k8sreconcile.KubernetesResourceReconciler{
+			Client:               fclient,
+			Scheme:               scheme,
+			ControllerReferencer: controllerutil.SetControllerReference,
+		},
+		Log: logr.Discard(),
+	}
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "test",
+			Namespace: "test-namespace",
+		},
+	}
+	serviceAccountPullSecrets := func() []corev1.LocalObjectReference {
+		serviceAccount := &corev1.ServiceAccount{}
+		err := fclient.Get(context.Background(), request.NamespacedName, serviceAccount)
+		if err != nil {
+			t.Fatalf("Unexpected error getting service account: %v", err)
+		}
+		return serviceAccount.ImagePullSecrets
+	}
+
+	_, err := reconciler.Reconcile(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectedPullSecrets := []corev1.LocalObjectReference{
+		{
+			Name: "test-pull-secret",
+		},
+	}
+	pullSecrets := serviceAccountPullSecrets()
+	if !cmp.Equal(expectedPullSecrets, pullSecrets) {
+		t.Errorf("Service account pull secrets mismatch (-want +got):\n%s", cmp.Diff(expectedPullSecrets, pullSecrets))
+	}
+
+	// Changing the pull secrets of the CPA updates the pull secrets of the existing ServiceAccount
+	instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+	err = fclient.Get(context.Background(), request.NamespacedName, instance)
+	if err != nil {
+		t.Fatalf("Unexpected error getting CPA: %v", err)
+	}
+	instance.Spec.Template.Spec.ImagePullSecrets = []corev1.LocalObjectReference{
+		{
+			Name: "test-pull-secret",
+		},
+		{
+			Name: "other-pull-secret",
+		},
+	}
+	err = fclient.Update(context.Background(), instance)
+	if err != nil {
+		t.Fatalf("Unexpected error updating CPA: %v", err)
+	}
+
+	_, err = reconciler.Reconcile(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectedPullSecrets = instance.Spec.Template.Spec.ImagePullSecrets
+	pullSecrets = serviceAccountPullSecrets()
+	if !cmp.Equal(expectedPullSecrets, pullSecrets) {
+		t.Errorf("Service account pull secrets mismatch (-want +got):\n%s", cmp.Diff(expectedPullSecrets, pullSecrets))
+	}
+
+	// Disabling the attachment removes the pull secrets from the ServiceAccount
+	err = fclient.Get(context.Background(), request.NamespacedName, instance)
+	if err != nil {
+		t.Fatalf("Unexpected error getting CPA: %v", err)
+	}
+	instance.Spec.AttachPullSecretsToSA = boolPtr(false)
+	err = fclient.Update(context.Background(), instance)
+	if err != nil {
+		t.Fatalf("Unexpected error updating CPA: %v", err)
+	}
+
+	_, err = reconciler.Reconcile(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	pullSecrets = serviceAccountPullSecrets()
+	if len(pullSecrets) != 0 {
+		t.Errorf("Service account pull secrets not removed, got %v", pullSecrets)
+	}
+}
+
+func TestReconcilePodRecreateCooldown(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+
+	fclient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(&custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "test-namespace",
+			},
+			Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "test container",
+							},
+						},
+					},
+				},
+				PodRecreateCooldownSeconds: int64Ptr(60),
+			},
+		}).
+		WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).
+		Build()
+
+	start := time.Date(2024, time.March, 1, 22, 0, 0, 0, time.UTC)
+	fakeClock := clocktesting.NewFakePassiveClock(start)
+
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
+		Client: fclient,
+		Scheme: scheme,
+		KubernetesResourceReconciler: &k8sreconcile.KubernetesResourceReconciler{
+			Client:               fclient,
+			Scheme:               scheme,
+			ControllerReferencer: controllerutil.SetControllerReference,
+		},
+		Log:   logr.Discard(),
+		Clock: fakeClock,
+	}
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "test",
+			Namespace: "test-namespace",
+		},
+	}
+
+	podExists := func() bool {
+		err := fclient.Get(context.Background(), request.NamespacedName, &corev1.Pod{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			t.Fatalf("Unexpected error getting pod: %v", err)
+		}
+		return err == nil
+	}
+
+	changeImage := func(image string) {
+		instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+		err := fclient.Get(context.Background(), request.NamespacedName, instance)
+		if err != nil {
+			t.Fatalf("Unexpected error getting CPA: %v", err)
+		}
+		instance.Spec.Template.Spec.Containers[0].Image = image
+		err = fclient.Update(context.Background(), instance)
+		if err != nil {
+			t.Fatalf("Unexpected error updating CPA: %v", err)
+		}
+	}
+
+	// Create the Pod, then change the spec to recreate it (delete and create)
+	for i, expectedPod := range []bool{true, false, true} {
+		if i == 1 {
+			changeImage("test-image:v2")
+		}
+		result, err := reconciler.Reconcile(context.Background(), request)
+		if err != nil {
+			t.Fatalf("Unexpected error on reconcile %d: %v", i, err)
+		}
+		if !cmp.Equal(reconcile.Result{}, result) {
+			t.Fatalf("Result mismatch on reconcile %d (-want +got):\n%s", i, cmp.Diff(reconcile.Result{}, result))
+		}
+		if !cmp.Equal(expectedPod, podExists()) {
+			t.Fatalf("Pod exists mismatch on reconcile %d (-want +got):\n%s", i, cmp.Diff(expectedPod, podExists()))
+		}
+	}
+
+	// Another change within the cooldown should not recreate the Pod, instead requeueing once the cooldown has passed
+	fakeClock.SetTime(start.Add(10 * time.Second))
+	changeImage("test-image:v3")
+	result, err := reconciler.Reconcile(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !cmp.Equal(reconcile.Result{RequeueAfter: 50 * time.Second}, result) {
+		t.Errorf("Result mismatch (-want +got):\n%s", cmp.Diff(reconcile.Result{RequeueAfter: 50 * time.Second}, result))
+	}
+	if !podExists() {
+		t.Fatalf("Pod recreated within cooldown")
+	}
+
+	instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+	err = fclient.Get(context.Background(), request.NamespacedName, instance)
+	if err != nil {
+		t.Fatalf("Unexpected error getting CPA: %v", err)
+	}
+	if instance.Status.LastPodRecreateTime == nil || !instance.Status.LastPodRecreateTime.Time.Equal(start) {
+		t.Fatalf("Last Pod recreate time mismatch, expected %s, got %v", start, instance.Status.LastPodRecreateTime)
+	}
+
+	// Once the cooldown has passed the Pod should be recreated
+	fakeClock.SetTime(start.Add(60 * time.Second))
+	result, err = reconciler.Reconcile(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !cmp.Equal(reconcile.Result{}, result) {
+		t.Errorf("Result mismatch (-want +got):\n%s", cmp.Diff(reconcile.Result{}, result))
+	}
+	if podExists() {
+		t.Errorf("Pod not recreated after cooldown")
+	}
+}
+
+func TestReconcileIdentityEnvVars(t *testing.T) {
+	var tests = []struct {
+		description string
+		expected    []corev1.EnvVar
+		inject      *bool
+	}{
+		{
+			"Identity env vars not injected by default",
+			[]corev1.EnvVar{
+				{
+					Name:  "scaleTargetRef",
+					Value: `{"kind":"","name":""}`,
+				},
+				{
+					Name:  "namespace",
+					Value: "test-namespace",
+				},
+			},
+			nil,
+		},
+		{
+			"Identity env vars not injected if disabled",
+			[]corev1.EnvVar{
+				{
+					Name:  "scaleTargetRef",
+					Value: `{"kind":"","name":""}`,
+				},
+				{
+					Name:  "namespace",
+					Value: "test-namespace",
+				},
+			},
+			boolPtr(false),
+		},
+		{
+			"Identity env vars injected if enabled",
+			[]corev1.EnvVar{
+				{
+					Name:  "scaleTargetRef",
+					Value: `{"kind":"","name":""}`,
+				},
+				{
+					Name:  "namespace",
+					Value: "test-namespace",
+				},
+				{
+					Name:  "cpaUID",
+					Value: "testuid",
+				},
+				{
+					Name:  "cpaGeneration",
+					Value: "3",
+				},
+			},
+			boolPtr(true),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var pod *corev1.Pod
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+					s := runtime.NewScheme()
+					s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+					return s
+				}()).WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:       "test",
+							Namespace:  "test-namespace",
+							UID:        "testuid",
+							Generation: 3,
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							Template: custompodautoscalercomv1.PodTemplateSpec{
+								Spec: custompodautoscalercomv1.PodSpec{
+									Containers: []corev1.Container{
+										{
+											Name: "test container",
+										},
+									},
+								},
+							},
+							InjectIdentityEnvVars: test.inject,
+						},
+					},
+				).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						provisionedPod, ok := obj.(*corev1.Pod)
+						if ok {
+							pod = provisionedPod
+						}
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log: logr.Discard(),
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if pod == nil {
+				t.Fatalf("Pod was not provisioned")
+			}
+
+			if !cmp.Equal(test.expected, pod.Spec.Containers[0].Env) {
+				t.Errorf("Env vars mismatch (-want +got):\n%s", cmp.Diff(test.expected, pod.Spec.Containers[0].Env))
+			}
+		})
+	}
+}
+
+func TestReconcileCorrelationID(t *testing.T) {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+		&custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "test",
+				Namespace:  "test-namespace",
+				UID:        "testuid",
+				Generation: 1,
+			},
+			Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "test container",
+							},
+						},
+					},
+				},
+				InjectCorrelationID: boolPtr(true),
+			},
+		},
+	).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build()
+
+	var pod *corev1.Pod
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
+		Client: client,
+		Scheme: runtime.NewScheme(),
+		KubernetesResourceReconciler: &fakek8sReconciler{
+			reconcile: func(
+				reqLogger logr.Logger,
+				instance *custompodautoscalercomv1.CustomPodAutoscaler,
+				obj metav1.Object,
+				shouldProvision bool,
+				updatable bool,
+				kind string,
+			) (reconcile.Result, error) {
+				provisionedPod, ok := obj.(*corev1.Pod)
+				if ok {
+					pod = provisionedPod
+				}
+				return reconcile.Result{}, nil
+			},
+			podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+				return nil
+			},
+		},
+		Log: logr.Discard(),
+	}
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "test",
+			Namespace: "test-namespace",
+		},
+	}
+	correlationIDs := []string{}
+	for i := 0; i < 2; i++ {
+		pod = nil
+		_, err := reconciler.Reconcile(context.Background(), request)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if pod == nil {
+			t.Fatalf("Pod was not provisioned on reconcile %d", i+1)
+		}
+		for _, envVar := range pod.Spec.Containers[0].Env {
+			if envVar.Name == "cpaCorrelationID" {
+				correlationIDs = append(correlationIDs, envVar.Value)
+			}
+		}
+
+		// Change the spec between reconciles, the correlation ID only depends on the UID
+		instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+		err = client.Get(context.Background(), request.NamespacedName, instance)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		instance.Spec.Config = []custompodautoscalercomv1.CustomPodAutoscalerConfig{
+			{
+				Name:  "interval",
+				Value: "15000",
+			},
+		}
+		instance.Generation++
+		err = client.Update(context.Background(), instance)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	expected := []string{"998adaeb374a0f3d", "998adaeb374a0f3d"}
+	if !cmp.Equal(expected, correlationIDs) {
+		t.Errorf("Correlation IDs mismatch (-want +got):\n%s", cmp.Diff(expected, correlationIDs))
+	}
+}
+
+func TestReconcileInitialStabilizationSeconds(t *testing.T) {
+	created := metav1.NewTime(time.Date(2024, time.March, 1, 22, 0, 0, 0, time.UTC))
+
+	var tests = []struct {
+		description                 string
+		expected                    []corev1.EnvVar
+		initialStabilizationSeconds *int32
+		config                      []custompodautoscalercomv1.CustomPodAutoscalerConfig
+	}{
+		{
+			"Initial stabilization not injected by default",
+			[]corev1.EnvVar{
+				{
+					Name:  "scaleTargetRef",
+					Value: `{"kind":"","name":""}`,
+				},
+				{
+					Name:  "namespace",
+					Value: "test-namespace",
+				},
+			},
+			nil,
+			nil,
+		},
+		{
+			"Initial stabilization injected if set",
+			[]corev1.EnvVar{
+				{
+					Name:  "scaleTargetRef",
+					Value: `{"kind":"","name":""}`,
+				},
+				{
+					Name:  "namespace",
+					Value: "test-namespace",
+				},
+				{
+					Name:  "initialStabilizationSeconds",
+					Value: "120",
+				},
+			},
+			int32Ptr(120),
+			nil,
+		},
+		{
+			"Initial stabilization config option takes precedence",
+			[]corev1.EnvVar{
+				{
+					Name:  "scaleTargetRef",
+					Value: `{"kind":"","name":""}`,
+				},
+				{
+					Name:  "namespace",
+					Value: "test-namespace",
+				},
+				{
+					Name:  "initialStabilizationSeconds",
+					Value: "30",
+				},
+			},
+			int32Ptr(120),
+			[]custompodautoscalercomv1.CustomPodAutoscalerConfig{
+				{
+					Name:  "initialStabilizationSeconds",
+					Value: "30",
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			client := fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+				s := runtime.NewScheme()
+				s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+				return s
+			}()).WithRuntimeObjects(
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						Template: custompodautoscalercomv1.PodTemplateSpec{
+							Spec: custompodautoscalercomv1.PodSpec{
+								Containers: []corev1.Container{
+									{
+										Name: "test container",
+									},
+								},
+							},
+						},
+						Config:                      test.config,
+						InitialStabilizationSeconds: test.initialStabilizationSeconds,
+					},
+				},
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build()
+
+			var pod *corev1.Pod
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: client,
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						provisionedPod, ok := obj.(*corev1.Pod)
+						if ok {
+							// Read back with the creation time set by the API server
+							provisionedPod.CreationTimestamp = created
+							pod = provisionedPod
+						}
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log: logr.Discard(),
+			}
+			request := reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			}
+			_, err := reconciler.Reconcile(context.Background(), request)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if pod == nil {
+				t.Fatalf("Pod was not provisioned")
+			}
+
+			if !cmp.Equal(test.expected, pod.Spec.Containers[0].Env) {
+				t.Errorf("Env vars mismatch (-want +got):\n%s", cmp.Diff(test.expected, pod.Spec.Containers[0].Env))
+			}
+
+			instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err = client.Get(context.Background(), request.NamespacedName, instance)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !cmp.Equal(&created, instance.Status.PodProvisionedTime) {
+				t.Errorf("Pod provisioned time mismatch (-want +got):\n%s", cmp.Diff(&created, instance.Status.PodProvisionedTime))
+			}
+		})
+	}
+}
+
+func TestReconcileRequiredLabels(t *testing.T) {
+	var tests = []struct {
+		description         string
+		expectedProvisioned map[string]map[string]string
+		expectedCondition   *metav1.Condition
+		requiredLabels      []string
+		labels              map[string]string
+	}{
+		{
+			"No required labels, provision without condition",
+			map[string]map[string]string{
+				"v1/ServiceAccount": {
+					"app.kubernetes.io/managed-by":        "custom-pod-autoscaler-operator",
+					"v1.custompodautoscaler.com/owned-by": "test",
+				},
+				"v1/Role": {
+					"app.kubernetes.io/managed-by":        "custom-pod-autoscaler-operator",
+					"v1.custompodautoscaler.com/owned-by": "test",
+				},
+				"v1/RoleBinding": {
+					"app.kubernetes.io/managed-by":        "custom-pod-autoscaler-operator",
+					"v1.custompodautoscaler.com/owned-by": "test",
+				},
+				"v1/Pod": {
+					"app.kubernetes.io/managed-by":        "custom-pod-autoscaler-operator",
+					"v1.custompodautoscaler.com/owned-by": "test",
+				},
+			},
+			nil,
+			nil,
+			map[string]string{
+				"team": "test-team",
+			},
+		},
+		{
+			"Missing required labels, block provisioning and set condition",
+			map[string]map[string]string{},
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionRequiredLabels,
+				Status:             metav1.ConditionFalse,
+				Reason:             "MissingRequiredLabels",
+				Message:            "Missing required labels: cost-center",
+				ObservedGeneration: 2,
+			},
+			[]string{"team", "cost-center"},
+			map[string]string{
+				"team": "test-team",
+			},
+		},
+		{
+			"Required labels present, copy labels to resources and set condition",
+			map[string]map[string]string{
+				"v1/ServiceAccount": {
+					"app.kubernetes.io/managed-by":        "custom-pod-autoscaler-operator",
+					"v1.custompodautoscaler.com/owned-by": "test",
+					"team":                                "test-team",
+					"cost-center":                         "1234",
+				},
+				"v1/Role": {
+					"app.kubernetes.io/managed-by":        "custom-pod-autoscaler-operator",
+					"v1.custompodautoscaler.com/owned-by": "test",
+					"team":                                "test-team",
+					"cost-center":                         "1234",
+				},
+				"v1/RoleBinding": {
+					"app.kubernetes.io/managed-by":        "custom-pod-autoscaler-operator",
+					"v1.custompodautoscaler.com/owned-by": "test",
+					"team":                                "test-team",
+					"cost-center":                         "1234",
+				},
+				"v1/Pod": {
+					"app.kubernetes.io/managed-by":        "custom-pod-autoscaler-operator",
+					"v1.custompodautoscaler.com/owned-by": "test",
+					"team":                                "test-team",
+					"cost-center":                         "1234",
+				},
+			},
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionRequiredLabels,
+				Status:             metav1.ConditionTrue,
+				Reason:             "RequiredLabelsPresent",
+				Message:            "All required labels are present",
+				ObservedGeneration: 2,
+			},
+			[]string{"team", "cost-center"},
+			map[string]string{
+				"team":        "test-team",
+				"cost-center": "1234",
+				"unrequired":  "test",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			provisioned := map[string]map[string]string{}
+			fclient := fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+				s := runtime.NewScheme()
+				s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+				return s
+			}()).WithRuntimeObjects(
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:       "test",
+						Namespace:  "test-namespace",
+						Generation: 2,
+						Labels:     test.labels,
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						Template: custompodautoscalercomv1.PodTemplateSpec{
+							Spec: custompodautoscalercomv1.PodSpec{
+								Containers: []corev1.Container{
+									{
+										Name: "test container",
+									},
+								},
+							},
+						},
+					},
+				},
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build()
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fclient,
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						provisioned[kind] = obj.GetLabels()
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log:            logr.Discard(),
+				RequiredLabels: test.requiredLabels,
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expectedProvisioned, provisioned) {
+				t.Errorf("Provisioned labels mismatch (-want +got):\n%s", cmp.Diff(test.expectedProvisioned, provisioned))
+			}
+
+			cpa := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err = fclient.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, cpa)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			condition := meta.FindStatusCondition(cpa.Status.Conditions, custompodautoscalercomv1.ConditionRequiredLabels)
+			if !cmp.Equal(test.expectedCondition, condition, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")) {
+				t.Errorf("Condition mismatch (-want +got):\n%s", cmp.Diff(test.expectedCondition, condition, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")))
+			}
+		})
+	}
+}
+
+func TestReconcileMaintenanceWindow(t *testing.T) {
+	// Window opens every Friday at 22:00 and stays open for 2 hours
+	window, err := controllers.ParseMaintenanceWindow("0 22 * * 5", 2*time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var tests = []struct {
+		description         string
+		expected            reconcile.Result
+		expectedProvisioned []string
+		maintenanceWindow   *controllers.MaintenanceWindow
+		now                 time.Time
+	}{
+		{
+			"No maintenance window, provision",
+			reconcile.Result{},
+			[]string{"v1/ServiceAccount", "v1/Role", "v1/RoleBinding", "v1/Pod"},
+			nil,
+			time.Date(2024, time.March, 1, 23, 0, 0, 0, time.Local),
+		},
+		{
+			"Outside maintenance window, provision",
+			reconcile.Result{},
+			[]string{"v1/ServiceAccount", "v1/Role", "v1/RoleBinding", "v1/Pod"},
+			window,
+			time.Date(2024, time.March, 1, 21, 0, 0, 0, time.Local),
+		},
+		{
+			"In maintenance window, requeue until window closes without provisioning",
+			reconcile.Result{RequeueAfter: time.Hour},
+			[]string{},
+			window,
+			time.Date(2024, time.March, 1, 23, 0, 0, 0, time.Local),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			provisioned := []string{}
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+					s := runtime.NewScheme()
+					s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+					return s
+				}()).WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test",
+							Namespace: "test-namespace",
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							Template: custompodautoscalercomv1.PodTemplateSpec{
+								Spec: custompodautoscalercomv1.PodSpec{
+									Containers: []corev1.Container{
+										{
+											Name: "test container",
+										},
+									},
+								},
+							},
+						},
+					},
+				).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						provisioned = append(provisioned, kind)
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log:               logr.Discard(),
+				MaintenanceWindow: test.maintenanceWindow,
+				Clock:             clocktesting.NewFakePassiveClock(test.now),
+			}
+			result, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expected, result) {
+				t.Errorf("Result mismatch (-want +got):\n%s", cmp.Diff(test.expected, result))
+			}
+
+			if !cmp.Equal(test.expectedProvisioned, provisioned) {
+				t.Errorf("Provisioned mismatch (-want +got):\n%s", cmp.Diff(test.expectedProvisioned, provisioned))
+			}
+		})
+	}
+}
+
+func TestReconcilePauseLifecycle(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+
+	fclient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			&custompodautoscalercomv1.CustomPodAutoscaler{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+				Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+					Template: custompodautoscalercomv1.PodTemplateSpec{
+						Spec: custompodautoscalercomv1.PodSpec{
+							Containers: []corev1.Container{
+								{
+									Name: "test container",
+								},
+							},
+						},
+					},
+					ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{
+						APIVersion: "apps/v1",
+						Kind:       "Deployment",
+						Name:       "test-deployment",
+					},
+				},
+			},
+			&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-deployment",
+					Namespace: "test-namespace",
+				},
+			},
+		).
+		WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).
+		Build()
+
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
+		Client: fclient,
+		Scheme: scheme,
+		KubernetesResourceReconciler: &k8sreconcile.KubernetesResourceReconciler{
+			Client:               fclient,
+			Scheme:               scheme,
+			ControllerReferencer: controllerutil.SetControllerReference,
+		},
+		ScalingClient: &scaleFake.FakeScaleClient{
+			Fake: k8stesting.Fake{
+				ReactionChain: []k8stesting.Reactor{
+					&k8stesting.SimpleReactor{
+						Resource: "*",
+						Verb:     "*",
+						Reaction: func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+							return true, &autoscalingv1.Scale{}, nil
+						},
+					},
+				},
+			},
+		},
+		Log: logr.Discard(),
+	}
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "test",
+			Namespace: "test-namespace",
+		},
+	}
+
+	var tests = []struct {
+		description       string
+		paused            bool
+		expectedAnnotated bool
+		expectedStatus    bool
+		expectedPodExists bool
+	}{
+		{
+			"Not paused, Pod provisioned and target not annotated",
+			false,
+			false,
+			false,
+			true,
+		},
+		{
+			"Paused, Pod deleted and target annotated",
+			true,
+			true,
+			true,
+			false,
+		},
+		{
+			"Resumed, Pod provisioned and target annotation removed",
+			false,
+			false,
+			false,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err := fclient.Get(context.Background(), request.NamespacedName, instance)
+			if err != nil {
+				t.Fatalf("Unexpected error getting CPA: %v", err)
+			}
+			if test.paused {
+				instance.Annotations = map[string]string{
+					controllers.PausedReplicasAnnotation: "5",
+				}
+			} else {
+				instance.Annotations = nil
+			}
+			err = fclient.Update(context.Background(), instance)
+			if err != nil {
+				t.Fatalf("Unexpected error updating CPA: %v", err)
+			}
+
+			_, err = reconciler.Reconcile(context.Background(), request)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			deployment := &appsv1.Deployment{}
+			err = fclient.Get(context.Background(), types.NamespacedName{Name: "test-deployment", Namespace: "test-namespace"}, deployment)
+			if err != nil {
+				t.Fatalf("Unexpected error getting deployment: %v", err)
+			}
+			_, annotated := deployment.Annotations[controllers.ManagedPauseAnnotation]
+			if !cmp.Equal(test.expectedAnnotated, annotated) {
+				t.Errorf("Annotated mismatch (-want +got):\n%s", cmp.Diff(test.expectedAnnotated, annotated))
+			}
+
+			instance = &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err = fclient.Get(context.Background(), request.NamespacedName, instance)
+			if err != nil {
+				t.Fatalf("Unexpected error getting CPA: %v", err)
+			}
+			if !cmp.Equal(test.expectedStatus, instance.Status.ScaleTargetPaused) {
+				t.Errorf("Status mismatch (-want +got):\n%s", cmp.Diff(test.expectedStatus, instance.Status.ScaleTargetPaused))
+			}
+
+			err = fclient.Get(context.Background(), request.NamespacedName, &corev1.Pod{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				t.Fatalf("Unexpected error getting pod: %v", err)
+			}
+			podExists := err == nil
+			if !cmp.Equal(test.expectedPodExists, podExists) {
+				t.Errorf("Pod exists mismatch (-want +got):\n%s", cmp.Diff(test.expectedPodExists, podExists))
+			}
+		})
+	}
+}
+
+func TestReconcilePauseScaleTargetNotFound(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+
+	fclient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			&custompodautoscalercomv1.CustomPodAutoscaler{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test-namespace",
+					Annotations: map[string]string{
+						controllers.PausedReplicasAnnotation: "5",
+					},
+				},
+				Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+					ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{
+						APIVersion: "apps/v1",
+						Kind:       "Deployment",
+						Name:       "test-deployment",
+					},
+				},
+			},
+		).
+		WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).
+		Build()
+
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
+		Client: fclient,
+		Scheme: scheme,
+		ScalingClient: &scaleFake.FakeScaleClient{
+			Fake: k8stesting.Fake{
+				ReactionChain: []k8stesting.Reactor{
+					&k8stesting.SimpleReactor{
+						Resource: "*",
+						Verb:     "*",
+						Reaction: func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+							return true, &autoscalingv1.Scale{}, nil
+						},
+					},
+				},
+			},
+		},
+		Log: logr.Discard(),
+	}
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "test",
+			Namespace: "test-namespace",
+		},
+	}
+
+	// The scale target being removed while paused should not fail and requeue every reconcile
+	result, err := reconciler.Reconcile(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !cmp.Equal(reconcile.Result{}, result) {
+		t.Errorf("Result mismatch (-want +got):\n%s", cmp.Diff(reconcile.Result{}, result))
+	}
+
+	instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+	err = fclient.Get(context.Background(), request.NamespacedName, instance)
+	if err != nil {
+		t.Fatalf("Unexpected error getting CPA: %v", err)
+	}
+	if instance.Status.ScaleTargetPaused {
+		t.Errorf("Missing scale target tracked as paused")
+	}
+}
+
+func TestReconcilePauseUntil(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+
+	fclient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			&custompodautoscalercomv1.CustomPodAutoscaler{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+				Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+					Template: custompodautoscalercomv1.PodTemplateSpec{
+						Spec: custompodautoscalercomv1.PodSpec{
+							Containers: []corev1.Container{
+								{
+									Name: "test container",
+								},
+							},
+						},
+					},
+					ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{
+						APIVersion: "apps/v1",
+						Kind:       "Deployment",
+						Name:       "test-deployment",
+					},
+				},
+			},
+			&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-deployment",
+					Namespace: "test-namespace",
+				},
+			},
+		).
+		WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).
+		Build()
+
+	start := time.Date(2024, time.March, 1, 22, 0, 0, 0, time.UTC)
+	fakeClock := clocktesting.NewFakePassiveClock(start)
+
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
+		Client: fclient,
+		Scheme: scheme,
+		KubernetesResourceReconciler: &k8sreconcile.KubernetesResourceReconciler{
+			Client:               fclient,
+			Scheme:               scheme,
+			ControllerReferencer: controllerutil.SetControllerReference,
+		},
+		ScalingClient: &scaleFake.FakeScaleClient{
+			Fake: k8stesting.Fake{
+				ReactionChain: []k8stesting.Reactor{
+					&k8stesting.SimpleReactor{
+						Resource: "*",
+						Verb:     "*",
+						Reaction: func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+							return true, &autoscalingv1.Scale{}, nil
+						},
+					},
+				},
+			},
+		},
+		Log:   logr.Discard(),
+		Clock: fakeClock,
+	}
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "test",
+			Namespace: "test-namespace",
+		},
+	}
+
+	var tests = []struct {
+		description       string
+		expected          reconcile.Result
+		expectedErr       string
+		expectedAnnotated bool
+		expectedPodExists bool
+		annotations       map[string]string
+		now               time.Time
+	}{
+		{
+			"Paused with replicas, Pod deleted and requeue once the pause ends",
+			reconcile.Result{RequeueAfter: time.Hour},
+			"",
+			true,
+			false,
+			map[string]string{
+				controllers.PauseUntilAnnotation:     "2024-03-01T23:00:00Z",
+				controllers.PausedReplicasAnnotation: "5",
+			},
+			start,
+		},
+		{
+			"Still paused, requeue once the pause ends",
+			reconcile.Result{RequeueAfter: 30 * time.Minute},
+			"",
+			true,
+			false,
+			map[string]string{
+				controllers.PauseUntilAnnotation:     "2024-03-01T23:00:00Z",
+				controllers.PausedReplicasAnnotation: "5",
+			},
+			start.Add(30 * time.Minute),
+		},
+		{
+			"Pause ended, automatically resumed",
+			reconcile.Result{},
+			"",
+			false,
+			true,
+			map[string]string{
+				controllers.PauseUntilAnnotation:     "2024-03-01T23:00:00Z",
+				controllers.PausedReplicasAnnotation: "5",
+			},
+			start.Add(time.Hour),
+		},
+		{
+			"Paused without replicas, Pod deleted without scaling the target",
+			reconcile.Result{RequeueAfter: 2 * time.Hour},
+			"",
+			false,
+			false,
+			map[string]string{
+				controllers.PauseUntilAnnotation: "2024-03-02T01:00:00Z",
+			},
+			start.Add(time.Hour),
+		},
+		{
+			"Pause without replicas ended, automatically resumed",
+			reconcile.Result{},
+			"",
+			false,
+			true,
+			map[string]string{
+				controllers.PauseUntilAnnotation: "2024-03-02T01:00:00Z",
+			},
+			start.Add(3 * time.Hour),
+		},
+		{
+			"Invalid pause until time, error",
+			reconcile.Result{},
+			`parsing time "tomorrow" as "2006-01-02T15:04:05Z07:00": cannot parse "tomorrow" as "2006"`,
+			false,
+			true,
+			map[string]string{
+				controllers.PauseUntilAnnotation: "tomorrow",
+			},
+			start.Add(3 * time.Hour),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			fakeClock.SetTime(test.now)
+
+			instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err := fclient.Get(context.Background(), request.NamespacedName, instance)
+			if err != nil {
+				t.Fatalf("Unexpected error getting CPA: %v", err)
+			}
+			instance.Annotations = test.annotations
+			err = fclient.Update(context.Background(), instance)
+			if err != nil {
+				t.Fatalf("Unexpected error updating CPA: %v", err)
+			}
+
+			result, err := reconciler.Reconcile(context.Background(), request)
+			errMessage := ""
+			if err != nil {
+				errMessage = err.Error()
+			}
+			if !cmp.Equal(test.expectedErr, errMessage) {
+				t.Errorf("Error mismatch (-want +got):\n%s", cmp.Diff(test.expectedErr, errMessage))
+			}
+
+			if !cmp.Equal(test.expected, result) {
+				t.Errorf("Result mismatch (-want +got):\n%s", cmp.Diff(test.expected, result))
+			}
+
+			deployment := &appsv1.Deployment{}
+			err = fclient.Get(context.Background(), types.NamespacedName{Name: "test-deployment", Namespace: "test-namespace"}, deployment)
+			if err != nil {
+				t.Fatalf("Unexpected error getting deployment: %v", err)
+			}
+			_, annotated := deployment.Annotations[controllers.ManagedPauseAnnotation]
+			if !cmp.Equal(test.expectedAnnotated, annotated) {
+				t.Errorf("Annotated mismatch (-want +got):\n%s", cmp.Diff(test.expectedAnnotated, annotated))
+			}
+
+			err = fclient.Get(context.Background(), request.NamespacedName, &corev1.Pod{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				t.Fatalf("Unexpected error getting pod: %v", err)
+			}
+			podExists := err == nil
+			if !cmp.Equal(test.expectedPodExists, podExists) {
+				t.Errorf("Pod exists mismatch (-want +got):\n%s", cmp.Diff(test.expectedPodExists, podExists))
+			}
+		})
+	}
+}
+
+func TestReconcilePausedMinReplicas(t *testing.T) {
+	var tests = []struct {
+		description      string
+		expectedReplicas *int32
+		annotations      map[string]string
+		currentReplicas  int32
+	}{
+		{
+			"Current replicas below paused minimum, raise to minimum",
+			int32Ptr(5),
+			map[string]string{
+				controllers.PausedMinReplicasAnnotation: "5",
+			},
+			2,
+		},
+		{
+			"Current replicas above paused minimum, leave unchanged",
+			nil,
+			map[string]string{
+				controllers.PausedMinReplicasAnnotation: "5",
+			},
+			8,
+		},
+		{
+			"Current replicas equal to paused minimum, leave unchanged",
+			nil,
+			map[string]string{
+				controllers.PausedMinReplicasAnnotation: "5",
+			},
+			5,
+		},
+		{
+			"Paused replicas takes precedence over paused minimum",
+			int32Ptr(3),
+			map[string]string{
+				controllers.PausedReplicasAnnotation:    "3",
+				controllers.PausedMinReplicasAnnotation: "5",
+			},
+			8,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+			utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+
+			fclient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:        "test",
+							Namespace:   "test-namespace",
+							Annotations: test.annotations,
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{
+								APIVersion: "apps/v1",
+								Kind:       "Deployment",
+								Name:       "test-deployment",
+							},
+						},
+					},
+					&appsv1.Deployment{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test-deployment",
+							Namespace: "test-namespace",
+						},
+					},
+				).
+				WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).
+				Build()
+
+			var updatedReplicas *int32
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fclient,
+				Scheme: scheme,
+				ScalingClient: &scaleFake.FakeScaleClient{
+					Fake: k8stesting.Fake{
+						ReactionChain: []k8stesting.Reactor{
+							&k8stesting.SimpleReactor{
+								Resource: "*",
+								Verb:     "get",
+								Reaction: func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+									return true, &autoscalingv1.Scale{
+										Spec: autoscalingv1.ScaleSpec{
+											Replicas: test.currentReplicas,
+										},
+									}, nil
+								},
+							},
+							&k8stesting.SimpleReactor{
+								Resource: "*",
+								Verb:     "update",
+								Reaction: func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+									scale := action.(k8stesting.UpdateAction).GetObject().(*autoscalingv1.Scale)
+									updatedReplicas = &scale.Spec.Replicas
+									return true, scale, nil
+								},
+							},
+						},
+					},
+				},
+				Log: logr.Discard(),
+			}
+
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expectedReplicas, updatedReplicas) {
+				t.Errorf("Updated replicas mismatch (-want +got):\n%s", cmp.Diff(test.expectedReplicas, updatedReplicas))
+			}
+
+			instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err = fclient.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, instance)
+			if err != nil {
+				t.Fatalf("Unexpected error getting CPA: %v", err)
+			}
+			if !instance.Status.ScaleTargetPaused {
+				t.Errorf("Expected scale target to be tracked as paused")
+			}
+		})
+	}
+}
+
+func TestReconcilePausedStatefulSetUpdating(t *testing.T) {
+	var tests = []struct {
+		description       string
+		expectedReplicas  *int32
+		expectedRequeue   time.Duration
+		expectedCondition *metav1.Condition
+		expectedPaused    bool
+		waitForUpdate     *bool
+		statefulSetStatus appsv1.StatefulSetStatus
+	}{
+		{
+			"Wait for update not set, update in progress, set paused replicas",
+			int32Ptr(3),
+			0,
+			nil,
+			true,
+			nil,
+			appsv1.StatefulSetStatus{
+				ObservedGeneration: 2,
+				CurrentRevision:    "test-statefulset-1",
+				UpdateRevision:     "test-statefulset-2",
+			},
+		},
+		{
+			"Wait for update, partitioned update in progress, wait and requeue",
+			nil,
+			15 * time.Second,
+			&metav1.Condition{
+				Type:   custompodautoscalercomv1.ConditionTargetUpdating,
+				Status: metav1.ConditionTrue,
+				Reason: "StatefulSetUpdating",
+				Message: "StatefulSet test-statefulset has an update in progress from revision test-statefulset-1 to " +
+					"test-statefulset-2, waiting to set paused replicas",
+			},
+			false,
+			boolPtr(true),
+			appsv1.StatefulSetStatus{
+				ObservedGeneration: 2,
+				CurrentRevision:    "test-statefulset-1",
+				UpdateRevision:     "test-statefulset-2",
+			},
+		},
+		{
+			"Wait for update, update not yet observed, wait and requeue",
+			nil,
+			15 * time.Second,
+			&metav1.Condition{
+				Type:   custompodautoscalercomv1.ConditionTargetUpdating,
+				Status: metav1.ConditionTrue,
+				Reason: "StatefulSetUpdating",
+				Message: "StatefulSet test-statefulset has an update in progress from revision test-statefulset-1 to " +
+					"test-statefulset-1, waiting to set paused replicas",
+			},
+			false,
+			boolPtr(true),
+			appsv1.StatefulSetStatus{
+				ObservedGeneration: 1,
+				CurrentRevision:    "test-statefulset-1",
+				UpdateRevision:     "test-statefulset-1",
+			},
+		},
+		{
+			"Wait for update, no update in progress, set paused replicas",
+			int32Ptr(3),
+			0,
+			&metav1.Condition{
+				Type:    custompodautoscalercomv1.ConditionTargetUpdating,
+				Status:  metav1.ConditionFalse,
+				Reason:  "TargetNotUpdating",
+				Message: "StatefulSet test-statefulset has no update in progress",
+			},
+			true,
+			boolPtr(true),
+			appsv1.StatefulSetStatus{
+				ObservedGeneration: 2,
+				CurrentRevision:    "test-statefulset-2",
+				UpdateRevision:     "test-statefulset-2",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+			utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+
+			fclient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test",
+							Namespace: "test-namespace",
+							Annotations: map[string]string{
+								controllers.PausedReplicasAnnotation: "3",
+							},
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{
+								APIVersion: "apps/v1",
+								Kind:       "StatefulSet",
+								Name:       "test-statefulset",
+							},
+							WaitForTargetUpdate: test.waitForUpdate,
+						},
+					},
+					&appsv1.StatefulSet{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:       "test-statefulset",
+							Namespace:  "test-namespace",
+							Generation: 2,
+						},
+						Spec: appsv1.StatefulSetSpec{
+							UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+								Type: appsv1.RollingUpdateStatefulSetStrategyType,
+								RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{
+									Partition: int32Ptr(2),
+								},
+							},
+						},
+						Status: test.statefulSetStatus,
+					},
+				).
+				WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}, &appsv1.StatefulSet{}).
+				Build()
+
+			var updatedReplicas *int32
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fclient,
+				Scheme: scheme,
+				ScalingClient: &scaleFake.FakeScaleClient{
+					Fake: k8stesting.Fake{
+						ReactionChain: []k8stesting.Reactor{
+							&k8stesting.SimpleReactor{
+								Resource: "*",
+								Verb:     "get",
+								Reaction: func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+									return true, &autoscalingv1.Scale{
+										Spec: autoscalingv1.ScaleSpec{
+											Replicas: 5,
+										},
+									}, nil
+								},
+							},
+							&k8stesting.SimpleReactor{
+								Resource: "*",
+								Verb:     "update",
+								Reaction: func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+									scale := action.(k8stesting.UpdateAction).GetObject().(*autoscalingv1.Scale)
+									updatedReplicas = &scale.Spec.Replicas
+									return true, scale, nil
+								},
+							},
+						},
+					},
+				},
+				Log: logr.Discard(),
+			}
+
+			result, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expectedReplicas, updatedReplicas) {
+				t.Errorf("Updated replicas mismatch (-want +got):\n%s", cmp.Diff(test.expectedReplicas, updatedReplicas))
+			}
+
+			if !cmp.Equal(test.expectedRequeue, result.RequeueAfter) {
+				t.Errorf("Requeue mismatch (-want +got):\n%s", cmp.Diff(test.expectedRequeue, result.RequeueAfter))
+			}
+
+			instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err = fclient.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, instance)
+			if err != nil {
+				t.Fatalf("Unexpected error getting CPA: %v", err)
+			}
+
+			if !cmp.Equal(test.expectedPaused, instance.Status.ScaleTargetPaused) {
+				t.Errorf("Paused mismatch (-want +got):\n%s", cmp.Diff(test.expectedPaused, instance.Status.ScaleTargetPaused))
+			}
+
+			condition := meta.FindStatusCondition(instance.Status.Conditions, custompodautoscalercomv1.ConditionTargetUpdating)
+			if !cmp.Equal(test.expectedCondition, condition, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")) {
+				t.Errorf("Condition mismatch (-want +got):\n%s", cmp.Diff(test.expectedCondition, condition, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")))
+			}
+		})
+	}
+}
+
+func TestReconcileEnvVarsSize(t *testing.T) {
+	var tests = []struct {
+		description       string
+		expectedStatus    metav1.ConditionStatus
+		expectedReason    string
+		expectedEvents    []string
+		config            []custompodautoscalercomv1.CustomPodAutoscalerConfig
+		envVarsThreshold  int
+		expectedCondition bool
+	}{
+		{
+			"Threshold disabled, no condition set",
+			"",
+			"",
+			[]string{},
+			[]custompodautoscalercomv1.CustomPodAutoscalerConfig{
+				{
+					Name:  "evaluate",
+					Value: strings.Repeat("a", 1024),
+				},
+			},
+			0,
+			false,
+		},
+		{
+			"Environment variables within threshold, condition false and no event",
+			metav1.ConditionFalse,
+			"EnvVarsWithinThreshold",
+			[]string{},
+			[]custompodautoscalercomv1.CustomPodAutoscalerConfig{
+				{
+					Name:  "interval",
+					Value: "10000",
+				},
+			},
+			1024,
+			true,
+		},
+		{
+			"Oversized config, condition true and warning event",
+			metav1.ConditionTrue,
+			"EnvVarsExceedThreshold",
+			[]string{
+				"Warning LargeEnvVars Environment variables of container test container are 1090 bytes, exceeding " +
+					"the 1024 byte threshold, provide large configuration using configFiles instead",
+			},
+			[]custompodautoscalercomv1.CustomPodAutoscalerConfig{
+				{
+					Name:  "evaluate",
+					Value: strings.Repeat("a", 1024),
+				},
+			},
+			1024,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+			utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+
+			fclient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						Template: custompodautoscalercomv1.PodTemplateSpec{
+							Spec: custompodautoscalercomv1.PodSpec{
+								Containers: []corev1.Container{
+									{
+										Name: "test container",
+									},
+								},
+							},
+						},
+						Config: test.config,
+					},
+				}).
+				WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).
+				Build()
+
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fclient,
+				Scheme: scheme,
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log:                  logr.Discard(),
+				Recorder:             recorder,
+				EnvVarsSizeThreshold: test.envVarsThreshold,
+			}
+
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			cpa := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err = fclient.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, cpa)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			condition := meta.FindStatusCondition(cpa.Status.Conditions, custompodautoscalercomv1.ConditionLargeEnvVars)
+			if !cmp.Equal(test.expectedCondition, condition != nil) {
+				t.Fatalf("Condition set mismatch (-want +got):\n%s", cmp.Diff(test.expectedCondition, condition != nil))
+			}
+			if condition != nil {
+				if !cmp.Equal(test.expectedStatus, condition.Status) {
+					t.Errorf("Condition status mismatch (-want +got):\n%s", cmp.Diff(test.expectedStatus, condition.Status))
+				}
+				if !cmp.Equal(test.expectedReason, condition.Reason) {
+					t.Errorf("Condition reason mismatch (-want +got):\n%s", cmp.Diff(test.expectedReason, condition.Reason))
+				}
+			}
+
+			close(recorder.Events)
+			events := []string{}
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			if !cmp.Equal(test.expectedEvents, events) {
+				t.Errorf("Events mismatch (-want +got):\n%s", cmp.Diff(test.expectedEvents, events))
+			}
+		})
+	}
+}
+
+func TestReconcileAdditionalRoleBindingSubjects(t *testing.T) {
+	var tests = []struct {
+		description string
+		expected    []rbacv1.Subject
+		expectedErr string
+		subjects    []rbacv1.Subject
+	}{
+		{
+			"No additional subjects, only the provisioned ServiceAccount is bound",
+			[]rbacv1.Subject{
+				{
+					Kind:      "ServiceAccount",
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			},
+			"",
+			nil,
+		},
+		{
+			"Additional subjects merged into the provisioned RoleBinding",
+			[]rbacv1.Subject{
+				{
+					Kind:      "ServiceAccount",
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+				{
+					Kind:      "ServiceAccount",
+					Name:      "sidecar",
+					Namespace: "test-namespace",
+				},
+				{
+					Kind:      "ServiceAccount",
+					Name:      "monitoring",
+					Namespace: "monitoring-namespace",
+				},
+				{
+					Kind:     "Group",
+					APIGroup: "rbac.authorization.k8s.io",
+					Name:     "autoscaler-admins",
+				},
+			},
+			"",
+			[]rbacv1.Subject{
+				{
+					Kind: "ServiceAccount",
+					Name: "sidecar",
+				},
+				{
+					Kind:      "ServiceAccount",
+					Name:      "monitoring",
+					Namespace: "monitoring-namespace",
+				},
+				{
+					Kind: "Group",
+					Name: "autoscaler-admins",
+				},
+			},
+		},
+		{
+			"Invalid subject kind, fail to reconcile",
+			nil,
+			`additionalRoleBindingSubjects test-role has invalid kind "Role", must be one of ServiceAccount, User, Group`,
+			[]rbacv1.Subject{
+				{
+					Kind: "Role",
+					Name: "test-role",
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var roleBinding *rbacv1.RoleBinding
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+					s := runtime.NewScheme()
+					s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+					return s
+				}()).WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test",
+							Namespace: "test-namespace",
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							AdditionalRoleBindingSubjects: test.subjects,
+						},
+					},
+				).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						provisionedRoleBinding, ok := obj.(*rbacv1.RoleBinding)
+						if ok {
+							roleBinding = provisionedRoleBinding
+						}
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log: logr.Discard(),
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			errMessage := ""
+			if err != nil {
+				errMessage = err.Error()
+			}
+			if !cmp.Equal(test.expectedErr, errMessage) {
+				t.Errorf("Error mismatch (-want +got):\n%s", cmp.Diff(test.expectedErr, errMessage))
+			}
+
+			var subjects []rbacv1.Subject
+			if roleBinding != nil {
+				subjects = roleBinding.Subjects
+			}
+			if !cmp.Equal(test.expected, subjects) {
+				t.Errorf("RoleBinding subjects mismatch (-want +got):\n%s", cmp.Diff(test.expected, subjects))
+			}
+		})
+	}
+}
+
+func TestReconcileProjectedToken(t *testing.T) {
+	projectedTokenVolume := func(audience string, expirationSeconds int64) corev1.Volume {
+		return corev1.Volume{
+			Name: "cpa-service-account-token",
+			VolumeSource: corev1.VolumeSource{
+				Projected: &corev1.ProjectedVolumeSource{
+					Sources: []corev1.VolumeProjection{
+						{
+							ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+								Audience:          audience,
+								ExpirationSeconds: int64Ptr(expirationSeconds),
+								Path:              "token",
+							},
+						},
+						{
+							ConfigMap: &corev1.ConfigMapProjection{
+								LocalObjectReference: corev1.LocalObjectReference{
+									Name: "kube-root-ca.crt",
+								},
+								Items: []corev1.KeyToPath{
+									{
+										Key:  "ca.crt",
+										Path: "ca.crt",
+									},
+								},
+							},
+						},
+						{
+							DownwardAPI: &corev1.DownwardAPIProjection{
+								Items: []corev1.DownwardAPIVolumeFile{
+									{
+										Path: "namespace",
+										FieldRef: &corev1.ObjectFieldSelector{
+											APIVersion: "v1",
+											FieldPath:  "metadata.namespace",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	tokenVolumeMount := corev1.VolumeMount{
+		Name:      "cpa-service-account-token",
+		MountPath: "/var/run/secrets/kubernetes.io/serviceaccount",
+		ReadOnly:  true,
+	}
+
+	var tests = []struct {
+		description                          string
+		expectedAutomountServiceAccountToken *bool
+		expectedVolumes                      []corev1.Volume
+		expectedVolumeMounts                 []corev1.VolumeMount
+		spec                                 custompodautoscalercomv1.CustomPodAutoscalerSpec
+		annotations                          map[string]string
+	}{
+		{
+			"Projected token not enabled, token automatically mounted",
+			nil,
+			nil,
+			nil,
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			nil,
+		},
+		{
+			"Projected token enabled, default expiration",
+			boolPtr(false),
+			[]corev1.Volume{
+				projectedTokenVolume("", 3600),
+			},
+			[]corev1.VolumeMount{
+				tokenVolumeMount,
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				UseProjectedToken: boolPtr(true),
+			},
+			nil,
+		},
+		{
+			"Projected token enabled, audience and expiration set, existing volumes kept",
+			boolPtr(false),
+			[]corev1.Volume{
+				{
+					Name: "cache",
+					VolumeSource: corev1.VolumeSource{
+						EmptyDir: &corev1.EmptyDirVolumeSource{},
+					},
+				},
+				projectedTokenVolume("metrics-api", 600),
+			},
+			[]corev1.VolumeMount{
+				{
+					Name:      "cache",
+					MountPath: "/cache",
+				},
+				tokenVolumeMount,
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Volumes: []corev1.Volume{
+							{
+								Name: "cache",
+								VolumeSource: corev1.VolumeSource{
+									EmptyDir: &corev1.EmptyDirVolumeSource{},
+								},
+							},
+						},
+						Containers: []corev1.Container{
+							{
+								Name: "test container",
+								VolumeMounts: []corev1.VolumeMount{
+									{
+										Name:      "cache",
+										MountPath: "/cache",
+									},
+								},
+							},
+						},
+					},
+				},
+				UseProjectedToken:               boolPtr(true),
+				ProjectedTokenAudience:          "metrics-api",
+				ProjectedTokenExpirationSeconds: int64Ptr(600),
+			},
+			nil,
+		},
+		{
+			"ProjectedTokenByDefault feature gate enabled, projected token used by default",
+			boolPtr(false),
+			[]corev1.Volume{
+				projectedTokenVolume("", 3600),
+			},
+			[]corev1.VolumeMount{
+				tokenVolumeMount,
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			map[string]string{
+				controllers.FeatureGatesAnnotation: "ProjectedTokenByDefault=true",
+			},
+		},
+		{
+			"ProjectedTokenByDefault feature gate disabled, token automatically mounted",
+			nil,
+			nil,
+			nil,
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			map[string]string{
+				controllers.FeatureGatesAnnotation: "ProjectedTokenByDefault=false",
+			},
+		},
+		{
+			"ProjectedTokenByDefault feature gate enabled, useProjectedToken false takes precedence",
+			nil,
+			nil,
+			nil,
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				UseProjectedToken: boolPtr(false),
+			},
+			map[string]string{
+				controllers.FeatureGatesAnnotation: "ProjectedTokenByDefault=true",
+			},
+		},
+		{
+			"Unknown feature gate ignored, known feature gates applied",
+			boolPtr(false),
+			[]corev1.Volume{
+				projectedTokenVolume("", 3600),
+			},
+			[]corev1.VolumeMount{
+				tokenVolumeMount,
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+			map[string]string{
+				controllers.FeatureGatesAnnotation: "DeploymentMode=true,ProjectedTokenByDefault=true",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if len(test.spec.Template.Spec.Containers) == 0 {
+				test.spec.Template.Spec.Containers = []corev1.Container{
+					{
+						Name: "test container",
+					},
+				}
+			}
+
+			var pod *corev1.Pod
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+					s := runtime.NewScheme()
+					s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+					return s
+				}()).WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:        "test",
+							Namespace:   "test-namespace",
+							Annotations: test.annotations,
+						},
+						Spec: test.spec,
+					},
+				).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						provisionedPod, ok := obj.(*corev1.Pod)
+						if ok {
+							pod = provisionedPod
+						}
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log: logr.Discard(),
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expectedAutomountServiceAccountToken, pod.Spec.AutomountServiceAccountToken) {
+				t.Errorf("AutomountServiceAccountToken mismatch (-want +got):\n%s", cmp.Diff(test.expectedAutomountServiceAccountToken, pod.Spec.AutomountServiceAccountToken))
+			}
+			if !cmp.Equal(test.expectedVolumes, pod.Spec.Volumes) {
+				t.Errorf("Volumes mismatch (-want +got):\n%s", cmp.Diff(test.expectedVolumes, pod.Spec.Volumes))
+			}
+			if !cmp.Equal(test.expectedVolumeMounts, pod.Spec.Containers[0].VolumeMounts) {
+				t.Errorf("VolumeMounts mismatch (-want +got):\n%s", cmp.Diff(test.expectedVolumeMounts, pod.Spec.Containers[0].VolumeMounts))
+			}
+		})
+	}
+}
+
+func TestReconcileScratchVolume(t *testing.T) {
+	var tests = []struct {
+		description          string
+		expectedVolumes      []corev1.Volume
+		expectedVolumeMounts []corev1.VolumeMount
+		spec                 custompodautoscalercomv1.CustomPodAutoscalerSpec
+	}{
+		{
+			"Scratch volume not enabled, no volume",
+			nil,
+			nil,
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+		},
+		{
+			"Scratch volume enabled, mounted at default path",
+			[]corev1.Volume{
+				{
+					Name: "cpa-scratch",
+					VolumeSource: corev1.VolumeSource{
+						EmptyDir: &corev1.EmptyDirVolumeSource{},
+					},
+				},
+			},
+			[]corev1.VolumeMount{
+				{
+					Name:      "cpa-scratch",
+					MountPath: "/tmp",
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				MountScratchVolume: boolPtr(true),
+			},
+		},
+		{
+			"Scratch volume enabled, mounted at configured path",
+			[]corev1.Volume{
+				{
+					Name: "cpa-scratch",
+					VolumeSource: corev1.VolumeSource{
+						EmptyDir: &corev1.EmptyDirVolumeSource{},
+					},
+				},
+			},
+			[]corev1.VolumeMount{
+				{
+					Name:      "cpa-scratch",
+					MountPath: "/scratch",
+				},
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				MountScratchVolume:     boolPtr(true),
+				ScratchVolumeMountPath: "/scratch",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			test.spec.Template.Spec.Containers = []corev1.Container{
+				{
+					Name: "test container",
+					SecurityContext: &corev1.SecurityContext{
+						ReadOnlyRootFilesystem: boolPtr(true),
+					},
+				},
+			}
+
+			var pod *corev1.Pod
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+					s := runtime.NewScheme()
+					s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+					return s
+				}()).WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test",
+							Namespace: "test-namespace",
+						},
+						Spec: test.spec,
+					},
+				).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						provisionedPod, ok := obj.(*corev1.Pod)
+						if ok {
+							pod = provisionedPod
+						}
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log: logr.Discard(),
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expectedVolumes, pod.Spec.Volumes) {
+				t.Errorf("Volumes mismatch (-want +got):\n%s", cmp.Diff(test.expectedVolumes, pod.Spec.Volumes))
+			}
+			if !cmp.Equal(test.expectedVolumeMounts, pod.Spec.Containers[0].VolumeMounts) {
+				t.Errorf("VolumeMounts mismatch (-want +got):\n%s", cmp.Diff(test.expectedVolumeMounts, pod.Spec.Containers[0].VolumeMounts))
+			}
+		})
+	}
+}
+
+func TestReconcileUnchangedFastPath(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+
+	// Count the calls made to the API server by each reconcile
+	apiCalls := 0
+	fclient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(&custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "test-namespace",
+			},
+			Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name:  "test container",
+								Image: "test-image",
+							},
+						},
+					},
+				},
+			},
+		}).
+		WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Get: func(ctx context.Context, client client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				apiCalls++
+				return client.Get(ctx, key, obj, opts...)
+			},
+			List: func(ctx context.Context, client client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+				apiCalls++
+				return client.List(ctx, list, opts...)
+			},
+			Create: func(ctx context.Context, client client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				apiCalls++
+				return client.Create(ctx, obj, opts...)
+			},
+			Update: func(ctx context.Context, client client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+				apiCalls++
+				return client.Update(ctx, obj, opts...)
+			},
+			Delete: func(ctx context.Context, client client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+				apiCalls++
+				return client.Delete(ctx, obj, opts...)
+			},
+			SubResourceUpdate: func(ctx context.Context, client client.Client, subResourceName string, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+				apiCalls++
+				return client.SubResource(subResourceName).Update(ctx, obj, opts...)
+			},
+		}).
+		Build()
+
+	start := time.Date(2024, time.March, 1, 22, 0, 0, 0, time.UTC)
+	fakeClock := clocktesting.NewFakePassiveClock(start)
+
+	// Count the resources reconciled, passing them through to a real resource reconciler
+	resourcesReconciled := 0
+	k8sReconciler := &k8sreconcile.KubernetesResourceReconciler{
+		Client:               fclient,
+		Scheme:               scheme,
+		ControllerReferencer: controllerutil.SetControllerReference,
+	}
+
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
+		Client: fclient,
+		Scheme: scheme,
+		KubernetesResourceReconciler: &fakek8sReconciler{
+			reconcile: func(
+				reqLogger logr.Logger,
+				instance *custompodautoscalercomv1.CustomPodAutoscaler,
+				obj metav1.Object,
+				shouldProvision bool,
+				updatable bool,
+				kind string,
+			) (reconcile.Result, error) {
+				resourcesReconciled++
+				return k8sReconciler.Reconcile(reqLogger, instance, obj, shouldProvision, updatable, kind)
+			},
+			podCleanup: k8sReconciler.PodCleanup,
+		},
+		Log:                   logr.Discard(),
+		Clock:                 fakeClock,
+		FullReconcileInterval: 10 * time.Minute,
+	}
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "test",
+			Namespace: "test-namespace",
+		},
+	}
+
+	setPodReady := func(t *testing.T) {
+		pod := &corev1.Pod{}
+		err := fclient.Get(context.Background(), request.NamespacedName, pod)
+		if err != nil {
+			t.Fatalf("Unexpected error getting pod: %v", err)
+		}
+		pod.Status.Conditions = []corev1.PodCondition{
+			{
+				Type:   corev1.PodReady,
+				Status: corev1.ConditionTrue,
+			},
+		}
+		err = fclient.Status().Update(context.Background(), pod)
+		if err != nil {
+			t.Fatalf("Unexpected error updating pod: %v", err)
+		}
+	}
+
+	var tests = []struct {
+		description                 string
+		expected                    reconcile.Result
+		expectedResourcesReconciled int
+		expectedAPICalls            int
+		setup                       func(t *testing.T)
+	}{
+		{
+			"First reconcile, all resources reconciled",
+			reconcile.Result{},
+			4,
+			11,
+			func(t *testing.T) {},
+		},
+		{
+			"Pod not ready, all resources reconciled",
+			reconcile.Result{},
+			4,
+			14,
+			func(t *testing.T) {},
+		},
+		{
+			"Pod ready and resources unchanged, resources skipped",
+			reconcile.Result{RequeueAfter: 10 * time.Minute},
+			0,
+			5,
+			setPodReady,
+		},
+		{
+			"Pod ready and resources unchanged within interval, resources skipped until the interval passes",
+			reconcile.Result{RequeueAfter: 4 * time.Minute},
+			0,
+			5,
+			func(t *testing.T) {
+				fakeClock.SetTime(start.Add(6 * time.Minute))
+			},
+		},
+		{
+			"Full reconcile interval passed, all resources reconciled",
+			reconcile.Result{},
+			4,
+			10,
+			func(t *testing.T) {
+				fakeClock.SetTime(start.Add(10 * time.Minute))
+			},
+		},
+		{
+			"Spec changed, all resources reconciled",
+			reconcile.Result{},
+			4,
+			11,
+			func(t *testing.T) {
+				setPodReady(t)
+				instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+				err := fclient.Get(context.Background(), request.NamespacedName, instance)
+				if err != nil {
+					t.Fatalf("Unexpected error getting CPA: %v", err)
+				}
+				instance.Spec.Template.Spec.Containers[0].Image = "new-image"
+				err = fclient.Update(context.Background(), instance)
+				if err != nil {
+					t.Fatalf("Unexpected error updating CPA: %v", err)
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			test.setup(t)
+			resourcesReconciled = 0
+			apiCalls = 0
+
+			result, err := reconciler.Reconcile(context.Background(), request)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expected, result) {
+				t.Errorf("Result mismatch (-want +got):\n%s", cmp.Diff(test.expected, result))
+			}
+			if !cmp.Equal(test.expectedResourcesReconciled, resourcesReconciled) {
+				t.Errorf("Resources reconciled mismatch (-want +got):\n%s", cmp.Diff(test.expectedResourcesReconciled, resourcesReconciled))
+			}
+			if !cmp.Equal(test.expectedAPICalls, apiCalls) {
+				t.Errorf("API calls mismatch (-want +got):\n%s", cmp.Diff(test.expectedAPICalls, apiCalls))
+			}
+		})
+	}
+}
+
+func TestReconcileDefaultAnnotations(t *testing.T) {
+	var tests = []struct {
+		description         string
+		expected            map[string]map[string]string
+		defaultAnnotations  map[string]string
+		templateAnnotations map[string]string
+	}{
+		{
+			"No default annotations, no annotations added",
+			map[string]map[string]string{
+				"v1/ServiceAccount": nil,
+				"v1/Role":           nil,
+				"v1/RoleBinding":    nil,
+				"v1/Pod":            {},
+			},
+			nil,
+			nil,
+		},
+		{
+			"Default annotations added to all provisioned resources",
+			map[string]map[string]string{
+				"v1/ServiceAccount": {
+					"app.kubernetes.io/part-of": "autoscaling",
+					"example.com/cost-center":   "platform",
+				},
+				"v1/Role": {
+					"app.kubernetes.io/part-of": "autoscaling",
+					"example.com/cost-center":   "platform",
+				},
+				"v1/RoleBinding": {
+					"app.kubernetes.io/part-of": "autoscaling",
+					"example.com/cost-center":   "platform",
+				},
+				"v1/Pod": {
+					"app.kubernetes.io/part-of": "autoscaling",
+					"example.com/cost-center":   "platform",
+				},
+			},
+			map[string]string{
+				"app.kubernetes.io/part-of": "autoscaling",
+				"example.com/cost-center":   "platform",
+			},
+			nil,
+		},
+		{
+			"Pod template annotations take precedence over default annotations",
+			map[string]map[string]string{
+				"v1/ServiceAccount": {
+					"app.kubernetes.io/part-of": "autoscaling",
+					"example.com/cost-center":   "platform",
+				},
+				"v1/Role": {
+					"app.kubernetes.io/part-of": "autoscaling",
+					"example.com/cost-center":   "platform",
+				},
+				"v1/RoleBinding": {
+					"app.kubernetes.io/part-of": "autoscaling",
+					"example.com/cost-center":   "platform",
+				},
+				"v1/Pod": {
+					"app.kubernetes.io/part-of": "autoscaling",
+					"example.com/cost-center":   "team-a",
+					"example.com/owner":         "team-a",
+				},
+			},
+			map[string]string{
+				"app.kubernetes.io/part-of": "autoscaling",
+				"example.com/cost-center":   "platform",
+			},
+			map[string]string{
+				"example.com/cost-center": "team-a",
+				"example.com/owner":       "team-a",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			annotations := map[string]map[string]string{}
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+					s := runtime.NewScheme()
+					s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+					return s
+				}()).WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test",
+							Namespace: "test-namespace",
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							Template: custompodautoscalercomv1.PodTemplateSpec{
+								ObjectMeta: custompodautoscalercomv1.PodMeta{
+									Annotations: test.templateAnnotations,
+								},
+							},
+						},
+					},
+				).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						objAnnotations := obj.GetAnnotations()
+						if kind == "v1/Pod" {
+							// The Pod spec hash is not a default annotation
+							objAnnotations = map[string]string{}
+							for key, value := range obj.GetAnnotations() {
+								if key != controllers.PodSpecHashAnnotation {
+									objAnnotations[key] = value
+								}
+							}
+						}
+						annotations[kind] = objAnnotations
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log:                logr.Discard(),
+				DefaultAnnotations: test.defaultAnnotations,
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expected, annotations) {
+				t.Errorf("Annotations mismatch (-want +got):\n%s", cmp.Diff(test.expected, annotations))
+			}
+		})
+	}
+}
+
+func TestReconcileConfigOverlays(t *testing.T) {
+	var tests = []struct {
+		description string
+		expected    []corev1.EnvVar
+		environment string
+		overlays    map[string][]custompodautoscalercomv1.CustomPodAutoscalerConfig
+	}{
+		{
+			"No environment, base config only",
+			[]corev1.EnvVar{
+				{
+					Name:  "interval",
+					Value: "15000",
+				},
+				{
+					Name:  "minReplicas",
+					Value: "1",
+				},
+			},
+			"",
+			map[string][]custompodautoscalercomv1.CustomPodAutoscalerConfig{
+				"prod": {
+					{
+						Name:  "minReplicas",
+						Value: "3",
+					},
+				},
+			},
+		},
+		{
+			"Environment without overlay, base config only",
+			[]corev1.EnvVar{
+				{
+					Name:  "interval",
+					Value: "15000",
+				},
+				{
+					Name:  "minReplicas",
+					Value: "1",
+				},
+			},
+			"staging",
+			map[string][]custompodautoscalercomv1.CustomPodAutoscalerConfig{
+				"prod": {
+					{
+						Name:  "minReplicas",
+						Value: "3",
+					},
+				},
+			},
+		},
+		{
+			"Environment overlay selected, overlay takes precedence over base config and adds new options",
+			[]corev1.EnvVar{
+				{
+					Name:  "interval",
+					Value: "15000",
+				},
+				{
+					Name:  "minReplicas",
+					Value: "3",
+				},
+				{
+					Name:  "maxReplicas",
+					Value: "20",
+				},
+			},
+			"prod",
+			map[string][]custompodautoscalercomv1.CustomPodAutoscalerConfig{
+				"staging": {
+					{
+						Name:  "minReplicas",
+						Value: "2",
+					},
+				},
+				"prod": {
+					{
+						Name:  "minReplicas",
+						Value: "3",
+					},
+					{
+						Name:  "maxReplicas",
+						Value: "20",
+					},
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var envVars []corev1.EnvVar
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+					s := runtime.NewScheme()
+					s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+					return s
+				}()).WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test",
+							Namespace: "test-namespace",
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							Template: custompodautoscalercomv1.PodTemplateSpec{
+								Spec: custompodautoscalercomv1.PodSpec{
+									Containers: []corev1.Container{
+										{
+											Name: "test container",
+										},
+									},
+								},
+							},
+							Config: []custompodautoscalercomv1.CustomPodAutoscalerConfig{
+								{
+									Name:  "interval",
+									Value: "15000",
+								},
+								{
+									Name:  "minReplicas",
+									Value: "1",
+								},
+							},
+							ConfigOverlays: test.overlays,
+						},
+					},
+				).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						if kind == "v1/Pod" {
+							// Only check the env vars from the config, not the scale target and namespace
+							for _, envVar := range obj.(*corev1.Pod).Spec.Containers[0].Env {
+								if envVar.Name != "scaleTargetRef" && envVar.Name != "namespace" {
+									envVars = append(envVars, envVar)
+								}
+							}
+						}
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log:         logr.Discard(),
+				Environment: test.environment,
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expected, envVars) {
+				t.Errorf("Env vars mismatch (-want +got):\n%s", cmp.Diff(test.expected, envVars))
+			}
+		})
+	}
+}
+
+func TestReconcileTemplateConfigValues(t *testing.T) {
+	var tests = []struct {
+		description string
+		expected    []corev1.EnvVar
+		expectedErr string
+		template    *bool
+		config      []custompodautoscalercomv1.CustomPodAutoscalerConfig
+	}{
+		{
+			"Templating not enabled, values containing braces used as they are",
+			[]corev1.EnvVar{
+				{
+					Name:  "metricsName",
+					Value: "{{ .Namespace }}-metrics",
+				},
+			},
+			"",
+			nil,
+			[]custompodautoscalercomv1.CustomPodAutoscalerConfig{
+				{
+					Name:  "metricsName",
+					Value: "{{ .Namespace }}-metrics",
+				},
+			},
+		},
+		{
+			"Templating enabled, values expanded",
+			[]corev1.EnvVar{
+				{
+					Name:  "metricsName",
+					Value: "test-namespace-metrics",
+				},
+				{
+					Name:  "target",
+					Value: "test/Deployment/test-deployment",
+				},
+				{
+					Name:  "interval",
+					Value: "15000",
+				},
+			},
+			"",
+			boolPtr(true),
+			[]custompodautoscalercomv1.CustomPodAutoscalerConfig{
+				{
+					Name:  "metricsName",
+					Value: "{{ .Namespace }}-metrics",
+				},
+				{
+					Name:  "target",
+					Value: "{{ .Name }}/{{ .ScaleTargetRef.Kind }}/{{ .ScaleTargetRef.Name }}",
+				},
+				{
+					Name:  "interval",
+					Value: "15000",
+				},
+			},
+		},
+		{
+			"Templating enabled, invalid template",
+			nil,
+			`invalid template in config value metricsName: template: metricsName:1: function "namespace" not defined`,
+			boolPtr(true),
+			[]custompodautoscalercomv1.CustomPodAutoscalerConfig{
+				{
+					Name:  "metricsName",
+					Value: "{{ namespace }}-metrics",
+				},
+			},
+		},
+		{
+			"Templating enabled, unknown field",
+			nil,
+			`failed to expand template in config value metricsName: template: metricsName:1:3: executing "metricsName" ` +
+				`at <.Unknown>: can't evaluate field Unknown in type *controllers.configTemplateContext`,
+			boolPtr(true),
+			[]custompodautoscalercomv1.CustomPodAutoscalerConfig{
+				{
+					Name:  "metricsName",
+					Value: "{{ .Unknown }}",
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var envVars []corev1.EnvVar
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+					s := runtime.NewScheme()
+					s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+					return s
+				}()).WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test",
+							Namespace: "test-namespace",
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							Template: custompodautoscalercomv1.PodTemplateSpec{
+								Spec: custompodautoscalercomv1.PodSpec{
+									Containers: []corev1.Container{
+										{
+											Name: "test container",
+										},
+									},
+								},
+							},
+							ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{
+								APIVersion: "apps/v1",
+								Kind:       "Deployment",
+								Name:       "test-deployment",
+							},
+							Config:               test.config,
+							TemplateConfigValues: test.template,
+						},
+					},
+				).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						if kind == "v1/Pod" {
+							// Only check the env vars from the config, not the scale target and namespace
+							for _, envVar := range obj.(*corev1.Pod).Spec.Containers[0].Env {
+								if envVar.Name != "scaleTargetRef" && envVar.Name != "namespace" {
+									envVars = append(envVars, envVar)
+								}
+							}
+						}
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log: logr.Discard(),
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			errMessage := ""
+			if err != nil {
+				errMessage = err.Error()
+			}
+			if !cmp.Equal(test.expectedErr, errMessage) {
+				t.Errorf("Error mismatch (-want +got):\n%s", cmp.Diff(test.expectedErr, errMessage))
+			}
+
+			if !cmp.Equal(test.expected, envVars) {
+				t.Errorf("Env vars mismatch (-want +got):\n%s", cmp.Diff(test.expected, envVars))
+			}
+		})
+	}
+}
+
+func TestReconcileShardSelector(t *testing.T) {
+	var tests = []struct {
+		description   string
+		expected      bool
+		shardSelector labels.Selector
+		labels        map[string]string
+	}{
+		{
+			"No shard selector, provisioned",
+			true,
+			nil,
+			nil,
+		},
+		{
+			"CPA matches shard selector, provisioned",
+			true,
+			labels.SelectorFromSet(labels.Set{"shard": "a"}),
+			map[string]string{
+				"shard": "a",
+			},
+		},
+		{
+			"CPA in another shard, ignored",
+			false,
+			labels.SelectorFromSet(labels.Set{"shard": "a"}),
+			map[string]string{
+				"shard": "b",
+			},
+		},
+		{
+			"CPA without shard label, ignored",
+			false,
+			labels.SelectorFromSet(labels.Set{"shard": "a"}),
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			provisioned := false
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+					s := runtime.NewScheme()
+					s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+					return s
+				}()).WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test",
+							Namespace: "test-namespace",
+							Labels:    test.labels,
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							Template: custompodautoscalercomv1.PodTemplateSpec{
+								Spec: custompodautoscalercomv1.PodSpec{
+									Containers: []corev1.Container{
+										{
+											Name: "test container",
+										},
+									},
+								},
+							},
+						},
+					},
+				).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						provisioned = true
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log:           logr.Discard(),
+				ShardSelector: test.shardSelector,
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expected, provisioned) {
+				t.Errorf("Provisioned mismatch (-want +got):\n%s", cmp.Diff(test.expected, provisioned))
+			}
+		})
+	}
+}
+
+func TestReconcileEnvironmentFilter(t *testing.T) {
+	var tests = []struct {
+		description       string
+		expected          bool
+		environmentFilter string
+		annotations       map[string]string
+	}{
+		{
+			"No environment filter, provisioned",
+			true,
+			"",
+			nil,
+		},
+		{
+			"CPA matches environment, provisioned",
+			true,
+			"staging",
+			map[string]string{
+				controllers.EnvironmentAnnotation: "staging",
+			},
+		},
+		{
+			"CPA in another environment, ignored",
+			false,
+			"staging",
+			map[string]string{
+				controllers.EnvironmentAnnotation: "production",
+			},
+		},
+		{
+			"CPA without environment annotation, ignored",
+			false,
+			"staging",
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			provisioned := false
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+					s := runtime.NewScheme()
+					s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+					return s
+				}()).WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:        "test",
+							Namespace:   "test-namespace",
+							Annotations: test.annotations,
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							Template: custompodautoscalercomv1.PodTemplateSpec{
+								Spec: custompodautoscalercomv1.PodSpec{
+									Containers: []corev1.Container{
+										{
+											Name: "test container",
+										},
+									},
+								},
+							},
+						},
+					},
+				).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						provisioned = true
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log:               logr.Discard(),
+				EnvironmentFilter: test.environmentFilter,
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expected, provisioned) {
+				t.Errorf("Provisioned mismatch (-want +got):\n%s", cmp.Diff(test.expected, provisioned))
+			}
+		})
+	}
+}
+
+func TestReconcileRBACPropagationDelay(t *testing.T) {
+	var tests = []struct {
+		description          string
+		expected             reconcile.Result
+		expectedPod          bool
+		rbacPropagationDelay time.Duration
+		objects              []runtime.Object
+	}{
+		{
+			"No RBAC propagation delay, Pod provisioned with RBAC",
+			reconcile.Result{},
+			true,
+			0,
+			nil,
+		},
+		{
+			"RBAC created, Pod deferred by one requeue",
+			reconcile.Result{RequeueAfter: 5 * time.Second},
+			false,
+			5 * time.Second,
+			nil,
+		},
+		{
+			"RoleBinding created, Pod deferred by one requeue",
+			reconcile.Result{RequeueAfter: 5 * time.Second},
+			false,
+			5 * time.Second,
+			[]runtime.Object{
+				&corev1.ServiceAccount{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+					},
+				},
+				&rbacv1.Role{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+					},
+				},
+			},
+		},
+		{
+			"RBAC already exists, Pod provisioned",
+			reconcile.Result{},
+			true,
+			5 * time.Second,
+			[]runtime.Object{
+				&corev1.ServiceAccount{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+					},
+				},
+				&rbacv1.Role{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+					},
+				},
+				&rbacv1.RoleBinding{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+					},
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			podProvisioned := false
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+					s := runtime.NewScheme()
+					utilruntime.Must(clientgoscheme.AddToScheme(s))
+					s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+					return s
+				}()).WithRuntimeObjects(append([]runtime.Object{
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test",
+							Namespace: "test-namespace",
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							Template: custompodautoscalercomv1.PodTemplateSpec{
+								Spec: custompodautoscalercomv1.PodSpec{
+									Containers: []corev1.Container{
+										{
+											Name: "test container",
+										},
+									},
+								},
+							},
+						},
+					},
+				}, test.objects...)...).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						if kind == "v1/Pod" {
+							podProvisioned = true
+						}
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log:                  logr.Discard(),
+				RBACPropagationDelay: test.rbacPropagationDelay,
+			}
+			result, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expected, result) {
+				t.Errorf("Result mismatch (-want +got):\n%s", cmp.Diff(test.expected, result))
+			}
+
+			if !cmp.Equal(test.expectedPod, podProvisioned) {
+				t.Errorf("Pod provisioned mismatch (-want +got):\n%s", cmp.Diff(test.expectedPod, podProvisioned))
+			}
+		})
+	}
+}
+
+func TestReconcilePodDiscoveryLabels(t *testing.T) {
+	var tests = []struct {
+		description        string
+		expected           map[string]string
+		podDiscoveryLabels map[string]string
+		templateLabels     map[string]string
+	}{
+		{
+			"No discovery labels, only operator labels",
+			map[string]string{
+				"app.kubernetes.io/managed-by":        "custom-pod-autoscaler-operator",
+				"v1.custompodautoscaler.com/owned-by": "test",
+			},
+			nil,
+			nil,
+		},
+		{
+			"Discovery label added",
+			map[string]string{
+				"app.kubernetes.io/managed-by":             "custom-pod-autoscaler-operator",
+				"v1.custompodautoscaler.com/owned-by":      "test",
+				"autoscaling.custompodautoscaler.com/role": "autoscaler",
+			},
+			map[string]string{
+				"autoscaling.custompodautoscaler.com/role": "autoscaler",
+			},
+			nil,
+		},
+		{
+			"Discovery label takes precedence over template label",
+			map[string]string{
+				"app.kubernetes.io/managed-by":             "custom-pod-autoscaler-operator",
+				"v1.custompodautoscaler.com/owned-by":      "test",
+				"autoscaling.custompodautoscaler.com/role": "autoscaler",
+				"team": "a",
+			},
+			map[string]string{
+				"autoscaling.custompodautoscaler.com/role": "autoscaler",
+			},
+			map[string]string{
+				"autoscaling.custompodautoscaler.com/role": "worker",
+				"team": "a",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var podLabels map[string]string
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+					s := runtime.NewScheme()
+					s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+					return s
+				}()).WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test",
+							Namespace: "test-namespace",
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							Template: custompodautoscalercomv1.PodTemplateSpec{
+								ObjectMeta: custompodautoscalercomv1.PodMeta{
+									Labels: test.templateLabels,
+								},
+								Spec: custompodautoscalercomv1.PodSpec{
+									Containers: []corev1.Container{
+										{
+											Name: "test container",
+										},
+									},
+								},
+							},
+						},
+					},
+				).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						if kind == "v1/Pod" {
+							podLabels = obj.GetLabels()
+						}
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log:                logr.Discard(),
+				PodDiscoveryLabels: test.podDiscoveryLabels,
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expected, podLabels) {
+				t.Errorf("Pod labels mismatch (-want +got):\n%s", cmp.Diff(test.expected, podLabels))
+			}
+		})
+	}
+}
+
+func TestReconcileTargetObservedVersion(t *testing.T) {
+	var tests = []struct {
+		description     string
+		expected        string
+		observedVersion string
+		scale           *autoscalingv1.Scale
+		scaleErr        error
+	}{
+		{
+			"Scale target not found, no version recorded",
+			"",
+			"",
+			nil,
+			apierrors.NewNotFound(schema.GroupResource{Group: "apps", Resource: "Deployment"}, "test-deployment"),
+		},
+		{
+			"Scale target not found, recorded version cleared",
+			"",
+			"100",
+			nil,
+			apierrors.NewNotFound(schema.GroupResource{Group: "apps", Resource: "Deployment"}, "test-deployment"),
+		},
+		{
+			"Fail to get scale target, recorded version kept",
+			"100",
+			"100",
+			nil,
+			errors.New("fail to get scale"),
+		},
+		{
+			"Scale target version recorded",
+			"100",
+			"",
+			&autoscalingv1.Scale{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "test-deployment",
+					Namespace:       "test-namespace",
+					ResourceVersion: "100",
+				},
+			},
+			nil,
+		},
+		{
+			"Scale target changed, recorded version updated",
+			"200",
+			"100",
+			&autoscalingv1.Scale{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "test-deployment",
+					Namespace:       "test-namespace",
+					ResourceVersion: "200",
+				},
+			},
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			fclient := fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+				s := runtime.NewScheme()
+				s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+				return s
+			}()).WithRuntimeObjects(
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{
+							APIVersion: "apps/v1",
+							Kind:       "Deployment",
+							Name:       "test-deployment",
+						},
+						Template: custompodautoscalercomv1.PodTemplateSpec{
+							Spec: custompodautoscalercomv1.PodSpec{
+								Containers: []corev1.Container{
+									{
+										Name: "test container",
+									},
+								},
+							},
+						},
+					},
+					Status: custompodautoscalercomv1.CustomPodAutoscalerStatus{
+						TargetObservedVersion: test.observedVersion,
+					},
+				},
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build()
+
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fclient,
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				ScalingClient: &scaleFake.FakeScaleClient{
+					Fake: k8stesting.Fake{
+						ReactionChain: []k8stesting.Reactor{
+							&k8stesting.SimpleReactor{
+								Resource: "*",
+								Verb:     "get",
+								Reaction: func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+									return true, test.scale, test.scaleErr
+								},
+							},
+						},
+					},
+				},
+				Log: logr.Discard(),
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err = fclient.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, instance)
+			if err != nil {
+				t.Fatalf("Unexpected error getting CPA: %v", err)
+			}
+
+			if !cmp.Equal(test.expected, instance.Status.TargetObservedVersion) {
+				t.Errorf("Target observed version mismatch (-want +got):\n%s", cmp.Diff(test.expected, instance.Status.TargetObservedVersion))
+			}
+		})
+	}
+}
+
+func TestReconcileRBACMode(t *testing.T) {
+	var tests = []struct {
+		description             string
+		expected                custompodautoscalercomv1.RBACMode
+		provisionServiceAccount *bool
+		provisionRole           *bool
+		provisionRoleBinding    *bool
+	}{
+		{
+			"Role and RoleBinding provisioned by default",
+			custompodautoscalercomv1.RBACModeProvisionedRole,
+			nil,
+			nil,
+			nil,
+		},
+		{
+			"Only RoleBinding provisioned, binds existing Role",
+			custompodautoscalercomv1.RBACModeBoundExistingRole,
+			nil,
+			boolPtr(false),
+			nil,
+		},
+		{
+			"Only Role provisioned, Role unbound",
+			custompodautoscalercomv1.RBACModeProvisionedRoleUnbound,
+			nil,
+			nil,
+			boolPtr(false),
+		},
+		{
+			"Role and RoleBinding disabled, skipped",
+			custompodautoscalercomv1.RBACModeSkipped,
+			nil,
+			boolPtr(false),
+			boolPtr(false),
+		},
+		{
+			"ServiceAccount not provisioned, skipped",
+			custompodautoscalercomv1.RBACModeSkipped,
+			boolPtr(false),
+			nil,
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			client := fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+				s := runtime.NewScheme()
+				s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+				return s
+			}()).WithRuntimeObjects(
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						Template: custompodautoscalercomv1.PodTemplateSpec{
+							Spec: custompodautoscalercomv1.PodSpec{
+								ServiceAccountName: "test-service-account",
+								Containers: []corev1.Container{
+									{
+										Name: "test container",
+									},
+								},
+							},
+						},
+						ProvisionServiceAccount: test.provisionServiceAccount,
+						ProvisionRole:           test.provisionRole,
+						ProvisionRoleBinding:    test.provisionRoleBinding,
+					},
+				},
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build()
+
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: client,
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log: logr.Discard(),
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err = client.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, instance)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expected, instance.Status.RBACMode) {
+				t.Errorf("RBAC mode mismatch (-want +got):\n%s", cmp.Diff(test.expected, instance.Status.RBACMode))
+			}
+		})
+	}
+}
+
+func TestReconcileProxyEnvVars(t *testing.T) {
+	proxyEnvVars := []corev1.EnvVar{
+		{
+			Name:  "HTTP_PROXY",
+			Value: "http://proxy.example.com:3128",
+		},
+		{
+			Name:  "NO_PROXY",
+			Value: ".svc,.cluster.local",
+		},
+	}
+
+	var tests = []struct {
+		description  string
+		expected     []corev1.EnvVar
+		proxyEnvVars []corev1.EnvVar
+		env          []corev1.EnvVar
+		config       []custompodautoscalercomv1.CustomPodAutoscalerConfig
+	}{
+		{
+			"No proxy env vars",
+			nil,
+			nil,
+			nil,
+			nil,
+		},
+		{
+			"Proxy env vars injected",
+			[]corev1.EnvVar{
+				{
+					Name:  "HTTP_PROXY",
+					Value: "http://proxy.example.com:3128",
+				},
+				{
+					Name:  "NO_PROXY",
+					Value: ".svc,.cluster.local",
+				},
+			},
+			proxyEnvVars,
+			nil,
+			nil,
+		},
+		{
+			"Proxy env var overridden by config",
+			[]corev1.EnvVar{
+				{
+					Name:  "HTTP_PROXY",
+					Value: "http://other-proxy.example.com:8080",
+				},
+				{
+					Name:  "NO_PROXY",
+					Value: ".svc,.cluster.local",
+				},
+			},
+			proxyEnvVars,
+			nil,
+			[]custompodautoscalercomv1.CustomPodAutoscalerConfig{
+				{
+					Name:  "HTTP_PROXY",
+					Value: "http://other-proxy.example.com:8080",
+				},
+			},
+		},
+		{
+			"Proxy env var overridden by template",
+			[]corev1.EnvVar{
+				{
+					Name:  "NO_PROXY",
+					Value: "*",
+				},
+				{
+					Name:  "HTTP_PROXY",
+					Value: "http://proxy.example.com:3128",
+				},
+			},
+			proxyEnvVars,
+			[]corev1.EnvVar{
+				{
+					Name:  "NO_PROXY",
+					Value: "*",
+				},
+			},
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var envVars []corev1.EnvVar
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+					s := runtime.NewScheme()
+					s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+					return s
+				}()).WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test",
+							Namespace: "test-namespace",
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							Template: custompodautoscalercomv1.PodTemplateSpec{
+								Spec: custompodautoscalercomv1.PodSpec{
+									Containers: []corev1.Container{
+										{
+											Name: "test container",
+											Env:  test.env,
+										},
+									},
+								},
+							},
+							Config: test.config,
+						},
+					},
+				).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						if kind == "v1/Pod" {
+							// Only check the env vars from the template, config and proxy, not the scale target and
+							// namespace
+							for _, envVar := range obj.(*corev1.Pod).Spec.Containers[0].Env {
+								if envVar.Name != "scaleTargetRef" && envVar.Name != "namespace" {
+									envVars = append(envVars, envVar)
+								}
+							}
+						}
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log:          logr.Discard(),
+				ProxyEnvVars: test.proxyEnvVars,
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expected, envVars) {
+				t.Errorf("Env vars mismatch (-want +got):\n%s", cmp.Diff(test.expected, envVars))
+			}
+		})
+	}
+}
+
+func TestReconcileParked(t *testing.T) {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+		&custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "test",
+				Namespace:  "test-namespace",
+				Generation: 1,
+			},
+			Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "test container",
+							},
+						},
+					},
+				},
+			},
+		},
+	).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build()
+
+	fail := true
+	attempts := 0
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
+		Client: client,
+		Scheme: runtime.NewScheme(),
+		KubernetesResourceReconciler: &fakek8sReconciler{
+			reconcile: func(
+				reqLogger logr.Logger,
+				instance *custompodautoscalercomv1.CustomPodAutoscaler,
+				obj metav1.Object,
+				shouldProvision bool,
+				updatable bool,
+				kind string,
+			) (reconcile.Result, error) {
+				if kind != "v1/ServiceAccount" {
+					return reconcile.Result{}, nil
+				}
+				attempts++
+				if fail {
+					return reconcile.Result{}, errors.New("fail to reconcile")
+				}
+				return reconcile.Result{}, nil
+			},
+			podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+				return nil
+			},
+		},
+		Log:                  logr.Discard(),
+		MaxReconcileFailures: 3,
+	}
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "test",
+			Namespace: "test-namespace",
+		},
+	}
+	getInstance := func() *custompodautoscalercomv1.CustomPodAutoscaler {
+		instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+		err := client.Get(context.Background(), request.NamespacedName, instance)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return instance
+	}
+
+	// Failures below the maximum are returned so the CPA is retried
+	for i := 0; i < 2; i++ {
+		_, err := reconciler.Reconcile(context.Background(), request)
+		if err == nil {
+			t.Fatalf("Expected error on reconcile %d", i+1)
+		}
+	}
+
+	// Reaching the maximum parks the CPA, stopping retries
+	result, err := reconciler.Reconcile(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !cmp.Equal(reconcile.Result{}, result) {
+		t.Errorf("Result mismatch (-want +got):\n%s", cmp.Diff(reconcile.Result{}, result))
+	}
+
+	instance := getInstance()
+	if !cmp.Equal(int32(3), instance.Status.ReconcileFailures) {
+		t.Errorf("Reconcile failures mismatch (-want +got):\n%s", cmp.Diff(int32(3), instance.Status.ReconcileFailures))
+	}
+	expectedParked := &metav1.Condition{
+		Type:               custompodautoscalercomv1.ConditionParked,
+		Status:             metav1.ConditionTrue,
+		Reason:             "ReconcileFailing",
+		Message:            "Reconcile failed 3 consecutive times, parked until the spec changes, last error: fail to reconcile",
+		ObservedGeneration: 1,
+	}
+	parked := meta.FindStatusCondition(instance.Status.Conditions, custompodautoscalercomv1.ConditionParked)
+	if !cmp.Equal(expectedParked, parked, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")) {
+		t.Errorf("Condition mismatch (-want +got):\n%s", cmp.Diff(expectedParked, parked, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")))
+	}
+
+	// A parked CPA is not reconciled while its spec is unchanged
+	_, err = reconciler.Reconcile(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !cmp.Equal(3, attempts) {
+		t.Errorf("Attempts mismatch (-want +got):\n%s", cmp.Diff(3, attempts))
+	}
+
+	// Changing the spec resumes reconciling
+	fail = false
+	instance.Spec.Config = []custompodautoscalercomv1.CustomPodAutoscalerConfig{
+		{
+			Name:  "interval",
+			Value: "15000",
+		},
+	}
+	instance.Generation = 2
+	err = client.Update(context.Background(), instance)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = reconciler.Reconcile(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !cmp.Equal(4, attempts) {
+		t.Errorf("Attempts mismatch (-want +got):\n%s", cmp.Diff(4, attempts))
+	}
+
+	instance = getInstance()
+	if !cmp.Equal(int32(0), instance.Status.ReconcileFailures) {
+		t.Errorf("Reconcile failures mismatch (-want +got):\n%s", cmp.Diff(int32(0), instance.Status.ReconcileFailures))
+	}
+	if meta.IsStatusConditionTrue(instance.Status.Conditions, custompodautoscalercomv1.ConditionParked) {
+		t.Errorf("Expected CPA to no longer be parked")
+	}
+}
+
+func TestReconcileMaxProvisionRetries(t *testing.T) {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+		&custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "test",
+				Namespace:  "test-namespace",
+				Generation: 1,
+			},
+			Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "test container",
+							},
+						},
+					},
+				},
+				MaxProvisionRetries: int32Ptr(3),
+			},
+		},
+	).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build()
+
+	attempts := 0
+	recorder := record.NewFakeRecorder(10)
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
+		Client:   client,
+		Scheme:   runtime.NewScheme(),
+		Recorder: recorder,
+		KubernetesResourceReconciler: &fakek8sReconciler{
+			reconcile: func(
+				reqLogger logr.Logger,
+				instance *custompodautoscalercomv1.CustomPodAutoscaler,
+				obj metav1.Object,
+				shouldProvision bool,
+				updatable bool,
+				kind string,
+			) (reconcile.Result, error) {
+				if kind != "v1/Pod" {
+					return reconcile.Result{}, nil
+				}
+				// Pod creation is always rejected
+				attempts++
+				return reconcile.Result{}, errors.New("admission webhook denied the request")
+			},
+			podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+				return nil
+			},
+		},
+		Log: logr.Discard(),
+	}
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "test",
+			Namespace: "test-namespace",
+		},
+	}
+	getInstance := func() *custompodautoscalercomv1.CustomPodAutoscaler {
+		instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+		err := client.Get(context.Background(), request.NamespacedName, instance)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return instance
+	}
+
+	// Failures below the maximum are returned so the Pod is retried
+	for i := 0; i < 2; i++ {
+		_, err := reconciler.Reconcile(context.Background(), request)
+		if err == nil {
+			t.Fatalf("Expected error on reconcile %d", i+1)
+		}
+
+		instance := getInstance()
+		expectedFailures := map[string]int32{"v1/Pod": int32(i + 1)}
+		if !cmp.Equal(expectedFailures, instance.Status.ProvisionFailures) {
+			t.Errorf("Provision failures mismatch (-want +got):\n%s", cmp.Diff(expectedFailures, instance.Status.ProvisionFailures))
+		}
+		if meta.IsStatusConditionTrue(instance.Status.Conditions, custompodautoscalercomv1.ConditionParked) {
+			t.Errorf("Expected CPA to not be parked on reconcile %d", i+1)
+		}
+	}
+
+	// Reaching the maximum parks the CPA, stopping retries
+	result, err := reconciler.Reconcile(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !cmp.Equal(reconcile.Result{}, result) {
+		t.Errorf("Result mismatch (-want +got):\n%s", cmp.Diff(reconcile.Result{}, result))
+	}
+
+	instance := getInstance()
+	expectedFailures := map[string]int32{"v1/Pod": 3}
+	if !cmp.Equal(expectedFailures, instance.Status.ProvisionFailures) {
+		t.Errorf("Provision failures mismatch (-want +got):\n%s", cmp.Diff(expectedFailures, instance.Status.ProvisionFailures))
+	}
+	expectedParked := &metav1.Condition{
+		Type:               custompodautoscalercomv1.ConditionParked,
+		Status:             metav1.ConditionTrue,
+		Reason:             "ProvisionFailing",
+		Message:            "Failed to provision v1/Pod test 3 consecutive times, parked until the spec changes, last error: admission webhook denied the request",
+		ObservedGeneration: 1,
+	}
+	parked := meta.FindStatusCondition(instance.Status.Conditions, custompodautoscalercomv1.ConditionParked)
+	if !cmp.Equal(expectedParked, parked, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")) {
+		t.Errorf("Condition mismatch (-want +got):\n%s", cmp.Diff(expectedParked, parked, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")))
+	}
+
+	expectedEvent := "Warning Parked " + expectedParked.Message
+	select {
+	case event := <-recorder.Events:
+		if !cmp.Equal(expectedEvent, event) {
+			t.Errorf("Event mismatch (-want +got):\n%s", cmp.Diff(expectedEvent, event))
+		}
+	default:
+		t.Errorf("Expected a parked event")
+	}
+
+	// A parked CPA does not retry provisioning while its spec is unchanged
+	_, err = reconciler.Reconcile(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !cmp.Equal(3, attempts) {
+		t.Errorf("Attempts mismatch (-want +got):\n%s", cmp.Diff(3, attempts))
+	}
+
+	// Changing the spec resumes provisioning with the failures reset
+	instance.Spec.Config = []custompodautoscalercomv1.CustomPodAutoscalerConfig{
+		{
+			Name:  "interval",
+			Value: "15000",
+		},
+	}
+	instance.Generation = 2
+	err = client.Update(context.Background(), instance)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = reconciler.Reconcile(context.Background(), request)
+	if err == nil {
+		t.Fatalf("Expected error after resuming")
+	}
+	if !cmp.Equal(4, attempts) {
+		t.Errorf("Attempts mismatch (-want +got):\n%s", cmp.Diff(4, attempts))
+	}
+
+	instance = getInstance()
+	expectedFailures = map[string]int32{"v1/Pod": 1}
+	if !cmp.Equal(expectedFailures, instance.Status.ProvisionFailures) {
+		t.Errorf("Provision failures mismatch (-want +got):\n%s", cmp.Diff(expectedFailures, instance.Status.ProvisionFailures))
+	}
+	if meta.IsStatusConditionTrue(instance.Status.Conditions, custompodautoscalercomv1.ConditionParked) {
+		t.Errorf("Expected CPA to no longer be parked")
+	}
+}
+
+func TestReconcileDependencyOrder(t *testing.T) {
+	var tests = []struct {
+		description       string
+		expectedKinds     []string
+		expectedCondition *metav1.Condition
+		failKind          string
+	}{
+		{
+			"All resources reconciled in dependency order",
+			[]string{"v1/ServiceAccount", "v1/Role", "v1/RoleBinding", "v1/ConfigMap", "v1/Secret", "v1/Pod"},
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionResourcesProvisioned,
+				Status:             metav1.ConditionTrue,
+				Reason:             "Provisioned",
+				Message:            "All resources were reconciled",
+				ObservedGeneration: 1,
+			},
+			"",
+		},
+		{
+			"ServiceAccount fails, no dependent resources reconciled",
+			[]string{"v1/ServiceAccount"},
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionResourcesProvisioned,
+				Status:             metav1.ConditionFalse,
+				Reason:             "ServiceAccountFailed",
+				Message:            "Failed to reconcile v1/ServiceAccount test, resources depending on it were not reconciled: fail to reconcile",
+				ObservedGeneration: 1,
+			},
+			"v1/ServiceAccount",
+		},
+		{
+			"Role fails, RoleBinding and later resources not reconciled",
+			[]string{"v1/ServiceAccount", "v1/Role"},
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionResourcesProvisioned,
+				Status:             metav1.ConditionFalse,
+				Reason:             "RoleFailed",
+				Message:            "Failed to reconcile v1/Role test, resources depending on it were not reconciled: fail to reconcile",
+				ObservedGeneration: 1,
+			},
+			"v1/Role",
+		},
+		{
+			"RoleBinding fails, later resources not reconciled",
+			[]string{"v1/ServiceAccount", "v1/Role", "v1/RoleBinding"},
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionResourcesProvisioned,
+				Status:             metav1.ConditionFalse,
+				Reason:             "RoleBindingFailed",
+				Message:            "Failed to reconcile v1/RoleBinding test, resources depending on it were not reconciled: fail to reconcile",
+				ObservedGeneration: 1,
+			},
+			"v1/RoleBinding",
+		},
+		{
+			"ConfigMap fails, Secret and Pod not reconciled",
+			[]string{"v1/ServiceAccount", "v1/Role", "v1/RoleBinding", "v1/ConfigMap"},
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionResourcesProvisioned,
+				Status:             metav1.ConditionFalse,
+				Reason:             "ConfigMapFailed",
+				Message:            "Failed to reconcile v1/ConfigMap test-config, resources depending on it were not reconciled: fail to reconcile",
+				ObservedGeneration: 1,
+			},
+			"v1/ConfigMap",
+		},
+		{
+			"Secret fails, Pod not reconciled",
+			[]string{"v1/ServiceAccount", "v1/Role", "v1/RoleBinding", "v1/ConfigMap", "v1/Secret"},
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionResourcesProvisioned,
+				Status:             metav1.ConditionFalse,
+				Reason:             "SecretFailed",
+				Message:            "Failed to reconcile v1/Secret test-secret-config, resources depending on it were not reconciled: fail to reconcile",
+				ObservedGeneration: 1,
+			},
+			"v1/Secret",
+		},
+		{
+			"Pod fails",
+			[]string{"v1/ServiceAccount", "v1/Role", "v1/RoleBinding", "v1/ConfigMap", "v1/Secret", "v1/Pod"},
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionResourcesProvisioned,
+				Status:             metav1.ConditionFalse,
+				Reason:             "PodFailed",
+				Message:            "Failed to reconcile v1/Pod test, resources depending on it were not reconciled: fail to reconcile",
+				ObservedGeneration: 1,
+			},
+			"v1/Pod",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			client := fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+				s := runtime.NewScheme()
+				s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+				return s
+			}()).WithRuntimeObjects(
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:       "test",
+						Namespace:  "test-namespace",
+						Generation: 1,
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						Template: custompodautoscalercomv1.PodTemplateSpec{
+							Spec: custompodautoscalercomv1.PodSpec{
+								Containers: []corev1.Container{
+									{
+										Name: "test container",
+									},
+								},
+							},
+						},
+						ConfigFiles: map[string]string{
+							"config.yaml": "interval: 15000",
+						},
+						SecretConfig: map[string]string{
+							"apiKey": "secret",
+						},
+					},
+				},
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build()
+
+			kinds := []string{}
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: client,
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						kinds = append(kinds, kind)
+						if kind == test.failKind {
+							return reconcile.Result{}, errors.New("fail to reconcile")
+						}
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log: logr.Discard(),
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if test.failKind == "" && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if test.failKind != "" && err == nil {
+				t.Fatalf("Expected error")
+			}
+
+			if !cmp.Equal(test.expectedKinds, kinds) {
+				t.Errorf("Reconciled kinds mismatch (-want +got):\n%s", cmp.Diff(test.expectedKinds, kinds))
+			}
+
+			instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err = client.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, instance)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			condition := meta.FindStatusCondition(instance.Status.Conditions, custompodautoscalercomv1.ConditionResourcesProvisioned)
+			if !cmp.Equal(test.expectedCondition, condition, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")) {
+				t.Errorf("Condition mismatch (-want +got):\n%s", cmp.Diff(test.expectedCondition, condition, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")))
+			}
+		})
+	}
+}
+
+func TestReconcileChecksStatusUpdates(t *testing.T) {
+	var tests = []struct {
+		description        string
+		expectedUpdates    int
+		expectedConditions []string
+		image              string
+	}{
+		{
+			"Checks set conditions and provisioning continues, status updated once",
+			1,
+			[]string{
+				custompodautoscalercomv1.ConditionImageNotAllowed,
+				custompodautoscalercomv1.ConditionLargeEnvVars,
+				custompodautoscalercomv1.ConditionResourcesProvisioned,
+			},
+			"allowed.io/autoscaler:latest",
+		},
+		{
+			"Checks set conditions and provisioning blocked, status updated once",
+			1,
+			[]string{
+				custompodautoscalercomv1.ConditionImageNotAllowed,
+			},
+			"other.io/autoscaler:latest",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+			utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+
+			updates := 0
+			fclient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						Template: custompodautoscalercomv1.PodTemplateSpec{
+							Spec: custompodautoscalercomv1.PodSpec{
+								Containers: []corev1.Container{
+									{
+										Name:  "test container",
+										Image: test.image,
+									},
+								},
+							},
+						},
+					},
+				}).
+				WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).
+				WithInterceptorFuncs(interceptor.Funcs{
+					SubResourceUpdate: func(ctx context.Context, client client.Client, subResourceName string, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+						updates++
+						return client.SubResource(subResourceName).Update(ctx, obj, opts...)
+					},
+				}).
+				Build()
+
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client:                       fclient,
+				Scheme:                       scheme,
+				KubernetesResourceReconciler: noopK8sReconciler(nil),
+				Log:                          logr.Discard(),
+				AllowedImageRegistries:       []string{"allowed.io"},
+				EnvVarsSizeThreshold:         1024,
+			}
+
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expectedUpdates, updates) {
+				t.Errorf("Status updates mismatch (-want +got):\n%s", cmp.Diff(test.expectedUpdates, updates))
+			}
+
+			cpa := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err = fclient.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, cpa)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			conditions := []string{}
+			for _, condition := range cpa.Status.Conditions {
+				conditions = append(conditions, condition.Type)
+			}
+			if !cmp.Equal(test.expectedConditions, conditions) {
+				t.Errorf("Conditions mismatch (-want +got):\n%s", cmp.Diff(test.expectedConditions, conditions))
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+)
+
+// DebugCPAPath is the path the DebugHandler is served under, requests should be made to
+// /debug/cpa/{namespace}/{name}, or /debug/cpa/{namespace}/{name}/logs for the captured reconcile logs
+const DebugCPAPath = "/debug/cpa/"
+
+// redactedValue replaces Secret values in the provisioning plan served by the DebugHandler
+const redactedValue = "REDACTED"
+
+// DebugHandler serves the provisioning plan for a CustomPodAutoscaler as JSON, this is the effective image, env vars,
+// RBAC rules and provisioning options after defaults have been applied. Nothing is provisioned by the handler
+type DebugHandler struct {
+	Client client.Client
+	// Reconciler is the CustomPodAutoscaler reconciler, its configuration is applied to the plan served so the plan
+	// matches what is provisioned. If not set only the defaults are applied
+	Reconciler *CustomPodAutoscalerReconciler
+	// ReconcileLogs are the captured reconcile logs served for each CPA, if not set no logs are served
+	ReconcileLogs *ReconcileLogs
+}
+
+func (d *DebugHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, DebugCPAPath), "/"), "/")
+	if len(parts) == 3 && parts[0] != "" && parts[1] != "" && parts[2] == "logs" {
+		d.serveLogs(w, types.NamespacedName{Namespace: parts[0], Name: parts[1]})
+		return
+	}
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "expected path "+DebugCPAPath+"{namespace}/{name}", http.StatusNotFound)
+		return
+	}
+
+	instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+	err := d.Client.Get(req.Context(), types.NamespacedName{Namespace: parts[0], Name: parts[1]}, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	reconciler := d.Reconciler
+	if reconciler == nil {
+		reconciler = &CustomPodAutoscalerReconciler{}
+	}
+
+	plan, _, err := reconciler.provisioningPlan(req.Context(), reconciler.Log, instance)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Secret values are not served, only the keys provided
+	if plan.Secret != nil {
+		for key := range plan.Secret.Data {
+			plan.Secret.Data[key] = []byte(redactedValue)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(plan)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// serveLogs serves the captured reconcile logs for the CPA as plain text, oldest first
+func (d *DebugHandler) serveLogs(w http.ResponseWriter, cpa types.NamespacedName) {
+	if d.ReconcileLogs == nil {
+		http.Error(w, "reconcile log capture is not enabled", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, line := range d.ReconcileLogs.Lines(cpa) {
+		fmt.Fprintln(w, line)
+	}
+}
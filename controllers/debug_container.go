@@ -0,0 +1,124 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/audit"
+)
+
+// DebugAnnotation attaches an ephemeral debug container to the autoscaler Pod each time its value changes, only if
+// the operator is run with a debug container image
+const DebugAnnotation = "v1.custompodautoscaler.com/debug"
+
+// debugContainerPrefix is the prefix of the names of ephemeral debug containers attached by the operator
+const debugContainerPrefix = "cpa-debug-"
+
+// debugContainerName returns the name of the ephemeral debug container attached for a debug request, derived from the
+// request so the same request never attaches more than one container
+func debugContainerName(request string) string {
+	sum := sha256.Sum256([]byte(request))
+	return debugContainerPrefix + hex.EncodeToString(sum[:4])
+}
+
+// debugRequested returns if debug containers are enabled and the CPA has a debug request that has not been handled
+func (r *CustomPodAutoscalerReconciler) debugRequested(instance *custompodautoscalercomv1.CustomPodAutoscaler) bool {
+	request, requested := instance.GetAnnotations()[DebugAnnotation]
+	return r.DebugContainerImage != "" && requested && request != instance.Status.LastDebugRequest
+}
+
+// requestedDebugContainer attaches an ephemeral debug container to the existing Pod if requested with the debug
+// annotation, targeting the first container of the Pod so its processes can be inspected. Returns if the status of the
+// CPA was changed to record the request handled
+func (r *CustomPodAutoscalerReconciler) requestedDebugContainer(
+	ctx context.Context,
+	reqLogger logr.Logger,
+	instance *custompodautoscalercomv1.CustomPodAutoscaler,
+	pod *corev1.Pod,
+) (bool, error) {
+	request, requested := instance.GetAnnotations()[DebugAnnotation]
+	if !requested || request == instance.Status.LastDebugRequest {
+		return false, nil
+	}
+
+	if r.DebugContainerImage == "" {
+		reqLogger.Info("Debug containers not enabled, ignoring debug request", "Kind", "custompodautoscaler.com/v1/CustomPodAutoscaler", "Namespace", instance.GetNamespace(), "Name", instance.GetName(), "Request", request)
+		return false, nil
+	}
+
+	podName := pod.Name
+	if podName == "" {
+		// Generated Pod names are tracked in the status
+		podName = instance.Status.PodName
+	}
+
+	existingPod := &corev1.Pod{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: podName, Namespace: pod.Namespace}, existingPod)
+	if err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+
+	name := debugContainerName(request)
+	switch {
+	case errors.IsNotFound(err) || len(existingPod.Spec.Containers) == 0:
+		reqLogger.Info("No existing Pod to debug, skipping debug request", "Kind", "v1/Pod", "Namespace", pod.Namespace, "Name", podName, "Request", request)
+	case hasEphemeralContainer(existingPod, name):
+		reqLogger.Info("Debug container already attached, skipping debug request", "Kind", "v1/Pod", "Namespace", existingPod.Namespace, "Name", existingPod.Name, "Container", name, "Request", request)
+	default:
+		reqLogger.Info("Attaching debug container to Pod on request", "Kind", "v1/Pod", "Namespace", existingPod.Namespace, "Name", existingPod.Name, "Container", name, "Request", request)
+		existingPod.Spec.EphemeralContainers = append(existingPod.Spec.EphemeralContainers, corev1.EphemeralContainer{
+			EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+				Name:  name,
+				Image: r.DebugContainerImage,
+				Stdin: true,
+				TTY:   true,
+			},
+			TargetContainerName: existingPod.Spec.Containers[0].Name,
+		})
+		err = r.Client.SubResource("ephemeralcontainers").Update(ctx, existingPod)
+		r.AuditLogger.Record(instance, audit.ActionUpdate, "v1/Pod", existingPod.Name, err)
+		if err != nil {
+			return false, err
+		}
+		if r.Recorder != nil {
+			r.Recorder.Eventf(instance, corev1.EventTypeNormal, "DebugContainerAttached",
+				"Attached debug container %s to Pod %s", name, existingPod.Name)
+		}
+	}
+
+	instance.Status.LastDebugRequest = request
+	return true, nil
+}
+
+// hasEphemeralContainer returns if the Pod has an ephemeral container with the name
+func hasEphemeralContainer(pod *corev1.Pod, name string) bool {
+	for _, container := range pod.Spec.EphemeralContainers {
+		if container.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	k8sreconcile "github.com/jthomperoo/custom-pod-autoscaler-operator/reconcile"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileDebugContainer(t *testing.T) {
+	var tests = []struct {
+		description         string
+		expected            []corev1.EphemeralContainer
+		expectedLastRequest string
+		debugContainerImage string
+		annotations         map[string]string
+		lastRequest         string
+	}{
+		{
+			"No debug request, no debug container attached",
+			nil,
+			"",
+			"busybox:1.36",
+			nil,
+			"",
+		},
+		{
+			"Debug requested, debug containers not enabled, no debug container attached",
+			nil,
+			"",
+			"",
+			map[string]string{
+				controllers.DebugAnnotation: "2026-10-17T10:00:00Z",
+			},
+			"",
+		},
+		{
+			"Debug requested, debug container attached",
+			[]corev1.EphemeralContainer{
+				{
+					EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+						Name:  "cpa-debug-a73e9991",
+						Image: "busybox:1.36",
+						Stdin: true,
+						TTY:   true,
+					},
+					TargetContainerName: "test-container",
+				},
+			},
+			"2026-10-17T10:00:00Z",
+			"busybox:1.36",
+			map[string]string{
+				controllers.DebugAnnotation: "2026-10-17T10:00:00Z",
+			},
+			"",
+		},
+		{
+			"Debug request already handled, no debug container attached",
+			nil,
+			"2026-10-17T10:00:00Z",
+			"busybox:1.36",
+			map[string]string{
+				controllers.DebugAnnotation: "2026-10-17T10:00:00Z",
+			},
+			"2026-10-17T10:00:00Z",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+			utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+
+			fclient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:        "test",
+							Namespace:   "test-namespace",
+							Annotations: test.annotations,
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							Template: custompodautoscalercomv1.PodTemplateSpec{
+								Spec: custompodautoscalercomv1.PodSpec{
+									Containers: []corev1.Container{
+										{
+											Name: "test-container",
+										},
+									},
+								},
+							},
+						},
+						Status: custompodautoscalercomv1.CustomPodAutoscalerStatus{
+							LastDebugRequest: test.lastRequest,
+						},
+					},
+				).
+				WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).
+				WithInterceptorFuncs(interceptor.Funcs{
+					// The fake client treats every subresource as the status, so update the Pod in place of the
+					// ephemeral containers subresource
+					SubResourceUpdate: func(ctx context.Context, client client.Client, subResourceName string, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+						if subResourceName == "ephemeralcontainers" {
+							return client.Update(ctx, obj)
+						}
+						return client.SubResource(subResourceName).Update(ctx, obj, opts...)
+					},
+				}).
+				Build()
+
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fclient,
+				Scheme: scheme,
+				KubernetesResourceReconciler: &k8sreconcile.KubernetesResourceReconciler{
+					Client:               fclient,
+					Scheme:               scheme,
+					ControllerReferencer: controllerutil.SetControllerReference,
+				},
+				Log:                 logr.Discard(),
+				DebugContainerImage: test.debugContainerImage,
+			}
+
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			pod := &corev1.Pod{}
+			err = fclient.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, pod)
+			if err != nil {
+				t.Fatalf("Unexpected error getting Pod: %v", err)
+			}
+
+			if !cmp.Equal(test.expected, pod.Spec.EphemeralContainers) {
+				t.Errorf("Ephemeral containers mismatch (-want +got):\n%s", cmp.Diff(test.expected, pod.Spec.EphemeralContainers))
+			}
+
+			instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err = fclient.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, instance)
+			if err != nil {
+				t.Fatalf("Unexpected error getting CPA: %v", err)
+			}
+
+			if !cmp.Equal(test.expectedLastRequest, instance.Status.LastDebugRequest) {
+				t.Errorf("Last debug request mismatch (-want +got):\n%s", cmp.Diff(test.expectedLastRequest, instance.Status.LastDebugRequest))
+			}
+		})
+	}
+}
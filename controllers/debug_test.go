@@ -0,0 +1,386 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDebugHandler(t *testing.T) {
+	var tests = []struct {
+		description    string
+		expectedStatus int
+		expectedPlan   *controllers.ProvisioningPlan
+		client         client.Client
+		method         string
+		path           string
+	}{
+		{
+			"Method not allowed",
+			http.StatusMethodNotAllowed,
+			nil,
+			nil,
+			http.MethodPost,
+			"/debug/cpa/test-namespace/test",
+		},
+		{
+			"Missing CPA name in path",
+			http.StatusNotFound,
+			nil,
+			nil,
+			http.MethodGet,
+			"/debug/cpa/test-namespace",
+		},
+		{
+			"Error getting CPA",
+			http.StatusInternalServerError,
+			nil,
+			func() *fakeClient {
+				fclient := &fakeClient{}
+				fclient.get = func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					return errors.New("Error getting CPA")
+				}
+				return fclient
+			}(),
+			http.MethodGet,
+			"/debug/cpa/test-namespace/test",
+		},
+		{
+			"CPA not found",
+			http.StatusNotFound,
+			nil,
+			fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+				s := runtime.NewScheme()
+				s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+				return s
+			}()).Build(),
+			http.MethodGet,
+			"/debug/cpa/test-namespace/test",
+		},
+		{
+			"Invalid CPA, no ServiceAccount provided",
+			http.StatusUnprocessableEntity,
+			nil,
+			fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+				s := runtime.NewScheme()
+				s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+				return s
+			}()).WithRuntimeObjects(
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						ProvisionServiceAccount: boolPtr(false),
+					},
+				},
+			).Build(),
+			http.MethodGet,
+			"/debug/cpa/test-namespace/test",
+		},
+		{
+			"Successfully serve provisioning plan",
+			http.StatusOK,
+			&controllers.ProvisioningPlan{
+				ProvisionRole:             false,
+				ProvisionRoleBinding:      true,
+				ProvisionServiceAccount:   false,
+				ProvisionPod:              true,
+				RoleRequiresMetricsServer: false,
+				RoleRequiresArgoRollouts:  false,
+				MetricsRBACMode:           custompodautoscalercomv1.MetricsRBACModeFull,
+				ServiceAccount: &corev1.ServiceAccount{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "custom-sa",
+						Namespace: "test-namespace",
+						Labels: map[string]string{
+							"app.kubernetes.io/managed-by": "custom-pod-autoscaler-operator",
+							controllers.OwnedByLabel:       "test",
+						},
+					},
+				},
+				Pod: &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+						Labels: map[string]string{
+							"app.kubernetes.io/managed-by": "custom-pod-autoscaler-operator",
+							controllers.OwnedByLabel:       "test",
+						},
+						Annotations: map[string]string{
+							controllers.PodSpecHashAnnotation: "7dfa2df65f3639ce",
+						},
+					},
+					Spec: corev1.PodSpec{
+						ServiceAccountName: "custom-sa",
+						Containers: []corev1.Container{
+							{
+								Name:  "test container",
+								Image: "test-image",
+								Ports: []corev1.ContainerPort{
+									{
+										Name:          "http",
+										ContainerPort: 5000,
+										Protocol:      corev1.ProtocolTCP,
+									},
+								},
+								Env: []corev1.EnvVar{
+									{
+										Name:  "scaleTargetRef",
+										Value: `{"kind":"","name":""}`,
+									},
+									{
+										Name:  "namespace",
+										Value: "test-namespace",
+									},
+									{
+										Name:  "interval",
+										Value: "10000",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+				s := runtime.NewScheme()
+				s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+				return s
+			}()).WithRuntimeObjects(
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						Template: custompodautoscalercomv1.PodTemplateSpec{
+							Spec: custompodautoscalercomv1.PodSpec{
+								ServiceAccountName: "custom-sa",
+								Containers: []corev1.Container{
+									{
+										Name:  "test container",
+										Image: "test-image",
+									},
+								},
+							},
+						},
+						Config: []custompodautoscalercomv1.CustomPodAutoscalerConfig{
+							{
+								Name:  "interval",
+								Value: "10000",
+							},
+						},
+						ProvisionRole:           boolPtr(false),
+						ProvisionServiceAccount: boolPtr(false),
+					},
+				},
+			).Build(),
+			http.MethodGet,
+			"/debug/cpa/test-namespace/test",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			handler := &controllers.DebugHandler{
+				Client: test.client,
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(test.method, test.path, nil))
+
+			if !cmp.Equal(test.expectedStatus, recorder.Code) {
+				t.Errorf("Status mismatch (-want +got):\n%s", cmp.Diff(test.expectedStatus, recorder.Code))
+				return
+			}
+
+			if test.expectedPlan == nil {
+				return
+			}
+
+			plan := &controllers.ProvisioningPlan{}
+			err := json.Unmarshal(recorder.Body.Bytes(), plan)
+			if err != nil {
+				t.Fatalf("Failed to parse provisioning plan: %v", err)
+			}
+
+			if !cmp.Equal(test.expectedPlan, plan) {
+				t.Errorf("Plan mismatch (-want +got):\n%s", cmp.Diff(test.expectedPlan, plan))
+			}
+		})
+	}
+}
+
+func TestDebugHandlerLogs(t *testing.T) {
+	cpa := types.NamespacedName{Namespace: "test-namespace", Name: "test"}
+
+	var tests = []struct {
+		description    string
+		expectedStatus int
+		expectedBody   string
+		reconcileLogs  func() *controllers.ReconcileLogs
+	}{
+		{
+			"Log capture not enabled, not found",
+			http.StatusNotFound,
+			"reconcile log capture is not enabled\n",
+			func() *controllers.ReconcileLogs {
+				return nil
+			},
+		},
+		{
+			"Captured lines served",
+			http.StatusOK,
+			"2024-03-01T22:30:00Z INFO Creating a new k8s object Kind=v1/Pod\n" +
+				"2024-03-01T22:30:00Z INFO Skip reconcile: k8s object already exists Kind=v1/ServiceAccount\n",
+			func() *controllers.ReconcileLogs {
+				logs := controllers.NewReconcileLogs(10, clocktesting.NewFakePassiveClock(time.Date(2024, time.March, 1, 22, 30, 0, 0, time.UTC)))
+				logger := logs.Logger(logr.Discard(), cpa)
+				logger.Info("Creating a new k8s object", "Kind", "v1/Pod")
+				logger.Info("Skip reconcile: k8s object already exists", "Kind", "v1/ServiceAccount")
+				return logs
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			handler := &controllers.DebugHandler{
+				ReconcileLogs: test.reconcileLogs(),
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/cpa/test-namespace/test/logs", nil))
+
+			if !cmp.Equal(test.expectedStatus, recorder.Code) {
+				t.Errorf("Status mismatch (-want +got):\n%s", cmp.Diff(test.expectedStatus, recorder.Code))
+			}
+
+			if !cmp.Equal(test.expectedBody, recorder.Body.String()) {
+				t.Errorf("Body mismatch (-want +got):\n%s", cmp.Diff(test.expectedBody, recorder.Body.String()))
+			}
+		})
+	}
+}
+
+func TestDebugHandlerReconcilerConfig(t *testing.T) {
+	var tests = []struct {
+		description       string
+		expectedLabel     string
+		expectedResources corev1.ResourceList
+		mode              controllers.ResourceCeilingMode
+	}{
+		{
+			"Resources above the ceiling are clamped in the plan",
+			"test-team",
+			corev1.ResourceList{
+				corev1.ResourceCPU: resource.MustParse("1"),
+			},
+			controllers.ResourceCeilingModeClamp,
+		},
+		{
+			"Resources above the ceiling are not clamped in the plan if rejected",
+			"test-team",
+			corev1.ResourceList{
+				corev1.ResourceCPU: resource.MustParse("2"),
+			},
+			controllers.ResourceCeilingModeReject,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			scheme.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+
+			handler := &controllers.DebugHandler{
+				Client: fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test",
+							Namespace: "test-namespace",
+							Labels: map[string]string{
+								"team": "test-team",
+							},
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							Template: custompodautoscalercomv1.PodTemplateSpec{
+								Spec: custompodautoscalercomv1.PodSpec{
+									Containers: []corev1.Container{
+										{
+											Name:  "test container",
+											Image: "test-image",
+											Resources: corev1.ResourceRequirements{
+												Requests: corev1.ResourceList{
+													corev1.ResourceCPU: resource.MustParse("2"),
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				).Build(),
+				Reconciler: &controllers.CustomPodAutoscalerReconciler{
+					RequiredLabels: []string{"team"},
+					ResourceCeiling: corev1.ResourceList{
+						corev1.ResourceCPU: resource.MustParse("1"),
+					},
+					ResourceCeilingMode: test.mode,
+				},
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/cpa/test-namespace/test", nil))
+
+			if !cmp.Equal(http.StatusOK, recorder.Code) {
+				t.Fatalf("Status mismatch (-want +got):\n%s", cmp.Diff(http.StatusOK, recorder.Code))
+			}
+
+			plan := &controllers.ProvisioningPlan{}
+			err := json.Unmarshal(recorder.Body.Bytes(), plan)
+			if err != nil {
+				t.Fatalf("Failed to parse provisioning plan: %v", err)
+			}
+
+			if !cmp.Equal(test.expectedLabel, plan.Pod.Labels["team"]) {
+				t.Errorf("Pod label mismatch (-want +got):\n%s", cmp.Diff(test.expectedLabel, plan.Pod.Labels["team"]))
+			}
+
+			resources := plan.Pod.Spec.Containers[0].Resources.Requests
+			if !cmp.Equal(test.expectedResources, resources) {
+				t.Errorf("Resources mismatch (-want +got):\n%s", cmp.Diff(test.expectedResources, resources))
+			}
+		})
+	}
+}
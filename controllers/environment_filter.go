@@ -0,0 +1,42 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// EnvironmentAnnotation is the environment a CPA belongs to, an operator started with an environment filter only
+// reconciles CPAs with this annotation set to its environment
+const EnvironmentAnnotation = "v1.custompodautoscaler.com/environment"
+
+// EnvironmentPredicate returns a predicate that only allows events for CPAs with the environment annotation set to the
+// environment provided, so operators for different environments can share a cluster. An empty environment allows
+// events for every CPA.
+func EnvironmentPredicate(environment string) predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return inEnvironment(environment, obj)
+	})
+}
+
+// inEnvironment returns if the environment annotation of the CPA matches the environment, every CPA is in the
+// environment if there is no environment
+func inEnvironment(environment string, obj metav1.Object) bool {
+	return environment == "" || obj.GetAnnotations()[EnvironmentAnnotation] == environment
+}
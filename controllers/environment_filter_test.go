@@ -0,0 +1,116 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestEnvironmentPredicate(t *testing.T) {
+	cpa := func(annotations map[string]string) *custompodautoscalercomv1.CustomPodAutoscaler {
+		return &custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "test",
+				Namespace:   "test-namespace",
+				Annotations: annotations,
+			},
+		}
+	}
+
+	var tests = []struct {
+		description string
+		expected    bool
+		environment string
+		eventFunc   func(environment string) bool
+	}{
+		{
+			"No environment, create allowed",
+			true,
+			"",
+			func(environment string) bool {
+				return controllers.EnvironmentPredicate(environment).Create(event.CreateEvent{
+					Object: cpa(nil),
+				})
+			},
+		},
+		{
+			"Create of CPA in environment, allowed",
+			true,
+			"staging",
+			func(environment string) bool {
+				return controllers.EnvironmentPredicate(environment).Create(event.CreateEvent{
+					Object: cpa(map[string]string{controllers.EnvironmentAnnotation: "staging"}),
+				})
+			},
+		},
+		{
+			"Create of CPA in another environment, ignored",
+			false,
+			"staging",
+			func(environment string) bool {
+				return controllers.EnvironmentPredicate(environment).Create(event.CreateEvent{
+					Object: cpa(map[string]string{controllers.EnvironmentAnnotation: "production"}),
+				})
+			},
+		},
+		{
+			"Create of CPA without environment annotation, ignored",
+			false,
+			"staging",
+			func(environment string) bool {
+				return controllers.EnvironmentPredicate(environment).Create(event.CreateEvent{
+					Object: cpa(nil),
+				})
+			},
+		},
+		{
+			"Update moving CPA into environment, allowed",
+			true,
+			"staging",
+			func(environment string) bool {
+				return controllers.EnvironmentPredicate(environment).Update(event.UpdateEvent{
+					ObjectOld: cpa(map[string]string{controllers.EnvironmentAnnotation: "production"}),
+					ObjectNew: cpa(map[string]string{controllers.EnvironmentAnnotation: "staging"}),
+				})
+			},
+		},
+		{
+			"Delete of CPA in another environment, ignored",
+			false,
+			"staging",
+			func(environment string) bool {
+				return controllers.EnvironmentPredicate(environment).Delete(event.DeleteEvent{
+					Object: cpa(map[string]string{controllers.EnvironmentAnnotation: "production"}),
+				})
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			result := test.eventFunc(test.environment)
+			if !cmp.Equal(test.expected, result) {
+				t.Errorf("Predicate mismatch (-want +got):\n%s", cmp.Diff(test.expected, result))
+			}
+		})
+	}
+}
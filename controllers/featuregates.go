@@ -0,0 +1,108 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FeatureGatesAnnotation enables or disables features of the operator for a single CPA, as a comma separated list of
+// feature=bool pairs (for example "ProjectedTokenByDefault=true"), allowing new behaviors to be rolled out gradually
+const FeatureGatesAnnotation = "v1.custompodautoscaler.com/feature-gates"
+
+// Feature is a behavior of the operator that can be toggled per CPA using the feature gates annotation
+type Feature string
+
+const (
+	// FeatureProjectedTokenByDefault provisions the Pod with a projected service account token unless the CPA sets
+	// useProjectedToken
+	FeatureProjectedTokenByDefault Feature = "ProjectedTokenByDefault"
+)
+
+// defaultFeatureGates are the known features and whether they are enabled if not set in the feature gates annotation
+var defaultFeatureGates = map[Feature]bool{
+	FeatureProjectedTokenByDefault: false,
+}
+
+// FeatureGates are the features enabled for a CPA
+type FeatureGates map[Feature]bool
+
+// ParseFeatureGates parses the value of the feature gates annotation, features not set in the value use their default
+func ParseFeatureGates(value string) (FeatureGates, error) {
+	gates, unknown, err := parseFeatureGates(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown feature gate %q, known feature gates are %s", unknown[0], knownFeatures())
+	}
+	return gates, nil
+}
+
+// parseFeatureGates parses the value of the feature gates annotation, features not set in the value use their default.
+// Unknown features are ignored and returned, so a CPA with a feature gate the operator does not know is still
+// provisioned
+func parseFeatureGates(value string) (FeatureGates, []Feature, error) {
+	gates := FeatureGates{}
+	for feature, enabled := range defaultFeatureGates {
+		gates[feature] = enabled
+	}
+
+	if strings.TrimSpace(value) == "" {
+		return gates, nil, nil
+	}
+
+	var unknown []Feature
+	for _, pair := range strings.Split(value, ",") {
+		key, rawEnabled, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found {
+			return nil, nil, fmt.Errorf("invalid feature gate %q, must be in the form feature=bool", pair)
+		}
+
+		feature := Feature(strings.TrimSpace(key))
+		if _, known := defaultFeatureGates[feature]; !known {
+			unknown = append(unknown, feature)
+			continue
+		}
+
+		enabled, err := strconv.ParseBool(strings.TrimSpace(rawEnabled))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid value %q for feature gate %s: %w", rawEnabled, feature, err)
+		}
+		gates[feature] = enabled
+	}
+
+	return gates, unknown, nil
+}
+
+// Enabled returns if the feature is enabled
+func (g FeatureGates) Enabled(feature Feature) bool {
+	return g[feature]
+}
+
+// knownFeatures returns the known features as a sorted comma separated list
+func knownFeatures() string {
+	features := []string{}
+	for feature := range defaultFeatureGates {
+		features = append(features, string(feature))
+	}
+	sort.Strings(features)
+	return strings.Join(features, ", ")
+}
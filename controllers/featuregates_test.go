@@ -0,0 +1,91 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+)
+
+func TestParseFeatureGates(t *testing.T) {
+	var tests = []struct {
+		description string
+		expected    controllers.FeatureGates
+		expectedErr string
+		value       string
+	}{
+		{
+			"No feature gates, defaults used",
+			controllers.FeatureGates{
+				controllers.FeatureProjectedTokenByDefault: false,
+			},
+			"",
+			"",
+		},
+		{
+			"Feature enabled",
+			controllers.FeatureGates{
+				controllers.FeatureProjectedTokenByDefault: true,
+			},
+			"",
+			"ProjectedTokenByDefault=true",
+		},
+		{
+			"Feature disabled, whitespace ignored",
+			controllers.FeatureGates{
+				controllers.FeatureProjectedTokenByDefault: false,
+			},
+			"",
+			" ProjectedTokenByDefault = false ",
+		},
+		{
+			"Missing value",
+			nil,
+			`invalid feature gate "ProjectedTokenByDefault", must be in the form feature=bool`,
+			"ProjectedTokenByDefault",
+		},
+		{
+			"Unknown feature",
+			nil,
+			`unknown feature gate "DeploymentMode", known feature gates are ProjectedTokenByDefault`,
+			"DeploymentMode=true",
+		},
+		{
+			"Invalid value",
+			nil,
+			`invalid value "yes" for feature gate ProjectedTokenByDefault: strconv.ParseBool: parsing "yes": invalid syntax`,
+			"ProjectedTokenByDefault=yes",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			result, err := controllers.ParseFeatureGates(test.value)
+			errMessage := ""
+			if err != nil {
+				errMessage = err.Error()
+			}
+			if !cmp.Equal(test.expectedErr, errMessage) {
+				t.Errorf("Error mismatch (-want +got):\n%s", cmp.Diff(test.expectedErr, errMessage))
+			}
+			if !cmp.Equal(test.expected, result) {
+				t.Errorf("FeatureGates mismatch (-want +got):\n%s", cmp.Diff(test.expected, result))
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+)
+
+// FleetSummary is a snapshot of the CPAs reconciled by the operator, counting the CPAs using each autoscaler image,
+// provisioning each resource and paused
+type FleetSummary struct {
+	Total          int            `json:"total"`
+	Images         map[string]int `json:"images"`
+	ProvisionModes map[string]int `json:"provisionModes"`
+	Paused         int            `json:"paused"`
+}
+
+// SummarizeFleet lists the CPAs in the namespace (every namespace if empty) that are in the shard and environment of
+// the operator and summarizes them, CPAs with unset provisioning options are counted using the default values
+func SummarizeFleet(ctx context.Context, reader client.Reader, namespace string, shardSelector labels.Selector, environmentFilter string) (*FleetSummary, error) {
+	cpas := &custompodautoscalercomv1.CustomPodAutoscalerList{}
+	err := reader.List(ctx, cpas, client.InNamespace(namespace))
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &FleetSummary{
+		Images:         map[string]int{},
+		ProvisionModes: map[string]int{},
+	}
+	for i := range cpas.Items {
+		instance := cpas.Items[i].DeepCopy()
+		if !inShard(shardSelector, instance) || !inEnvironment(environmentFilter, instance) {
+			continue
+		}
+		applyDefaults(instance)
+
+		summary.Total++
+
+		// The autoscaler is the first container in the template
+		image := ""
+		if len(instance.Spec.Template.Spec.Containers) > 0 {
+			image = instance.Spec.Template.Spec.Containers[0].Image
+		}
+		summary.Images[image]++
+
+		provisioned := map[string]bool{
+			"pod":            *instance.Spec.ProvisionPod,
+			"role":           *instance.Spec.ProvisionRole,
+			"roleBinding":    *instance.Spec.ProvisionRoleBinding,
+			"serviceAccount": *instance.Spec.ProvisionServiceAccount,
+			"serviceMonitor": instance.Spec.ProvisionServiceMonitor != nil && *instance.Spec.ProvisionServiceMonitor,
+			"networkPolicy":  instance.Spec.ProvisionNetworkPolicy != nil && *instance.Spec.ProvisionNetworkPolicy,
+		}
+		for mode, enabled := range provisioned {
+			if enabled {
+				summary.ProvisionModes[mode]++
+			}
+		}
+
+		if instance.Status.PausedSince != nil || instance.Status.ScaleTargetPaused {
+			summary.Paused++
+		}
+	}
+
+	return summary, nil
+}
+
+// FleetSummaryLogger logs a summary of the CPAs reconciled by the operator once when the operator starts, giving a
+// snapshot of the state of the autoscalers after an upgrade. Added to the manager as a runnable.
+type FleetSummaryLogger struct {
+	// Reader is used to list the CPAs, should read from the API server directly as the cache may not have synced
+	Reader            client.Reader
+	Log               logr.Logger
+	Namespace         string
+	ShardSelector     labels.Selector
+	EnvironmentFilter string
+}
+
+// Start logs the fleet summary, failing to summarize the CPAs is logged without stopping the operator
+func (l *FleetSummaryLogger) Start(ctx context.Context) error {
+	summary, err := SummarizeFleet(ctx, l.Reader, l.Namespace, l.ShardSelector, l.EnvironmentFilter)
+	if err != nil {
+		l.Log.Error(err, "Failed to summarize Custom Pod Autoscalers")
+		return nil
+	}
+
+	l.Log.Info("Custom Pod Autoscaler fleet summary", "total", summary.Total, "images", summary.Images,
+		"provisionModes", summary.ProvisionModes, "paused", summary.Paused)
+	return nil
+}
+
+// NeedLeaderElection returns false so every operator instance logs the summary, not only the leader
+func (l *FleetSummaryLogger) NeedLeaderElection() bool {
+	return false
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestSummarizeFleet(t *testing.T) {
+	equateErrorMessage := cmp.Comparer(func(x, y error) bool {
+		if x == nil || y == nil {
+			return x == nil && y == nil
+		}
+		return x.Error() == y.Error()
+	})
+
+	cpa := func(name string, namespace string, image string, cpaLabels map[string]string, mutate func(cpa *custompodautoscalercomv1.CustomPodAutoscaler)) *custompodautoscalercomv1.CustomPodAutoscaler {
+		cpa := &custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    cpaLabels,
+			},
+			Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name:  "autoscaler",
+								Image: image,
+							},
+						},
+					},
+				},
+			},
+		}
+		if mutate != nil {
+			mutate(cpa)
+		}
+		return cpa
+	}
+
+	var tests = []struct {
+		description   string
+		expected      *controllers.FleetSummary
+		expectedErr   error
+		namespace     string
+		shardSelector labels.Selector
+		listErr       error
+		objects       []runtime.Object
+	}{
+		{
+			"Fail to list CPAs",
+			nil,
+			errors.New("fail to list"),
+			"",
+			nil,
+			errors.New("fail to list"),
+			nil,
+		},
+		{
+			"No CPAs, empty summary",
+			&controllers.FleetSummary{
+				Images:         map[string]int{},
+				ProvisionModes: map[string]int{},
+			},
+			nil,
+			"",
+			nil,
+			nil,
+			nil,
+		},
+		{
+			"CPAs with different images, provisioning and pauses, summarized",
+			&controllers.FleetSummary{
+				Total: 3,
+				Images: map[string]int{
+					"autoscaler:v1": 2,
+					"autoscaler:v2": 1,
+				},
+				ProvisionModes: map[string]int{
+					"pod":            2,
+					"role":           3,
+					"roleBinding":    3,
+					"serviceAccount": 3,
+					"serviceMonitor": 1,
+				},
+				Paused: 2,
+			},
+			nil,
+			"",
+			nil,
+			nil,
+			[]runtime.Object{
+				cpa("first", "test-namespace", "autoscaler:v1", nil, nil),
+				cpa("second", "test-namespace", "autoscaler:v1", nil, func(cpa *custompodautoscalercomv1.CustomPodAutoscaler) {
+					cpa.Spec.ProvisionPod = boolPtr(false)
+					cpa.Status.ScaleTargetPaused = true
+				}),
+				cpa("third", "other-namespace", "autoscaler:v2", nil, func(cpa *custompodautoscalercomv1.CustomPodAutoscaler) {
+					cpa.Spec.ProvisionServiceMonitor = boolPtr(true)
+					cpa.Status.PausedSince = &metav1.Time{Time: time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)}
+				}),
+			},
+		},
+		{
+			"Only CPAs in the namespace and shard, summarized",
+			&controllers.FleetSummary{
+				Total: 1,
+				Images: map[string]int{
+					"autoscaler:v2": 1,
+				},
+				ProvisionModes: map[string]int{
+					"pod":            1,
+					"role":           1,
+					"roleBinding":    1,
+					"serviceAccount": 1,
+				},
+			},
+			nil,
+			"test-namespace",
+			labels.SelectorFromSet(labels.Set{"shard": "a"}),
+			nil,
+			[]runtime.Object{
+				cpa("first", "test-namespace", "autoscaler:v1", map[string]string{"shard": "b"}, nil),
+				cpa("second", "test-namespace", "autoscaler:v2", map[string]string{"shard": "a"}, nil),
+				cpa("third", "other-namespace", "autoscaler:v1", map[string]string{"shard": "a"}, nil),
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			scheme.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{},
+				&custompodautoscalercomv1.CustomPodAutoscalerList{})
+
+			fclient := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(test.objects...).WithInterceptorFuncs(interceptor.Funcs{
+				List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+					if test.listErr != nil {
+						return test.listErr
+					}
+					return c.List(ctx, list, opts...)
+				},
+			}).Build()
+
+			result, err := controllers.SummarizeFleet(context.Background(), fclient, test.namespace, test.shardSelector, "")
+			if !cmp.Equal(err, test.expectedErr, equateErrorMessage) {
+				t.Errorf("Error mismatch (-want +got):\n%s", cmp.Diff(test.expectedErr, err, equateErrorMessage))
+				return
+			}
+
+			if !cmp.Equal(test.expected, result) {
+				t.Errorf("Summary mismatch (-want +got):\n%s", cmp.Diff(test.expected, result))
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	k8sscale "k8s.io/client-go/scale"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// cacheSyncTimeout is how long the readiness check waits for the informer caches to sync before failing
+const cacheSyncTimeout = time.Second
+
+// ReadyzCheck returns a readiness check that only passes once the scaling client has been set up and the informer
+// caches used by the reconciler have synced
+func ReadyzCheck(informers cache.Informers, scalingClient k8sscale.ScalesGetter) healthz.Checker {
+	return func(req *http.Request) error {
+		if scalingClient == nil {
+			return errors.New("scaling client not set up")
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), cacheSyncTimeout)
+		defer cancel()
+		if !informers.WaitForCacheSync(ctx) {
+			return errors.New("informer caches not synced")
+		}
+
+		return nil
+	}
+}
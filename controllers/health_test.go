@@ -0,0 +1,76 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	k8sscale "k8s.io/client-go/scale"
+	scaleFake "k8s.io/client-go/scale/fake"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+)
+
+func TestReadyzCheck(t *testing.T) {
+	equateErrorMessage := cmp.Comparer(func(x, y error) bool {
+		if x == nil || y == nil {
+			return x == nil && y == nil
+		}
+		return x.Error() == y.Error()
+	})
+
+	var tests = []struct {
+		description   string
+		expectedErr   error
+		informers     *informertest.FakeInformers
+		scalingClient k8sscale.ScalesGetter
+	}{
+		{
+			"Scaling client not set up",
+			errors.New("scaling client not set up"),
+			&informertest.FakeInformers{},
+			nil,
+		},
+		{
+			"Informer caches not synced",
+			errors.New("informer caches not synced"),
+			&informertest.FakeInformers{
+				Synced: boolPtr(false),
+			},
+			&scaleFake.FakeScaleClient{},
+		},
+		{
+			"Ready",
+			nil,
+			&informertest.FakeInformers{
+				Synced: boolPtr(true),
+			},
+			&scaleFake.FakeScaleClient{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := controllers.ReadyzCheck(test.informers, test.scalingClient)(httptest.NewRequest("GET", "/readyz", nil))
+			if !cmp.Equal(err, test.expectedErr, equateErrorMessage) {
+				t.Errorf("Error mismatch (-want +got):\n%s", cmp.Diff(test.expectedErr, err, equateErrorMessage))
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+)
+
+// defaultImageRegistry is the registry images without a registry are pulled from
+const defaultImageRegistry = "docker.io"
+
+// imageRegistry returns the registry of the image, the first component of the image name is only a registry if it
+// contains a '.' or ':' or is localhost, otherwise the image is from the default registry
+func imageRegistry(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		return parts[0]
+	}
+	return defaultImageRegistry
+}
+
+// disallowedImages returns the images of the containers and init containers of the Pod that are not from one of the
+// allowed registries
+func disallowedImages(pod *corev1.Pod, allowedRegistries []string) []string {
+	allowed := map[string]bool{}
+	for _, registry := range allowedRegistries {
+		allowed[registry] = true
+	}
+
+	images := []string{}
+	for _, container := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		if !allowed[imageRegistry(container.Image)] {
+			images = append(images, container.Image)
+		}
+	}
+	return images
+}
+
+// checkImageRegistries sets the ImageNotAllowed condition, reporting any images of the Pod that are not from one of
+// the registries allowed by the operator, returning the images that are not allowed
+func (r *CustomPodAutoscalerReconciler) checkImageRegistries(instance *custompodautoscalercomv1.CustomPodAutoscaler, pod *corev1.Pod) []string {
+	images := disallowedImages(pod, r.AllowedImageRegistries)
+
+	condition := metav1.Condition{
+		Type:               custompodautoscalercomv1.ConditionImageNotAllowed,
+		Status:             metav1.ConditionFalse,
+		Reason:             "ImagesAllowed",
+		Message:            "All images are from allowed registries",
+		ObservedGeneration: instance.Generation,
+	}
+	if len(images) > 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "RegistryNotAllowed"
+		condition.Message = fmt.Sprintf("Images %s are not from an allowed registry (%s), not provisioning",
+			strings.Join(images, ", "), strings.Join(r.AllowedImageRegistries, ", "))
+	}
+
+	if meta.SetStatusCondition(&instance.Status.Conditions, condition) && condition.Status == metav1.ConditionTrue && r.Recorder != nil {
+		r.Recorder.Event(instance, corev1.EventTypeWarning, custompodautoscalercomv1.ConditionImageNotAllowed, condition.Message)
+	}
+	return images
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileImageRegistries(t *testing.T) {
+	var tests = []struct {
+		description         string
+		expectedCondition   *metav1.Condition
+		expectedEvents      []string
+		expectedProvisioned bool
+		allowedRegistries   []string
+		initContainers      []corev1.Container
+		image               string
+	}{
+		{
+			"No allowed registries set, no condition and provisioned",
+			nil,
+			[]string{},
+			true,
+			nil,
+			nil,
+			"ghcr.io/example/autoscaler:v1",
+		},
+		{
+			"Image without a registry from allowed default registry, provisioned",
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionImageNotAllowed,
+				Status:             metav1.ConditionFalse,
+				Reason:             "ImagesAllowed",
+				Message:            "All images are from allowed registries",
+				ObservedGeneration: 1,
+			},
+			[]string{},
+			true,
+			[]string{"docker.io"},
+			nil,
+			"example/autoscaler:v1",
+		},
+		{
+			"Image from allowed registry with a port, provisioned",
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionImageNotAllowed,
+				Status:             metav1.ConditionFalse,
+				Reason:             "ImagesAllowed",
+				Message:            "All images are from allowed registries",
+				ObservedGeneration: 1,
+			},
+			[]string{},
+			true,
+			[]string{"docker.io", "registry.internal:5000"},
+			nil,
+			"registry.internal:5000/autoscaler:v1",
+		},
+		{
+			"Image from registry not allowed, condition true, warning event and not provisioned",
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionImageNotAllowed,
+				Status:             metav1.ConditionTrue,
+				Reason:             "RegistryNotAllowed",
+				Message:            "Images ghcr.io/example/autoscaler:v1 are not from an allowed registry (docker.io), not provisioning",
+				ObservedGeneration: 1,
+			},
+			[]string{
+				"Warning ImageNotAllowed Images ghcr.io/example/autoscaler:v1 are not from an allowed registry (docker.io), not provisioning",
+			},
+			false,
+			[]string{"docker.io"},
+			nil,
+			"ghcr.io/example/autoscaler:v1",
+		},
+		{
+			"Init container image from registry not allowed, not provisioned",
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionImageNotAllowed,
+				Status:             metav1.ConditionTrue,
+				Reason:             "RegistryNotAllowed",
+				Message:            "Images quay.io/example/proxy:v1 are not from an allowed registry (ghcr.io), not provisioning",
+				ObservedGeneration: 1,
+			},
+			[]string{
+				"Warning ImageNotAllowed Images quay.io/example/proxy:v1 are not from an allowed registry (ghcr.io), not provisioning",
+			},
+			false,
+			[]string{"ghcr.io"},
+			[]corev1.Container{
+				{
+					Name:  "proxy",
+					Image: "quay.io/example/proxy:v1",
+				},
+			},
+			"ghcr.io/example/autoscaler:v1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			scheme.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+
+			fclient := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:       "test",
+						Namespace:  "test-namespace",
+						Generation: 1,
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						Template: custompodautoscalercomv1.PodTemplateSpec{
+							Spec: custompodautoscalercomv1.PodSpec{
+								InitContainers: test.initContainers,
+								Containers: []corev1.Container{
+									{
+										Name:  "test container",
+										Image: test.image,
+									},
+								},
+							},
+						},
+					},
+				},
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build()
+
+			provisioned := false
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fclient,
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						if kind == "v1/Pod" {
+							provisioned = true
+						}
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				Log:                    logr.Discard(),
+				Recorder:               recorder,
+				AllowedImageRegistries: test.allowedRegistries,
+			}
+
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expectedProvisioned, provisioned) {
+				t.Errorf("Provisioned mismatch (-want +got):\n%s", cmp.Diff(test.expectedProvisioned, provisioned))
+			}
+
+			cpa := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err = fclient.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, cpa)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			condition := meta.FindStatusCondition(cpa.Status.Conditions, custompodautoscalercomv1.ConditionImageNotAllowed)
+			if !cmp.Equal(test.expectedCondition, condition, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")) {
+				t.Errorf("Condition mismatch (-want +got):\n%s", cmp.Diff(test.expectedCondition, condition, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")))
+			}
+
+			close(recorder.Events)
+			events := []string{}
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			if !cmp.Equal(test.expectedEvents, events) {
+				t.Errorf("Events mismatch (-want +got):\n%s", cmp.Diff(test.expectedEvents, events))
+			}
+		})
+	}
+}
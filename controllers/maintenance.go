@@ -0,0 +1,60 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// MaintenanceWindow is a recurring window during which the operator avoids making changes to provisioned resources,
+// the window opens on each activation of the cron schedule and stays open for the duration
+type MaintenanceWindow struct {
+	schedule cron.Schedule
+	duration time.Duration
+}
+
+// ParseMaintenanceWindow parses a maintenance window from a standard cron expression (for example "0 22 * * 5") and
+// the duration the window stays open for
+func ParseMaintenanceWindow(schedule string, duration time.Duration) (*MaintenanceWindow, error) {
+	if duration <= 0 {
+		return nil, errors.New("maintenance window duration must be greater than zero")
+	}
+
+	parsed, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid maintenance window schedule %q: %w", schedule, err)
+	}
+
+	return &MaintenanceWindow{
+		schedule: parsed,
+		duration: duration,
+	}, nil
+}
+
+// Remaining returns how long until the window closes if the time provided is within the window, otherwise zero
+func (w *MaintenanceWindow) Remaining(now time.Time) time.Duration {
+	// The latest window that could still be open is the first activation after the window duration before now
+	opened := w.schedule.Next(now.Add(-w.duration))
+	if opened.After(now) {
+		return 0
+	}
+	return opened.Add(w.duration).Sub(now)
+}
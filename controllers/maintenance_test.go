@@ -0,0 +1,113 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+)
+
+func TestParseMaintenanceWindow(t *testing.T) {
+	var tests = []struct {
+		description string
+		expectedErr string
+		schedule    string
+		duration    time.Duration
+	}{
+		{
+			"Invalid schedule",
+			`invalid maintenance window schedule "not a schedule": expected exactly 5 fields, found 3: [not a schedule]`,
+			"not a schedule",
+			time.Hour,
+		},
+		{
+			"Invalid duration",
+			"maintenance window duration must be greater than zero",
+			"0 22 * * 5",
+			0,
+		},
+		{
+			"Valid maintenance window",
+			"",
+			"0 22 * * 5",
+			time.Hour,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			_, err := controllers.ParseMaintenanceWindow(test.schedule, test.duration)
+			errMessage := ""
+			if err != nil {
+				errMessage = err.Error()
+			}
+			if !cmp.Equal(test.expectedErr, errMessage) {
+				t.Errorf("Error mismatch (-want +got):\n%s", cmp.Diff(test.expectedErr, errMessage))
+			}
+		})
+	}
+}
+
+func TestMaintenanceWindowRemaining(t *testing.T) {
+	// Window opens every Friday at 22:00 and stays open for 2 hours
+	window, err := controllers.ParseMaintenanceWindow("0 22 * * 5", 2*time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var tests = []struct {
+		description string
+		expected    time.Duration
+		now         time.Time
+	}{
+		{
+			"Before window opens",
+			0,
+			time.Date(2024, time.March, 1, 21, 59, 0, 0, time.Local),
+		},
+		{
+			"Window just opened",
+			2 * time.Hour,
+			time.Date(2024, time.March, 1, 22, 0, 0, 0, time.Local),
+		},
+		{
+			"Within window, spanning midnight",
+			30 * time.Minute,
+			time.Date(2024, time.March, 1, 23, 30, 0, 0, time.Local),
+		},
+		{
+			"Window closed",
+			0,
+			time.Date(2024, time.March, 2, 0, 0, 0, 0, time.Local),
+		},
+		{
+			"Different day",
+			0,
+			time.Date(2024, time.March, 4, 22, 30, 0, 0, time.Local),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			result := window.Remaining(test.now)
+			if !cmp.Equal(test.expected, result) {
+				t.Errorf("Remaining mismatch (-want +got):\n%s", cmp.Diff(test.expected, result))
+			}
+		})
+	}
+}
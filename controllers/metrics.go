@@ -0,0 +1,154 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+)
+
+// ReconcilesByTargetKind is a counter of CPA reconciles, labelled with the kind of the scale target of the CPA
+var ReconcilesByTargetKind = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "cpa_by_target_kind_total",
+	Help: "Number of CustomPodAutoscaler reconciles, labelled by the kind of the scale target",
+}, []string{"kind"})
+
+// invalidMetricLabelChars matches the characters of a CPA label key that are not allowed in a Prometheus label name
+var invalidMetricLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// NewReconcilesByTargetKind returns a counter of CPA reconciles in place of ReconcilesByTargetKind, also labelled
+// with the values of the CPA label keys provided. Each key becomes a metric label with any characters not allowed in
+// a Prometheus label name replaced by underscores, for example app.kubernetes.io/team becomes app_kubernetes_io_team
+func NewReconcilesByTargetKind(labelKeys []string) (*prometheus.CounterVec, error) {
+	labelNames := []string{"kind"}
+	seen := map[string]string{"kind": "kind"}
+	for _, key := range labelKeys {
+		name := invalidMetricLabelChars.ReplaceAllString(key, "_")
+		if name == "" || (name[0] >= '0' && name[0] <= '9') {
+			return nil, fmt.Errorf("invalid metric label %q, must not be empty or start with a digit", key)
+		}
+		if existing, exists := seen[name]; exists {
+			return nil, fmt.Errorf("metric label %q has the same name as %q", key, existing)
+		}
+		seen[name] = key
+		labelNames = append(labelNames, name)
+	}
+
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cpa_by_target_kind_total",
+		Help: "Number of CustomPodAutoscaler reconciles, labelled by the kind of the scale target and CPA labels",
+	}, labelNames), nil
+}
+
+// PausedCustomPodAutoscalers is a gauge of the number of CPAs with autoscaling currently paused
+var PausedCustomPodAutoscalers = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "cpa_paused",
+	Help: "Number of CustomPodAutoscalers with autoscaling currently paused",
+})
+
+// PauseDurationSeconds is a histogram of how long autoscaling was paused for, observed when autoscaling is resumed
+var PauseDurationSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Name: "cpa_pause_duration_seconds",
+	Help: "How long autoscaling of a CustomPodAutoscaler was paused for before being resumed",
+	// 1 minute to roughly 11 days
+	Buckets: prometheus.ExponentialBuckets(60, 4, 8),
+})
+
+func init() {
+	metrics.Registry.MustRegister(ReconcilesByTargetKind, PausedCustomPodAutoscalers, PauseDurationSeconds)
+}
+
+// targetKindReconciles returns the counter that reconciles are counted in, falling back to the
+// ReconcilesByTargetKind counter if none is set
+func (r *CustomPodAutoscalerReconciler) targetKindReconciles() *prometheus.CounterVec {
+	if r.TargetKindReconciles == nil {
+		return ReconcilesByTargetKind
+	}
+	return r.TargetKindReconciles
+}
+
+// countReconcile counts a reconcile of the CPA, labelled with the kind of the scale target and the values of the
+// metric labels of the CPA, a metric label the CPA does not have is counted with an empty value
+func (r *CustomPodAutoscalerReconciler) countReconcile(instance *custompodautoscalercomv1.CustomPodAutoscaler) {
+	values := []string{instance.Spec.ScaleTargetRef.Kind}
+	for _, key := range r.MetricLabels {
+		values = append(values, instance.GetLabels()[key])
+	}
+	r.targetKindReconciles().WithLabelValues(values...).Inc()
+}
+
+// PauseMetrics tracks which CPAs have autoscaling paused, reporting the number of paused CPAs and how long each pause
+// lasted. A nil PauseMetrics is valid and tracks nothing, so pause metrics can be disabled by not setting one.
+type PauseMetrics struct {
+	mu        sync.Mutex
+	paused    map[types.NamespacedName]bool
+	gauge     prometheus.Gauge
+	durations prometheus.Observer
+}
+
+// NewPauseMetrics returns a PauseMetrics setting the number of paused CPAs on the gauge and observing pause durations
+// in seconds with the observer
+func NewPauseMetrics(gauge prometheus.Gauge, durations prometheus.Observer) *PauseMetrics {
+	return &PauseMetrics{
+		paused:    map[types.NamespacedName]bool{},
+		gauge:     gauge,
+		durations: durations,
+	}
+}
+
+// Paused records that autoscaling of the CPA is paused
+func (m *PauseMetrics) Paused(cpa types.NamespacedName) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.paused[cpa] = true
+	m.gauge.Set(float64(len(m.paused)))
+}
+
+// Resumed records that autoscaling of the CPA has been resumed after being paused for the duration provided
+func (m *PauseMetrics) Resumed(cpa types.NamespacedName, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.durations.Observe(duration.Seconds())
+	m.Remove(cpa)
+}
+
+// Remove records that autoscaling of the CPA is not paused without observing a pause duration, used if the CPA is
+// not paused or has been deleted
+func (m *PauseMetrics) Remove(cpa types.NamespacedName) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.paused, cpa)
+	m.gauge.Set(float64(len(m.paused)))
+}
@@ -0,0 +1,439 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileTargetKindMetric(t *testing.T) {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+
+	cpa := func(name string, kind string) *custompodautoscalercomv1.CustomPodAutoscaler {
+		return &custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "test-namespace",
+			},
+			Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{
+					Kind: kind,
+					Name: "target",
+				},
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "test container",
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+		cpa("deployment-a", "Deployment"),
+		cpa("deployment-b", "Deployment"),
+		cpa("statefulset", "StatefulSet"),
+	).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build()
+
+	targetKindReconciles := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "test_by_target_kind_total",
+	}, []string{"kind"})
+
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
+		Client: client,
+		Scheme: runtime.NewScheme(),
+		KubernetesResourceReconciler: &fakek8sReconciler{
+			reconcile: func(
+				reqLogger logr.Logger,
+				instance *custompodautoscalercomv1.CustomPodAutoscaler,
+				obj metav1.Object,
+				shouldProvision bool,
+				updatable bool,
+				kind string,
+			) (reconcile.Result, error) {
+				return reconcile.Result{}, nil
+			},
+			podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+				return nil
+			},
+		},
+		Log:                  logr.Discard(),
+		TargetKindReconciles: targetKindReconciles,
+	}
+
+	// Every reconcile of an existing CPA should be counted, CPAs that no longer exist are not counted
+	for _, name := range []string{"deployment-a", "deployment-b", "deployment-a", "statefulset", "missing"} {
+		_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      name,
+				Namespace: "test-namespace",
+			},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error reconciling %s: %v", name, err)
+		}
+	}
+
+	expected := map[string]float64{
+		"Deployment":  3,
+		"StatefulSet": 1,
+		"Rollout":     0,
+	}
+	for kind, expectedCount := range expected {
+		metric := &dto.Metric{}
+		err := targetKindReconciles.WithLabelValues(kind).Write(metric)
+		if err != nil {
+			t.Fatalf("Unexpected error reading counter: %v", err)
+		}
+		count := metric.GetCounter().GetValue()
+		if !cmp.Equal(expectedCount, count) {
+			t.Errorf("Count mismatch for %s (-want +got):\n%s", kind, cmp.Diff(expectedCount, count))
+		}
+	}
+}
+
+func TestReconcileMetricLabels(t *testing.T) {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+
+	cpa := func(name string, cpaLabels map[string]string) *custompodautoscalercomv1.CustomPodAutoscaler {
+		return &custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "test-namespace",
+				Labels:    cpaLabels,
+			},
+			Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{
+					Kind: "Deployment",
+					Name: "target",
+				},
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "test container",
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+		cpa("payments-a", map[string]string{"team": "payments", "app.kubernetes.io/part-of": "checkout", "other": "a"}),
+		cpa("payments-b", map[string]string{"team": "payments", "app.kubernetes.io/part-of": "checkout", "other": "b"}),
+		cpa("search", map[string]string{"team": "search"}),
+		cpa("unlabelled", nil),
+	).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build()
+
+	metricLabels := []string{"team", "app.kubernetes.io/part-of"}
+	targetKindReconciles, err := controllers.NewReconcilesByTargetKind(metricLabels)
+	if err != nil {
+		t.Fatalf("Unexpected error creating counter: %v", err)
+	}
+
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
+		Client: client,
+		Scheme: runtime.NewScheme(),
+		KubernetesResourceReconciler: &fakek8sReconciler{
+			reconcile: func(
+				reqLogger logr.Logger,
+				instance *custompodautoscalercomv1.CustomPodAutoscaler,
+				obj metav1.Object,
+				shouldProvision bool,
+				updatable bool,
+				kind string,
+			) (reconcile.Result, error) {
+				return reconcile.Result{}, nil
+			},
+			podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+				return nil
+			},
+		},
+		Log:                  logr.Discard(),
+		TargetKindReconciles: targetKindReconciles,
+		MetricLabels:         metricLabels,
+	}
+
+	for _, name := range []string{"payments-a", "payments-b", "search", "unlabelled"} {
+		_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      name,
+				Namespace: "test-namespace",
+			},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error reconciling %s: %v", name, err)
+		}
+	}
+
+	// Only the configured label keys are included, so CPAs with different values for other labels share a series
+	expectedCounts := []struct {
+		labels prometheus.Labels
+		count  float64
+	}{
+		{prometheus.Labels{"kind": "Deployment", "team": "payments", "app_kubernetes_io_part_of": "checkout"}, 2},
+		{prometheus.Labels{"kind": "Deployment", "team": "search", "app_kubernetes_io_part_of": ""}, 1},
+		{prometheus.Labels{"kind": "Deployment", "team": "", "app_kubernetes_io_part_of": ""}, 1},
+	}
+	for _, expectedCount := range expectedCounts {
+		metric := &dto.Metric{}
+		err := targetKindReconciles.With(expectedCount.labels).Write(metric)
+		if err != nil {
+			t.Fatalf("Unexpected error reading counter: %v", err)
+		}
+		count := metric.GetCounter().GetValue()
+		if !cmp.Equal(expectedCount.count, count) {
+			t.Errorf("Count mismatch for %v (-want +got):\n%s", expectedCount.labels, cmp.Diff(expectedCount.count, count))
+		}
+	}
+
+	series := testutil.CollectAndCount(targetKindReconciles)
+	if !cmp.Equal(3, series) {
+		t.Errorf("Series mismatch (-want +got):\n%s", cmp.Diff(3, series))
+	}
+}
+
+func TestNewReconcilesByTargetKind(t *testing.T) {
+	var tests = []struct {
+		description string
+		expectedErr string
+		labelKeys   []string
+	}{
+		{
+			"No label keys",
+			"",
+			nil,
+		},
+		{
+			"Valid label keys",
+			"",
+			[]string{"team", "app.kubernetes.io/part-of"},
+		},
+		{
+			"Label key starting with a digit, invalid",
+			`invalid metric label "1team", must not be empty or start with a digit`,
+			[]string{"1team"},
+		},
+		{
+			"Label key with the same name as the kind label, invalid",
+			`metric label "kind" has the same name as "kind"`,
+			[]string{"kind"},
+		},
+		{
+			"Label keys with the same metric label name, invalid",
+			`metric label "example.com/team" has the same name as "example.com_team"`,
+			[]string{"example.com_team", "example.com/team"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			_, err := controllers.NewReconcilesByTargetKind(test.labelKeys)
+			errMessage := ""
+			if err != nil {
+				errMessage = err.Error()
+			}
+			if !cmp.Equal(test.expectedErr, errMessage) {
+				t.Errorf("Error mismatch (-want +got):\n%s", cmp.Diff(test.expectedErr, errMessage))
+			}
+		})
+	}
+}
+
+func TestReconcilePauseMetrics(t *testing.T) {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+	scheme.AddKnownTypes(corev1.SchemeGroupVersion, &corev1.Pod{}, &corev1.PodList{})
+
+	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+		&custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "test-namespace",
+				Annotations: map[string]string{
+					controllers.PauseUntilAnnotation: "2024-03-02T00:00:00Z",
+				},
+			},
+			Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "test container",
+							},
+						},
+					},
+				},
+			},
+		},
+	).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build()
+
+	paused := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "test_paused",
+	})
+	pauseDurations := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name: "test_pause_duration_seconds",
+	})
+
+	start := time.Date(2024, time.March, 1, 22, 0, 0, 0, time.UTC)
+	fakeClock := clocktesting.NewFakePassiveClock(start)
+
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
+		Client: client,
+		Scheme: runtime.NewScheme(),
+		KubernetesResourceReconciler: &fakek8sReconciler{
+			reconcile: func(
+				reqLogger logr.Logger,
+				instance *custompodautoscalercomv1.CustomPodAutoscaler,
+				obj metav1.Object,
+				shouldProvision bool,
+				updatable bool,
+				kind string,
+			) (reconcile.Result, error) {
+				return reconcile.Result{}, nil
+			},
+			podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+				return nil
+			},
+		},
+		Log:          logr.Discard(),
+		Clock:        fakeClock,
+		PauseMetrics: controllers.NewPauseMetrics(paused, pauseDurations),
+	}
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "test",
+			Namespace: "test-namespace",
+		},
+	}
+
+	readMetrics := func() (float64, uint64, float64) {
+		gaugeMetric := &dto.Metric{}
+		err := paused.Write(gaugeMetric)
+		if err != nil {
+			t.Fatalf("Unexpected error reading gauge: %v", err)
+		}
+		histogramMetric := &dto.Metric{}
+		err = pauseDurations.Write(histogramMetric)
+		if err != nil {
+			t.Fatalf("Unexpected error reading histogram: %v", err)
+		}
+		return gaugeMetric.GetGauge().GetValue(), histogramMetric.GetHistogram().GetSampleCount(), histogramMetric.GetHistogram().GetSampleSum()
+	}
+
+	getCPA := func() *custompodautoscalercomv1.CustomPodAutoscaler {
+		cpa := &custompodautoscalercomv1.CustomPodAutoscaler{}
+		err := client.Get(context.Background(), request.NamespacedName, cpa)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return cpa
+	}
+
+	// Paused, the CPA should be counted as paused and the pause start time tracked
+	_, err := reconciler.Reconcile(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	gauge, count, sum := readMetrics()
+	if !cmp.Equal(float64(1), gauge) {
+		t.Errorf("Paused mismatch (-want +got):\n%s", cmp.Diff(float64(1), gauge))
+	}
+	if !cmp.Equal(uint64(0), count) {
+		t.Errorf("Pause duration count mismatch (-want +got):\n%s", cmp.Diff(uint64(0), count))
+	}
+
+	cpa := getCPA()
+	expectedPausedSince := metav1.NewTime(start)
+	if !cmp.Equal(&expectedPausedSince, cpa.Status.PausedSince) {
+		t.Errorf("Paused since mismatch (-want +got):\n%s", cmp.Diff(&expectedPausedSince, cpa.Status.PausedSince))
+	}
+
+	// Still paused, the CPA should not be counted twice and the pause start time should not change
+	fakeClock.SetTime(start.Add(30 * time.Minute))
+	_, err = reconciler.Reconcile(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	gauge, _, _ = readMetrics()
+	if !cmp.Equal(float64(1), gauge) {
+		t.Errorf("Paused mismatch (-want +got):\n%s", cmp.Diff(float64(1), gauge))
+	}
+
+	cpa = getCPA()
+	if !cmp.Equal(&expectedPausedSince, cpa.Status.PausedSince) {
+		t.Errorf("Paused since mismatch (-want +got):\n%s", cmp.Diff(&expectedPausedSince, cpa.Status.PausedSince))
+	}
+
+	// Resumed by removing the annotation, the pause duration should be observed and the pause start time cleared
+	fakeClock.SetTime(start.Add(90 * time.Minute))
+	cpa.Annotations = nil
+	err = client.Update(context.Background(), cpa)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = reconciler.Reconcile(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	gauge, count, sum = readMetrics()
+	if !cmp.Equal(float64(0), gauge) {
+		t.Errorf("Paused mismatch (-want +got):\n%s", cmp.Diff(float64(0), gauge))
+	}
+	if !cmp.Equal(uint64(1), count) {
+		t.Errorf("Pause duration count mismatch (-want +got):\n%s", cmp.Diff(uint64(1), count))
+	}
+	expectedDuration := (90 * time.Minute).Seconds()
+	if !cmp.Equal(expectedDuration, sum) {
+		t.Errorf("Pause duration mismatch (-want +got):\n%s", cmp.Diff(expectedDuration, sum))
+	}
+
+	cpa = getCPA()
+	if cpa.Status.PausedSince != nil {
+		t.Errorf("Paused since mismatch, expected nil, got %v", cpa.Status.PausedSince)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+)
+
+const (
+	// dnsPort is the port cluster DNS is served on
+	dnsPort = 53
+	// apiServerPort is the port the Kubernetes API server is served on through the kubernetes Service
+	apiServerPort = 443
+	// apiServerTargetPort is the port the Kubernetes API server listens on in most clusters, NetworkPolicies are
+	// applied after the kubernetes Service is resolved to an endpoint so this port must be allowed too
+	apiServerTargetPort = 6443
+)
+
+// buildNetworkPolicy defines a NetworkPolicy selecting the autoscaler Pod, denying all egress except DNS, the
+// Kubernetes API server and the egress rules of the CPA. The API server address differs between clusters, so it is
+// allowed by port to any destination. Ingress is not restricted so the autoscaler HTTP API can still be reached
+func buildNetworkPolicy(instance *custompodautoscalercomv1.CustomPodAutoscaler, labels map[string]string) *networkingv1.NetworkPolicy {
+	egress := []networkingv1.NetworkPolicyEgressRule{
+		{
+			Ports: []networkingv1.NetworkPolicyPort{
+				networkPolicyPort(corev1.ProtocolUDP, dnsPort),
+				networkPolicyPort(corev1.ProtocolTCP, dnsPort),
+			},
+		},
+		{
+			Ports: []networkingv1.NetworkPolicyPort{
+				networkPolicyPort(corev1.ProtocolTCP, apiServerPort),
+				networkPolicyPort(corev1.ProtocolTCP, apiServerTargetPort),
+			},
+		},
+	}
+	for _, rule := range instance.Spec.NetworkPolicyEgress {
+		egress = append(egress, *rule.DeepCopy())
+	}
+
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance.Name,
+			Namespace: instance.Namespace,
+			Labels:    labels,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					managedByLabel: labels[managedByLabel],
+					OwnedByLabel:   labels[OwnedByLabel],
+				},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			Egress:      egress,
+		},
+	}
+}
+
+func networkPolicyPort(protocol corev1.Protocol, port int32) networkingv1.NetworkPolicyPort {
+	portValue := intstr.FromInt32(port)
+	return networkingv1.NetworkPolicyPort{
+		Protocol: &protocol,
+		Port:     &portValue,
+	}
+}
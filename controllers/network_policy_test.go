@@ -0,0 +1,197 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileNetworkPolicy(t *testing.T) {
+	udp := corev1.ProtocolUDP
+	tcp := corev1.ProtocolTCP
+	dnsPort := intstr.FromInt32(53)
+	apiServerPort := intstr.FromInt32(443)
+	apiServerTargetPort := intstr.FromInt32(6443)
+	metricsPort := intstr.FromInt32(9090)
+
+	defaultEgress := []networkingv1.NetworkPolicyEgressRule{
+		{
+			Ports: []networkingv1.NetworkPolicyPort{
+				{Protocol: &udp, Port: &dnsPort},
+				{Protocol: &tcp, Port: &dnsPort},
+			},
+		},
+		{
+			Ports: []networkingv1.NetworkPolicyPort{
+				{Protocol: &tcp, Port: &apiServerPort},
+				{Protocol: &tcp, Port: &apiServerTargetPort},
+			},
+		},
+	}
+
+	metricsEgress := networkingv1.NetworkPolicyEgressRule{
+		Ports: []networkingv1.NetworkPolicyPort{
+			{Protocol: &tcp, Port: &metricsPort},
+		},
+		To: []networkingv1.NetworkPolicyPeer{
+			{
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"kubernetes.io/metadata.name": "monitoring",
+					},
+				},
+				PodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"app": "prometheus",
+					},
+				},
+			},
+		},
+	}
+
+	labels := map[string]string{
+		"app.kubernetes.io/managed-by":        "custom-pod-autoscaler-operator",
+		"v1.custompodautoscaler.com/owned-by": "test",
+	}
+
+	var tests = []struct {
+		description     string
+		expected        *networkingv1.NetworkPolicy
+		provisionPolicy *bool
+		egress          []networkingv1.NetworkPolicyEgressRule
+		kinds           []string
+	}{
+		{
+			"NetworkPolicy not requested",
+			nil,
+			nil,
+			nil,
+			[]string{"v1/ServiceAccount", "v1/Role", "v1/RoleBinding", "v1/Pod"},
+		},
+		{
+			"NetworkPolicy requested, DNS and API server egress allowed, provisioned before the Pod",
+			&networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test-namespace",
+					Labels:    labels,
+				},
+				Spec: networkingv1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{
+						MatchLabels: labels,
+					},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+					Egress:      defaultEgress,
+				},
+			},
+			boolPtr(true),
+			nil,
+			[]string{"v1/ServiceAccount", "v1/Role", "v1/RoleBinding", "networking.k8s.io/v1/NetworkPolicy", "v1/Pod"},
+		},
+		{
+			"NetworkPolicy requested with additional egress, egress rules appended",
+			&networkingv1.NetworkPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test-namespace",
+					Labels:    labels,
+				},
+				Spec: networkingv1.NetworkPolicySpec{
+					PodSelector: metav1.LabelSelector{
+						MatchLabels: labels,
+					},
+					PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+					Egress:      append(append([]networkingv1.NetworkPolicyEgressRule{}, defaultEgress...), metricsEgress),
+				},
+			},
+			boolPtr(true),
+			[]networkingv1.NetworkPolicyEgressRule{metricsEgress},
+			[]string{"v1/ServiceAccount", "v1/Role", "v1/RoleBinding", "networking.k8s.io/v1/NetworkPolicy", "v1/Pod"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			scheme.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+
+			var networkPolicy *networkingv1.NetworkPolicy
+			kinds := []string{}
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test",
+							Namespace: "test-namespace",
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							Template: custompodautoscalercomv1.PodTemplateSpec{
+								Spec: custompodautoscalercomv1.PodSpec{
+									Containers: []corev1.Container{
+										{
+											Name: "test container",
+										},
+									},
+								},
+							},
+							ProvisionNetworkPolicy: test.provisionPolicy,
+							NetworkPolicyEgress:    test.egress,
+						},
+					},
+				).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: noopK8sReconciler(func(obj metav1.Object, kind string) {
+					kinds = append(kinds, kind)
+					if kind == "networking.k8s.io/v1/NetworkPolicy" {
+						networkPolicy = obj.(*networkingv1.NetworkPolicy)
+					}
+				}),
+				Log: logr.Discard(),
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expected, networkPolicy) {
+				t.Errorf("NetworkPolicy mismatch (-want +got):\n%s", cmp.Diff(test.expected, networkPolicy))
+			}
+
+			if !cmp.Equal(test.kinds, kinds) {
+				t.Errorf("Reconciled kinds mismatch (-want +got):\n%s", cmp.Diff(test.kinds, kinds))
+			}
+		})
+	}
+}
@@ -0,0 +1,1088 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/json"
+
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+)
+
+const (
+	// configFilesVolumeName is the name of the volume the ConfigFiles ConfigMap is mounted from
+	configFilesVolumeName = "cpa-config-files"
+	// defaultConfigFilesMountPath is the path ConfigFiles are mounted at if no mount path is set
+	defaultConfigFilesMountPath = "/etc/cpa/config"
+	// scratchVolumeName is the name of the emptyDir scratch volume
+	scratchVolumeName = "cpa-scratch"
+	// defaultScratchVolumeMountPath is the path the scratch volume is mounted at if no mount path is set
+	defaultScratchVolumeMountPath = "/tmp"
+	// defaultAPIPort is the port the autoscaler serves its HTTP API on by default
+	defaultAPIPort = 5000
+	// projectedTokenVolumeName is the name of the projected service account token volume
+	projectedTokenVolumeName = "cpa-service-account-token"
+	// projectedTokenMountPath is the path the projected service account token volume is mounted at, matching the
+	// automatically mounted token so in-cluster clients find the token without any configuration
+	projectedTokenMountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// defaultProjectedTokenExpirationSeconds is the lifetime of the projected service account token if none is set
+	defaultProjectedTokenExpirationSeconds = 3600
+	// scaleTargetAntiAffinityWeight is the weight of the preferred anti-affinity against the Pods of the scale target
+	scaleTargetAntiAffinityWeight = 100
+)
+
+// ProvisioningPlan is the fully resolved set of resources the operator provisions for a CustomPodAutoscaler, built
+// after defaults have been applied to the CustomPodAutoscaler spec
+type ProvisioningPlan struct {
+	ProvisionRole             bool                                     `json:"provisionRole"`
+	ProvisionRoleBinding      bool                                     `json:"provisionRoleBinding"`
+	ProvisionServiceAccount   bool                                     `json:"provisionServiceAccount"`
+	ProvisionPod              bool                                     `json:"provisionPod"`
+	RoleRequiresMetricsServer bool                                     `json:"roleRequiresMetricsServer"`
+	RoleRequiresArgoRollouts  bool                                     `json:"roleRequiresArgoRollouts"`
+	MetricsRBACMode           custompodautoscalercomv1.MetricsRBACMode `json:"metricsRBACMode"`
+	ServiceAccount            *corev1.ServiceAccount                   `json:"serviceAccount"`
+	Role                      *rbacv1.Role                             `json:"role,omitempty"`
+	RoleBinding               *rbacv1.RoleBinding                      `json:"roleBinding,omitempty"`
+	ConfigMap                 *corev1.ConfigMap                        `json:"configMap,omitempty"`
+	Secret                    *corev1.Secret                           `json:"secret,omitempty"`
+	Pod                       *corev1.Pod                              `json:"pod"`
+	Service                   *corev1.Service                          `json:"service,omitempty"`
+	ServiceMonitor            *unstructured.Unstructured               `json:"serviceMonitor,omitempty"`
+	NetworkPolicy             *networkingv1.NetworkPolicy              `json:"networkPolicy,omitempty"`
+	// IgnoredFeatureGates are the unknown features set in the feature gates annotation, not part of the provisioned
+	// resources so not included in the plan hash
+	IgnoredFeatureGates []Feature `json:"-"`
+}
+
+// applyDefaults sets any unset provisioning options in the CustomPodAutoscaler spec to their default values
+func applyDefaults(instance *custompodautoscalercomv1.CustomPodAutoscaler) {
+	if instance.Spec.ProvisionRole == nil {
+		defaultVal := true
+		instance.Spec.ProvisionRole = &defaultVal
+	}
+	if instance.Spec.ProvisionRoleBinding == nil {
+		defaultVal := true
+		instance.Spec.ProvisionRoleBinding = &defaultVal
+	}
+	if instance.Spec.ProvisionServiceAccount == nil {
+		defaultVal := true
+		instance.Spec.ProvisionServiceAccount = &defaultVal
+	}
+	if instance.Spec.ProvisionPod == nil {
+		defaultVal := true
+		instance.Spec.ProvisionPod = &defaultVal
+	}
+	if instance.Spec.RoleRequiresMetricsServer == nil {
+		defaultVal := false
+		instance.Spec.RoleRequiresMetricsServer = &defaultVal
+	}
+	if instance.Spec.RoleRequiresArgoRollouts == nil {
+		defaultVal := false
+		instance.Spec.RoleRequiresArgoRollouts = &defaultVal
+	}
+	if instance.Spec.MetricsRBACMode == "" {
+		instance.Spec.MetricsRBACMode = custompodautoscalercomv1.MetricsRBACModeFull
+	}
+	if instance.Spec.ConfigFilesMountPath == "" {
+		instance.Spec.ConfigFilesMountPath = defaultConfigFilesMountPath
+	}
+	if instance.Spec.ScratchVolumeMountPath == "" {
+		instance.Spec.ScratchVolumeMountPath = defaultScratchVolumeMountPath
+	}
+}
+
+// applyConfigOverlay merges the config overlay for the environment provided onto the config in the CustomPodAutoscaler
+// spec, overlay options replace config options with the same name and any other overlay options are added. If no
+// environment is provided, or the CustomPodAutoscaler has no overlay for the environment, the config is unchanged
+func applyConfigOverlay(instance *custompodautoscalercomv1.CustomPodAutoscaler, environment string) {
+	overlay, exists := instance.Spec.ConfigOverlays[environment]
+	if environment == "" || !exists {
+		return
+	}
+
+	config := append([]custompodautoscalercomv1.CustomPodAutoscalerConfig{}, instance.Spec.Config...)
+	for _, option := range overlay {
+		replaced := false
+		for i := range config {
+			if config[i].Name == option.Name {
+				config[i].Value = option.Value
+				replaced = true
+			}
+		}
+		if !replaced {
+			config = append(config, option)
+		}
+	}
+	instance.Spec.Config = config
+}
+
+// newProvisioningPlan applies defaults to the CustomPodAutoscaler provided and builds the resources that should be
+// provisioned for it. The Role and RoleBinding are only included if the ServiceAccount is provisioned by the operator
+func newProvisioningPlan(instance *custompodautoscalercomv1.CustomPodAutoscaler) (*ProvisioningPlan, error) {
+	applyDefaults(instance)
+
+	// Features enabled for the CPA with the feature gates annotation change the defaults applied to the spec, unknown
+	// features are rejected by the webhook so are ignored here rather than failing every reconcile
+	gates, ignoredFeatureGates, err := parseFeatureGates(instance.GetAnnotations()[FeatureGatesAnnotation])
+	if err != nil {
+		return nil, errors.NewBadRequest(err.Error())
+	}
+	if gates.Enabled(FeatureProjectedTokenByDefault) && instance.Spec.UseProjectedToken == nil {
+		defaultVal := true
+		instance.Spec.UseProjectedToken = &defaultVal
+	}
+
+	err = validateRoleBindingSubjects(instance.Spec.AdditionalRoleBindingSubjects)
+	if err != nil {
+		return nil, errors.NewBadRequest(err.Error())
+	}
+
+	// Parse scaleTargetRef
+	scaleTargetRef, err := json.Marshal(instance.Spec.ScaleTargetRef)
+	if err != nil {
+		// Should not occur, panic
+		panic(err)
+	}
+
+	labels := map[string]string{
+		managedByLabel: "custom-pod-autoscaler-operator",
+		OwnedByLabel:   instance.Name,
+	}
+
+	plan := &ProvisioningPlan{
+		ProvisionRole:             *instance.Spec.ProvisionRole,
+		ProvisionRoleBinding:      *instance.Spec.ProvisionRoleBinding,
+		ProvisionServiceAccount:   *instance.Spec.ProvisionServiceAccount,
+		ProvisionPod:              *instance.Spec.ProvisionPod,
+		RoleRequiresMetricsServer: *instance.Spec.RoleRequiresMetricsServer,
+		RoleRequiresArgoRollouts:  *instance.Spec.RoleRequiresArgoRollouts,
+		MetricsRBACMode:           instance.Spec.MetricsRBACMode,
+		IgnoredFeatureGates:       ignoredFeatureGates,
+	}
+
+	// Define a new Service Account object
+	if !(*instance.Spec.ProvisionServiceAccount) {
+		if instance.Spec.Template.Spec.ServiceAccountName != "" {
+			plan.ServiceAccount = &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      instance.Spec.Template.Spec.ServiceAccountName,
+					Namespace: instance.Namespace,
+					Labels:    labels,
+				},
+			}
+		} else {
+			return nil, errors.NewBadRequest("ServiceAccount not provided in the CustomPodAutoscaler spec")
+		}
+	} else {
+		plan.ServiceAccount = &corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      instance.Name,
+				Namespace: instance.Namespace,
+				Labels:    labels,
+			},
+		}
+		if instance.Spec.AttachPullSecretsToSA != nil && *instance.Spec.AttachPullSecretsToSA {
+			plan.ServiceAccount.ImagePullSecrets = append([]corev1.LocalObjectReference{}, instance.Spec.Template.Spec.ImagePullSecrets...)
+		}
+		plan.Role = buildRole(instance, labels)
+		plan.RoleBinding = buildRoleBinding(instance, labels)
+	}
+
+	configMapName := ""
+	if len(instance.Spec.ConfigFiles) > 0 {
+		plan.ConfigMap = buildConfigMap(instance, labels)
+		configMapName = plan.ConfigMap.Name
+	}
+
+	secretName := ""
+	if len(instance.Spec.SecretConfig) > 0 {
+		plan.Secret = buildSecret(instance, labels)
+		secretName = plan.Secret.Name
+	}
+
+	plan.Pod, err = buildPod(instance, plan.ServiceAccount.Name, string(scaleTargetRef), configMapName, secretName)
+	if err != nil {
+		return nil, errors.NewBadRequest(err.Error())
+	}
+	if plan.Secret != nil {
+		setSecretConfigHash(plan.Pod, plan.Secret)
+	}
+	setPodSpecHash(plan.Pod)
+
+	if instance.Spec.ProvisionServiceMonitor != nil && *instance.Spec.ProvisionServiceMonitor {
+		plan.Service = buildService(instance, plan.Pod, labels)
+		plan.ServiceMonitor = buildServiceMonitor(instance, plan.Service, labels)
+	}
+
+	if instance.Spec.ProvisionNetworkPolicy != nil && *instance.Spec.ProvisionNetworkPolicy {
+		plan.NetworkPolicy = buildNetworkPolicy(instance, labels)
+	}
+
+	return plan, nil
+}
+
+// hash returns a hash of all of the resources in the plan, used to detect if any provisioned resources have changed
+func (p *ProvisioningPlan) hash() string {
+	data, err := json.Marshal(p)
+	if err != nil {
+		// Should not occur, panic
+		panic(err)
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])[:16]
+}
+
+// rbacMode returns a summary of the RBAC resources provisioned by the plan, Role and RoleBinding are only provisioned
+// if the ServiceAccount is provisioned
+func (p *ProvisioningPlan) rbacMode() custompodautoscalercomv1.RBACMode {
+	if p.Role == nil || p.RoleBinding == nil {
+		return custompodautoscalercomv1.RBACModeSkipped
+	}
+	switch {
+	case p.ProvisionRole && p.ProvisionRoleBinding:
+		return custompodautoscalercomv1.RBACModeProvisionedRole
+	case p.ProvisionRoleBinding:
+		return custompodautoscalercomv1.RBACModeBoundExistingRole
+	case p.ProvisionRole:
+		return custompodautoscalercomv1.RBACModeProvisionedRoleUnbound
+	}
+	return custompodautoscalercomv1.RBACModeSkipped
+}
+
+// objects returns every resource in the plan
+func (p *ProvisioningPlan) objects() []metav1.Object {
+	objs := []metav1.Object{p.ServiceAccount, p.Pod}
+	if p.Role != nil {
+		objs = append(objs, p.Role)
+	}
+	if p.RoleBinding != nil {
+		objs = append(objs, p.RoleBinding)
+	}
+	if p.ConfigMap != nil {
+		objs = append(objs, p.ConfigMap)
+	}
+	if p.Secret != nil {
+		objs = append(objs, p.Secret)
+	}
+	if p.Service != nil {
+		objs = append(objs, p.Service)
+	}
+	if p.ServiceMonitor != nil {
+		objs = append(objs, p.ServiceMonitor)
+	}
+	if p.NetworkPolicy != nil {
+		objs = append(objs, p.NetworkPolicy)
+	}
+	return objs
+}
+
+// addLabels adds the labels provided to every resource in the plan, without modifying any labels shared between
+// resources
+func (p *ProvisioningPlan) addLabels(labels map[string]string) {
+	for _, obj := range p.objects() {
+		objLabels := make(map[string]string, len(obj.GetLabels())+len(labels))
+		for key, value := range obj.GetLabels() {
+			objLabels[key] = value
+		}
+		for key, value := range labels {
+			objLabels[key] = value
+		}
+		obj.SetLabels(objLabels)
+	}
+
+	// The Pod labels have changed so the hash must be updated
+	setPodSpecHash(p.Pod)
+}
+
+// addPodLabels adds the labels provided to the Pod only, such as labels for discovering autoscaler Pods across CPAs.
+// The labels take precedence over labels from the Pod template, so they are the same for every CPA
+func (p *ProvisioningPlan) addPodLabels(labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+
+	podLabels := make(map[string]string, len(p.Pod.GetLabels())+len(labels))
+	for key, value := range p.Pod.GetLabels() {
+		podLabels[key] = value
+	}
+	for key, value := range labels {
+		podLabels[key] = value
+	}
+	p.Pod.SetLabels(podLabels)
+
+	// The Pod labels have changed so the hash must be updated
+	setPodSpecHash(p.Pod)
+}
+
+// addDefaultAnnotations adds the annotations provided to every resource in the plan, annotations already set on a
+// resource (such as annotations from the Pod template) take precedence
+func (p *ProvisioningPlan) addDefaultAnnotations(annotations map[string]string) {
+	if len(annotations) == 0 {
+		return
+	}
+
+	for _, obj := range p.objects() {
+		objAnnotations := make(map[string]string, len(obj.GetAnnotations())+len(annotations))
+		for key, value := range annotations {
+			objAnnotations[key] = value
+		}
+		for key, value := range obj.GetAnnotations() {
+			objAnnotations[key] = value
+		}
+		obj.SetAnnotations(objAnnotations)
+	}
+
+	// The Pod annotations have changed so the hash must be updated
+	setPodSpecHash(p.Pod)
+}
+
+// addProxyEnvVars adds the proxy environment variables provided to every container and native sidecar init container
+// of the Pod, environment variables already set in the container (such as from the template or the CPA config) take
+// precedence
+func (p *ProvisioningPlan) addProxyEnvVars(envVars []corev1.EnvVar) {
+	if len(envVars) == 0 {
+		return
+	}
+
+	for i, container := range p.Pod.Spec.Containers {
+		p.Pod.Spec.Containers[i].Env = withMissingEnvVars(container.Env, envVars)
+	}
+	for i, initContainer := range p.Pod.Spec.InitContainers {
+		if nativeSidecar(initContainer) {
+			p.Pod.Spec.InitContainers[i].Env = withMissingEnvVars(initContainer.Env, envVars)
+		}
+	}
+
+	// The Pod spec has changed so the hash must be updated
+	setPodSpecHash(p.Pod)
+}
+
+// addSecurityProfile applies the securityContext defaults of the profile to the Pod and all of its containers and init
+// containers, fields already set (such as from the template) take precedence. The security contexts are copied to avoid
+// modifying the template in the CPA spec
+func (p *ProvisioningPlan) addSecurityProfile(profile SecurityProfile) {
+	if profile == "" {
+		return
+	}
+
+	podSecurityContext := &corev1.PodSecurityContext{}
+	if p.Pod.Spec.SecurityContext != nil {
+		podSecurityContext = p.Pod.Spec.SecurityContext.DeepCopy()
+	}
+	if podSecurityContext.SeccompProfile == nil {
+		podSecurityContext.SeccompProfile = &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		}
+	}
+	if profile == SecurityProfileRestricted && podSecurityContext.RunAsNonRoot == nil {
+		runAsNonRoot := true
+		podSecurityContext.RunAsNonRoot = &runAsNonRoot
+	}
+	p.Pod.Spec.SecurityContext = podSecurityContext
+
+	if profile == SecurityProfileRestricted {
+		for i, container := range p.Pod.Spec.Containers {
+			p.Pod.Spec.Containers[i].SecurityContext = restrictedSecurityContext(container.SecurityContext)
+		}
+		for i, initContainer := range p.Pod.Spec.InitContainers {
+			p.Pod.Spec.InitContainers[i].SecurityContext = restrictedSecurityContext(initContainer.SecurityContext)
+		}
+	}
+
+	// The Pod spec has changed so the hash must be updated
+	setPodSpecHash(p.Pod)
+}
+
+// restrictedSecurityContext returns a copy of the container security context with privilege escalation disallowed and
+// all capabilities dropped, unless the security context already sets them
+func restrictedSecurityContext(existing *corev1.SecurityContext) *corev1.SecurityContext {
+	securityContext := &corev1.SecurityContext{}
+	if existing != nil {
+		securityContext = existing.DeepCopy()
+	}
+	if securityContext.AllowPrivilegeEscalation == nil {
+		allowPrivilegeEscalation := false
+		securityContext.AllowPrivilegeEscalation = &allowPrivilegeEscalation
+	}
+	if securityContext.Capabilities == nil {
+		securityContext.Capabilities = &corev1.Capabilities{}
+	}
+	if len(securityContext.Capabilities.Drop) == 0 {
+		securityContext.Capabilities.Drop = []corev1.Capability{"ALL"}
+	}
+	return securityContext
+}
+
+// addScaleTargetRules appends rules to the provisioned Role granting access to the scale target and its scale
+// subresource if the Role does not already allow it, so scale targets in API groups the default Role does not cover
+// (such as Knative Services) can be autoscaled. The rules are limited to the scale target by name
+func (p *ProvisioningPlan) addScaleTargetRules(instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+	if p.Role == nil {
+		return nil
+	}
+
+	required, err := requiredPermissions(instance)
+	if err != nil {
+		return err
+	}
+	if len(missingPermissions(p.Role, required)) == 0 {
+		return nil
+	}
+
+	target := required[0]
+	p.Role.Rules = append(p.Role.Rules,
+		rbacv1.PolicyRule{
+			APIGroups:     []string{target.group},
+			Resources:     []string{target.resource},
+			ResourceNames: []string{target.resourceName},
+			Verbs:         []string{"get"},
+		},
+		rbacv1.PolicyRule{
+			APIGroups:     []string{target.group},
+			Resources:     []string{target.resource + "/scale"},
+			ResourceNames: []string{target.resourceName},
+			Verbs:         []string{"get", "update"},
+		},
+	)
+	return nil
+}
+
+// addScaleTargetAntiAffinity adds a preferred pod anti-affinity term to the Pod against Pods matching the selector of
+// the scale target, spreading the autoscaler and the scale target across nodes. Anti-affinity terms from the template
+// are kept, the affinity is copied to avoid modifying the template in the CPA spec
+func (p *ProvisioningPlan) addScaleTargetAntiAffinity(selector *metav1.LabelSelector) {
+	affinity := &corev1.Affinity{}
+	if p.Pod.Spec.Affinity != nil {
+		affinity = p.Pod.Spec.Affinity.DeepCopy()
+	}
+	if affinity.PodAntiAffinity == nil {
+		affinity.PodAntiAffinity = &corev1.PodAntiAffinity{}
+	}
+	affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+		affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+		corev1.WeightedPodAffinityTerm{
+			Weight: scaleTargetAntiAffinityWeight,
+			PodAffinityTerm: corev1.PodAffinityTerm{
+				LabelSelector: selector,
+				TopologyKey:   corev1.LabelHostname,
+			},
+		},
+	)
+	p.Pod.Spec.Affinity = affinity
+
+	// The Pod spec has changed so the hash must be updated
+	setPodSpecHash(p.Pod)
+}
+
+// withMissingEnvVars returns the existing environment variables with any of the additional environment variables that
+// are not already set appended, the existing environment variables are copied to avoid modifying any env vars shared
+// with the template in the CPA spec
+func withMissingEnvVars(existing []corev1.EnvVar, additional []corev1.EnvVar) []corev1.EnvVar {
+	set := map[string]bool{}
+	for _, envVar := range existing {
+		set[envVar.Name] = true
+	}
+	envVars := append([]corev1.EnvVar{}, existing...)
+	for _, envVar := range additional {
+		if !set[envVar.Name] {
+			envVars = append(envVars, envVar)
+		}
+	}
+	return envVars
+}
+
+// nativeSidecar returns if the init container is a native sidecar container, which keeps running alongside the other
+// containers of the Pod rather than running to completion before they start
+func nativeSidecar(initContainer corev1.Container) bool {
+	return initContainer.RestartPolicy != nil && *initContainer.RestartPolicy == corev1.ContainerRestartPolicyAlways
+}
+
+// setSecretConfigHash annotates the Pod with a hash of the SecretConfig Secret data, environment variables from the
+// Secret are only read when the containers start so the changed hash recreates the Pod when the Secret changes
+func setSecretConfigHash(pod *corev1.Pod, secret *corev1.Secret) {
+	data, err := json.Marshal(secret.Data)
+	if err != nil {
+		// Should not occur, panic
+		panic(err)
+	}
+
+	annotations := map[string]string{}
+	for key, value := range pod.Annotations {
+		annotations[key] = value
+	}
+	hash := sha256.Sum256(data)
+	annotations[SecretConfigHashAnnotation] = hex.EncodeToString(hash[:])[:16]
+	pod.Annotations = annotations
+}
+
+// setPodSpecHash annotates the Pod with a hash of its labels, annotations and spec, allowing an existing Pod to only be
+// recreated if the Pod has changed. The name is not included as a generated name is only known once the Pod is created
+func setPodSpecHash(pod *corev1.Pod) {
+	annotations := map[string]string{}
+	for key, value := range pod.Annotations {
+		if key != PodSpecHashAnnotation {
+			annotations[key] = value
+		}
+	}
+
+	data, err := json.Marshal(struct {
+		Labels      map[string]string `json:"labels"`
+		Annotations map[string]string `json:"annotations"`
+		Spec        corev1.PodSpec    `json:"spec"`
+	}{
+		Labels:      pod.Labels,
+		Annotations: annotations,
+		Spec:        pod.Spec,
+	})
+	if err != nil {
+		// Should not occur, panic
+		panic(err)
+	}
+
+	hash := sha256.Sum256(data)
+	annotations[PodSpecHashAnnotation] = hex.EncodeToString(hash[:])[:16]
+	pod.Annotations = annotations
+}
+
+// buildRole defines the Role the autoscaler uses to manage its scale target
+func buildRole(instance *custompodautoscalercomv1.CustomPodAutoscaler, labels map[string]string) *rbacv1.Role {
+	role := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance.Name,
+			Namespace: instance.Namespace,
+			Labels:    labels,
+		},
+		Rules: []rbacv1.PolicyRule{
+			{
+				APIGroups: []string{""},
+				Resources: []string{"pods", "replicationcontrollers", "replicationcontrollers/scale"},
+				Verbs:     []string{"*"},
+			},
+			{
+				APIGroups: []string{"apps"},
+				Resources: []string{"deployments", "deployments/scale", "replicasets", "replicasets/scale", "statefulsets", "statefulsets/scale"},
+				Verbs:     []string{"*"},
+			},
+		},
+	}
+
+	if *instance.Spec.RoleRequiresMetricsServer {
+		// Only grant read access to the metrics APIs if requested, otherwise grant full access for compatibility
+		verbs := []string{"*"}
+		if instance.Spec.MetricsRBACMode == custompodautoscalercomv1.MetricsRBACModeReadOnly {
+			verbs = []string{"get", "list"}
+		}
+		role.Rules = append(role.Rules, rbacv1.PolicyRule{
+			APIGroups: []string{"metrics.k8s.io", "custom.metrics.k8s.io", "external.metrics.k8s.io"},
+			Resources: []string{"*"},
+			Verbs:     verbs,
+		})
+	}
+
+	if *instance.Spec.RoleRequiresArgoRollouts {
+		role.Rules = append(role.Rules, rbacv1.PolicyRule{
+			APIGroups: []string{"argoproj.io"},
+			Resources: []string{"rollouts", "rollouts/scale"},
+			Verbs:     []string{"*"},
+		})
+	}
+
+	return role
+}
+
+// buildRoleBinding defines the Role Binding between the provisioned Role and the ServiceAccount, along with any
+// additional subjects
+func buildRoleBinding(instance *custompodautoscalercomv1.CustomPodAutoscaler, labels map[string]string) *rbacv1.RoleBinding {
+	subjects := []rbacv1.Subject{
+		{
+			Kind:      "ServiceAccount",
+			Name:      instance.Name,
+			Namespace: instance.Namespace,
+		},
+	}
+	for _, subject := range instance.Spec.AdditionalRoleBindingSubjects {
+		if subject.Kind == rbacv1.ServiceAccountKind && subject.Namespace == "" {
+			subject.Namespace = instance.Namespace
+		}
+		if (subject.Kind == rbacv1.UserKind || subject.Kind == rbacv1.GroupKind) && subject.APIGroup == "" {
+			subject.APIGroup = rbacv1.GroupName
+		}
+		subjects = append(subjects, subject)
+	}
+
+	return &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance.Name,
+			Namespace: instance.Namespace,
+			Labels:    labels,
+		},
+		Subjects: subjects,
+		RoleRef: rbacv1.RoleRef{
+			Kind:     "Role",
+			Name:     instance.Name,
+			APIGroup: "rbac.authorization.k8s.io",
+		},
+	}
+}
+
+// validateRoleBindingSubjects checks that the additional RoleBinding subjects are kinds that can be bound to a Role
+func validateRoleBindingSubjects(subjects []rbacv1.Subject) error {
+	for _, subject := range subjects {
+		switch subject.Kind {
+		case rbacv1.ServiceAccountKind, rbacv1.UserKind, rbacv1.GroupKind:
+		default:
+			return fmt.Errorf("additionalRoleBindingSubjects %s has invalid kind %q, must be one of %s, %s, %s",
+				subject.Name, subject.Kind, rbacv1.ServiceAccountKind, rbacv1.UserKind, rbacv1.GroupKind)
+		}
+	}
+	return nil
+}
+
+// buildConfigMap defines the ConfigMap holding the ConfigFiles provided in the CustomPodAutoscaler spec
+func buildConfigMap(instance *custompodautoscalercomv1.CustomPodAutoscaler, labels map[string]string) *corev1.ConfigMap {
+	data := map[string]string{}
+	for filename, content := range instance.Spec.ConfigFiles {
+		data[filename] = content
+	}
+
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance.Name + "-config",
+			Namespace: instance.Namespace,
+			Labels:    labels,
+		},
+		Data: data,
+	}
+}
+
+// buildSecret defines the Secret holding the SecretConfig provided in the CustomPodAutoscaler spec
+func buildSecret(instance *custompodautoscalercomv1.CustomPodAutoscaler, labels map[string]string) *corev1.Secret {
+	data := map[string][]byte{}
+	for name, value := range instance.Spec.SecretConfig {
+		data[name] = []byte(value)
+	}
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance.Name + "-secret-config",
+			Namespace: instance.Namespace,
+			Labels:    labels,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: data,
+	}
+}
+
+// buildPod defines the autoscaler Pod from the CustomPodAutoscaler PodTemplateSpec, injecting configuration and
+// pointing it at the ServiceAccount provided. If a ConfigMap name is provided the ConfigMap is mounted into every
+// container at the ConfigFiles mount path, if a Secret name is provided the Secret is injected into every container
+// as environment variables. An error is returned if a templated config value cannot be expanded
+func buildPod(instance *custompodautoscalercomv1.CustomPodAutoscaler, serviceAccountName string, scaleTargetRef string, configMapName string, secretName string) (*corev1.Pod, error) {
+	// Set up Pod labels, if labels are provided in the template Pod Spec the labels are merged
+	// with the CPA managed-by label, otherwise only the managed-by label is added. The labels are
+	// merged into a new map to avoid modifying the template labels in the CPA spec
+	podLabels := map[string]string{}
+	for key, value := range instance.Spec.Template.ObjectMeta.Labels {
+		podLabels[key] = value
+	}
+	podLabels[managedByLabel] = "custom-pod-autoscaler-operator"
+	podLabels[OwnedByLabel] = instance.Name
+
+	// Set up ObjectMeta, if no name or namespaces are provided in the template PodSpec then
+	// the CPA name and namespace are used
+	objectMeta := instance.Spec.Template.ObjectMeta
+	if objectMeta.Name == "" {
+		objectMeta.Name = instance.Name
+	}
+	if objectMeta.Namespace == "" {
+		objectMeta.Namespace = instance.Namespace
+	}
+	objectMeta.Labels = podLabels
+
+	// If using a generated name the Pod name is only known once it has been created, so the name tracked in the
+	// status is used to refer to the existing Pod
+	if instance.Spec.GeneratePodName != nil && *instance.Spec.GeneratePodName {
+		objectMeta.GenerateName = objectMeta.Name + "-"
+		objectMeta.Name = instance.Status.PodName
+	}
+
+	// Set up the PodSpec template
+	podSpec := instance.Spec.Template.Spec
+	useProjectedToken := instance.Spec.UseProjectedToken != nil && *instance.Spec.UseProjectedToken
+	mountScratchVolume := instance.Spec.MountScratchVolume != nil && *instance.Spec.MountScratchVolume
+	// Configuration, such as namespace, target ref and configuration options, injected as environment variables
+	configEnvVars, err := cpaEnvVars(instance, scaleTargetRef)
+	if err != nil {
+		return nil, err
+	}
+	// Inject environment variables, the SecretConfig and volume mounts into a Container specified by the PodSpec
+	injectContainer := func(container corev1.Container) corev1.Container {
+		// If no environment variables specified by the template PodSpec, set up empty env vars
+		// slice
+		var envVars []corev1.EnvVar
+		if container.Env == nil {
+			envVars = []corev1.EnvVar{}
+		} else {
+			envVars = container.Env
+		}
+		// Inject in configuration, such as namespace, target ref and configuration
+		// options as environment variables
+		envVars = append(envVars, configEnvVars...)
+		container.Env = envVars
+		// Inject the SecretConfig, copying the env sources to avoid modifying the template in the CPA spec
+		if secretName != "" {
+			container.EnvFrom = append(append([]corev1.EnvFromSource{}, container.EnvFrom...), corev1.EnvFromSource{
+				SecretRef: &corev1.SecretEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: secretName,
+					},
+				},
+			})
+		}
+		// Mount the ConfigFiles, copying the volume mounts to avoid modifying the template in the CPA spec
+		if configMapName != "" {
+			container.VolumeMounts = append(append([]corev1.VolumeMount{}, container.VolumeMounts...), corev1.VolumeMount{
+				Name:      configFilesVolumeName,
+				MountPath: instance.Spec.ConfigFilesMountPath,
+				ReadOnly:  true,
+			})
+		}
+		// Mount the projected service account token in place of the automatically mounted token
+		if useProjectedToken {
+			container.VolumeMounts = append(append([]corev1.VolumeMount{}, container.VolumeMounts...), corev1.VolumeMount{
+				Name:      projectedTokenVolumeName,
+				MountPath: projectedTokenMountPath,
+				ReadOnly:  true,
+			})
+		}
+		// Mount the writable scratch volume
+		if mountScratchVolume {
+			container.VolumeMounts = append(append([]corev1.VolumeMount{}, container.VolumeMounts...), corev1.VolumeMount{
+				Name:      scratchVolumeName,
+				MountPath: instance.Spec.ScratchVolumeMountPath,
+			})
+		}
+		return container
+	}
+	// Inject into every Container specified by the PodSpec
+	containers := []corev1.Container{}
+	for _, container := range podSpec.Containers {
+		containers = append(containers, injectContainer(container))
+	}
+	// Init containers with a restart policy of Always are native sidecars that run alongside the autoscaler, so are
+	// injected in the same way, copying the init containers to avoid modifying the template in the CPA spec. Other init
+	// containers are left unchanged
+	if len(podSpec.InitContainers) > 0 {
+		initContainers := []corev1.Container{}
+		for _, initContainer := range podSpec.InitContainers {
+			if nativeSidecar(initContainer) {
+				initContainer = injectContainer(initContainer)
+			}
+			initContainers = append(initContainers, initContainer)
+		}
+		podSpec.InitContainers = initContainers
+	}
+	// Inject the resource budget of the autoscaler container into it, copying the env vars to avoid modifying the
+	// template in the CPA spec
+	if len(containers) > 0 && instance.Spec.InjectResourceEnvVars != nil && *instance.Spec.InjectResourceEnvVars {
+		containers[0].Env = append(append([]corev1.EnvVar{}, containers[0].Env...), resourceEnvVars(containers[0].Name)...)
+	}
+	// Update PodSpec to use the modified containers, and to point to the provisioned service account
+	podSpec.Containers = containers
+	podSpec.ServiceAccountName = serviceAccountName
+
+	if configMapName != "" {
+		podSpec.Volumes = append(append([]corev1.Volume{}, podSpec.Volumes...), corev1.Volume{
+			Name: configFilesVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: configMapName,
+					},
+				},
+			},
+		})
+	}
+
+	if mountScratchVolume {
+		podSpec.Volumes = append(append([]corev1.Volume{}, podSpec.Volumes...), corev1.Volume{
+			Name: scratchVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+	}
+
+	if useProjectedToken {
+		podSpec.Volumes = append(append([]corev1.Volume{}, podSpec.Volumes...), projectedTokenVolume(instance))
+		automountServiceAccountToken := false
+		podSpec.AutomountServiceAccountToken = &automountServiceAccountToken
+	}
+
+	// Apply pod level options from the CPA spec, options set in the template take precedence
+	if podSpec.ActiveDeadlineSeconds == nil {
+		podSpec.ActiveDeadlineSeconds = instance.Spec.ActiveDeadlineSeconds
+	}
+	if podSpec.SchedulerName == "" {
+		podSpec.SchedulerName = instance.Spec.SchedulerName
+	}
+	if podSpec.PreemptionPolicy == nil {
+		podSpec.PreemptionPolicy = instance.Spec.PreemptionPolicy
+	}
+	if len(podSpec.Containers) > 0 && podSpec.Containers[0].StartupProbe == nil {
+		podSpec.Containers[0].StartupProbe = instance.Spec.StartupProbe
+	}
+	if len(podSpec.SchedulingGates) == 0 && len(instance.Spec.SchedulingGates) > 0 {
+		podSpec.SchedulingGates = append([]corev1.PodSchedulingGate{}, instance.Spec.SchedulingGates...)
+	}
+	if len(podSpec.Containers) > 0 && instance.Spec.Resources != nil {
+		podSpec.Containers[0].Resources = mergeResourceRequirements(podSpec.Containers[0].Resources, *instance.Spec.Resources)
+	}
+	if podSpec.Overhead == nil && instance.Spec.Overhead != nil {
+		podSpec.Overhead = instance.Spec.Overhead.DeepCopy()
+	}
+	if podSpec.RuntimeClassName == nil && instance.Spec.RuntimeClassName != nil {
+		runtimeClassName := *instance.Spec.RuntimeClassName
+		podSpec.RuntimeClassName = &runtimeClassName
+	}
+	if len(podSpec.ReadinessGates) == 0 && len(instance.Spec.ReadinessGates) > 0 {
+		podSpec.ReadinessGates = append([]corev1.PodReadinessGate{}, instance.Spec.ReadinessGates...)
+	}
+	if len(instance.Spec.Sysctls) > 0 && (podSpec.SecurityContext == nil || len(podSpec.SecurityContext.Sysctls) == 0) {
+		securityContext := &corev1.PodSecurityContext{}
+		if podSpec.SecurityContext != nil {
+			securityContext = podSpec.SecurityContext.DeepCopy()
+		}
+		securityContext.Sysctls = append([]corev1.Sysctl{}, instance.Spec.Sysctls...)
+		podSpec.SecurityContext = securityContext
+	}
+	if podSpec.Hostname == "" {
+		podSpec.Hostname = instance.Spec.Hostname
+	}
+	if podSpec.Subdomain == "" {
+		podSpec.Subdomain = instance.Spec.Subdomain
+	}
+	if podSpec.ShareProcessNamespace == nil && instance.Spec.ShareProcessNamespace {
+		shareProcessNamespace := true
+		podSpec.ShareProcessNamespace = &shareProcessNamespace
+	}
+	if instance.Spec.NodeFailureTolerationSeconds != nil {
+		podSpec.Tolerations = withNodeFailureTolerations(podSpec.Tolerations, *instance.Spec.NodeFailureTolerationSeconds)
+	}
+	if len(podSpec.HostAliases) == 0 && len(instance.Spec.HostAliases) > 0 {
+		podSpec.HostAliases = []corev1.HostAlias{}
+		for _, hostAlias := range instance.Spec.HostAliases {
+			podSpec.HostAliases = append(podSpec.HostAliases, *hostAlias.DeepCopy())
+		}
+	}
+	if len(podSpec.Containers) > 0 && len(podSpec.Containers[0].Command) == 0 && len(instance.Spec.Command) > 0 {
+		podSpec.Containers[0].Command = append([]string{}, instance.Spec.Command...)
+	}
+	if len(podSpec.Containers) > 0 && len(podSpec.Containers[0].Args) == 0 && len(instance.Spec.Args) > 0 {
+		podSpec.Containers[0].Args = append([]string{}, instance.Spec.Args...)
+	}
+	if container := autoscalerContainer(instance, podSpec.Containers); container != nil && container.ImagePullPolicy == "" && instance.Spec.ImagePullPolicy != "" {
+		container.ImagePullPolicy = instance.Spec.ImagePullPolicy
+	}
+	if len(podSpec.Containers) > 0 && podSpec.Containers[0].Lifecycle == nil && instance.Spec.Lifecycle != nil {
+		podSpec.Containers[0].Lifecycle = instance.Spec.Lifecycle.DeepCopy()
+	}
+	if len(podSpec.Containers) > 0 && len(podSpec.Containers[0].Ports) == 0 {
+		podSpec.Containers[0].Ports = containerPorts(instance)
+	}
+	// Host namespaces are enabled if either the template or the CPA spec enables them
+	podSpec.HostNetwork = podSpec.HostNetwork || instance.Spec.HostNetwork
+	podSpec.HostPID = podSpec.HostPID || instance.Spec.HostPID
+	podSpec.HostIPC = podSpec.HostIPC || instance.Spec.HostIPC
+	if podSpec.HostNetwork && podSpec.DNSPolicy == "" {
+		podSpec.DNSPolicy = corev1.DNSClusterFirstWithHostNet
+	}
+
+	// Define Pod object with ObjectMeta and modified PodSpec
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta(objectMeta),
+		Spec:       corev1.PodSpec(podSpec),
+	}, nil
+}
+
+// projectedTokenVolume returns a projected volume holding a short-lived service account token along with the cluster
+// CA certificate and the namespace, the same files as the automatically mounted service account token
+func projectedTokenVolume(instance *custompodautoscalercomv1.CustomPodAutoscaler) corev1.Volume {
+	expirationSeconds := int64(defaultProjectedTokenExpirationSeconds)
+	if instance.Spec.ProjectedTokenExpirationSeconds != nil {
+		expirationSeconds = *instance.Spec.ProjectedTokenExpirationSeconds
+	}
+	return corev1.Volume{
+		Name: projectedTokenVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				Sources: []corev1.VolumeProjection{
+					{
+						ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+							Audience:          instance.Spec.ProjectedTokenAudience,
+							ExpirationSeconds: &expirationSeconds,
+							Path:              "token",
+						},
+					},
+					{
+						ConfigMap: &corev1.ConfigMapProjection{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: "kube-root-ca.crt",
+							},
+							Items: []corev1.KeyToPath{
+								{
+									Key:  "ca.crt",
+									Path: "ca.crt",
+								},
+							},
+						},
+					},
+					{
+						DownwardAPI: &corev1.DownwardAPIProjection{
+							Items: []corev1.DownwardAPIVolumeFile{
+								{
+									Path: "namespace",
+									FieldRef: &corev1.ObjectFieldSelector{
+										APIVersion: "v1",
+										FieldPath:  "metadata.namespace",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// autoscalerContainer returns the container named by the autoscalerContainerName of the CPA, or the first container
+// if no name is set. Returns nil if there is no such container
+func autoscalerContainer(instance *custompodautoscalercomv1.CustomPodAutoscaler, containers []corev1.Container) *corev1.Container {
+	if instance.Spec.AutoscalerContainerName == "" {
+		if len(containers) == 0 {
+			return nil
+		}
+		return &containers[0]
+	}
+	for i := range containers {
+		if containers[i].Name == instance.Spec.AutoscalerContainerName {
+			return &containers[i]
+		}
+	}
+	return nil
+}
+
+// containerPorts returns the ports of the autoscaler container set in the CPA spec, or the autoscaler HTTP API port
+// if none are set
+func containerPorts(instance *custompodautoscalercomv1.CustomPodAutoscaler) []corev1.ContainerPort {
+	if len(instance.Spec.ContainerPorts) > 0 {
+		return append([]corev1.ContainerPort{}, instance.Spec.ContainerPorts...)
+	}
+	return []corev1.ContainerPort{
+		{
+			Name:          "http",
+			ContainerPort: defaultAPIPort,
+			Protocol:      corev1.ProtocolTCP,
+		},
+	}
+}
+
+// resourceEnvVars returns env vars exposing the CPU (in millicores) and memory (in bytes) requests and limits of the
+// container using the downward API
+func resourceEnvVars(containerName string) []corev1.EnvVar {
+	resourceEnvVar := func(name string, field string, divisor resource.Quantity) corev1.EnvVar {
+		return corev1.EnvVar{
+			Name: name,
+			ValueFrom: &corev1.EnvVarSource{
+				ResourceFieldRef: &corev1.ResourceFieldSelector{
+					ContainerName: containerName,
+					Resource:      field,
+					Divisor:       divisor,
+				},
+			},
+		}
+	}
+	return []corev1.EnvVar{
+		resourceEnvVar("cpaCpuRequest", "requests.cpu", resource.MustParse("1m")),
+		resourceEnvVar("cpaCpuLimit", "limits.cpu", resource.MustParse("1m")),
+		resourceEnvVar("cpaMemRequest", "requests.memory", resource.MustParse("1")),
+		resourceEnvVar("cpaMemLimit", "limits.memory", resource.MustParse("1")),
+	}
+}
+
+// withNodeFailureTolerations returns the tolerations with tolerations for the not-ready and unreachable node taints
+// added, any of these taints that are already tolerated are left unchanged
+func withNodeFailureTolerations(tolerations []corev1.Toleration, tolerationSeconds int64) []corev1.Toleration {
+	merged := append([]corev1.Toleration{}, tolerations...)
+	for _, taint := range []string{corev1.TaintNodeNotReady, corev1.TaintNodeUnreachable} {
+		tolerated := false
+		for _, toleration := range tolerations {
+			if toleration.Key == taint {
+				tolerated = true
+				break
+			}
+		}
+		if tolerated {
+			continue
+		}
+		seconds := tolerationSeconds
+		merged = append(merged, corev1.Toleration{
+			Key:               taint,
+			Operator:          corev1.TolerationOpExists,
+			Effect:            corev1.TaintEffectNoExecute,
+			TolerationSeconds: &seconds,
+		})
+	}
+	return merged
+}
+
+// mergeResourceRequirements returns the resource requirements with any requests or limits that are not set filled in
+// from the defaults provided, resources that are already set are not changed
+func mergeResourceRequirements(resources corev1.ResourceRequirements, defaults corev1.ResourceRequirements) corev1.ResourceRequirements {
+	merged := *resources.DeepCopy()
+	merged.Requests = mergeResourceList(merged.Requests, defaults.Requests)
+	merged.Limits = mergeResourceList(merged.Limits, defaults.Limits)
+	return merged
+}
+
+// mergeResourceList adds any resources in the defaults that are not in the resource list provided
+func mergeResourceList(resources corev1.ResourceList, defaults corev1.ResourceList) corev1.ResourceList {
+	if len(defaults) == 0 {
+		return resources
+	}
+	if resources == nil {
+		resources = corev1.ResourceList{}
+	}
+	for name, quantity := range defaults {
+		if _, exists := resources[name]; !exists {
+			resources[name] = quantity.DeepCopy()
+		}
+	}
+	return resources
+}
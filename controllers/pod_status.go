@@ -0,0 +1,178 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+)
+
+// CrashLoopingRestartThreshold is the number of restarts of the autoscaler Pod above which the CPA is reported as
+// crash looping
+const CrashLoopingRestartThreshold = 5
+
+// PodStatusReconciler tracks the restarts of autoscaler Pods in the status of the CPA that owns them. This is kept
+// separate from the CustomPodAutoscalerReconciler as reconciling the CPA recreates the Pod, while Pod status changes
+// should only update the CPA status.
+type PodStatusReconciler struct {
+	client.Client
+	Log logr.Logger
+	// ShardSelector limits the CPAs updated to those with labels matching the selector, if not set every CPA is
+	// updated
+	ShardSelector labels.Selector
+	// EnvironmentFilter limits the CPAs updated to those with the environment annotation set to this value, if not set
+	// every CPA is updated
+	EnvironmentFilter string
+}
+
+// PodStatusPred is the predicate that filters events for autoscaler Pods, only Pods owned by a CPA are reconciled
+// when they are created or their restart count changes.
+var PodStatusPred = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldPod, ok := e.ObjectOld.(*corev1.Pod)
+		if !ok {
+			return false
+		}
+		newPod, ok := e.ObjectNew.(*corev1.Pod)
+		if !ok {
+			return false
+		}
+		_, owned := cpaOwnerName(newPod)
+		return owned && podRestartCount(oldPod) != podRestartCount(newPod)
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return false
+	},
+	CreateFunc: func(e event.CreateEvent) bool {
+		_, owned := cpaOwnerName(e.Object)
+		return owned
+	},
+	GenericFunc: func(e event.GenericEvent) bool {
+		return false
+	},
+}
+
+// Reconcile updates the restart count and crash looping condition of the CPA that owns the Pod
+func (r *PodStatusReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	reqLogger := r.Log.WithValues("Request", req.NamespacedName)
+
+	pod := &corev1.Pod{}
+	err := r.Client.Get(ctx, req.NamespacedName, pod)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	if !pod.DeletionTimestamp.IsZero() {
+		// Pod being deleted, the status is tracked from the Pod that replaces it
+		return ctrl.Result{}, nil
+	}
+
+	cpaName, owned := cpaOwnerName(pod)
+	if !owned {
+		return ctrl.Result{}, nil
+	}
+
+	instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+	err = r.Client.Get(ctx, types.NamespacedName{Name: cpaName, Namespace: pod.Namespace}, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	if !inShard(r.ShardSelector, instance) || !inEnvironment(r.EnvironmentFilter, instance) {
+		return ctrl.Result{}, nil
+	}
+
+	restartCount := podRestartCount(pod)
+
+	condition := metav1.Condition{
+		Type:               custompodautoscalercomv1.ConditionCrashLooping,
+		Status:             metav1.ConditionFalse,
+		Reason:             "RestartsBelowThreshold",
+		Message:            fmt.Sprintf("Autoscaler Pod %s has restarted %d times", pod.Name, restartCount),
+		ObservedGeneration: instance.Generation,
+	}
+	if restartCount > CrashLoopingRestartThreshold {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "RestartThresholdExceeded"
+	}
+
+	statusChanged := meta.SetStatusCondition(&instance.Status.Conditions, condition)
+	if instance.Status.PodRestartCount != restartCount {
+		instance.Status.PodRestartCount = restartCount
+		statusChanged = true
+	}
+
+	if !statusChanged {
+		return ctrl.Result{}, nil
+	}
+
+	reqLogger.Info("Updating autoscaler Pod restart count", "Kind", "custompodautoscaler.com/v1/CustomPodAutoscaler", "Namespace", instance.GetNamespace(), "Name", instance.GetName(), "RestartCount", restartCount)
+	err = r.Client.Status().Update(ctx, instance)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the Pod status controller with the Manager
+func (r *PodStatusReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("custompodautoscaler-pod-status").
+		For(&corev1.Pod{}).
+		WithEventFilter(PodStatusPred).
+		Complete(r)
+}
+
+// cpaOwnerName returns the name of the CPA that owns the object, if it is owned by a CPA
+func cpaOwnerName(obj metav1.Object) (string, bool) {
+	for _, owner := range obj.GetOwnerReferences() {
+		if owner.APIVersion == custompodautoscalercomv1.GroupVersion.String() && owner.Kind == "CustomPodAutoscaler" {
+			return owner.Name, true
+		}
+	}
+	return "", false
+}
+
+// podRestartCount returns the total number of restarts of the containers in the Pod
+func podRestartCount(pod *corev1.Pod) int32 {
+	var restartCount int32
+	for _, status := range pod.Status.ContainerStatuses {
+		restartCount += status.RestartCount
+	}
+	return restartCount
+}
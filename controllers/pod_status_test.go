@@ -0,0 +1,221 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestPodStatusPredicate(t *testing.T) {
+	ownedPod := func(restarts int32) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				OwnerReferences: []metav1.OwnerReference{
+					{
+						APIVersion: "custompodautoscaler.com/v1",
+						Kind:       "CustomPodAutoscaler",
+						Name:       "test",
+					},
+				},
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{
+					{
+						RestartCount: restarts,
+					},
+				},
+			},
+		}
+	}
+
+	var tests = []struct {
+		description string
+		expected    bool
+		result      bool
+	}{
+		{
+			"Create owned Pod",
+			true,
+			controllers.PodStatusPred.Create(event.CreateEvent{Object: ownedPod(0)}),
+		},
+		{
+			"Create Pod not owned by a CPA",
+			false,
+			controllers.PodStatusPred.Create(event.CreateEvent{Object: &corev1.Pod{}}),
+		},
+		{
+			"Update owned Pod restart count",
+			true,
+			controllers.PodStatusPred.Update(event.UpdateEvent{ObjectOld: ownedPod(0), ObjectNew: ownedPod(1)}),
+		},
+		{
+			"Update owned Pod without restart count change",
+			false,
+			controllers.PodStatusPred.Update(event.UpdateEvent{ObjectOld: ownedPod(1), ObjectNew: ownedPod(1)}),
+		},
+		{
+			"Delete owned Pod",
+			false,
+			controllers.PodStatusPred.Delete(event.DeleteEvent{Object: ownedPod(0)}),
+		},
+		{
+			"Generic",
+			false,
+			controllers.PodStatusPred.Generic(event.GenericEvent{}),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if !cmp.Equal(test.expected, test.result) {
+				t.Errorf("Boolean mismatch (-want +got):\n%s", cmp.Diff(test.expected, test.result))
+			}
+		})
+	}
+}
+
+func TestPodStatusReconcile(t *testing.T) {
+	var tests = []struct {
+		description          string
+		expectedRestartCount int32
+		expectedCondition    *metav1.Condition
+		restartCounts        []int32
+	}{
+		{
+			"No restarts",
+			0,
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionCrashLooping,
+				Status:             metav1.ConditionFalse,
+				Reason:             "RestartsBelowThreshold",
+				Message:            "Autoscaler Pod test has restarted 0 times",
+				ObservedGeneration: 1,
+			},
+			[]int32{0},
+		},
+		{
+			"Restarts below threshold",
+			3,
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionCrashLooping,
+				Status:             metav1.ConditionFalse,
+				Reason:             "RestartsBelowThreshold",
+				Message:            "Autoscaler Pod test has restarted 3 times",
+				ObservedGeneration: 1,
+			},
+			[]int32{2, 1},
+		},
+		{
+			"Restarts above threshold, crash looping",
+			8,
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionCrashLooping,
+				Status:             metav1.ConditionTrue,
+				Reason:             "RestartThresholdExceeded",
+				Message:            "Autoscaler Pod test has restarted 8 times",
+				ObservedGeneration: 1,
+			},
+			[]int32{8},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			containerStatuses := []corev1.ContainerStatus{}
+			for _, restartCount := range test.restartCounts {
+				containerStatuses = append(containerStatuses, corev1.ContainerStatus{
+					RestartCount: restartCount,
+				})
+			}
+
+			fclient := fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+				s := runtime.NewScheme()
+				utilruntime.Must(clientgoscheme.AddToScheme(s))
+				s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+				return s
+			}()).WithRuntimeObjects(
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:       "test",
+						Namespace:  "test-namespace",
+						Generation: 1,
+					},
+				},
+				&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+						OwnerReferences: []metav1.OwnerReference{
+							{
+								APIVersion: "custompodautoscaler.com/v1",
+								Kind:       "CustomPodAutoscaler",
+								Name:       "test",
+							},
+						},
+					},
+					Status: corev1.PodStatus{
+						ContainerStatuses: containerStatuses,
+					},
+				},
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build()
+
+			reconciler := &controllers.PodStatusReconciler{
+				Client: fclient,
+				Log:    logr.Discard(),
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			cpa := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err = fclient.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, cpa)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expectedRestartCount, cpa.Status.PodRestartCount) {
+				t.Errorf("Restart count mismatch (-want +got):\n%s", cmp.Diff(test.expectedRestartCount, cpa.Status.PodRestartCount))
+			}
+
+			condition := meta.FindStatusCondition(cpa.Status.Conditions, custompodautoscalercomv1.ConditionCrashLooping)
+			if !cmp.Equal(test.expectedCondition, condition, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")) {
+				t.Errorf("Condition mismatch (-want +got):\n%s", cmp.Diff(test.expectedCondition, condition, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")))
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// rbacMissing reports if any of the RBAC resources the plan provisions (ServiceAccount, Role and RoleBinding) do not
+// exist yet, so will be created by this reconcile
+func (r *CustomPodAutoscalerReconciler) rbacMissing(ctx context.Context, plan *ProvisioningPlan) (bool, error) {
+	resources := []client.Object{}
+	if plan.ProvisionServiceAccount {
+		resources = append(resources, plan.ServiceAccount)
+	}
+	if plan.ProvisionRole {
+		resources = append(resources, plan.Role)
+	}
+	if plan.ProvisionRoleBinding {
+		resources = append(resources, plan.RoleBinding)
+	}
+
+	for _, resource := range resources {
+		// Get into a copy so the planned resource is not overwritten by the existing one
+		existing := resource.DeepCopyObject().(client.Object)
+		err := r.Client.Get(ctx, client.ObjectKeyFromObject(resource), existing)
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+)
+
+// ReconcileLogs captures the most recent reconcile log lines of each CPA in a bounded in-memory ring buffer, allowing
+// the operator decisions for a single CPA to be inspected without access to the operator logs. A nil ReconcileLogs is
+// valid and captures nothing, so capture can be disabled by not setting a ReconcileLogs.
+type ReconcileLogs struct {
+	mu      sync.Mutex
+	size    int
+	clock   clock.PassiveClock
+	buffers map[types.NamespacedName]*logRing
+}
+
+// logRing is a fixed size ring buffer of log lines, once full the oldest line is overwritten
+type logRing struct {
+	lines []string
+	next  int
+	full  bool
+}
+
+// NewReconcileLogs returns a ReconcileLogs keeping up to size lines for each CPA, timestamped using the clock
+func NewReconcileLogs(size int, clock clock.PassiveClock) *ReconcileLogs {
+	return &ReconcileLogs{
+		size:    size,
+		clock:   clock,
+		buffers: map[types.NamespacedName]*logRing{},
+	}
+}
+
+// Logger returns a logger that writes to the log provided and captures each line for the CPA
+func (l *ReconcileLogs) Logger(log logr.Logger, cpa types.NamespacedName) logr.Logger {
+	if l == nil {
+		return log
+	}
+
+	sink := log.GetSink()
+	// The capturing sink adds a frame between the caller and the wrapped sink
+	if callDepthSink, ok := sink.(logr.CallDepthLogSink); ok {
+		sink = callDepthSink.WithCallDepth(1)
+	}
+
+	return logr.New(&captureSink{
+		sink: sink,
+		logs: l,
+		cpa:  cpa,
+	})
+}
+
+// Lines returns the captured log lines for the CPA, oldest first
+func (l *ReconcileLogs) Lines(cpa types.NamespacedName) []string {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ring, exists := l.buffers[cpa]
+	if !exists {
+		return []string{}
+	}
+
+	if !ring.full {
+		return append([]string{}, ring.lines[:ring.next]...)
+	}
+	return append(append([]string{}, ring.lines[ring.next:]...), ring.lines[:ring.next]...)
+}
+
+// Remove discards the captured log lines for the CPA, used once the CPA has been deleted
+func (l *ReconcileLogs) Remove(cpa types.NamespacedName) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.buffers, cpa)
+}
+
+func (l *ReconcileLogs) capture(cpa types.NamespacedName, line string) {
+	if l.size <= 0 {
+		return
+	}
+
+	line = l.clock.Now().UTC().Format(time.RFC3339) + " " + line
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ring, exists := l.buffers[cpa]
+	if !exists {
+		ring = &logRing{
+			lines: make([]string, l.size),
+		}
+		l.buffers[cpa] = ring
+	}
+
+	ring.lines[ring.next] = line
+	ring.next = (ring.next + 1) % len(ring.lines)
+	if ring.next == 0 {
+		ring.full = true
+	}
+}
+
+// captureSink is a logr.LogSink that captures log lines for a CPA before passing them to the wrapped sink
+type captureSink struct {
+	sink          logr.LogSink
+	logs          *ReconcileLogs
+	cpa           types.NamespacedName
+	name          string
+	keysAndValues []interface{}
+}
+
+func (s *captureSink) Init(info logr.RuntimeInfo) {
+	if s.sink != nil {
+		s.sink.Init(info)
+	}
+}
+
+// Enabled captures every level, lines are only passed to the wrapped sink if it is enabled for the level
+func (s *captureSink) Enabled(level int) bool {
+	return true
+}
+
+func (s *captureSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	s.logs.capture(s.cpa, s.format("INFO", msg, nil, keysAndValues))
+	if s.sink != nil && s.sink.Enabled(level) {
+		s.sink.Info(level, msg, keysAndValues...)
+	}
+}
+
+func (s *captureSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	s.logs.capture(s.cpa, s.format("ERROR", msg, err, keysAndValues))
+	if s.sink != nil {
+		s.sink.Error(err, msg, keysAndValues...)
+	}
+}
+
+func (s *captureSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	child := *s
+	child.keysAndValues = append(append([]interface{}{}, s.keysAndValues...), keysAndValues...)
+	if s.sink != nil {
+		child.sink = s.sink.WithValues(keysAndValues...)
+	}
+	return &child
+}
+
+func (s *captureSink) WithName(name string) logr.LogSink {
+	child := *s
+	child.name = name
+	if s.name != "" {
+		child.name = s.name + "." + name
+	}
+	if s.sink != nil {
+		child.sink = s.sink.WithName(name)
+	}
+	return &child
+}
+
+// format formats a log line as the level, logger name, message, error and key value pairs
+func (s *captureSink) format(level string, msg string, err error, keysAndValues []interface{}) string {
+	var line strings.Builder
+	line.WriteString(level)
+	if s.name != "" {
+		line.WriteString(" " + s.name)
+	}
+	line.WriteString(" " + msg)
+	if err != nil {
+		fmt.Fprintf(&line, " error=%q", err.Error())
+	}
+	all := append(append([]interface{}{}, s.keysAndValues...), keysAndValues...)
+	for i := 0; i+1 < len(all); i += 2 {
+		fmt.Fprintf(&line, " %v=%v", all[i], all[i+1])
+	}
+	return line.String()
+}
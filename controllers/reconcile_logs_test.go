@@ -0,0 +1,128 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestReconcileLogs(t *testing.T) {
+	cpa := types.NamespacedName{Namespace: "test-namespace", Name: "test"}
+	other := types.NamespacedName{Namespace: "test-namespace", Name: "other"}
+
+	var tests = []struct {
+		description string
+		expected    []string
+		size        int
+		log         func(logs *controllers.ReconcileLogs)
+	}{
+		{
+			"No lines captured",
+			[]string{},
+			3,
+			func(logs *controllers.ReconcileLogs) {},
+		},
+		{
+			"Lines captured with names, values and errors",
+			[]string{
+				"2024-03-01T22:30:00Z INFO controllers.CustomPodAutoscaler Creating a new k8s object Request=test-namespace/test Kind=v1/Pod",
+				"2024-03-01T22:30:00Z ERROR controllers.CustomPodAutoscaler Reconcile failed error=\"fail to create\" Request=test-namespace/test",
+			},
+			3,
+			func(logs *controllers.ReconcileLogs) {
+				logger := logs.Logger(logr.Discard(), cpa).WithName("controllers").WithName("CustomPodAutoscaler").WithValues("Request", cpa)
+				logger.Info("Creating a new k8s object", "Kind", "v1/Pod")
+				logger.Error(errors.New("fail to create"), "Reconcile failed")
+			},
+		},
+		{
+			"Buffer full, oldest lines rotated out",
+			[]string{
+				"2024-03-01T22:30:00Z INFO line 3",
+				"2024-03-01T22:30:00Z INFO line 4",
+				"2024-03-01T22:30:00Z INFO line 5",
+			},
+			3,
+			func(logs *controllers.ReconcileLogs) {
+				logger := logs.Logger(logr.Discard(), cpa)
+				logger.Info("line 1")
+				logger.Info("line 2")
+				logger.Info("line 3")
+				logger.Info("line 4")
+				logger.Info("line 5")
+			},
+		},
+		{
+			"Lines of other CPAs not included",
+			[]string{
+				"2024-03-01T22:30:00Z INFO line 1",
+			},
+			3,
+			func(logs *controllers.ReconcileLogs) {
+				logs.Logger(logr.Discard(), cpa).Info("line 1")
+				logs.Logger(logr.Discard(), other).Info("other line")
+			},
+		},
+		{
+			"Lines removed once CPA deleted",
+			[]string{},
+			3,
+			func(logs *controllers.ReconcileLogs) {
+				logs.Logger(logr.Discard(), cpa).Info("line 1")
+				logs.Remove(cpa)
+			},
+		},
+		{
+			"Zero size, no lines captured",
+			[]string{},
+			0,
+			func(logs *controllers.ReconcileLogs) {
+				logs.Logger(logr.Discard(), cpa).Info("line 1")
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			logs := controllers.NewReconcileLogs(test.size, clocktesting.NewFakePassiveClock(time.Date(2024, time.March, 1, 22, 30, 0, 0, time.UTC)))
+			test.log(logs)
+
+			lines := logs.Lines(cpa)
+			if !cmp.Equal(test.expected, lines) {
+				t.Errorf("Lines mismatch (-want +got):\n%s", cmp.Diff(test.expected, lines))
+			}
+		})
+	}
+}
+
+func TestReconcileLogsNil(t *testing.T) {
+	var logs *controllers.ReconcileLogs
+	cpa := types.NamespacedName{Namespace: "test-namespace", Name: "test"}
+	// Capture is disabled with a nil ReconcileLogs, the logger provided should be used unchanged
+	logs.Logger(logr.Discard(), cpa).Info("line 1")
+	logs.Remove(cpa)
+	if lines := logs.Lines(cpa); lines != nil {
+		t.Errorf("Expected no lines, got %v", lines)
+	}
+}
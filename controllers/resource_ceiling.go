@@ -0,0 +1,157 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+)
+
+// ResourceCeilingMode is how the operator handles an autoscaler container with resources above the resource ceiling
+type ResourceCeilingMode string
+
+const (
+	// ResourceCeilingModeClamp lowers resources above the ceiling to the ceiling and provisions the Pod
+	ResourceCeilingModeClamp ResourceCeilingMode = "clamp"
+	// ResourceCeilingModeReject does not provision the Pod until its resources are within the ceiling
+	ResourceCeilingModeReject ResourceCeilingMode = "reject"
+)
+
+// ParseResourceCeiling parses a comma separated list of resource quantities in the form resource=quantity, for
+// example "cpu=1,memory=1Gi"
+func ParseResourceCeiling(ceiling string) (corev1.ResourceList, error) {
+	parsed := corev1.ResourceList{}
+	for _, entry := range strings.Split(ceiling, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, found := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid resource ceiling %q, must be in the form resource=quantity", entry)
+		}
+		quantity, err := resource.ParseQuantity(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity in resource ceiling %q: %w", entry, err)
+		}
+		parsed[corev1.ResourceName(name)] = quantity
+	}
+	return parsed, nil
+}
+
+// ParseResourceCeilingMode parses the mode the resource ceiling is enforced with
+func ParseResourceCeilingMode(mode string) (ResourceCeilingMode, error) {
+	parsed := ResourceCeilingMode(mode)
+	if parsed != ResourceCeilingModeClamp && parsed != ResourceCeilingModeReject {
+		return "", fmt.Errorf("invalid resource ceiling mode %q, must be one of %s, %s", mode,
+			ResourceCeilingModeClamp, ResourceCeilingModeReject)
+	}
+	return parsed, nil
+}
+
+// resourcesAboveCeiling returns the requests and limits of the autoscaler container (the first container) of the Pod
+// that are above the ceiling, in the form requests.cpu=2
+func resourcesAboveCeiling(pod *corev1.Pod, ceiling corev1.ResourceList) []string {
+	if len(pod.Spec.Containers) == 0 {
+		return nil
+	}
+
+	names := []string{}
+	for name := range ceiling {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	resources := pod.Spec.Containers[0].Resources
+	exceeded := []string{}
+	for _, list := range []struct {
+		name      string
+		resources corev1.ResourceList
+	}{
+		{"requests", resources.Requests},
+		{"limits", resources.Limits},
+	} {
+		for _, name := range names {
+			quantity, exists := list.resources[corev1.ResourceName(name)]
+			maximum := ceiling[corev1.ResourceName(name)]
+			if exists && quantity.Cmp(maximum) > 0 {
+				exceeded = append(exceeded, fmt.Sprintf("%s.%s=%s", list.name, name, quantity.String()))
+			}
+		}
+	}
+	return exceeded
+}
+
+// clampResources lowers the requests and limits of the autoscaler container (the first container) of the Pod that are
+// above the ceiling to the ceiling
+func (p *ProvisioningPlan) clampResources(ceiling corev1.ResourceList) {
+	if len(p.Pod.Spec.Containers) == 0 {
+		return
+	}
+
+	// The resources may be shared with the template in the CPA spec, so are copied before being changed
+	container := &p.Pod.Spec.Containers[0]
+	container.Resources = *container.Resources.DeepCopy()
+	for _, list := range []corev1.ResourceList{container.Resources.Requests, container.Resources.Limits} {
+		for name, quantity := range list {
+			maximum, exists := ceiling[name]
+			if exists && quantity.Cmp(maximum) > 0 {
+				list[name] = maximum.DeepCopy()
+			}
+		}
+	}
+
+	// The Pod resources have changed so the hash must be updated
+	setPodSpecHash(p.Pod)
+}
+
+// checkResourceCeiling sets the ResourcesAboveCeiling condition, reporting the resources of the autoscaler container
+// that are above the resource ceiling of the operator
+func (r *CustomPodAutoscalerReconciler) checkResourceCeiling(instance *custompodautoscalercomv1.CustomPodAutoscaler, exceeded []string) {
+	condition := metav1.Condition{
+		Type:               custompodautoscalercomv1.ConditionResourcesAboveCeiling,
+		Status:             metav1.ConditionFalse,
+		Reason:             "WithinCeiling",
+		Message:            "All resources are within the resource ceiling",
+		ObservedGeneration: instance.Generation,
+	}
+	if len(exceeded) > 0 {
+		condition.Status = metav1.ConditionTrue
+		if r.ResourceCeilingMode == ResourceCeilingModeReject {
+			condition.Reason = "Rejected"
+			condition.Message = fmt.Sprintf("Resources %s are above the resource ceiling, not provisioning",
+				strings.Join(exceeded, ", "))
+		} else {
+			condition.Reason = "Clamped"
+			condition.Message = fmt.Sprintf("Resources %s are above the resource ceiling, clamped to the ceiling",
+				strings.Join(exceeded, ", "))
+		}
+	}
+
+	if meta.SetStatusCondition(&instance.Status.Conditions, condition) && condition.Status == metav1.ConditionTrue && r.Recorder != nil {
+		r.Recorder.Event(instance, corev1.EventTypeWarning, custompodautoscalercomv1.ConditionResourcesAboveCeiling, condition.Message)
+	}
+}
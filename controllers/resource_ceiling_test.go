@@ -0,0 +1,215 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileResourceCeiling(t *testing.T) {
+	resources := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("2"),
+			corev1.ResourceMemory: resource.MustParse("512Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("4"),
+			corev1.ResourceMemory: resource.MustParse("2Gi"),
+		},
+	}
+
+	var tests = []struct {
+		description       string
+		expectedCondition *metav1.Condition
+		expectedEvents    []string
+		expectedResources *corev1.ResourceRequirements
+		ceiling           corev1.ResourceList
+		mode              controllers.ResourceCeilingMode
+	}{
+		{
+			"No resource ceiling set, no condition and provisioned unchanged",
+			nil,
+			[]string{},
+			&resources,
+			nil,
+			controllers.ResourceCeilingModeClamp,
+		},
+		{
+			"Resources within ceiling, provisioned unchanged",
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionResourcesAboveCeiling,
+				Status:             metav1.ConditionFalse,
+				Reason:             "WithinCeiling",
+				Message:            "All resources are within the resource ceiling",
+				ObservedGeneration: 1,
+			},
+			[]string{},
+			&resources,
+			corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("4"),
+				corev1.ResourceMemory: resource.MustParse("4Gi"),
+			},
+			controllers.ResourceCeilingModeReject,
+		},
+		{
+			"Resources above ceiling in clamp mode, condition true, warning event and provisioned clamped",
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionResourcesAboveCeiling,
+				Status:             metav1.ConditionTrue,
+				Reason:             "Clamped",
+				Message:            "Resources requests.cpu=2, limits.cpu=4, limits.memory=2Gi are above the resource ceiling, clamped to the ceiling",
+				ObservedGeneration: 1,
+			},
+			[]string{
+				"Warning ResourcesAboveCeiling Resources requests.cpu=2, limits.cpu=4, limits.memory=2Gi are above the resource ceiling, clamped to the ceiling",
+			},
+			&corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("1"),
+					corev1.ResourceMemory: resource.MustParse("512Mi"),
+				},
+				Limits: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("1"),
+					corev1.ResourceMemory: resource.MustParse("1Gi"),
+				},
+			},
+			corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("1"),
+				corev1.ResourceMemory: resource.MustParse("1Gi"),
+			},
+			controllers.ResourceCeilingModeClamp,
+		},
+		{
+			"Resources above ceiling in reject mode, condition true, warning event and not provisioned",
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionResourcesAboveCeiling,
+				Status:             metav1.ConditionTrue,
+				Reason:             "Rejected",
+				Message:            "Resources limits.memory=2Gi are above the resource ceiling, not provisioning",
+				ObservedGeneration: 1,
+			},
+			[]string{
+				"Warning ResourcesAboveCeiling Resources limits.memory=2Gi are above the resource ceiling, not provisioning",
+			},
+			nil,
+			corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("1Gi"),
+			},
+			controllers.ResourceCeilingModeReject,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			scheme.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+
+			fclient := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:       "test",
+						Namespace:  "test-namespace",
+						Generation: 1,
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						Template: custompodautoscalercomv1.PodTemplateSpec{
+							Spec: custompodautoscalercomv1.PodSpec{
+								Containers: []corev1.Container{
+									{
+										Name:      "test container",
+										Resources: *resources.DeepCopy(),
+									},
+								},
+							},
+						},
+					},
+				},
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build()
+
+			var provisionedResources *corev1.ResourceRequirements
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fclient,
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: noopK8sReconciler(func(obj metav1.Object, kind string) {
+					if pod, ok := obj.(*corev1.Pod); ok {
+						provisionedResources = pod.Spec.Containers[0].Resources.DeepCopy()
+					}
+				}),
+				Log:                 logr.Discard(),
+				Recorder:            recorder,
+				ResourceCeiling:     test.ceiling,
+				ResourceCeilingMode: test.mode,
+			}
+
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expectedResources, provisionedResources) {
+				t.Errorf("Resources mismatch (-want +got):\n%s", cmp.Diff(test.expectedResources, provisionedResources))
+			}
+
+			cpa := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err = fclient.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, cpa)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			// Clamping only changes the provisioned Pod, the CPA spec is left as it is
+			specResources := cpa.Spec.Template.Spec.Containers[0].Resources
+			if !cmp.Equal(resources, specResources) {
+				t.Errorf("Spec resources mismatch (-want +got):\n%s", cmp.Diff(resources, specResources))
+			}
+
+			condition := meta.FindStatusCondition(cpa.Status.Conditions, custompodautoscalercomv1.ConditionResourcesAboveCeiling)
+			if !cmp.Equal(test.expectedCondition, condition, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")) {
+				t.Errorf("Condition mismatch (-want +got):\n%s", cmp.Diff(test.expectedCondition, condition, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")))
+			}
+
+			close(recorder.Events)
+			events := []string{}
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			if !cmp.Equal(test.expectedEvents, events) {
+				t.Errorf("Events mismatch (-want +got):\n%s", cmp.Diff(test.expectedEvents, events))
+			}
+		})
+	}
+}
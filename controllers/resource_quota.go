@@ -0,0 +1,160 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+)
+
+// quotaRequeueDelay is how long to wait before checking again if there is quota available for the Pod, ResourceQuotas
+// are not owned by the CPA so quota being freed does not trigger a reconcile
+const quotaRequeueDelay = time.Minute
+
+// podQuotaUsage returns the quota the Pod would use once created, keyed by the ResourceQuota resource names. The
+// requests and limits of the Pod are the sum of its containers or the largest init container, whichever is larger
+func podQuotaUsage(pod *corev1.Pod) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	limits := corev1.ResourceList{}
+	for _, container := range pod.Spec.Containers {
+		addResources(requests, container.Resources.Requests)
+		addResources(limits, container.Resources.Limits)
+	}
+	for _, container := range pod.Spec.InitContainers {
+		maxResources(requests, container.Resources.Requests)
+		maxResources(limits, container.Resources.Limits)
+	}
+
+	usage := corev1.ResourceList{
+		corev1.ResourcePods:               resource.MustParse("1"),
+		corev1.ResourceName("count/pods"): resource.MustParse("1"),
+	}
+	for name, quantity := range requests {
+		usage[name] = quantity
+		usage[corev1.ResourceName("requests."+string(name))] = quantity
+	}
+	for name, quantity := range limits {
+		usage[corev1.ResourceName("limits."+string(name))] = quantity
+	}
+	return usage
+}
+
+func addResources(total corev1.ResourceList, resources corev1.ResourceList) {
+	for name, quantity := range resources {
+		current := total[name]
+		current.Add(quantity)
+		total[name] = current
+	}
+}
+
+func maxResources(total corev1.ResourceList, resources corev1.ResourceList) {
+	for name, quantity := range resources {
+		current, exists := total[name]
+		if !exists || quantity.Cmp(current) > 0 {
+			total[name] = quantity
+		}
+	}
+}
+
+// checkResourceQuota sets the QuotaExceeded condition, reporting the ResourceQuotas of the namespace that creating the
+// Pod would exceed, returning the exceeded quotas. ResourceQuotas with scopes are not checked, as they may not apply to
+// the Pod. If the Pod already exists it is already counted against the quotas, so the condition is removed
+func (r *CustomPodAutoscalerReconciler) checkResourceQuota(ctx context.Context, instance *custompodautoscalercomv1.CustomPodAutoscaler, pod *corev1.Pod) ([]string, error) {
+	podExists := false
+	if pod.Name != "" {
+		existingPod := &corev1.Pod{}
+		err := r.Client.Get(ctx, types.NamespacedName{Name: pod.Name, Namespace: pod.Namespace}, existingPod)
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+		podExists = err == nil
+	}
+
+	quotas := &corev1.ResourceQuotaList{}
+	if !podExists {
+		err := r.Client.List(ctx, quotas, client.InNamespace(pod.Namespace))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	usage := podQuotaUsage(pod)
+	exceeded := []string{}
+	checked := false
+	for _, quota := range quotas.Items {
+		if len(quota.Spec.Scopes) > 0 || quota.Spec.ScopeSelector != nil {
+			continue
+		}
+		checked = true
+
+		names := []string{}
+		for name := range quota.Spec.Hard {
+			names = append(names, string(name))
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			requested, tracked := usage[corev1.ResourceName(name)]
+			if !tracked {
+				continue
+			}
+			hard := quota.Spec.Hard[corev1.ResourceName(name)]
+			used := quota.Status.Used[corev1.ResourceName(name)]
+			total := used.DeepCopy()
+			total.Add(requested)
+			if total.Cmp(hard) > 0 {
+				exceeded = append(exceeded, fmt.Sprintf("%s in ResourceQuota %s: requested %s, used %s, hard %s",
+					name, quota.Name, requested.String(), used.String(), hard.String()))
+			}
+		}
+	}
+
+	if !checked {
+		meta.RemoveStatusCondition(&instance.Status.Conditions, custompodautoscalercomv1.ConditionQuotaExceeded)
+	} else {
+		condition := metav1.Condition{
+			Type:               custompodautoscalercomv1.ConditionQuotaExceeded,
+			Status:             metav1.ConditionFalse,
+			Reason:             "WithinQuota",
+			Message:            "Creating the Pod is within the ResourceQuotas of the namespace",
+			ObservedGeneration: instance.Generation,
+		}
+		if len(exceeded) > 0 {
+			condition.Status = metav1.ConditionTrue
+			condition.Reason = "QuotaExceeded"
+			condition.Message = fmt.Sprintf("Creating the Pod would exceed ResourceQuotas (%s), not provisioning the Pod "+
+				"until there is quota available", strings.Join(exceeded, "; "))
+		}
+		if meta.SetStatusCondition(&instance.Status.Conditions, condition) && condition.Status == metav1.ConditionTrue && r.Recorder != nil {
+			r.Recorder.Event(instance, corev1.EventTypeWarning, custompodautoscalercomv1.ConditionQuotaExceeded, condition.Message)
+		}
+	}
+	return exceeded, nil
+}
@@ -0,0 +1,284 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileResourceQuota(t *testing.T) {
+	quota := func(name string, hard corev1.ResourceList, used corev1.ResourceList) *corev1.ResourceQuota {
+		return &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-namespace"},
+			Spec: corev1.ResourceQuotaSpec{
+				Hard: hard,
+			},
+			Status: corev1.ResourceQuotaStatus{
+				Hard: hard,
+				Used: used,
+			},
+		}
+	}
+
+	container := corev1.Container{
+		Name: "test container",
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("500m"),
+				corev1.ResourceMemory: resource.MustParse("128Mi"),
+			},
+			Limits: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("256Mi"),
+			},
+		},
+	}
+
+	var tests = []struct {
+		description         string
+		expectedCondition   *metav1.Condition
+		expectedEvents      []string
+		expectedProvisioned bool
+		expectedResult      reconcile.Result
+		checkResourceQuota  bool
+		objects             []runtime.Object
+	}{
+		{
+			"Check disabled, quota exceeded, no condition and provisioned",
+			nil,
+			[]string{},
+			true,
+			reconcile.Result{},
+			false,
+			[]runtime.Object{
+				quota("pods", corev1.ResourceList{corev1.ResourcePods: resource.MustParse("2")},
+					corev1.ResourceList{corev1.ResourcePods: resource.MustParse("2")}),
+			},
+		},
+		{
+			"No ResourceQuotas, no condition and provisioned",
+			nil,
+			[]string{},
+			true,
+			reconcile.Result{},
+			true,
+			nil,
+		},
+		{
+			"Pod count quota exceeded, condition true, warning event, not provisioned and requeued",
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionQuotaExceeded,
+				Status:             metav1.ConditionTrue,
+				Reason:             "QuotaExceeded",
+				Message:            "Creating the Pod would exceed ResourceQuotas (pods in ResourceQuota pods: requested 1, used 2, hard 2), not provisioning the Pod until there is quota available",
+				ObservedGeneration: 1,
+			},
+			[]string{
+				"Warning QuotaExceeded Creating the Pod would exceed ResourceQuotas (pods in ResourceQuota pods: requested 1, used 2, hard 2), not provisioning the Pod until there is quota available",
+			},
+			false,
+			reconcile.Result{RequeueAfter: time.Minute},
+			true,
+			[]runtime.Object{
+				quota("pods", corev1.ResourceList{corev1.ResourcePods: resource.MustParse("2")},
+					corev1.ResourceList{corev1.ResourcePods: resource.MustParse("2")}),
+			},
+		},
+		{
+			"Compute quotas exceeded, every exceeded resource reported, not provisioned and requeued",
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionQuotaExceeded,
+				Status:             metav1.ConditionTrue,
+				Reason:             "QuotaExceeded",
+				Message:            "Creating the Pod would exceed ResourceQuotas (limits.memory in ResourceQuota compute: requested 256Mi, used 900Mi, hard 1Gi; requests.cpu in ResourceQuota compute: requested 500m, used 800m, hard 1), not provisioning the Pod until there is quota available",
+				ObservedGeneration: 1,
+			},
+			[]string{
+				"Warning QuotaExceeded Creating the Pod would exceed ResourceQuotas (limits.memory in ResourceQuota compute: requested 256Mi, used 900Mi, hard 1Gi; requests.cpu in ResourceQuota compute: requested 500m, used 800m, hard 1), not provisioning the Pod until there is quota available",
+			},
+			false,
+			reconcile.Result{RequeueAfter: time.Minute},
+			true,
+			[]runtime.Object{
+				quota("compute",
+					corev1.ResourceList{
+						corev1.ResourceRequestsCPU:    resource.MustParse("1"),
+						corev1.ResourceRequestsMemory: resource.MustParse("1Gi"),
+						corev1.ResourceLimitsMemory:   resource.MustParse("1Gi"),
+					},
+					corev1.ResourceList{
+						corev1.ResourceRequestsCPU:    resource.MustParse("800m"),
+						corev1.ResourceRequestsMemory: resource.MustParse("512Mi"),
+						corev1.ResourceLimitsMemory:   resource.MustParse("900Mi"),
+					}),
+			},
+		},
+		{
+			"Quota available, condition false and provisioned",
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionQuotaExceeded,
+				Status:             metav1.ConditionFalse,
+				Reason:             "WithinQuota",
+				Message:            "Creating the Pod is within the ResourceQuotas of the namespace",
+				ObservedGeneration: 1,
+			},
+			[]string{},
+			true,
+			reconcile.Result{},
+			true,
+			[]runtime.Object{
+				quota("compute",
+					corev1.ResourceList{
+						corev1.ResourcePods:        resource.MustParse("10"),
+						corev1.ResourceRequestsCPU: resource.MustParse("2"),
+					},
+					corev1.ResourceList{
+						corev1.ResourcePods:        resource.MustParse("3"),
+						corev1.ResourceRequestsCPU: resource.MustParse("1"),
+					}),
+			},
+		},
+		{
+			"Scoped quota exceeded, not checked, no condition and provisioned",
+			nil,
+			[]string{},
+			true,
+			reconcile.Result{},
+			true,
+			[]runtime.Object{
+				&corev1.ResourceQuota{
+					ObjectMeta: metav1.ObjectMeta{Name: "best-effort", Namespace: "test-namespace"},
+					Spec: corev1.ResourceQuotaSpec{
+						Hard:   corev1.ResourceList{corev1.ResourcePods: resource.MustParse("0")},
+						Scopes: []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeBestEffort},
+					},
+				},
+			},
+		},
+		{
+			"Pod already exists, quota not checked, no condition and provisioned",
+			nil,
+			[]string{},
+			true,
+			reconcile.Result{},
+			true,
+			[]runtime.Object{
+				quota("pods", corev1.ResourceList{corev1.ResourcePods: resource.MustParse("1")},
+					corev1.ResourceList{corev1.ResourcePods: resource.MustParse("1")}),
+				&corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "test-namespace"},
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			scheme.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+			scheme.AddKnownTypes(corev1.SchemeGroupVersion, &corev1.Pod{}, &corev1.ResourceQuota{}, &corev1.ResourceQuotaList{})
+
+			objs := append([]runtime.Object{
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:       "test",
+						Namespace:  "test-namespace",
+						Generation: 1,
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						Template: custompodautoscalercomv1.PodTemplateSpec{
+							Spec: custompodautoscalercomv1.PodSpec{
+								Containers: []corev1.Container{container},
+							},
+						},
+					},
+				},
+			}, test.objects...)
+
+			fclient := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objs...).
+				WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build()
+
+			provisioned := false
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fclient,
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: noopK8sReconciler(func(obj metav1.Object, kind string) {
+					if kind == "v1/Pod" {
+						provisioned = true
+					}
+				}),
+				Log:                logr.Discard(),
+				Recorder:           recorder,
+				CheckResourceQuota: test.checkResourceQuota,
+			}
+
+			result, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expectedResult, result) {
+				t.Errorf("Result mismatch (-want +got):\n%s", cmp.Diff(test.expectedResult, result))
+			}
+
+			if !cmp.Equal(test.expectedProvisioned, provisioned) {
+				t.Errorf("Provisioned mismatch (-want +got):\n%s", cmp.Diff(test.expectedProvisioned, provisioned))
+			}
+
+			cpa := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err = fclient.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, cpa)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			condition := meta.FindStatusCondition(cpa.Status.Conditions, custompodautoscalercomv1.ConditionQuotaExceeded)
+			if !cmp.Equal(test.expectedCondition, condition, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")) {
+				t.Errorf("Condition mismatch (-want +got):\n%s", cmp.Diff(test.expectedCondition, condition, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")))
+			}
+
+			close(recorder.Events)
+			events := []string{}
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			if !cmp.Equal(test.expectedEvents, events) {
+				t.Errorf("Events mismatch (-want +got):\n%s", cmp.Diff(test.expectedEvents, events))
+			}
+		})
+	}
+}
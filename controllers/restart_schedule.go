@@ -0,0 +1,220 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/audit"
+)
+
+// parseRestartSchedule parses the restart schedule of the CPA from a standard cron expression, returning nil if no
+// restart schedule is set
+func parseRestartSchedule(instance *custompodautoscalercomv1.CustomPodAutoscaler) (cron.Schedule, error) {
+	if instance.Spec.RestartSchedule == "" {
+		return nil, nil
+	}
+
+	schedule, err := cron.ParseStandard(instance.Spec.RestartSchedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid restart schedule %q: %w", instance.Spec.RestartSchedule, err)
+	}
+	return schedule, nil
+}
+
+// restartRemaining returns how long until the next restart on the restart schedule is due, zero if a restart is due
+// or the schedule is not being tracked yet
+func restartRemaining(instance *custompodautoscalercomv1.CustomPodAutoscaler, schedule cron.Schedule, now time.Time) time.Duration {
+	if instance.Status.LastScheduledRestartTime == nil {
+		return 0
+	}
+
+	remaining := schedule.Next(instance.Status.LastScheduledRestartTime.Time).Sub(now)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// scheduledRestart deletes the autoscaler Pod if a restart on the restart schedule is due, so the Pod is recreated.
+// Returns how long until the next restart is due and if the status has changed
+func (r *CustomPodAutoscalerReconciler) scheduledRestart(
+	ctx context.Context,
+	reqLogger logr.Logger,
+	instance *custompodautoscalercomv1.CustomPodAutoscaler,
+	schedule cron.Schedule,
+	pod *corev1.Pod,
+) (time.Duration, bool, error) {
+	now := r.clock().Now()
+	handled := metav1.NewTime(now)
+
+	if instance.Status.LastScheduledRestartTime == nil {
+		// Start tracking the schedule from now rather than restarting a Pod that may have only just started
+		instance.Status.LastScheduledRestartTime = &handled
+		return schedule.Next(now).Sub(now), true, nil
+	}
+
+	due := schedule.Next(instance.Status.LastScheduledRestartTime.Time)
+	if now.Before(due) {
+		return due.Sub(now), false, nil
+	}
+
+	existingPod, err := r.podToRestart(ctx, instance, pod, due)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if existingPod == nil {
+		reqLogger.Info("Pod recreated since the scheduled restart was due, skipping restart", "Kind", "v1/Pod", "Namespace", pod.Namespace, "Name", pod.Name)
+	} else {
+		reqLogger.Info("Restarting Pod on restart schedule", "Kind", "v1/Pod", "Namespace", existingPod.Namespace, "Name", existingPod.Name)
+		err = r.Client.Delete(ctx, existingPod)
+		if errors.IsNotFound(err) {
+			err = nil
+		}
+		r.AuditLogger.Record(instance, audit.ActionDelete, "v1/Pod", existingPod.Name, err)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+
+	instance.Status.LastScheduledRestartTime = &handled
+	return schedule.Next(now).Sub(now), true, nil
+}
+
+// restartRequested returns if the restart annotation has changed since it was last handled
+func restartRequested(instance *custompodautoscalercomv1.CustomPodAutoscaler) bool {
+	request, requested := instance.GetAnnotations()[RestartAnnotation]
+	return requested && request != instance.Status.LastRestartRequest
+}
+
+// requestedRestart deletes the autoscaler Pod if the restart annotation has changed since it was last handled, so the
+// Pod is recreated. Returns if the status has changed
+func (r *CustomPodAutoscalerReconciler) requestedRestart(
+	ctx context.Context,
+	reqLogger logr.Logger,
+	instance *custompodautoscalercomv1.CustomPodAutoscaler,
+	pod *corev1.Pod,
+) (bool, error) {
+	if !restartRequested(instance) {
+		return false, nil
+	}
+	request := instance.GetAnnotations()[RestartAnnotation]
+
+	existingPod, err := r.podToRestart(ctx, instance, pod, r.clock().Now())
+	if err != nil {
+		return false, err
+	}
+
+	if existingPod == nil {
+		reqLogger.Info("No existing Pod to restart, skipping requested restart", "Kind", "v1/Pod", "Namespace", pod.Namespace, "Name", pod.Name, "Request", request)
+	} else {
+		reqLogger.Info("Restarting Pod on request", "Kind", "v1/Pod", "Namespace", existingPod.Namespace, "Name", existingPod.Name, "Request", request)
+		err = r.Client.Delete(ctx, existingPod)
+		if errors.IsNotFound(err) {
+			err = nil
+		}
+		r.AuditLogger.Record(instance, audit.ActionDelete, "v1/Pod", existingPod.Name, err)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	instance.Status.LastRestartRequest = request
+	return true, nil
+}
+
+// podToRestart returns the existing Pod if it should be restarted, a restart is not needed if there is no Pod, the
+// Pod has been created since the restart was due, or the Pod is about to be recreated to apply changes to it, to avoid
+// restarts overlapping with recreates
+func (r *CustomPodAutoscalerReconciler) podToRestart(ctx context.Context, instance *custompodautoscalercomv1.CustomPodAutoscaler, pod *corev1.Pod, due time.Time) (*corev1.Pod, error) {
+	podName := pod.Name
+	if podName == "" {
+		// Generated Pod names are tracked in the status
+		podName = instance.Status.PodName
+	}
+	if podName == "" {
+		return nil, nil
+	}
+
+	existingPod := &corev1.Pod{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: podName, Namespace: pod.Namespace}, existingPod)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if !existingPod.DeletionTimestamp.IsZero() || !existingPod.CreationTimestamp.Time.Before(due) {
+		return nil, nil
+	}
+
+	if existingPod.Annotations[PodSpecHashAnnotation] != pod.Annotations[PodSpecHashAnnotation] {
+		return nil, nil
+	}
+
+	return existingPod, nil
+}
+
+// podAgeRemaining returns how long until a Pod created at the time provided reaches the maximum Pod age of the CPA,
+// zero if the Pod has reached the maximum age
+func podAgeRemaining(instance *custompodautoscalercomv1.CustomPodAutoscaler, created time.Time, now time.Time) time.Duration {
+	remaining := created.Add(instance.Spec.MaxPodAge.Duration).Sub(now)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// maxPodAgeRestart deletes the autoscaler Pod if it is older than the maximum Pod age of the CPA, so the Pod is
+// recreated. A Pod that has been recreated since reaching the maximum age, or is about to be recreated to apply
+// changes to it, is not restarted
+func (r *CustomPodAutoscalerReconciler) maxPodAgeRestart(
+	ctx context.Context,
+	reqLogger logr.Logger,
+	instance *custompodautoscalercomv1.CustomPodAutoscaler,
+	pod *corev1.Pod,
+) error {
+	// Pods created before the due time are restarted, so a Pod that has exactly reached the maximum age is included
+	due := r.clock().Now().Add(-instance.Spec.MaxPodAge.Duration).Add(time.Nanosecond)
+	existingPod, err := r.podToRestart(ctx, instance, pod, due)
+	if err != nil {
+		return err
+	}
+	if existingPod == nil {
+		return nil
+	}
+
+	reqLogger.Info("Restarting Pod older than the maximum Pod age", "Kind", "v1/Pod", "Namespace", existingPod.Namespace, "Name", existingPod.Name, "Created", existingPod.CreationTimestamp, "MaxPodAge", instance.Spec.MaxPodAge.Duration)
+	err = r.Client.Delete(ctx, existingPod)
+	if errors.IsNotFound(err) {
+		err = nil
+	}
+	r.AuditLogger.Record(instance, audit.ActionDelete, "v1/Pod", existingPod.Name, err)
+	return err
+}
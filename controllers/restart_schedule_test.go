@@ -0,0 +1,747 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	k8sreconcile "github.com/jthomperoo/custom-pod-autoscaler-operator/reconcile"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileRestartSchedule(t *testing.T) {
+	now := time.Date(2024, time.March, 2, 3, 0, 30, 0, time.UTC)
+	timePtr := func(value time.Time) *metav1.Time {
+		converted := metav1.NewTime(value)
+		return &converted
+	}
+
+	template := custompodautoscalercomv1.PodTemplateSpec{
+		Spec: custompodautoscalercomv1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "test container",
+				},
+			},
+		},
+	}
+	changedTemplate := custompodautoscalercomv1.PodTemplateSpec{
+		Spec: custompodautoscalercomv1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "test container",
+					Image: "changed",
+				},
+			},
+		},
+	}
+
+	var tests = []struct {
+		description         string
+		expectedErr         string
+		expectedRequeue     time.Duration
+		expectedRestartTime *metav1.Time
+		expectedRestarted   bool
+		schedule            string
+		lastRestartTime     *metav1.Time
+		podCreationTime     time.Time
+		template            custompodautoscalercomv1.PodTemplateSpec
+	}{
+		{
+			"No restart schedule, Pod not restarted",
+			"",
+			0,
+			nil,
+			false,
+			"",
+			nil,
+			time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC),
+			template,
+		},
+		{
+			"Invalid restart schedule, error",
+			`invalid restart schedule "every day": expected exactly 5 fields, found 2: [every day]`,
+			0,
+			nil,
+			false,
+			"every day",
+			nil,
+			time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC),
+			template,
+		},
+		{
+			"Schedule not tracked yet, tracking starts and Pod not restarted",
+			"",
+			24*time.Hour - 30*time.Second,
+			timePtr(now),
+			false,
+			"0 3 * * *",
+			nil,
+			time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC),
+			template,
+		},
+		{
+			"Restart not due yet, requeue until restart due",
+			"",
+			59*time.Minute + 30*time.Second,
+			timePtr(time.Date(2024, time.March, 2, 3, 30, 0, 0, time.UTC)),
+			false,
+			"0 4 * * *",
+			timePtr(time.Date(2024, time.March, 2, 3, 30, 0, 0, time.UTC)),
+			time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC),
+			template,
+		},
+		{
+			"Restart due, Pod restarted",
+			"",
+			24*time.Hour - 30*time.Second,
+			timePtr(now),
+			true,
+			"0 3 * * *",
+			timePtr(time.Date(2024, time.March, 1, 3, 0, 0, 0, time.UTC)),
+			time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC),
+			template,
+		},
+		{
+			"Restart due, Pod created since restart due, restart skipped",
+			"",
+			24*time.Hour - 30*time.Second,
+			timePtr(now),
+			false,
+			"0 3 * * *",
+			timePtr(time.Date(2024, time.March, 1, 3, 0, 0, 0, time.UTC)),
+			time.Date(2024, time.March, 2, 3, 0, 10, 0, time.UTC),
+			template,
+		},
+		{
+			"Restart due, Pod being recreated for changes, restart skipped",
+			"",
+			24*time.Hour - 30*time.Second,
+			timePtr(now),
+			false,
+			"0 3 * * *",
+			timePtr(time.Date(2024, time.March, 1, 3, 0, 0, 0, time.UTC)),
+			time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC),
+			changedTemplate,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			scheme.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+			scheme.AddKnownTypes(corev1.SchemeGroupVersion, &corev1.Pod{})
+
+			// The existing Pod was provisioned for the unchanged template
+			existingPod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test",
+					Namespace:         "test-namespace",
+					CreationTimestamp: metav1.NewTime(test.podCreationTime),
+					Annotations: map[string]string{
+						controllers.PodSpecHashAnnotation: plannedPodSpecHash(t, scheme, template),
+					},
+				},
+			}
+
+			client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						Template:        test.template,
+						RestartSchedule: test.schedule,
+					},
+					Status: custompodautoscalercomv1.CustomPodAutoscalerStatus{
+						LastScheduledRestartTime: test.lastRestartTime,
+					},
+				},
+				existingPod,
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build()
+
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client:                       client,
+				Scheme:                       scheme,
+				KubernetesResourceReconciler: noopK8sReconciler(nil),
+				Log:                          logr.Discard(),
+				Clock:                        clocktesting.NewFakePassiveClock(now),
+			}
+
+			result, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			errMessage := ""
+			if err != nil {
+				errMessage = err.Error()
+			}
+			if !cmp.Equal(test.expectedErr, errMessage) {
+				t.Fatalf("Error mismatch (-want +got):\n%s", cmp.Diff(test.expectedErr, errMessage))
+			}
+			if err != nil {
+				return
+			}
+
+			if !cmp.Equal(test.expectedRequeue, result.RequeueAfter) {
+				t.Errorf("Requeue mismatch (-want +got):\n%s", cmp.Diff(test.expectedRequeue, result.RequeueAfter))
+			}
+
+			instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err = client.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, instance)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !cmp.Equal(test.expectedRestartTime, instance.Status.LastScheduledRestartTime) {
+				t.Errorf("Restart time mismatch (-want +got):\n%s", cmp.Diff(test.expectedRestartTime, instance.Status.LastScheduledRestartTime))
+			}
+
+			err = client.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, &corev1.Pod{})
+			restarted := apierrors.IsNotFound(err)
+			if !restarted && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !cmp.Equal(test.expectedRestarted, restarted) {
+				t.Errorf("Restarted mismatch (-want +got):\n%s", cmp.Diff(test.expectedRestarted, restarted))
+			}
+		})
+	}
+}
+
+// noopK8sReconciler returns a K8sReconciler that reconciles nothing, passing each object reconciled to the observe
+// function if it is set
+func noopK8sReconciler(observe func(obj metav1.Object, kind string)) *fakek8sReconciler {
+	return &fakek8sReconciler{
+		reconcile: func(
+			reqLogger logr.Logger,
+			instance *custompodautoscalercomv1.CustomPodAutoscaler,
+			obj metav1.Object,
+			shouldProvision bool,
+			updatable bool,
+			kind string,
+		) (reconcile.Result, error) {
+			if observe != nil {
+				observe(obj, kind)
+			}
+			return reconcile.Result{}, nil
+		},
+		podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+			return nil
+		},
+	}
+}
+
+// plannedPodSpecHash returns the Pod spec hash of the Pod the operator provisions for a CPA with the template
+func plannedPodSpecHash(t *testing.T, scheme *runtime.Scheme, template custompodautoscalercomv1.PodTemplateSpec) string {
+	podSpecHash := ""
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+			&custompodautoscalercomv1.CustomPodAutoscaler{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+				Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+					Template: template,
+				},
+			},
+		).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+		Scheme: scheme,
+		KubernetesResourceReconciler: noopK8sReconciler(func(obj metav1.Object, kind string) {
+			if kind == "v1/Pod" {
+				podSpecHash = obj.GetAnnotations()[controllers.PodSpecHashAnnotation]
+			}
+		}),
+		Log: logr.Discard(),
+	}
+	_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "test",
+			Namespace: "test-namespace",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return podSpecHash
+}
+
+func TestReconcileRestartAnnotation(t *testing.T) {
+	now := time.Date(2024, time.March, 2, 3, 0, 30, 0, time.UTC)
+
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+	scheme.AddKnownTypes(corev1.SchemeGroupVersion, &corev1.Pod{})
+
+	template := custompodautoscalercomv1.PodTemplateSpec{
+		Spec: custompodautoscalercomv1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "test container",
+				},
+			},
+		},
+	}
+
+	// The existing Pod was provisioned for the template
+	podSpecHash := plannedPodSpecHash(t, scheme, template)
+	existingPod := func() *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "test",
+				Namespace:         "test-namespace",
+				CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+				Annotations: map[string]string{
+					controllers.PodSpecHashAnnotation: podSpecHash,
+				},
+			},
+		}
+	}
+
+	restarts := 0
+	client := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+		&custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "test-namespace",
+			},
+			Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: template,
+			},
+		},
+		existingPod(),
+	).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).WithInterceptorFuncs(interceptor.Funcs{
+		Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+			if _, isPod := obj.(*corev1.Pod); isPod {
+				restarts++
+			}
+			return c.Delete(ctx, obj, opts...)
+		},
+	}).Build()
+
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
+		Client:                       client,
+		Scheme:                       scheme,
+		KubernetesResourceReconciler: noopK8sReconciler(nil),
+		Log:                          logr.Discard(),
+		Clock:                        clocktesting.NewFakePassiveClock(now),
+	}
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "test",
+			Namespace: "test-namespace",
+		},
+	}
+
+	var steps = []struct {
+		description         string
+		expectedRestarts    int
+		expectedLastRequest string
+		annotation          string
+	}{
+		{
+			"No restart annotation, Pod not restarted",
+			0,
+			"",
+			"",
+		},
+		{
+			"Restart annotation set, Pod restarted",
+			1,
+			"2024-03-02T03:00:00Z",
+			"2024-03-02T03:00:00Z",
+		},
+		{
+			"Restart annotation unchanged, Pod not restarted again",
+			1,
+			"2024-03-02T03:00:00Z",
+			"2024-03-02T03:00:00Z",
+		},
+		{
+			"Restart annotation changed, Pod restarted",
+			2,
+			"2024-03-02T03:00:30Z",
+			"2024-03-02T03:00:30Z",
+		},
+	}
+	for _, step := range steps {
+		// The Pod is recreated by the operator after a restart
+		err := client.Get(context.Background(), request.NamespacedName, &corev1.Pod{})
+		if apierrors.IsNotFound(err) {
+			err = client.Create(context.Background(), existingPod())
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.description, err)
+		}
+
+		instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+		err = client.Get(context.Background(), request.NamespacedName, instance)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.description, err)
+		}
+		if step.annotation != "" {
+			instance.Annotations = map[string]string{
+				controllers.RestartAnnotation: step.annotation,
+			}
+			err = client.Update(context.Background(), instance)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", step.description, err)
+			}
+		}
+
+		_, err = reconciler.Reconcile(context.Background(), request)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.description, err)
+		}
+
+		if !cmp.Equal(step.expectedRestarts, restarts) {
+			t.Errorf("%s: restarts mismatch (-want +got):\n%s", step.description, cmp.Diff(step.expectedRestarts, restarts))
+		}
+
+		err = client.Get(context.Background(), request.NamespacedName, instance)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.description, err)
+		}
+		if !cmp.Equal(step.expectedLastRequest, instance.Status.LastRestartRequest) {
+			t.Errorf("%s: last restart request mismatch (-want +got):\n%s", step.description, cmp.Diff(step.expectedLastRequest, instance.Status.LastRestartRequest))
+		}
+	}
+}
+
+func TestReconcileRestartAnnotationUnchangedFastPath(t *testing.T) {
+	now := time.Date(2024, time.March, 2, 3, 0, 30, 0, time.UTC)
+
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+
+	restarts := 0
+	fclient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "test-namespace",
+			},
+			Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "test container",
+							},
+						},
+					},
+				},
+			},
+		},
+	).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).WithInterceptorFuncs(interceptor.Funcs{
+		Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+			if _, isPod := obj.(*corev1.Pod); isPod {
+				restarts++
+			}
+			return c.Delete(ctx, obj, opts...)
+		},
+	}).Build()
+
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
+		Client: fclient,
+		Scheme: scheme,
+		KubernetesResourceReconciler: &k8sreconcile.KubernetesResourceReconciler{
+			Client:               fclient,
+			Scheme:               scheme,
+			ControllerReferencer: controllerutil.SetControllerReference,
+		},
+		Log:                   logr.Discard(),
+		Clock:                 clocktesting.NewFakePassiveClock(now),
+		FullReconcileInterval: 10 * time.Minute,
+	}
+
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "test",
+			Namespace: "test-namespace",
+		},
+	}
+
+	// Provision the resources with a ready Pod, so later reconciles take the fast path while unchanged
+	_, err := reconciler.Reconcile(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pod := &corev1.Pod{}
+	err = fclient.Get(context.Background(), request.NamespacedName, pod)
+	if err != nil {
+		t.Fatalf("Unexpected error getting pod: %v", err)
+	}
+	pod.Status.Conditions = []corev1.PodCondition{
+		{
+			Type:   corev1.PodReady,
+			Status: corev1.ConditionTrue,
+		},
+	}
+	err = fclient.Status().Update(context.Background(), pod)
+	if err != nil {
+		t.Fatalf("Unexpected error updating pod: %v", err)
+	}
+
+	instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+	err = fclient.Get(context.Background(), request.NamespacedName, instance)
+	if err != nil {
+		t.Fatalf("Unexpected error getting CPA: %v", err)
+	}
+	if instance.Status.LastFullReconcileTime == nil || instance.Status.PlanHash == "" {
+		t.Fatalf("Full reconcile not tracked in status")
+	}
+
+	// Unchanged resources are skipped until the next full reconcile
+	result, err := reconciler.Reconcile(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !cmp.Equal(reconcile.Result{RequeueAfter: 10 * time.Minute}, result) {
+		t.Fatalf("Result mismatch (-want +got):\n%s", cmp.Diff(reconcile.Result{RequeueAfter: 10 * time.Minute}, result))
+	}
+
+	// Requesting a restart should restart the Pod straight away rather than waiting for the next full reconcile
+	err = fclient.Get(context.Background(), request.NamespacedName, instance)
+	if err != nil {
+		t.Fatalf("Unexpected error getting CPA: %v", err)
+	}
+	instance.Annotations = map[string]string{
+		controllers.RestartAnnotation: "2024-03-02T03:00:00Z",
+	}
+	err = fclient.Update(context.Background(), instance)
+	if err != nil {
+		t.Fatalf("Unexpected error updating CPA: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err = reconciler.Reconcile(context.Background(), request)
+		if err != nil {
+			t.Fatalf("Unexpected error on reconcile %d: %v", i, err)
+		}
+	}
+
+	if !cmp.Equal(1, restarts) {
+		t.Errorf("Restarts mismatch (-want +got):\n%s", cmp.Diff(1, restarts))
+	}
+
+	err = fclient.Get(context.Background(), request.NamespacedName, instance)
+	if err != nil {
+		t.Fatalf("Unexpected error getting CPA: %v", err)
+	}
+	if !cmp.Equal("2024-03-02T03:00:00Z", instance.Status.LastRestartRequest) {
+		t.Errorf("Last restart request mismatch (-want +got):\n%s", cmp.Diff("2024-03-02T03:00:00Z", instance.Status.LastRestartRequest))
+	}
+}
+func TestReconcileMaxPodAge(t *testing.T) {
+	now := time.Date(2024, time.March, 2, 3, 0, 30, 0, time.UTC)
+
+	template := custompodautoscalercomv1.PodTemplateSpec{
+		Spec: custompodautoscalercomv1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "test container",
+				},
+			},
+		},
+	}
+	changedTemplate := custompodautoscalercomv1.PodTemplateSpec{
+		Spec: custompodautoscalercomv1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "test container",
+					Image: "changed",
+				},
+			},
+		},
+	}
+
+	var tests = []struct {
+		description     string
+		expectedRequeue time.Duration
+		expectedDeletes int
+		maxPodAge       *metav1.Duration
+		schedule        string
+		lastRestartTime *metav1.Time
+		podCreationTime time.Time
+		template        custompodautoscalercomv1.PodTemplateSpec
+	}{
+		{
+			"No maximum Pod age, Pod not restarted",
+			0,
+			0,
+			nil,
+			"",
+			nil,
+			now.Add(-48 * time.Hour),
+			template,
+		},
+		{
+			"Pod younger than maximum age, requeue until maximum age reached",
+			8*time.Hour + 59*time.Minute + 30*time.Second,
+			0,
+			&metav1.Duration{Duration: 24 * time.Hour},
+			"",
+			nil,
+			time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC),
+			template,
+		},
+		{
+			"Pod reached maximum age, Pod restarted and requeued for the maximum age of the new Pod",
+			24 * time.Hour,
+			1,
+			&metav1.Duration{Duration: 24 * time.Hour},
+			"",
+			nil,
+			now.Add(-24 * time.Hour),
+			template,
+		},
+		{
+			"Pod older than maximum age, Pod restarted",
+			24 * time.Hour,
+			1,
+			&metav1.Duration{Duration: 24 * time.Hour},
+			"",
+			nil,
+			now.Add(-30 * time.Hour),
+			template,
+		},
+		{
+			"Pod older than maximum age, Pod being recreated for changes, restart skipped",
+			0,
+			0,
+			&metav1.Duration{Duration: 24 * time.Hour},
+			"",
+			nil,
+			now.Add(-30 * time.Hour),
+			changedTemplate,
+		},
+		{
+			"Pod older than maximum age and scheduled restart due, Pod restarted once",
+			24*time.Hour - 30*time.Second,
+			1,
+			&metav1.Duration{Duration: 24 * time.Hour},
+			"0 3 * * *",
+			&metav1.Time{Time: time.Date(2024, time.March, 1, 3, 0, 0, 0, time.UTC)},
+			now.Add(-30 * time.Hour),
+			template,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			scheme.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+			scheme.AddKnownTypes(corev1.SchemeGroupVersion, &corev1.Pod{})
+
+			// The existing Pod was provisioned for the unchanged template
+			existingPod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test",
+					Namespace:         "test-namespace",
+					CreationTimestamp: metav1.NewTime(test.podCreationTime),
+					Annotations: map[string]string{
+						controllers.PodSpecHashAnnotation: plannedPodSpecHash(t, scheme, template),
+					},
+				},
+			}
+
+			deletes := 0
+			fclient := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						Template:        test.template,
+						MaxPodAge:       test.maxPodAge,
+						RestartSchedule: test.schedule,
+					},
+					Status: custompodautoscalercomv1.CustomPodAutoscalerStatus{
+						LastScheduledRestartTime: test.lastRestartTime,
+					},
+				},
+				existingPod,
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).WithInterceptorFuncs(interceptor.Funcs{
+				Delete: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.DeleteOption) error {
+					if _, isPod := obj.(*corev1.Pod); isPod {
+						deletes++
+					}
+					return c.Delete(ctx, obj, opts...)
+				},
+			}).Build()
+
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fclient,
+				Scheme: scheme,
+				// Reconciling an existing Pod reports its creation time, a deleted Pod is recreated without one
+				KubernetesResourceReconciler: noopK8sReconciler(func(obj metav1.Object, kind string) {
+					if kind != "v1/Pod" {
+						return
+					}
+					pod := &corev1.Pod{}
+					err := fclient.Get(context.Background(), types.NamespacedName{Name: obj.GetName(), Namespace: obj.GetNamespace()}, pod)
+					if err == nil {
+						obj.SetCreationTimestamp(pod.CreationTimestamp)
+					}
+				}),
+				Log:   logr.Discard(),
+				Clock: clocktesting.NewFakePassiveClock(now),
+			}
+
+			result, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expectedRequeue, result.RequeueAfter) {
+				t.Errorf("Requeue mismatch (-want +got):\n%s", cmp.Diff(test.expectedRequeue, result.RequeueAfter))
+			}
+
+			if !cmp.Equal(test.expectedDeletes, deletes) {
+				t.Errorf("Pod deletes mismatch (-want +got):\n%s", cmp.Diff(test.expectedDeletes, deletes))
+			}
+		})
+	}
+}
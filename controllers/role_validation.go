@@ -0,0 +1,185 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+)
+
+// scaleTargetResources are the resources of the scale target kinds supported by the provisioned Role, other kinds
+// are assumed to use the lowercase plural of the kind
+var scaleTargetResources = map[string]string{
+	"Deployment":            "deployments",
+	"ReplicaSet":            "replicasets",
+	"StatefulSet":           "statefulsets",
+	"ReplicationController": "replicationcontrollers",
+	"Rollout":               "rollouts",
+}
+
+// requiredPermission is a verb the autoscaler needs to be allowed on a resource, limited to the resource name if set
+type requiredPermission struct {
+	group        string
+	resource     string
+	verb         string
+	resourceName string
+}
+
+func (p requiredPermission) String() string {
+	if p.group == "" {
+		return fmt.Sprintf("%s %s", p.verb, p.resource)
+	}
+	return fmt.Sprintf("%s %s.%s", p.verb, p.resource, p.group)
+}
+
+// requiredPermissions returns the permissions the autoscaler needs to manage the scale target of the CPA, getting the
+// target, getting and updating its scale subresource and listing the Pods it manages
+func requiredPermissions(instance *custompodautoscalercomv1.CustomPodAutoscaler) ([]requiredPermission, error) {
+	target := instance.Spec.ScaleTargetRef
+	groupVersion, err := schema.ParseGroupVersion(target.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	resource, exists := scaleTargetResources[target.Kind]
+	if !exists {
+		resource = strings.ToLower(target.Kind) + "s"
+	}
+
+	return []requiredPermission{
+		{group: groupVersion.Group, resource: resource, verb: "get", resourceName: target.Name},
+		{group: groupVersion.Group, resource: resource + "/scale", verb: "get", resourceName: target.Name},
+		{group: groupVersion.Group, resource: resource + "/scale", verb: "update", resourceName: target.Name},
+		{group: "", resource: "pods", verb: "list"},
+	}, nil
+}
+
+// missingPermissions returns the required permissions that are not allowed by any of the rules of the Role
+func missingPermissions(role *rbacv1.Role, required []requiredPermission) []string {
+	missing := []string{}
+	for _, permission := range required {
+		allowed := false
+		for _, rule := range role.Rules {
+			if ruleAllows(rule, permission) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			missing = append(missing, permission.String())
+		}
+	}
+	return missing
+}
+
+// ruleAllows returns if the rule allows the permission, a rule limited to resource names only allows permissions on
+// one of those names
+func ruleAllows(rule rbacv1.PolicyRule, permission requiredPermission) bool {
+	if !containsOrWildcard(rule.APIGroups, permission.group) || !containsOrWildcard(rule.Verbs, permission.verb) {
+		return false
+	}
+
+	resourceAllowed := false
+	for _, resource := range rule.Resources {
+		if resource == rbacv1.ResourceAll || resource == permission.resource {
+			resourceAllowed = true
+			break
+		}
+		// A '*/subresource' rule allows the subresource of any resource
+		if parts := strings.SplitN(permission.resource, "/", 2); len(parts) == 2 && resource == "*/"+parts[1] {
+			resourceAllowed = true
+			break
+		}
+	}
+	if !resourceAllowed {
+		return false
+	}
+
+	if len(rule.ResourceNames) == 0 {
+		return true
+	}
+	if permission.resourceName == "" {
+		return false
+	}
+	for _, name := range rule.ResourceNames {
+		if name == permission.resourceName {
+			return true
+		}
+	}
+	return false
+}
+
+func containsOrWildcard(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkExistingRole sets the RoleInsufficient condition, reporting if the existing Role bound to the autoscaler is
+// missing or does not grant the permissions the autoscaler needs to manage its scale target
+func (r *CustomPodAutoscalerReconciler) checkExistingRole(ctx context.Context, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+	condition := metav1.Condition{
+		Type:               custompodautoscalercomv1.ConditionRoleInsufficient,
+		Status:             metav1.ConditionFalse,
+		Reason:             "RoleSufficient",
+		Message:            fmt.Sprintf("Role %s grants the permissions the autoscaler needs", instance.Name),
+		ObservedGeneration: instance.Generation,
+	}
+
+	role := &rbacv1.Role{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}, role)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "RoleNotFound"
+		condition.Message = fmt.Sprintf("Role %s does not exist, the autoscaler will not be able to manage %s %s",
+			instance.Name, instance.Spec.ScaleTargetRef.Kind, instance.Spec.ScaleTargetRef.Name)
+	} else {
+		required, err := requiredPermissions(instance)
+		if err != nil {
+			return err
+		}
+		missing := missingPermissions(role, required)
+		if len(missing) > 0 {
+			condition.Status = metav1.ConditionTrue
+			condition.Reason = "PermissionsMissing"
+			condition.Message = fmt.Sprintf("Role %s does not grant permissions the autoscaler needs to manage %s %s: %s",
+				instance.Name, instance.Spec.ScaleTargetRef.Kind, instance.Spec.ScaleTargetRef.Name, strings.Join(missing, ", "))
+		}
+	}
+
+	if meta.SetStatusCondition(&instance.Status.Conditions, condition) && condition.Status == metav1.ConditionTrue && r.Recorder != nil {
+		r.Recorder.Event(instance, corev1.EventTypeWarning, custompodautoscalercomv1.ConditionRoleInsufficient, condition.Message)
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	autoscaling "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileExistingRole(t *testing.T) {
+	var tests = []struct {
+		description       string
+		expectedCondition *metav1.Condition
+		expectedEvents    []string
+		provisionRole     bool
+		validate          *bool
+		role              *rbacv1.Role
+	}{
+		{
+			"Validation not enabled, no condition",
+			nil,
+			[]string{},
+			false,
+			nil,
+			nil,
+		},
+		{
+			"Validation enabled, Role provisioned by the operator, no condition",
+			nil,
+			[]string{},
+			true,
+			boolPtr(true),
+			nil,
+		},
+		{
+			"Validation enabled, Role does not exist, condition true and warning event",
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionRoleInsufficient,
+				Status:             metav1.ConditionTrue,
+				Reason:             "RoleNotFound",
+				Message:            "Role test does not exist, the autoscaler will not be able to manage Deployment hello-kubernetes",
+				ObservedGeneration: 1,
+			},
+			[]string{
+				"Warning RoleInsufficient Role test does not exist, the autoscaler will not be able to manage Deployment hello-kubernetes",
+			},
+			false,
+			boolPtr(true),
+			nil,
+		},
+		{
+			"Validation enabled, Role missing scale permission, condition true and warning event",
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionRoleInsufficient,
+				Status:             metav1.ConditionTrue,
+				Reason:             "PermissionsMissing",
+				Message:            "Role test does not grant permissions the autoscaler needs to manage Deployment hello-kubernetes: get deployments/scale.apps, update deployments/scale.apps",
+				ObservedGeneration: 1,
+			},
+			[]string{
+				"Warning RoleInsufficient Role test does not grant permissions the autoscaler needs to manage Deployment hello-kubernetes: get deployments/scale.apps, update deployments/scale.apps",
+			},
+			false,
+			boolPtr(true),
+			&rbacv1.Role{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+				Rules: []rbacv1.PolicyRule{
+					{
+						APIGroups: []string{""},
+						Resources: []string{"pods"},
+						Verbs:     []string{"list"},
+					},
+					{
+						APIGroups: []string{"apps"},
+						Resources: []string{"deployments"},
+						Verbs:     []string{"get", "list"},
+					},
+				},
+			},
+		},
+		{
+			"Validation enabled, Role limited to another resource name, condition true",
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionRoleInsufficient,
+				Status:             metav1.ConditionTrue,
+				Reason:             "PermissionsMissing",
+				Message:            "Role test does not grant permissions the autoscaler needs to manage Deployment hello-kubernetes: get deployments.apps, get deployments/scale.apps, update deployments/scale.apps",
+				ObservedGeneration: 1,
+			},
+			[]string{
+				"Warning RoleInsufficient Role test does not grant permissions the autoscaler needs to manage Deployment hello-kubernetes: get deployments.apps, get deployments/scale.apps, update deployments/scale.apps",
+			},
+			false,
+			boolPtr(true),
+			&rbacv1.Role{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+				Rules: []rbacv1.PolicyRule{
+					{
+						APIGroups: []string{""},
+						Resources: []string{"pods"},
+						Verbs:     []string{"list"},
+					},
+					{
+						APIGroups:     []string{"apps"},
+						Resources:     []string{"deployments", "deployments/scale"},
+						ResourceNames: []string{"other"},
+						Verbs:         []string{"*"},
+					},
+				},
+			},
+		},
+		{
+			"Validation enabled, Role grants required permissions, condition false",
+			&metav1.Condition{
+				Type:               custompodautoscalercomv1.ConditionRoleInsufficient,
+				Status:             metav1.ConditionFalse,
+				Reason:             "RoleSufficient",
+				Message:            "Role test grants the permissions the autoscaler needs",
+				ObservedGeneration: 1,
+			},
+			[]string{},
+			false,
+			boolPtr(true),
+			&rbacv1.Role{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+				Rules: []rbacv1.PolicyRule{
+					{
+						APIGroups: []string{""},
+						Resources: []string{"pods"},
+						Verbs:     []string{"get", "list"},
+					},
+					{
+						APIGroups:     []string{"apps"},
+						Resources:     []string{"deployments"},
+						ResourceNames: []string{"hello-kubernetes"},
+						Verbs:         []string{"get"},
+					},
+					{
+						APIGroups: []string{"*"},
+						Resources: []string{"*/scale"},
+						Verbs:     []string{"get", "update"},
+					},
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			scheme.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+			scheme.AddKnownTypes(rbacv1.SchemeGroupVersion, &rbacv1.Role{})
+
+			objs := []runtime.Object{
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:       "test",
+						Namespace:  "test-namespace",
+						Generation: 1,
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						Template: custompodautoscalercomv1.PodTemplateSpec{
+							Spec: custompodautoscalercomv1.PodSpec{
+								Containers: []corev1.Container{
+									{
+										Name: "test container",
+									},
+								},
+							},
+						},
+						ScaleTargetRef: autoscaling.CrossVersionObjectReference{
+							APIVersion: "apps/v1",
+							Kind:       "Deployment",
+							Name:       "hello-kubernetes",
+						},
+						ProvisionRole:        boolPtr(test.provisionRole),
+						ValidateExistingRole: test.validate,
+					},
+				},
+			}
+			if test.role != nil {
+				objs = append(objs, test.role)
+			}
+
+			fclient := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objs...).
+				WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build()
+
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client:                       fclient,
+				Scheme:                       runtime.NewScheme(),
+				KubernetesResourceReconciler: noopK8sReconciler(nil),
+				Log:                          logr.Discard(),
+				Recorder:                     recorder,
+			}
+
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			cpa := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err = fclient.Get(context.Background(), types.NamespacedName{Name: "test", Namespace: "test-namespace"}, cpa)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			condition := meta.FindStatusCondition(cpa.Status.Conditions, custompodautoscalercomv1.ConditionRoleInsufficient)
+			if !cmp.Equal(test.expectedCondition, condition, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")) {
+				t.Errorf("Condition mismatch (-want +got):\n%s", cmp.Diff(test.expectedCondition, condition, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")))
+			}
+
+			close(recorder.Events)
+			events := []string{}
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			if !cmp.Equal(test.expectedEvents, events) {
+				t.Errorf("Events mismatch (-want +got):\n%s", cmp.Diff(test.expectedEvents, events))
+			}
+		})
+	}
+}
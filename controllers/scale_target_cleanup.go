@@ -0,0 +1,168 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/audit"
+)
+
+// ScaleTargetCleanupFinalizer is added to CPAs with scaleTargetCleanup set, holding deletion of the CPA until the
+// scale target has been cleaned up
+const ScaleTargetCleanupFinalizer = "custompodautoscaler.com/scale-target-cleanup"
+
+// scaleTargetCleanupSkippedReason is the reason of the event recorded when the scale target of a CPA being deleted
+// cannot be cleaned up
+const scaleTargetCleanupSkippedReason = "ScaleTargetCleanupSkipped"
+
+// syncScaleTargetCleanupFinalizer adds the finalizer to the CPA if scaleTargetCleanup is set, and removes it if not so
+// unsetting the option does not block deletion
+func (r *CustomPodAutoscalerReconciler) syncScaleTargetCleanupFinalizer(ctx context.Context, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+	var changed bool
+	if instance.Spec.ScaleTargetCleanup != nil {
+		changed = controllerutil.AddFinalizer(instance, ScaleTargetCleanupFinalizer)
+	} else {
+		changed = controllerutil.RemoveFinalizer(instance, ScaleTargetCleanupFinalizer)
+	}
+	if !changed {
+		return nil
+	}
+	return r.Client.Update(ctx, instance)
+}
+
+// cleanupScaleTarget cleans up the scale target of a CPA being deleted, restoring the replicas of a paused scale target
+// if set and removing the managed pause annotation, before removing the finalizer to allow the deletion to complete
+func (r *CustomPodAutoscalerReconciler) cleanupScaleTarget(ctx context.Context, reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) (reconcile.Result, error) {
+	if instance.Spec.ScaleTargetCleanup != nil && instance.Spec.ScaleTargetCleanup.Replicas != nil && instance.Status.ScaleTargetPaused {
+		err := r.restoreScaleTargetReplicas(ctx, reqLogger, instance, *instance.Spec.ScaleTargetCleanup.Replicas)
+		if err != nil {
+			if !cleanupSkippable(err) {
+				return reconcile.Result{}, err
+			}
+			return reconcile.Result{}, r.skipScaleTargetCleanup(ctx, reqLogger, instance, err)
+		}
+	}
+
+	result, err := r.setScaleTargetPaused(ctx, instance, false)
+	if err != nil {
+		if !cleanupSkippable(err) {
+			return result, err
+		}
+		return reconcile.Result{}, r.skipScaleTargetCleanup(ctx, reqLogger, instance, err)
+	}
+
+	reqLogger.Info("Scale target cleaned up, removing finalizer", "Kind", "custompodautoscaler.com/v1/CustomPodAutoscaler", "Namespace", instance.GetNamespace(), "Name", instance.GetName())
+	controllerutil.RemoveFinalizer(instance, ScaleTargetCleanupFinalizer)
+	return reconcile.Result{}, r.Client.Update(ctx, instance)
+}
+
+// cleanupSkippable returns if the error cleaning up the scale target means there is nothing the operator can clean up,
+// as the scale target or its kind no longer exists or the operator is not allowed to access it. Retrying these would
+// hold the deletion of the CPA indefinitely
+func cleanupSkippable(err error) bool {
+	return errors.IsNotFound(err) || meta.IsNoMatchError(err) || errors.IsForbidden(err)
+}
+
+// skipScaleTargetCleanup removes the finalizer of a CPA being deleted without cleaning up the scale target, recording a
+// warning event with the reason the scale target could not be cleaned up
+func (r *CustomPodAutoscalerReconciler) skipScaleTargetCleanup(ctx context.Context, reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler, cleanupErr error) error {
+	scaleTargetRef := instance.Spec.ScaleTargetRef
+	reqLogger.Info("Unable to clean up scale target, removing finalizer without cleaning up", "Kind", scaleTargetRef.Kind, "Namespace", instance.Namespace, "Name", scaleTargetRef.Name, "Error", cleanupErr)
+	if r.Recorder != nil {
+		r.Recorder.Eventf(instance, corev1.EventTypeWarning, scaleTargetCleanupSkippedReason,
+			"Unable to clean up %s %s, removed finalizer without cleaning up: %s", scaleTargetRef.Kind, scaleTargetRef.Name, cleanupErr)
+	}
+	controllerutil.RemoveFinalizer(instance, ScaleTargetCleanupFinalizer)
+	return r.Client.Update(ctx, instance)
+}
+
+// restoreScaleTargetReplicas sets the replicas of the scale target, if the scale target no longer exists there is
+// nothing to restore
+func (r *CustomPodAutoscalerReconciler) restoreScaleTargetReplicas(ctx context.Context, reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler, replicas int32) error {
+	scaleTargetRef := instance.Spec.ScaleTargetRef
+	resourceGV, err := schema.ParseGroupVersion(scaleTargetRef.APIVersion)
+	if err != nil {
+		return err
+	}
+
+	reqLogger.Info("Restoring scale target replicas before deletion", "Kind", scaleTargetRef.Kind, "Namespace", instance.Namespace, "Name", scaleTargetRef.Name, "Replicas", replicas)
+
+	if resourceGV.Group == argoRolloutsGroup && scaleTargetRef.Kind == argoRolloutKind {
+		scaled, err := r.scaleArgoRollout(ctx, reqLogger, instance.Namespace, resourceGV, scaleTargetRef.Name, replicas, false)
+		if scaled || err != nil {
+			r.AuditLogger.Record(instance, audit.ActionScale, scaleTargetRef.APIVersion+"/"+scaleTargetRef.Kind, scaleTargetRef.Name, err)
+		}
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if r.customResourceTarget(resourceGV) {
+		scaled, err := r.scaleCustomResource(ctx, reqLogger, instance, resourceGV, replicas, false)
+		if scaled || err != nil {
+			r.AuditLogger.Record(instance, audit.ActionScale, scaleTargetRef.APIVersion+"/"+scaleTargetRef.Kind, scaleTargetRef.Name, err)
+		}
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	targetGR := schema.GroupResource{
+		Group:    resourceGV.Group,
+		Resource: scaleTargetRef.Kind,
+	}
+
+	_, getSpan := r.tracer().Start(ctx, "GetScale", trace.WithAttributes(
+		kindAttribute.String(scaleTargetRef.Kind),
+		nameAttribute.String(scaleTargetRef.Name),
+	))
+	scaleResource, err := r.ScalingClient.Scales(instance.Namespace).Get(ctx, targetGR, scaleTargetRef.Name, metav1.GetOptions{})
+	endSpan(getSpan, err)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	scaleResource.Spec.Replicas = replicas
+
+	_, updateSpan := r.tracer().Start(ctx, "UpdateScale", trace.WithAttributes(
+		kindAttribute.String(scaleTargetRef.Kind),
+		nameAttribute.String(scaleTargetRef.Name),
+	))
+	_, err = r.ScalingClient.Scales(instance.Namespace).Update(ctx, targetGR, scaleResource, metav1.UpdateOptions{
+		FieldManager: r.FieldManager,
+	})
+	endSpan(updateSpan, err)
+	r.AuditLogger.Record(instance, audit.ActionScale, scaleTargetRef.APIVersion+"/"+scaleTargetRef.Kind, scaleTargetRef.Name, err)
+	return err
+}
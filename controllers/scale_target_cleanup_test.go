@@ -0,0 +1,364 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	k8sreconcile "github.com/jthomperoo/custom-pod-autoscaler-operator/reconcile"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	scaleFake "k8s.io/client-go/scale/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileScaleTargetCleanup(t *testing.T) {
+	var tests = []struct {
+		description           string
+		expectedScaleReplicas []int32
+		annotations           map[string]string
+		cleanup               *custompodautoscalercomv1.ScaleTargetCleanup
+	}{
+		{
+			"Paused CPA deleted, replicas restored and managed pause annotation removed",
+			[]int32{5, 3},
+			map[string]string{
+				controllers.PausedReplicasAnnotation: "5",
+			},
+			&custompodautoscalercomv1.ScaleTargetCleanup{
+				Replicas: int32Ptr(3),
+			},
+		},
+		{
+			"Paused CPA deleted without cleanup replicas, managed pause annotation removed",
+			[]int32{5},
+			map[string]string{
+				controllers.PausedReplicasAnnotation: "5",
+			},
+			&custompodautoscalercomv1.ScaleTargetCleanup{},
+		},
+		{
+			"Unpaused CPA deleted, replicas not restored",
+			[]int32{},
+			nil,
+			&custompodautoscalercomv1.ScaleTargetCleanup{
+				Replicas: int32Ptr(3),
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+			utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+
+			fclient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:        "test",
+							Namespace:   "test-namespace",
+							Annotations: test.annotations,
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							Template: custompodautoscalercomv1.PodTemplateSpec{
+								Spec: custompodautoscalercomv1.PodSpec{
+									Containers: []corev1.Container{
+										{
+											Name: "test container",
+										},
+									},
+								},
+							},
+							ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{
+								APIVersion: "apps/v1",
+								Kind:       "Deployment",
+								Name:       "test-deployment",
+							},
+							ScaleTargetCleanup: test.cleanup,
+						},
+					},
+					&appsv1.Deployment{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test-deployment",
+							Namespace: "test-namespace",
+						},
+					},
+				).
+				WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).
+				Build()
+
+			scaleReplicas := []int32{}
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fclient,
+				Scheme: scheme,
+				KubernetesResourceReconciler: &k8sreconcile.KubernetesResourceReconciler{
+					Client:               fclient,
+					Scheme:               scheme,
+					ControllerReferencer: controllerutil.SetControllerReference,
+				},
+				ScalingClient: &scaleFake.FakeScaleClient{
+					Fake: k8stesting.Fake{
+						ReactionChain: []k8stesting.Reactor{
+							&k8stesting.SimpleReactor{
+								Resource: "*",
+								Verb:     "update",
+								Reaction: func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+									scale := action.(k8stesting.UpdateAction).GetObject().(*autoscalingv1.Scale)
+									scaleReplicas = append(scaleReplicas, scale.Spec.Replicas)
+									return true, scale, nil
+								},
+							},
+							&k8stesting.SimpleReactor{
+								Resource: "*",
+								Verb:     "get",
+								Reaction: func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+									return true, &autoscalingv1.Scale{}, nil
+								},
+							},
+						},
+					},
+				},
+				Log: logr.Discard(),
+			}
+
+			request := reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			}
+
+			// The finalizer is added when the CPA is reconciled
+			_, err := reconciler.Reconcile(context.Background(), request)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			instance := &custompodautoscalercomv1.CustomPodAutoscaler{}
+			err = fclient.Get(context.Background(), request.NamespacedName, instance)
+			if err != nil {
+				t.Fatalf("Unexpected error getting CPA: %v", err)
+			}
+			if !controllerutil.ContainsFinalizer(instance, controllers.ScaleTargetCleanupFinalizer) {
+				t.Fatalf("Expected CPA to have the %s finalizer", controllers.ScaleTargetCleanupFinalizer)
+			}
+
+			deployment := &appsv1.Deployment{}
+			err = fclient.Get(context.Background(), types.NamespacedName{Name: "test-deployment", Namespace: "test-namespace"}, deployment)
+			if err != nil {
+				t.Fatalf("Unexpected error getting deployment: %v", err)
+			}
+			_, annotated := deployment.Annotations[controllers.ManagedPauseAnnotation]
+			if !cmp.Equal(instance.Status.ScaleTargetPaused, annotated) {
+				t.Errorf("Annotated mismatch (-want +got):\n%s", cmp.Diff(instance.Status.ScaleTargetPaused, annotated))
+			}
+
+			// Deleting the CPA is held by the finalizer until the scale target is cleaned up
+			err = fclient.Delete(context.Background(), instance)
+			if err != nil {
+				t.Fatalf("Unexpected error deleting CPA: %v", err)
+			}
+
+			_, err = reconciler.Reconcile(context.Background(), request)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expectedScaleReplicas, scaleReplicas) {
+				t.Errorf("Scale replicas mismatch (-want +got):\n%s", cmp.Diff(test.expectedScaleReplicas, scaleReplicas))
+			}
+
+			deployment = &appsv1.Deployment{}
+			err = fclient.Get(context.Background(), types.NamespacedName{Name: "test-deployment", Namespace: "test-namespace"}, deployment)
+			if err != nil {
+				t.Fatalf("Unexpected error getting deployment: %v", err)
+			}
+			if _, annotated := deployment.Annotations[controllers.ManagedPauseAnnotation]; annotated {
+				t.Errorf("Expected managed pause annotation to be removed")
+			}
+
+			err = fclient.Get(context.Background(), request.NamespacedName, &custompodautoscalercomv1.CustomPodAutoscaler{})
+			if !apierrors.IsNotFound(err) {
+				t.Errorf("Expected CPA to be deleted, got error: %v", err)
+			}
+		})
+	}
+}
+
+func TestReconcileScaleTargetCleanupSkipped(t *testing.T) {
+	var tests = []struct {
+		description    string
+		expectedEvents []string
+		scaleTargetRef autoscalingv1.CrossVersionObjectReference
+		cleanup        *custompodautoscalercomv1.ScaleTargetCleanup
+		scaleErr       error
+		getTargetErr   error
+	}{
+		{
+			"Operator forbidden from scaling the scale target, finalizer removed with warning event",
+			[]string{
+				"Warning ScaleTargetCleanupSkipped Unable to clean up Deployment test-deployment, removed finalizer " +
+					"without cleaning up: deployments.apps \"test-deployment\" is forbidden: operator not granted access",
+			},
+			autoscalingv1.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       "test-deployment",
+			},
+			&custompodautoscalercomv1.ScaleTargetCleanup{
+				Replicas: int32Ptr(3),
+			},
+			apierrors.NewForbidden(schema.GroupResource{Group: "apps", Resource: "deployments"}, "test-deployment",
+				errors.New("operator not granted access")),
+			nil,
+		},
+		{
+			"Scale target kind no longer served, finalizer removed with warning event",
+			[]string{
+				"Warning ScaleTargetCleanupSkipped Unable to clean up Widget test-widget, removed finalizer without " +
+					"cleaning up: no matches for kind \"Widget\" in version \"example.com/v1\"",
+			},
+			autoscalingv1.CrossVersionObjectReference{
+				APIVersion: "example.com/v1",
+				Kind:       "Widget",
+				Name:       "test-widget",
+			},
+			&custompodautoscalercomv1.ScaleTargetCleanup{},
+			nil,
+			&meta.NoKindMatchError{
+				GroupKind:        schema.GroupKind{Group: "example.com", Kind: "Widget"},
+				SearchedVersions: []string{"v1"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+			utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+
+			deletionTimestamp := metav1.Now()
+			fclient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:              "test",
+							Namespace:         "test-namespace",
+							DeletionTimestamp: &deletionTimestamp,
+							Finalizers:        []string{controllers.ScaleTargetCleanupFinalizer},
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							ScaleTargetRef:     test.scaleTargetRef,
+							ScaleTargetCleanup: test.cleanup,
+						},
+						Status: custompodautoscalercomv1.CustomPodAutoscalerStatus{
+							ScaleTargetPaused: true,
+						},
+					},
+					&appsv1.Deployment{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test-deployment",
+							Namespace: "test-namespace",
+						},
+					},
+				).
+				WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).
+				WithInterceptorFuncs(interceptor.Funcs{
+					Get: func(ctx context.Context, client client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+						if _, ok := obj.(*unstructured.Unstructured); ok && test.getTargetErr != nil {
+							return test.getTargetErr
+						}
+						return client.Get(ctx, key, obj, opts...)
+					},
+				}).
+				Build()
+
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client:                       fclient,
+				Scheme:                       scheme,
+				KubernetesResourceReconciler: noopK8sReconciler(nil),
+				ScalingClient: &scaleFake.FakeScaleClient{
+					Fake: k8stesting.Fake{
+						ReactionChain: []k8stesting.Reactor{
+							&k8stesting.SimpleReactor{
+								Resource: "*",
+								Verb:     "get",
+								Reaction: func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+									return true, &autoscalingv1.Scale{}, test.scaleErr
+								},
+							},
+						},
+					},
+				},
+				Log:      logr.Discard(),
+				Recorder: recorder,
+			}
+
+			request := reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			}
+
+			_, err := reconciler.Reconcile(context.Background(), request)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			err = fclient.Get(context.Background(), request.NamespacedName, &custompodautoscalercomv1.CustomPodAutoscaler{})
+			if !apierrors.IsNotFound(err) {
+				t.Errorf("Expected CPA to be deleted, got error: %v", err)
+			}
+
+			close(recorder.Events)
+			events := []string{}
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			if !cmp.Equal(test.expectedEvents, events) {
+				t.Errorf("Events mismatch (-want +got):\n%s", cmp.Diff(test.expectedEvents, events))
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// SecurityProfile is a set of securityContext defaults applied to the provisioned Pod, named after the Pod Security
+// Standards level the Pod is made to meet
+type SecurityProfile string
+
+const (
+	// SecurityProfileBaseline uses the runtime default seccomp profile
+	SecurityProfileBaseline SecurityProfile = "baseline"
+	// SecurityProfileRestricted runs the Pod as non-root with the runtime default seccomp profile, disallowing
+	// privilege escalation and dropping all capabilities in every container
+	SecurityProfileRestricted SecurityProfile = "restricted"
+)
+
+// NamespaceSecurityProfile is the SecurityProfile applied to Pods provisioned in namespaces matching the selector
+type NamespaceSecurityProfile struct {
+	Selector labels.Selector
+	Profile  SecurityProfile
+}
+
+// ParseNamespaceSecurityProfiles parses a semicolon separated list of namespace label selectors mapped to security
+// profiles in the form selector:profile, for example
+// "kubernetes.io/metadata.name=team-a:restricted;pod-security.kubernetes.io/enforce=baseline:baseline"
+func ParseNamespaceSecurityProfiles(profiles string) ([]NamespaceSecurityProfile, error) {
+	parsed := []NamespaceSecurityProfile{}
+	for _, entry := range strings.Split(profiles, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		// Label selectors cannot contain colons, so the profile is everything after the last colon
+		index := strings.LastIndex(entry, ":")
+		if index < 0 {
+			return nil, fmt.Errorf("invalid namespace security profile %q, must be in the form selector:profile", entry)
+		}
+		selector, err := labels.Parse(strings.TrimSpace(entry[:index]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace selector in security profile %q: %w", entry, err)
+		}
+		profile := SecurityProfile(strings.TrimSpace(entry[index+1:]))
+		if profile != SecurityProfileBaseline && profile != SecurityProfileRestricted {
+			return nil, fmt.Errorf("invalid security profile %q in %q, must be one of %s, %s", profile, entry,
+				SecurityProfileBaseline, SecurityProfileRestricted)
+		}
+		parsed = append(parsed, NamespaceSecurityProfile{
+			Selector: selector,
+			Profile:  profile,
+		})
+	}
+	return parsed, nil
+}
+
+// namespaceSecurityProfile returns the profile of the first NamespaceSecurityProfile matching the labels of the
+// namespace, if none match an empty profile is returned
+func (r *CustomPodAutoscalerReconciler) namespaceSecurityProfile(ctx context.Context, namespace string) (SecurityProfile, error) {
+	reader := r.NamespaceReader
+	if reader == nil {
+		reader = r.Client
+	}
+
+	ns := &corev1.Namespace{}
+	err := reader.Get(ctx, types.NamespacedName{Name: namespace}, ns)
+	if err != nil {
+		return "", err
+	}
+	for _, profile := range r.NamespaceSecurityProfiles {
+		if profile.Selector.Matches(labels.Set(ns.Labels)) {
+			return profile.Profile, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,368 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestParseNamespaceSecurityProfiles(t *testing.T) {
+	var tests = []struct {
+		description string
+		expected    []string
+		expectedErr string
+		profiles    string
+	}{
+		{
+			"No profiles",
+			[]string{},
+			"",
+			"",
+		},
+		{
+			"Multiple profiles",
+			[]string{
+				"kubernetes.io/metadata.name=team-a:restricted",
+				"pod-security.kubernetes.io/enforce in (baseline,privileged):baseline",
+			},
+			"",
+			"kubernetes.io/metadata.name=team-a:restricted; pod-security.kubernetes.io/enforce in (baseline,privileged):baseline;",
+		},
+		{
+			"Missing profile",
+			nil,
+			`invalid namespace security profile "kubernetes.io/metadata.name=team-a", must be in the form selector:profile`,
+			"kubernetes.io/metadata.name=team-a",
+		},
+		{
+			"Unknown profile",
+			nil,
+			`invalid security profile "privileged" in "kubernetes.io/metadata.name=team-a:privileged", must be one of baseline, restricted`,
+			"kubernetes.io/metadata.name=team-a:privileged",
+		},
+		{
+			"Invalid selector",
+			nil,
+			`invalid namespace selector in security profile "team-a!!:restricted": unable to parse requirement: found '!', expected: in, notin, =, ==, !=, gt, lt`,
+			"team-a!!:restricted",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			profiles, err := controllers.ParseNamespaceSecurityProfiles(test.profiles)
+			if err != nil {
+				if !cmp.Equal(test.expectedErr, err.Error()) {
+					t.Errorf("Error mismatch (-want +got):\n%s", cmp.Diff(test.expectedErr, err.Error()))
+				}
+				return
+			}
+			if test.expectedErr != "" {
+				t.Fatalf("Expected error %q", test.expectedErr)
+			}
+
+			parsed := []string{}
+			for _, profile := range profiles {
+				parsed = append(parsed, profile.Selector.String()+":"+string(profile.Profile))
+			}
+			if !cmp.Equal(test.expected, parsed) {
+				t.Errorf("Profiles mismatch (-want +got):\n%s", cmp.Diff(test.expected, parsed))
+			}
+		})
+	}
+}
+
+func TestReconcileNamespaceSecurityProfiles(t *testing.T) {
+	var tests = []struct {
+		description                      string
+		expectedPodSecurityContext       *corev1.PodSecurityContext
+		expectedContainerSecurityContext *corev1.SecurityContext
+		namespace                        string
+		podSecurityContext               *corev1.PodSecurityContext
+		containerSecurityContext         *corev1.SecurityContext
+	}{
+		{
+			"Restricted namespace, restricted profile applied",
+			&corev1.PodSecurityContext{
+				RunAsNonRoot: boolPtr(true),
+				SeccompProfile: &corev1.SeccompProfile{
+					Type: corev1.SeccompProfileTypeRuntimeDefault,
+				},
+			},
+			&corev1.SecurityContext{
+				AllowPrivilegeEscalation: boolPtr(false),
+				Capabilities: &corev1.Capabilities{
+					Drop: []corev1.Capability{"ALL"},
+				},
+			},
+			"restricted-namespace",
+			nil,
+			nil,
+		},
+		{
+			"Baseline namespace, baseline profile applied",
+			&corev1.PodSecurityContext{
+				SeccompProfile: &corev1.SeccompProfile{
+					Type: corev1.SeccompProfileTypeRuntimeDefault,
+				},
+			},
+			nil,
+			"baseline-namespace",
+			nil,
+			nil,
+		},
+		{
+			"Unmatched namespace, no profile applied",
+			nil,
+			nil,
+			"other-namespace",
+			nil,
+			nil,
+		},
+		{
+			"Restricted namespace, template security contexts take precedence",
+			&corev1.PodSecurityContext{
+				RunAsNonRoot: boolPtr(true),
+				RunAsUser:    int64Ptr(1000),
+				SeccompProfile: &corev1.SeccompProfile{
+					Type:             corev1.SeccompProfileTypeLocalhost,
+					LocalhostProfile: stringPtr("profiles/autoscaler.json"),
+				},
+			},
+			&corev1.SecurityContext{
+				AllowPrivilegeEscalation: boolPtr(false),
+				ReadOnlyRootFilesystem:   boolPtr(true),
+				Capabilities: &corev1.Capabilities{
+					Add:  []corev1.Capability{"NET_BIND_SERVICE"},
+					Drop: []corev1.Capability{"ALL"},
+				},
+			},
+			"restricted-namespace",
+			&corev1.PodSecurityContext{
+				RunAsUser: int64Ptr(1000),
+				SeccompProfile: &corev1.SeccompProfile{
+					Type:             corev1.SeccompProfileTypeLocalhost,
+					LocalhostProfile: stringPtr("profiles/autoscaler.json"),
+				},
+			},
+			&corev1.SecurityContext{
+				ReadOnlyRootFilesystem: boolPtr(true),
+				Capabilities: &corev1.Capabilities{
+					Add: []corev1.Capability{"NET_BIND_SERVICE"},
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			scheme.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+			scheme.AddKnownTypes(corev1.SchemeGroupVersion, &corev1.Namespace{})
+
+			fclient := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+				&corev1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "restricted-namespace",
+						Labels: map[string]string{
+							"kubernetes.io/metadata.name":        "restricted-namespace",
+							"pod-security.kubernetes.io/enforce": "restricted",
+						},
+					},
+				},
+				&corev1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "baseline-namespace",
+						Labels: map[string]string{
+							"kubernetes.io/metadata.name": "baseline-namespace",
+						},
+					},
+				},
+				&corev1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "other-namespace",
+						Labels: map[string]string{
+							"kubernetes.io/metadata.name": "other-namespace",
+						},
+					},
+				},
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: test.namespace,
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						Template: custompodautoscalercomv1.PodTemplateSpec{
+							Spec: custompodautoscalercomv1.PodSpec{
+								Containers: []corev1.Container{
+									{
+										Name:            "test container",
+										SecurityContext: test.containerSecurityContext,
+									},
+								},
+								SecurityContext: test.podSecurityContext,
+							},
+						},
+					},
+				},
+			).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build()
+
+			profiles, err := controllers.ParseNamespaceSecurityProfiles(
+				"pod-security.kubernetes.io/enforce=restricted:restricted;kubernetes.io/metadata.name=baseline-namespace:baseline")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var pod *corev1.Pod
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fclient,
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: noopK8sReconciler(func(obj metav1.Object, kind string) {
+					provisionedPod, ok := obj.(*corev1.Pod)
+					if ok {
+						pod = provisionedPod
+					}
+				}),
+				Log:                       logr.Discard(),
+				NamespaceSecurityProfiles: profiles,
+			}
+
+			_, err = reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: test.namespace,
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if pod == nil {
+				t.Fatalf("Pod was not provisioned")
+			}
+
+			if !cmp.Equal(test.expectedPodSecurityContext, pod.Spec.SecurityContext) {
+				t.Errorf("Pod security context mismatch (-want +got):\n%s", cmp.Diff(test.expectedPodSecurityContext, pod.Spec.SecurityContext))
+			}
+
+			if !cmp.Equal(test.expectedContainerSecurityContext, pod.Spec.Containers[0].SecurityContext) {
+				t.Errorf("Container security context mismatch (-want +got):\n%s", cmp.Diff(test.expectedContainerSecurityContext, pod.Spec.Containers[0].SecurityContext))
+			}
+		})
+	}
+}
+
+func TestReconcileNamespaceSecurityProfilesNamespaceReader(t *testing.T) {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+	scheme.AddKnownTypes(corev1.SchemeGroupVersion, &corev1.Namespace{})
+
+	// The cache of an operator limited to a single namespace cannot read namespaces
+	fclient := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+		&custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "restricted-namespace",
+			},
+			Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "test container",
+							},
+						},
+					},
+				},
+			},
+		},
+	).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).WithInterceptorFuncs(interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if _, isNamespace := obj.(*corev1.Namespace); isNamespace {
+				return errors.New("unable to get: restricted-namespace because of unknown namespace for the cache")
+			}
+			return c.Get(ctx, key, obj, opts...)
+		},
+	}).Build()
+
+	namespaceReader := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "restricted-namespace",
+				Labels: map[string]string{
+					"pod-security.kubernetes.io/enforce": "restricted",
+				},
+			},
+		},
+	).Build()
+
+	profiles, err := controllers.ParseNamespaceSecurityProfiles("pod-security.kubernetes.io/enforce=restricted:restricted")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var pod *corev1.Pod
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
+		Client: fclient,
+		Scheme: runtime.NewScheme(),
+		KubernetesResourceReconciler: noopK8sReconciler(func(obj metav1.Object, kind string) {
+			if provisionedPod, ok := obj.(*corev1.Pod); ok {
+				pod = provisionedPod
+			}
+		}),
+		Log:                       logr.Discard(),
+		NamespaceSecurityProfiles: profiles,
+		NamespaceReader:           namespaceReader,
+	}
+
+	_, err = reconciler.Reconcile(context.Background(), reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "test",
+			Namespace: "restricted-namespace",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if pod == nil {
+		t.Fatalf("Pod was not provisioned")
+	}
+
+	expected := &corev1.PodSecurityContext{
+		RunAsNonRoot: boolPtr(true),
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+	if !cmp.Equal(expected, pod.Spec.SecurityContext) {
+		t.Errorf("Pod security context mismatch (-want +got):\n%s", cmp.Diff(expected, pod.Spec.SecurityContext))
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/discovery"
+
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/audit"
+)
+
+const (
+	// serviceMonitorsResource is the resource name the Prometheus Operator ServiceMonitor CRD is served under
+	serviceMonitorsResource = "servicemonitors"
+	// serviceMonitorKind is the kind of a Prometheus Operator ServiceMonitor
+	serviceMonitorKind = "ServiceMonitor"
+	// serviceMonitorMetricsPath is the path the ServiceMonitor scrapes metrics from
+	serviceMonitorMetricsPath = "/metrics"
+)
+
+// serviceMonitorGroupVersion is the group version of the Prometheus Operator ServiceMonitor CRD, ServiceMonitors are
+// managed as unstructured resources to avoid a dependency on the Prometheus Operator
+var serviceMonitorGroupVersion = schema.GroupVersion{Group: "monitoring.coreos.com", Version: "v1"}
+
+// ServiceMonitorServed returns if the Prometheus Operator ServiceMonitor CRD is served, ServiceMonitors are only
+// provisioned if it is
+func ServiceMonitorServed(discoveryClient discovery.DiscoveryInterface) (bool, error) {
+	resources, err := discoveryClient.ServerResourcesForGroupVersion(serviceMonitorGroupVersion.String())
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	for _, resource := range resources.APIResources {
+		if resource.Name == serviceMonitorsResource {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// buildService defines a headless Service selecting the autoscaler Pod, exposing the ports of the autoscaler
+// container. Unnamed ports are named so they can be referenced by the ServiceMonitor
+func buildService(instance *custompodautoscalercomv1.CustomPodAutoscaler, pod *corev1.Pod, labels map[string]string) *corev1.Service {
+	ports := []corev1.ServicePort{}
+	if len(pod.Spec.Containers) > 0 {
+		for _, containerPort := range pod.Spec.Containers[0].Ports {
+			name := containerPort.Name
+			if name == "" {
+				name = fmt.Sprintf("port-%d", containerPort.ContainerPort)
+			}
+			ports = append(ports, corev1.ServicePort{
+				Name:       name,
+				Port:       containerPort.ContainerPort,
+				TargetPort: intstr.FromInt32(containerPort.ContainerPort),
+				Protocol:   containerPort.Protocol,
+			})
+		}
+	}
+
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance.Name,
+			Namespace: instance.Namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: corev1.ClusterIPNone,
+			Selector: map[string]string{
+				managedByLabel: labels[managedByLabel],
+				OwnedByLabel:   labels[OwnedByLabel],
+			},
+			Ports: ports,
+		},
+	}
+}
+
+// buildServiceMonitor defines a Prometheus Operator ServiceMonitor scraping the first port of the Service
+func buildServiceMonitor(instance *custompodautoscalercomv1.CustomPodAutoscaler, service *corev1.Service, labels map[string]string) *unstructured.Unstructured {
+	endpoints := []interface{}{}
+	if len(service.Spec.Ports) > 0 {
+		endpoints = append(endpoints, map[string]interface{}{
+			"port": service.Spec.Ports[0].Name,
+			"path": serviceMonitorMetricsPath,
+		})
+	}
+
+	selector := map[string]interface{}{}
+	for key, value := range service.Spec.Selector {
+		selector[key] = value
+	}
+
+	serviceMonitor := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"selector": map[string]interface{}{
+					"matchLabels": selector,
+				},
+				"endpoints": endpoints,
+			},
+		},
+	}
+	serviceMonitor.SetGroupVersionKind(serviceMonitorGroupVersion.WithKind(serviceMonitorKind))
+	serviceMonitor.SetName(instance.Name)
+	serviceMonitor.SetNamespace(instance.Namespace)
+	serviceMonitor.SetLabels(labels)
+	return serviceMonitor
+}
+
+// reconcileServiceMonitor creates or updates the ServiceMonitor using the dynamic client, with the CPA set as the
+// owner and controller so the ServiceMonitor is deleted along with the CPA
+func (r *CustomPodAutoscalerReconciler) reconcileServiceMonitor(
+	ctx context.Context,
+	reqLogger logr.Logger,
+	instance *custompodautoscalercomv1.CustomPodAutoscaler,
+	serviceMonitor *unstructured.Unstructured,
+) (err error) {
+	kind := serviceMonitorGroupVersion.String() + "/" + serviceMonitorKind
+	ctx, span := r.tracer().Start(ctx, "ReconcileResource", trace.WithAttributes(
+		kindAttribute.String(kind),
+		nameAttribute.String(serviceMonitor.GetName()),
+	))
+	defer func() {
+		endSpan(span, err)
+		if err != nil {
+			r.reportResourceFailed(ctx, reqLogger, instance, serviceMonitor, kind, err)
+		}
+	}()
+
+	serviceMonitor = serviceMonitor.DeepCopy()
+	serviceMonitor.SetOwnerReferences([]metav1.OwnerReference{
+		*metav1.NewControllerRef(instance, custompodautoscalercomv1.GroupVersion.WithKind("CustomPodAutoscaler")),
+	})
+
+	serviceMonitors := r.DynamicClient.Resource(serviceMonitorGroupVersion.WithResource(serviceMonitorsResource)).Namespace(serviceMonitor.GetNamespace())
+	existing, err := serviceMonitors.Get(ctx, serviceMonitor.GetName(), metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		reqLogger.Info("Creating a new k8s object ", "Kind", kind, "Namespace", serviceMonitor.GetNamespace(), "Name", serviceMonitor.GetName())
+		_, err = serviceMonitors.Create(ctx, serviceMonitor, metav1.CreateOptions{FieldManager: r.FieldManager})
+		r.AuditLogger.Record(instance, audit.ActionCreate, kind, serviceMonitor.GetName(), err)
+		return err
+	}
+
+	reqLogger.Info("Updating k8s object ", "Kind", kind, "Namespace", serviceMonitor.GetNamespace(), "Name", serviceMonitor.GetName())
+	serviceMonitor.SetResourceVersion(existing.GetResourceVersion())
+	_, err = serviceMonitors.Update(ctx, serviceMonitor, metav1.UpdateOptions{FieldManager: r.FieldManager})
+	r.AuditLogger.Record(instance, audit.ActionUpdate, kind, serviceMonitor.GetName(), err)
+	return err
+}
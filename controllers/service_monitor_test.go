@@ -0,0 +1,453 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	k8sreconcile "github.com/jthomperoo/custom-pod-autoscaler-operator/reconcile"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var serviceMonitorsResource = schema.GroupVersionResource{Group: "monitoring.coreos.com", Version: "v1", Resource: "servicemonitors"}
+
+func TestServiceMonitorServed(t *testing.T) {
+	var tests = []struct {
+		description string
+		expected    bool
+		resources   []*metav1.APIResourceList
+	}{
+		{
+			"Prometheus Operator not installed",
+			false,
+			[]*metav1.APIResourceList{},
+		},
+		{
+			"Group version served without ServiceMonitor resource",
+			false,
+			[]*metav1.APIResourceList{
+				{
+					GroupVersion: "monitoring.coreos.com/v1",
+					APIResources: []metav1.APIResource{
+						{
+							Name: "prometheuses",
+							Kind: "Prometheus",
+						},
+					},
+				},
+			},
+		},
+		{
+			"ServiceMonitor served",
+			true,
+			[]*metav1.APIResourceList{
+				{
+					GroupVersion: "monitoring.coreos.com/v1",
+					APIResources: []metav1.APIResource{
+						{
+							Name: "servicemonitors",
+							Kind: "ServiceMonitor",
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			discoveryClient := &fakediscovery.FakeDiscovery{
+				Fake: &k8stesting.Fake{
+					Resources: test.resources,
+				},
+			}
+			served, err := controllers.ServiceMonitorServed(discoveryClient)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !cmp.Equal(test.expected, served) {
+				t.Errorf("Served mismatch (-want +got):\n%s", cmp.Diff(test.expected, served))
+			}
+		})
+	}
+}
+
+func TestReconcileServiceMonitor(t *testing.T) {
+	expectedService := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "test-namespace",
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by":        "custom-pod-autoscaler-operator",
+				"v1.custompodautoscaler.com/owned-by": "test",
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: corev1.ClusterIPNone,
+			Selector: map[string]string{
+				"app.kubernetes.io/managed-by":        "custom-pod-autoscaler-operator",
+				"v1.custompodautoscaler.com/owned-by": "test",
+			},
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "http",
+					Port:       5000,
+					TargetPort: intstr.FromInt32(5000),
+					Protocol:   corev1.ProtocolTCP,
+				},
+			},
+		},
+	}
+
+	expectedServiceMonitor := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "monitoring.coreos.com/v1",
+			"kind":       "ServiceMonitor",
+			"metadata": map[string]interface{}{
+				"name":      "test",
+				"namespace": "test-namespace",
+				"labels": map[string]interface{}{
+					"app.kubernetes.io/managed-by":        "custom-pod-autoscaler-operator",
+					"v1.custompodautoscaler.com/owned-by": "test",
+				},
+				"ownerReferences": []interface{}{
+					map[string]interface{}{
+						"apiVersion":         "custompodautoscaler.com/v1",
+						"kind":               "CustomPodAutoscaler",
+						"name":               "test",
+						"uid":                "test-uid",
+						"controller":         true,
+						"blockOwnerDeletion": true,
+					},
+				},
+			},
+			"spec": map[string]interface{}{
+				"selector": map[string]interface{}{
+					"matchLabels": map[string]interface{}{
+						"app.kubernetes.io/managed-by":        "custom-pod-autoscaler-operator",
+						"v1.custompodautoscaler.com/owned-by": "test",
+					},
+				},
+				"endpoints": []interface{}{
+					map[string]interface{}{
+						"port": "http",
+						"path": "/metrics",
+					},
+				},
+			},
+		},
+	}
+
+	existingServiceMonitor := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "monitoring.coreos.com/v1",
+			"kind":       "ServiceMonitor",
+			"metadata": map[string]interface{}{
+				"name":      "test",
+				"namespace": "test-namespace",
+			},
+			"spec": map[string]interface{}{
+				"endpoints": []interface{}{},
+			},
+		},
+	}
+
+	var tests = []struct {
+		description            string
+		expectedService        *corev1.Service
+		expectedServiceMonitor *unstructured.Unstructured
+		provisionMonitor       *bool
+		served                 bool
+		existing               []runtime.Object
+	}{
+		{
+			"ServiceMonitor not requested",
+			nil,
+			nil,
+			nil,
+			true,
+			nil,
+		},
+		{
+			"ServiceMonitor requested, CRD not installed, nothing provisioned",
+			nil,
+			nil,
+			boolPtr(true),
+			false,
+			nil,
+		},
+		{
+			"ServiceMonitor requested, CRD installed, Service and ServiceMonitor provisioned",
+			expectedService,
+			expectedServiceMonitor,
+			boolPtr(true),
+			true,
+			nil,
+		},
+		{
+			"ServiceMonitor requested, CRD installed, existing ServiceMonitor updated",
+			expectedService,
+			expectedServiceMonitor,
+			boolPtr(true),
+			true,
+			[]runtime.Object{existingServiceMonitor},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			scheme.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+
+			dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+				serviceMonitorsResource: "ServiceMonitorList",
+			}, test.existing...)
+
+			var service *corev1.Service
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(
+					&custompodautoscalercomv1.CustomPodAutoscaler{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "test",
+							Namespace: "test-namespace",
+							UID:       "test-uid",
+						},
+						Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+							Template: custompodautoscalercomv1.PodTemplateSpec{
+								Spec: custompodautoscalercomv1.PodSpec{
+									Containers: []corev1.Container{
+										{
+											Name: "test container",
+										},
+									},
+								},
+							},
+							ProvisionServiceMonitor: test.provisionMonitor,
+						},
+					},
+				).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						if kind == "v1/Service" {
+							service = obj.(*corev1.Service)
+						}
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				DynamicClient:        dynamicClient,
+				Log:                  logr.Discard(),
+				ServiceMonitorServed: test.served,
+			}
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expectedService, service) {
+				t.Errorf("Service mismatch (-want +got):\n%s", cmp.Diff(test.expectedService, service))
+			}
+
+			serviceMonitor, err := dynamicClient.Resource(serviceMonitorsResource).Namespace("test-namespace").Get(context.Background(), "test", metav1.GetOptions{})
+			if err != nil {
+				if !apierrors.IsNotFound(err) {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				serviceMonitor = nil
+			}
+			if !cmp.Equal(test.expectedServiceMonitor, serviceMonitor) {
+				t.Errorf("ServiceMonitor mismatch (-want +got):\n%s", cmp.Diff(test.expectedServiceMonitor, serviceMonitor))
+			}
+		})
+	}
+}
+
+func TestReconcileServiceMonitorUnchangedFastPath(t *testing.T) {
+	var tests = []struct {
+		description           string
+		expectedFullReconcile bool
+		remove                func(t *testing.T, fclient client.Client, dynamicClient *dynamicfake.FakeDynamicClient)
+	}{
+		{
+			"Service and ServiceMonitor exist, full reconcile skipped",
+			false,
+			func(t *testing.T, fclient client.Client, dynamicClient *dynamicfake.FakeDynamicClient) {},
+		},
+		{
+			"Service deleted, full reconcile recreates it",
+			true,
+			func(t *testing.T, fclient client.Client, dynamicClient *dynamicfake.FakeDynamicClient) {
+				err := fclient.Delete(context.Background(), &corev1.Service{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+					},
+				})
+				if err != nil {
+					t.Fatalf("Unexpected error deleting Service: %v", err)
+				}
+			},
+		},
+		{
+			"ServiceMonitor deleted, full reconcile recreates it",
+			true,
+			func(t *testing.T, fclient client.Client, dynamicClient *dynamicfake.FakeDynamicClient) {
+				err := dynamicClient.Resource(serviceMonitorsResource).Namespace("test-namespace").Delete(context.Background(), "test", metav1.DeleteOptions{})
+				if err != nil {
+					t.Fatalf("Unexpected error deleting ServiceMonitor: %v", err)
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+			utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+
+			fclient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						Template: custompodautoscalercomv1.PodTemplateSpec{
+							Spec: custompodautoscalercomv1.PodSpec{
+								Containers: []corev1.Container{
+									{
+										Name: "test container",
+									},
+								},
+							},
+						},
+						ProvisionServiceMonitor: boolPtr(true),
+					},
+				}).
+				WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}, &corev1.Pod{}).
+				Build()
+
+			dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+				serviceMonitorsResource: "ServiceMonitorList",
+			})
+
+			k8sReconciler := &k8sreconcile.KubernetesResourceReconciler{
+				Client:               fclient,
+				Scheme:               scheme,
+				ControllerReferencer: controllerutil.SetControllerReference,
+			}
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client:                       fclient,
+				Scheme:                       scheme,
+				KubernetesResourceReconciler: k8sReconciler,
+				DynamicClient:                dynamicClient,
+				Log:                          logr.Discard(),
+				Clock:                        clocktesting.NewFakePassiveClock(time.Date(2024, time.March, 1, 22, 0, 0, 0, time.UTC)),
+				FullReconcileInterval:        10 * time.Minute,
+				ServiceMonitorServed:         true,
+			}
+
+			request := reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			}
+
+			_, err := reconciler.Reconcile(context.Background(), request)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			pod := &corev1.Pod{}
+			err = fclient.Get(context.Background(), request.NamespacedName, pod)
+			if err != nil {
+				t.Fatalf("Unexpected error getting pod: %v", err)
+			}
+			pod.Status.Conditions = []corev1.PodCondition{
+				{
+					Type:   corev1.PodReady,
+					Status: corev1.ConditionTrue,
+				},
+			}
+			err = fclient.Status().Update(context.Background(), pod)
+			if err != nil {
+				t.Fatalf("Unexpected error updating pod: %v", err)
+			}
+
+			test.remove(t, fclient, dynamicClient)
+
+			result, err := reconciler.Reconcile(context.Background(), request)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			// A skipped full reconcile requeues for the next full reconcile
+			fullReconcile := result.RequeueAfter == 0
+			if !cmp.Equal(test.expectedFullReconcile, fullReconcile) {
+				t.Errorf("Full reconcile mismatch (-want +got):\n%s", cmp.Diff(test.expectedFullReconcile, fullReconcile))
+			}
+
+			err = fclient.Get(context.Background(), request.NamespacedName, &corev1.Service{})
+			if err != nil {
+				t.Errorf("Unexpected error getting Service: %v", err)
+			}
+
+			_, err = dynamicClient.Resource(serviceMonitorsResource).Namespace("test-namespace").Get(context.Background(), "test", metav1.GetOptions{})
+			if err != nil {
+				t.Errorf("Unexpected error getting ServiceMonitor: %v", err)
+			}
+		})
+	}
+}
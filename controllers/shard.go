@@ -0,0 +1,37 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// ShardPredicate returns a predicate that only allows events for CPAs with labels matching the shard selector, so
+// the CPAs in a cluster can be split between multiple operator instances. A nil selector allows events for every CPA.
+func ShardPredicate(selector labels.Selector) predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return inShard(selector, obj)
+	})
+}
+
+// inShard returns if the labels of the CPA match the shard selector, every CPA is in the shard if there is no selector
+func inShard(selector labels.Selector, obj metav1.Object) bool {
+	return selector == nil || selector.Matches(labels.Set(obj.GetLabels()))
+}
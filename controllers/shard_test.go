@@ -0,0 +1,107 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestShardPredicate(t *testing.T) {
+	cpa := func(cpaLabels map[string]string) *custompodautoscalercomv1.CustomPodAutoscaler {
+		return &custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "test-namespace",
+				Labels:    cpaLabels,
+			},
+		}
+	}
+
+	var tests = []struct {
+		description string
+		expected    bool
+		selector    labels.Selector
+		eventFunc   func(selector labels.Selector) bool
+	}{
+		{
+			"No selector, create allowed",
+			true,
+			nil,
+			func(selector labels.Selector) bool {
+				return controllers.ShardPredicate(selector).Create(event.CreateEvent{
+					Object: cpa(nil),
+				})
+			},
+		},
+		{
+			"Create of CPA in shard, allowed",
+			true,
+			labels.SelectorFromSet(labels.Set{"shard": "a"}),
+			func(selector labels.Selector) bool {
+				return controllers.ShardPredicate(selector).Create(event.CreateEvent{
+					Object: cpa(map[string]string{"shard": "a"}),
+				})
+			},
+		},
+		{
+			"Create of CPA in another shard, ignored",
+			false,
+			labels.SelectorFromSet(labels.Set{"shard": "a"}),
+			func(selector labels.Selector) bool {
+				return controllers.ShardPredicate(selector).Create(event.CreateEvent{
+					Object: cpa(map[string]string{"shard": "b"}),
+				})
+			},
+		},
+		{
+			"Update moving CPA into shard, allowed",
+			true,
+			labels.SelectorFromSet(labels.Set{"shard": "a"}),
+			func(selector labels.Selector) bool {
+				return controllers.ShardPredicate(selector).Update(event.UpdateEvent{
+					ObjectOld: cpa(map[string]string{"shard": "b"}),
+					ObjectNew: cpa(map[string]string{"shard": "a"}),
+				})
+			},
+		},
+		{
+			"Delete of CPA in another shard, ignored",
+			false,
+			labels.SelectorFromSet(labels.Set{"shard": "a"}),
+			func(selector labels.Selector) bool {
+				return controllers.ShardPredicate(selector).Delete(event.DeleteEvent{
+					Object: cpa(map[string]string{"shard": "b"}),
+				})
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			result := test.eventFunc(test.selector)
+			if !cmp.Equal(test.expected, result) {
+				t.Errorf("Predicate mismatch (-want +got):\n%s", cmp.Diff(test.expected, result))
+			}
+		})
+	}
+}
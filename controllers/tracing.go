@@ -0,0 +1,99 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// TracerName is the name of the OpenTelemetry tracer used to trace reconciles
+const TracerName = "github.com/jthomperoo/custom-pod-autoscaler-operator"
+
+// Span attribute keys used when tracing reconciles
+const (
+	cpaNameAttribute      = attribute.Key("cpa.name")
+	cpaNamespaceAttribute = attribute.Key("cpa.namespace")
+	cpaActionAttribute    = attribute.Key("cpa.action")
+	cpaResultAttribute    = attribute.Key("cpa.result")
+	kindAttribute         = attribute.Key("k8s.kind")
+	nameAttribute         = attribute.Key("k8s.name")
+)
+
+// Reconcile actions recorded on the reconcile span
+const (
+	actionNotFound         = "not-found"
+	actionDeleting         = "deleting"
+	actionPause            = "pause"
+	actionProvision        = "provision"
+	actionMaintenance      = "maintenance"
+	actionUnchanged        = "unchanged"
+	actionOtherShard       = "other-shard"
+	actionParked           = "parked"
+	actionOtherEnvironment = "other-environment"
+)
+
+// SetupTracerProvider sets up an OpenTelemetry tracer provider that exports spans to the OTLP gRPC endpoint provided
+func SetupTracerProvider(ctx context.Context, endpoint string, insecure bool) (*sdktrace.TracerProvider, error) {
+	options := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(endpoint),
+	}
+	if insecure {
+		options = append(options, otlptracegrpc.WithInsecure())
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", "custom-pod-autoscaler-operator"),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	), nil
+}
+
+// tracer returns the tracer used by the reconciler, falling back to a no-op tracer if none is set
+func (r *CustomPodAutoscalerReconciler) tracer() trace.Tracer {
+	if r.Tracer == nil {
+		return noop.NewTracerProvider().Tracer(TracerName)
+	}
+	return r.Tracer
+}
+
+// endSpan records the error provided (if any) on the span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
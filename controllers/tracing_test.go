@@ -0,0 +1,263 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	scaleFake "k8s.io/client-go/scale/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestReconcileTracing(t *testing.T) {
+	type span struct {
+		Name       string
+		Attributes map[string]string
+	}
+
+	var tests = []struct {
+		description string
+		expected    []span
+		objs        []runtime.Object
+	}{
+		{
+			"CPA not found",
+			[]span{
+				{
+					Name: "Reconcile",
+					Attributes: map[string]string{
+						"cpa.name":      "test",
+						"cpa.namespace": "test-namespace",
+						"cpa.action":    "not-found",
+						"cpa.result":    "success",
+					},
+				},
+			},
+			nil,
+		},
+		{
+			"Provision CPA resources",
+			[]span{
+				{
+					Name: "ReconcileResource",
+					Attributes: map[string]string{
+						"k8s.kind": "v1/ServiceAccount",
+						"k8s.name": "test",
+					},
+				},
+				{
+					Name: "ReconcileResource",
+					Attributes: map[string]string{
+						"k8s.kind": "v1/Role",
+						"k8s.name": "test",
+					},
+				},
+				{
+					Name: "ReconcileResource",
+					Attributes: map[string]string{
+						"k8s.kind": "v1/RoleBinding",
+						"k8s.name": "test",
+					},
+				},
+				{
+					Name: "ReconcileResource",
+					Attributes: map[string]string{
+						"k8s.kind": "v1/Pod",
+						"k8s.name": "test",
+					},
+				},
+				{
+					Name: "GetScale",
+					Attributes: map[string]string{
+						"k8s.kind": "",
+						"k8s.name": "",
+					},
+				},
+				{
+					Name: "Reconcile",
+					Attributes: map[string]string{
+						"cpa.name":      "test",
+						"cpa.namespace": "test-namespace",
+						"cpa.action":    "provision",
+						"cpa.result":    "success",
+					},
+				},
+			},
+			[]runtime.Object{
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						Template: custompodautoscalercomv1.PodTemplateSpec{
+							Spec: custompodautoscalercomv1.PodSpec{
+								Containers: []corev1.Container{
+									{
+										Name: "test container",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			"Pause CPA",
+			[]span{
+				{
+					Name: "GetScale",
+					Attributes: map[string]string{
+						"k8s.kind": "Deployment",
+						"k8s.name": "test-deployment",
+					},
+				},
+				{
+					Name: "UpdateScale",
+					Attributes: map[string]string{
+						"k8s.kind": "Deployment",
+						"k8s.name": "test-deployment",
+					},
+				},
+				{
+					Name: "Reconcile",
+					Attributes: map[string]string{
+						"cpa.name":      "test",
+						"cpa.namespace": "test-namespace",
+						"cpa.action":    "pause",
+						"cpa.result":    "success",
+					},
+				},
+			},
+			[]runtime.Object{
+				&custompodautoscalercomv1.CustomPodAutoscaler{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test",
+						Namespace: "test-namespace",
+						Annotations: map[string]string{
+							controllers.PausedReplicasAnnotation: "5",
+						},
+					},
+					Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+						ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{
+							APIVersion: "apps/v1",
+							Kind:       "Deployment",
+							Name:       "test-deployment",
+						},
+					},
+				},
+				&appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "test-deployment",
+						Namespace: "test-namespace",
+					},
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+			reconciler := &controllers.CustomPodAutoscalerReconciler{
+				Client: fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+					s := runtime.NewScheme()
+					utilruntime.Must(clientgoscheme.AddToScheme(s))
+					s.AddKnownTypes(custompodautoscalercomv1.GroupVersion, &custompodautoscalercomv1.CustomPodAutoscaler{})
+					return s
+				}()).WithStatusSubresource(&custompodautoscalercomv1.CustomPodAutoscaler{}).WithRuntimeObjects(test.objs...).Build(),
+				Scheme: runtime.NewScheme(),
+				KubernetesResourceReconciler: &fakek8sReconciler{
+					reconcile: func(
+						reqLogger logr.Logger,
+						instance *custompodautoscalercomv1.CustomPodAutoscaler,
+						obj metav1.Object,
+						shouldProvision bool,
+						updatable bool,
+						kind string,
+					) (reconcile.Result, error) {
+						return reconcile.Result{}, nil
+					},
+					podCleanup: func(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+						return nil
+					},
+				},
+				ScalingClient: &scaleFake.FakeScaleClient{
+					Fake: k8stesting.Fake{
+						ReactionChain: []k8stesting.Reactor{
+							&k8stesting.SimpleReactor{
+								Resource: "*",
+								Verb:     "*",
+								Reaction: func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
+									return true, &autoscalingv1.Scale{}, nil
+								},
+							},
+						},
+					},
+				},
+				Log:    logr.Discard(),
+				Tracer: tracerProvider.Tracer(controllers.TracerName),
+			}
+
+			_, err := reconciler.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			spans := []span{}
+			for _, ended := range recorder.Ended() {
+				attributes := map[string]string{}
+				for _, attr := range ended.Attributes() {
+					attributes[string(attr.Key)] = attr.Value.Emit()
+				}
+				spans = append(spans, span{
+					Name:       ended.Name(),
+					Attributes: attributes,
+				})
+			}
+
+			if !cmp.Equal(test.expected, spans) {
+				t.Errorf("Spans mismatch (-want +got):\n%s", cmp.Diff(test.expected, spans))
+			}
+		})
+	}
+}
@@ -0,0 +1,396 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+)
+
+// +kubebuilder:webhook:path=/validate-custompodautoscaler-com-v1-custompodautoscaler,mutating=false,failurePolicy=ignore,sideEffects=None,groups=custompodautoscaler.com,resources=custompodautoscalers,verbs=create;update,versions=v1,name=vcustompodautoscaler.custompodautoscaler.com,admissionReviewVersions=v1
+
+// AllowDuplicateScaleTargetAnnotation allows a CustomPodAutoscaler to target the same resource as another
+// CustomPodAutoscaler in the namespace when set to "true"
+const AllowDuplicateScaleTargetAnnotation = "v1.custompodautoscaler.com/allow-duplicate-scale-target"
+
+// safeSysctls are the sysctls Kubernetes considers safe, allowed by the kubelet without any node configuration
+var safeSysctls = map[string]bool{
+	"kernel.shm_rmid_forced":              true,
+	"net.ipv4.ip_local_port_range":        true,
+	"net.ipv4.ip_local_reserved_ports":    true,
+	"net.ipv4.ip_unprivileged_port_start": true,
+	"net.ipv4.ping_group_range":           true,
+	"net.ipv4.tcp_syncookies":             true,
+	"net.ipv4.tcp_keepalive_time":         true,
+	"net.ipv4.tcp_fin_timeout":            true,
+	"net.ipv4.tcp_keepalive_intvl":        true,
+	"net.ipv4.tcp_keepalive_probes":       true,
+}
+
+// CustomPodAutoscalerValidator validates CustomPodAutoscalers on admission, warning about configuration that is allowed
+// but not recommended
+type CustomPodAutoscalerValidator struct {
+	// Client is used to list the CustomPodAutoscalers in the namespace to reject duplicate scale targets, if not set
+	// scale targets are not checked
+	Client client.Client
+	// RuntimeClassReader is used to check that the RuntimeClass of the CPA exists and that the Pod overhead matches
+	// it, if not set strict validation is disabled and the RuntimeClass is not checked
+	RuntimeClassReader client.Reader
+}
+
+// SetupWebhookWithManager registers the validating webhook with the Manager's webhook server
+func (v *CustomPodAutoscalerValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&custompodautoscalercomv1.CustomPodAutoscaler{}).
+		WithValidator(v).
+		Complete()
+}
+
+// ValidateCreate validates a CustomPodAutoscaler when it is created
+func (v *CustomPodAutoscalerValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	warnings, err := v.validate(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	instance := obj.(*custompodautoscalercomv1.CustomPodAutoscaler)
+	err = v.validateUniqueScaleTarget(ctx, instance)
+	if err != nil {
+		return nil, err
+	}
+
+	err = v.validateRuntimeClass(ctx, instance)
+	if err != nil {
+		return nil, err
+	}
+
+	return warnings, nil
+}
+
+// ValidateUpdate validates a CustomPodAutoscaler when it is updated
+func (v *CustomPodAutoscalerValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	warnings, err := v.validate(newObj)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only check the scale target if it has changed, so CPAs that already share a scale target can still be updated
+	oldInstance, ok := oldObj.(*custompodautoscalercomv1.CustomPodAutoscaler)
+	if !ok {
+		return nil, fmt.Errorf("expected a CustomPodAutoscaler but got %T", oldObj)
+	}
+	instance := newObj.(*custompodautoscalercomv1.CustomPodAutoscaler)
+	if oldInstance.Spec.ScaleTargetRef != instance.Spec.ScaleTargetRef {
+		err = v.validateUniqueScaleTarget(ctx, instance)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Only check the RuntimeClass if it or the overhead has changed, so CPAs are not blocked from being updated by
+	// a RuntimeClass being removed after they were created
+	oldRuntimeClassName, oldOverhead := podRuntimeClass(oldInstance)
+	runtimeClassName, overhead := podRuntimeClass(instance)
+	if !apiequality.Semantic.DeepEqual(oldRuntimeClassName, runtimeClassName) ||
+		!apiequality.Semantic.DeepEqual(oldOverhead, overhead) {
+		err = v.validateRuntimeClass(ctx, instance)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return warnings, nil
+}
+
+// ValidateDelete allows all CustomPodAutoscaler deletions
+func (v *CustomPodAutoscalerValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *CustomPodAutoscalerValidator) validate(obj runtime.Object) (admission.Warnings, error) {
+	instance, ok := obj.(*custompodautoscalercomv1.CustomPodAutoscaler)
+	if !ok {
+		return nil, fmt.Errorf("expected a CustomPodAutoscaler but got %T", obj)
+	}
+
+	_, err := ParseFeatureGates(instance.GetAnnotations()[FeatureGatesAnnotation])
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateRoleBindingSubjects(instance.Spec.AdditionalRoleBindingSubjects)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the plan from a copy, as building the plan applies defaults to the spec
+	plan, err := newProvisioningPlan(instance.DeepCopy())
+	if err != nil {
+		// Invalid provisioning options are reported when the CPA is reconciled
+		return nil, nil
+	}
+
+	warnings := admission.Warnings{}
+	warnings = append(warnings, wildcardRBACWarnings(plan)...)
+	warnings = append(warnings, hostNamespaceWarnings(plan)...)
+	warnings = append(warnings, unsafeSysctlWarnings(plan)...)
+	warnings = append(warnings, shareProcessNamespaceWarnings(plan)...)
+
+	return warnings, nil
+}
+
+// validateUniqueScaleTarget rejects the CPA if another CPA in the namespace has the same scale target, as the CPAs
+// would fight over the replica count of the target, unless the CPA allows duplicate scale targets
+func (v *CustomPodAutoscalerValidator) validateUniqueScaleTarget(ctx context.Context, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+	if v.Client == nil || instance.Spec.ScaleTargetRef.Name == "" {
+		return nil
+	}
+
+	if instance.GetAnnotations()[AllowDuplicateScaleTargetAnnotation] == "true" {
+		return nil
+	}
+
+	cpas := &custompodautoscalercomv1.CustomPodAutoscalerList{}
+	err := v.Client.List(ctx, cpas, client.InNamespace(instance.Namespace))
+	if err != nil {
+		return fmt.Errorf("failed to list CustomPodAutoscalers to check for duplicate scale targets: %w", err)
+	}
+
+	for _, cpa := range cpas.Items {
+		if cpa.Name == instance.Name || cpa.DeletionTimestamp != nil {
+			continue
+		}
+		if !sameScaleTarget(cpa.Spec.ScaleTargetRef, instance.Spec.ScaleTargetRef) {
+			continue
+		}
+		return fmt.Errorf("scaleTargetRef %s %s is already targeted by CustomPodAutoscaler %s, set the %s annotation "+
+			"to \"true\" to allow this", instance.Spec.ScaleTargetRef.Kind, instance.Spec.ScaleTargetRef.Name, cpa.Name,
+			AllowDuplicateScaleTargetAnnotation)
+	}
+
+	return nil
+}
+
+// validateRuntimeClass rejects the CPA if the RuntimeClass its Pod runs under does not exist, or if the Pod overhead
+// set does not match the overhead of the RuntimeClass, as the Pod would be rejected when it is provisioned
+func (v *CustomPodAutoscalerValidator) validateRuntimeClass(ctx context.Context, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
+	if v.RuntimeClassReader == nil {
+		return nil
+	}
+
+	runtimeClassName, overhead := podRuntimeClass(instance)
+	if runtimeClassName == nil || *runtimeClassName == "" {
+		return nil
+	}
+
+	runtimeClass := &nodev1.RuntimeClass{}
+	err := v.RuntimeClassReader.Get(ctx, client.ObjectKey{Name: *runtimeClassName}, runtimeClass)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return fmt.Errorf("runtimeClassName %s does not exist", *runtimeClassName)
+		}
+		return fmt.Errorf("failed to get RuntimeClass %s: %w", *runtimeClassName, err)
+	}
+
+	if overhead == nil || runtimeClass.Overhead == nil || runtimeClass.Overhead.PodFixed == nil {
+		return nil
+	}
+
+	if !apiequality.Semantic.DeepEqual(overhead, runtimeClass.Overhead.PodFixed) {
+		return fmt.Errorf("overhead %s does not match the overhead %s of RuntimeClass %s", formatResourceList(overhead),
+			formatResourceList(runtimeClass.Overhead.PodFixed), *runtimeClassName)
+	}
+
+	return nil
+}
+
+// podRuntimeClass returns the RuntimeClass name and overhead the Pod of the CPA is provisioned with, values set in the
+// Pod template take precedence over the CPA spec
+func podRuntimeClass(instance *custompodautoscalercomv1.CustomPodAutoscaler) (*string, corev1.ResourceList) {
+	runtimeClassName := instance.Spec.RuntimeClassName
+	overhead := instance.Spec.Overhead
+	if instance.Spec.Template.Spec.RuntimeClassName != nil {
+		runtimeClassName = instance.Spec.Template.Spec.RuntimeClassName
+	}
+	if instance.Spec.Template.Spec.Overhead != nil {
+		overhead = instance.Spec.Template.Spec.Overhead
+	}
+	return runtimeClassName, overhead
+}
+
+// formatResourceList formats resources as a comma separated list of name=quantity sorted by name
+func formatResourceList(resources corev1.ResourceList) string {
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	formatted := make([]string, 0, len(names))
+	for _, name := range names {
+		quantity := resources[corev1.ResourceName(name)]
+		formatted = append(formatted, fmt.Sprintf("%s=%s", name, quantity.String()))
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// sameScaleTarget returns if both references refer to the same resource, ignoring the API version so references to
+// different versions of the same group match
+func sameScaleTarget(a, b autoscalingv1.CrossVersionObjectReference) bool {
+	aGV, err := schema.ParseGroupVersion(a.APIVersion)
+	if err != nil {
+		return false
+	}
+	bGV, err := schema.ParseGroupVersion(b.APIVersion)
+	if err != nil {
+		return false
+	}
+	return aGV.Group == bGV.Group && a.Kind == b.Kind && a.Name == b.Name
+}
+
+// wildcardRBACWarnings warns if the Role the operator would provision grants wildcard verbs or resources
+func wildcardRBACWarnings(plan *ProvisioningPlan) admission.Warnings {
+	if !plan.ProvisionRole || plan.Role == nil {
+		return nil
+	}
+
+	wildcardResources := []string{}
+	for _, rule := range plan.Role.Rules {
+		if !containsWildcard(rule.Verbs) && !containsWildcard(rule.Resources) {
+			continue
+		}
+		wildcardResources = append(wildcardResources, qualifiedResources(rule)...)
+	}
+
+	if len(wildcardResources) == 0 {
+		return nil
+	}
+
+	return admission.Warnings{
+		fmt.Sprintf("the provisioned Role grants wildcard access to %s, to follow least privilege set provisionRole "+
+			"to false and bind a Role with scoped rules to the autoscaler ServiceAccount",
+			strings.Join(wildcardResources, ", ")),
+	}
+}
+
+// hostNamespaceWarnings warns if the Pod the operator would provision uses any host namespaces, as this gives the
+// autoscaler privileged access to the node
+func hostNamespaceWarnings(plan *ProvisioningPlan) admission.Warnings {
+	if plan.Pod == nil {
+		return nil
+	}
+
+	namespaces := []string{}
+	if plan.Pod.Spec.HostNetwork {
+		namespaces = append(namespaces, "hostNetwork")
+	}
+	if plan.Pod.Spec.HostPID {
+		namespaces = append(namespaces, "hostPID")
+	}
+	if plan.Pod.Spec.HostIPC {
+		namespaces = append(namespaces, "hostIPC")
+	}
+
+	if len(namespaces) == 0 {
+		return nil
+	}
+
+	return admission.Warnings{
+		fmt.Sprintf("the provisioned Pod uses %s, giving the autoscaler privileged access to the node",
+			strings.Join(namespaces, ", ")),
+	}
+}
+
+// unsafeSysctlWarnings warns if the Pod the operator would provision sets sysctls that are not in the Kubernetes safe
+// set, as the Pod is rejected by the kubelet unless the node is configured to allow them
+func unsafeSysctlWarnings(plan *ProvisioningPlan) admission.Warnings {
+	if plan.Pod == nil || plan.Pod.Spec.SecurityContext == nil {
+		return nil
+	}
+
+	unsafe := []string{}
+	for _, sysctl := range plan.Pod.Spec.SecurityContext.Sysctls {
+		// Sysctl names can be separated by slashes in place of dots
+		if !safeSysctls[strings.ReplaceAll(sysctl.Name, "/", ".")] {
+			unsafe = append(unsafe, sysctl.Name)
+		}
+	}
+
+	if len(unsafe) == 0 {
+		return nil
+	}
+
+	return admission.Warnings{
+		fmt.Sprintf("the provisioned Pod sets unsafe sysctls %s, the Pod is only started on nodes with the kubelet "+
+			"configured to allow them using --allowed-unsafe-sysctls", strings.Join(unsafe, ", ")),
+	}
+}
+
+// containsWildcard returns if any of the values are the RBAC wildcard
+func containsWildcard(values []string) bool {
+	for _, value := range values {
+		if value == rbacv1.ResourceAll {
+			return true
+		}
+	}
+	return false
+}
+
+// qualifiedResources returns the resources of the rule qualified with each API group of the rule, for example
+// deployments.apps
+func qualifiedResources(rule rbacv1.PolicyRule) []string {
+	resources := []string{}
+	for _, group := range rule.APIGroups {
+		for _, resource := range rule.Resources {
+			if group == "" {
+				resources = append(resources, resource)
+				continue
+			}
+			resources = append(resources, resource+"."+group)
+		}
+	}
+	return resources
+}
+
+// shareProcessNamespaceWarnings warns if the Pod the operator would provision shares a process namespace between its
+// containers, as every container can then see and signal the processes of the others and read their filesystems
+func shareProcessNamespaceWarnings(plan *ProvisioningPlan) admission.Warnings {
+	if plan.Pod == nil || plan.Pod.Spec.ShareProcessNamespace == nil || !*plan.Pod.Spec.ShareProcessNamespace {
+		return nil
+	}
+
+	return admission.Warnings{
+		"the provisioned Pod uses shareProcessNamespace, every container can see and signal the processes of the " +
+			"other containers and read their filesystems through /proc",
+	}
+}
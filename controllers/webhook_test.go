@@ -0,0 +1,480 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestCustomPodAutoscalerValidator(t *testing.T) {
+	var tests = []struct {
+		description string
+		expected    admission.Warnings
+		spec        custompodautoscalercomv1.CustomPodAutoscalerSpec
+	}{
+		{
+			"Default provisioned Role, warn on wildcard rules",
+			admission.Warnings{
+				"the provisioned Role grants wildcard access to pods, replicationcontrollers, " +
+					"replicationcontrollers/scale, deployments.apps, deployments/scale.apps, replicasets.apps, " +
+					"replicasets/scale.apps, statefulsets.apps, statefulsets/scale.apps, to follow least privilege set " +
+					"provisionRole to false and bind a Role with scoped rules to the autoscaler ServiceAccount",
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{},
+		},
+		{
+			"Provisioned Role with metrics server access, warn on wildcard rules",
+			admission.Warnings{
+				"the provisioned Role grants wildcard access to pods, replicationcontrollers, " +
+					"replicationcontrollers/scale, deployments.apps, deployments/scale.apps, replicasets.apps, " +
+					"replicasets/scale.apps, statefulsets.apps, statefulsets/scale.apps, *.metrics.k8s.io, " +
+					"*.custom.metrics.k8s.io, *.external.metrics.k8s.io, to follow least privilege set provisionRole " +
+					"to false and bind a Role with scoped rules to the autoscaler ServiceAccount",
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				RoleRequiresMetricsServer: boolPtr(true),
+				MetricsRBACMode:           custompodautoscalercomv1.MetricsRBACModeReadOnly,
+			},
+		},
+		{
+			"Role not provisioned, no warnings",
+			admission.Warnings{},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				ProvisionRole: boolPtr(false),
+			},
+		},
+		{
+			"ServiceAccount not provisioned, no Role provisioned, no warnings",
+			admission.Warnings{},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				ProvisionServiceAccount: boolPtr(false),
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						ServiceAccountName: "test-service-account",
+					},
+				},
+			},
+		},
+		{
+			"Host namespaces enabled, warn on privileged access",
+			admission.Warnings{
+				"the provisioned Pod uses hostNetwork, hostPID, hostIPC, giving the autoscaler privileged access to " +
+					"the node",
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				ProvisionRole: boolPtr(false),
+				HostNetwork:   true,
+				HostPID:       true,
+				HostIPC:       true,
+			},
+		},
+		{
+			"Host network enabled in template, warn on privileged access",
+			admission.Warnings{
+				"the provisioned Pod uses hostNetwork, giving the autoscaler privileged access to the node",
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				ProvisionRole: boolPtr(false),
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						HostNetwork: true,
+					},
+				},
+			},
+		},
+		{
+			"Safe sysctls, no warnings",
+			admission.Warnings{},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				ProvisionRole: boolPtr(false),
+				Sysctls: []corev1.Sysctl{
+					{
+						Name:  "net.ipv4.ip_local_port_range",
+						Value: "1024 65535",
+					},
+					{
+						Name:  "net/ipv4/tcp_keepalive_time",
+						Value: "600",
+					},
+				},
+			},
+		},
+		{
+			"Unsafe sysctls, warn on node configuration required",
+			admission.Warnings{
+				"the provisioned Pod sets unsafe sysctls net.core.somaxconn, net.ipv4.tcp_max_syn_backlog, the Pod is " +
+					"only started on nodes with the kubelet configured to allow them using --allowed-unsafe-sysctls",
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				ProvisionRole: boolPtr(false),
+				Sysctls: []corev1.Sysctl{
+					{
+						Name:  "net.ipv4.tcp_syncookies",
+						Value: "1",
+					},
+					{
+						Name:  "net.core.somaxconn",
+						Value: "1024",
+					},
+					{
+						Name:  "net.ipv4.tcp_max_syn_backlog",
+						Value: "4096",
+					},
+				},
+			},
+		},
+		{
+			"Unsafe sysctls set in template, warn on node configuration required",
+			admission.Warnings{
+				"the provisioned Pod sets unsafe sysctls net.core.somaxconn, the Pod is only started on nodes with the " +
+					"kubelet configured to allow them using --allowed-unsafe-sysctls",
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				ProvisionRole: boolPtr(false),
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						SecurityContext: &corev1.PodSecurityContext{
+							Sysctls: []corev1.Sysctl{
+								{
+									Name:  "net.core.somaxconn",
+									Value: "1024",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			"Process namespace shared, warn on containers seeing each other's processes",
+			admission.Warnings{
+				"the provisioned Pod uses shareProcessNamespace, every container can see and signal the processes of " +
+					"the other containers and read their filesystems through /proc",
+			},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				ProvisionRole:         boolPtr(false),
+				ShareProcessNamespace: true,
+			},
+		},
+		{
+			"Process namespace sharing disabled in template, no warnings",
+			admission.Warnings{},
+			custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				ProvisionRole: boolPtr(false),
+				Template: custompodautoscalercomv1.PodTemplateSpec{
+					Spec: custompodautoscalercomv1.PodSpec{
+						ShareProcessNamespace: boolPtr(false),
+					},
+				},
+				ShareProcessNamespace: true,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			validator := &controllers.CustomPodAutoscalerValidator{}
+			cpa := &custompodautoscalercomv1.CustomPodAutoscaler{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test-namespace",
+				},
+				Spec: test.spec,
+			}
+
+			createWarnings, err := validator.ValidateCreate(context.Background(), cpa)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !cmp.Equal(test.expected, createWarnings) {
+				t.Errorf("Create warnings mismatch (-want +got):\n%s", cmp.Diff(test.expected, createWarnings))
+			}
+
+			updateWarnings, err := validator.ValidateUpdate(context.Background(), cpa.DeepCopy(), cpa)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !cmp.Equal(test.expected, updateWarnings) {
+				t.Errorf("Update warnings mismatch (-want +got):\n%s", cmp.Diff(test.expected, updateWarnings))
+			}
+
+			if cpa.Spec.ProvisionPod != nil {
+				t.Errorf("Validating the CPA applied defaults to the spec")
+			}
+		})
+	}
+}
+
+func TestCustomPodAutoscalerValidatorUniqueScaleTarget(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+
+	cpa := func(name string, annotations map[string]string, scaleTargetRef autoscalingv1.CrossVersionObjectReference) *custompodautoscalercomv1.CustomPodAutoscaler {
+		return &custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "test-namespace",
+				Annotations: annotations,
+			},
+			Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				ScaleTargetRef: scaleTargetRef,
+				ProvisionRole:  boolPtr(false),
+			},
+		}
+	}
+
+	deployment := autoscalingv1.CrossVersionObjectReference{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Name:       "test-deployment",
+	}
+
+	var tests = []struct {
+		description string
+		expectedErr string
+		old         *custompodautoscalercomv1.CustomPodAutoscaler
+		cpa         *custompodautoscalercomv1.CustomPodAutoscaler
+	}{
+		{
+			"Create with unique scale target, allow",
+			"",
+			nil,
+			cpa("test", nil, autoscalingv1.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       "other-deployment",
+			}),
+		},
+		{
+			"Create with duplicate scale target, reject",
+			`scaleTargetRef Deployment test-deployment is already targeted by CustomPodAutoscaler existing, set the ` +
+				`v1.custompodautoscaler.com/allow-duplicate-scale-target annotation to "true" to allow this`,
+			nil,
+			cpa("test", nil, deployment),
+		},
+		{
+			"Create with duplicate scale target using a different API version, reject",
+			`scaleTargetRef Deployment test-deployment is already targeted by CustomPodAutoscaler existing, set the ` +
+				`v1.custompodautoscaler.com/allow-duplicate-scale-target annotation to "true" to allow this`,
+			nil,
+			cpa("test", nil, autoscalingv1.CrossVersionObjectReference{
+				APIVersion: "apps/v1beta2",
+				Kind:       "Deployment",
+				Name:       "test-deployment",
+			}),
+		},
+		{
+			"Create with duplicate scale target and override annotation, allow",
+			"",
+			nil,
+			cpa("test", map[string]string{
+				controllers.AllowDuplicateScaleTargetAnnotation: "true",
+			}, deployment),
+		},
+		{
+			"Update existing CPA without changes, allow",
+			"",
+			cpa("existing", nil, deployment),
+			cpa("existing", nil, deployment),
+		},
+		{
+			"Update scale target to duplicate scale target, reject",
+			`scaleTargetRef Deployment test-deployment is already targeted by CustomPodAutoscaler existing, set the ` +
+				`v1.custompodautoscaler.com/allow-duplicate-scale-target annotation to "true" to allow this`,
+			cpa("test", nil, autoscalingv1.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       "other-deployment",
+			}),
+			cpa("test", nil, deployment),
+		},
+		{
+			"Update already duplicate CPA without changing scale target, allow",
+			"",
+			cpa("test", map[string]string{
+				controllers.AllowDuplicateScaleTargetAnnotation: "true",
+			}, deployment),
+			cpa("test", nil, deployment),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			validator := &controllers.CustomPodAutoscalerValidator{
+				Client: fake.NewClientBuilder().
+					WithScheme(scheme).
+					WithObjects(cpa("existing", nil, deployment)).
+					Build(),
+			}
+
+			var err error
+			if test.old == nil {
+				_, err = validator.ValidateCreate(context.Background(), test.cpa)
+			} else {
+				_, err = validator.ValidateUpdate(context.Background(), test.old, test.cpa)
+			}
+			errMessage := ""
+			if err != nil {
+				errMessage = err.Error()
+			}
+			if !cmp.Equal(test.expectedErr, errMessage) {
+				t.Errorf("Error mismatch (-want +got):\n%s", cmp.Diff(test.expectedErr, errMessage))
+			}
+		})
+	}
+}
+
+func TestCustomPodAutoscalerValidatorRuntimeClass(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(custompodautoscalercomv1.AddToScheme(scheme))
+	utilruntime.Must(nodev1.AddToScheme(scheme))
+
+	cpa := func(runtimeClassName *string, overhead corev1.ResourceList) *custompodautoscalercomv1.CustomPodAutoscaler {
+		return &custompodautoscalercomv1.CustomPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test",
+				Namespace: "test-namespace",
+			},
+			Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+				ProvisionRole:    boolPtr(false),
+				RuntimeClassName: runtimeClassName,
+				Overhead:         overhead,
+			},
+		}
+	}
+
+	gvisor := "gvisor"
+	missing := "missing"
+
+	var tests = []struct {
+		description string
+		expectedErr string
+		strict      bool
+		old         *custompodautoscalercomv1.CustomPodAutoscaler
+		cpa         *custompodautoscalercomv1.CustomPodAutoscaler
+	}{
+		{
+			"Strict validation disabled, missing runtime class, allow",
+			"",
+			false,
+			nil,
+			cpa(&missing, nil),
+		},
+		{
+			"No runtime class, allow",
+			"",
+			true,
+			nil,
+			cpa(nil, nil),
+		},
+		{
+			"Existing runtime class, allow",
+			"",
+			true,
+			nil,
+			cpa(&gvisor, nil),
+		},
+		{
+			"Missing runtime class, reject",
+			"runtimeClassName missing does not exist",
+			true,
+			nil,
+			cpa(&missing, nil),
+		},
+		{
+			"Overhead matches runtime class, allow",
+			"",
+			true,
+			nil,
+			cpa(&gvisor, corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("250m"),
+				corev1.ResourceMemory: resource.MustParse("120Mi"),
+			}),
+		},
+		{
+			"Overhead does not match runtime class, reject",
+			"overhead cpu=100m does not match the overhead cpu=250m, memory=120Mi of RuntimeClass gvisor",
+			true,
+			nil,
+			cpa(&gvisor, corev1.ResourceList{
+				corev1.ResourceCPU: resource.MustParse("100m"),
+			}),
+		},
+		{
+			"Update without changing missing runtime class, allow",
+			"",
+			true,
+			cpa(&missing, nil),
+			cpa(&missing, nil),
+		},
+		{
+			"Update to missing runtime class, reject",
+			"runtimeClassName missing does not exist",
+			true,
+			cpa(&gvisor, nil),
+			cpa(&missing, nil),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			validator := &controllers.CustomPodAutoscalerValidator{}
+			if test.strict {
+				validator.RuntimeClassReader = fake.NewClientBuilder().
+					WithScheme(scheme).
+					WithObjects(&nodev1.RuntimeClass{
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "gvisor",
+						},
+						Handler: "runsc",
+						Overhead: &nodev1.Overhead{
+							PodFixed: corev1.ResourceList{
+								corev1.ResourceCPU:    resource.MustParse("250m"),
+								corev1.ResourceMemory: resource.MustParse("120Mi"),
+							},
+						},
+					}).
+					Build()
+			}
+
+			var err error
+			if test.old == nil {
+				_, err = validator.ValidateCreate(context.Background(), test.cpa)
+			} else {
+				_, err = validator.ValidateUpdate(context.Background(), test.old, test.cpa)
+			}
+			errMessage := ""
+			if err != nil {
+				errMessage = err.Error()
+			}
+			if !cmp.Equal(test.expectedErr, errMessage) {
+				t.Errorf("Error mismatch (-want +got):\n%s", cmp.Diff(test.expectedErr, errMessage))
+			}
+		})
+	}
+}
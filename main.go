@@ -17,19 +17,35 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/discovery"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	"go.opentelemetry.io/otel"
 
 	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/audit"
 	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
 	"github.com/jthomperoo/custom-pod-autoscaler-operator/reconcile"
 	// +kubebuilder:scaffold:imports
@@ -50,10 +66,182 @@ func init() {
 }
 
 func main() {
+	var probeAddr string
+	var enableDebugEndpoints bool
+	var fieldManager string
+	var otelEndpoint string
+	var otelInsecure bool
+	var requiredLabels string
+	var allowedImageRegistries string
+	var defaultAnnotations string
+	var enableWebhooks bool
+	var webhookCertDir string
+	var webhookStrictValidation bool
+	var maintenanceWindowSchedule string
+	var maintenanceWindowDuration time.Duration
+	var auditLogPath string
+	var serverSideApply bool
+	var forceOwnership bool
+	var envVarsSizeThreshold int
+	var fullReconcileInterval time.Duration
+	var environment string
+	var reconcileLogLines int
+	var shardSelector string
+	var httpProxy string
+	var httpsProxy string
+	var noProxy string
+	var maxReconcileFailures int
+	var checkResourceQuota bool
+	var scaleTargetRoleRules bool
+	var kubeAPIQPS float64
+	var kubeAPIBurst int
+	var namespaceSecurityProfiles string
+	var environmentFilter string
+	var rbacPropagationDelay time.Duration
+	var debugContainerImage string
+	var podDiscoveryLabels string
+	var metricLabels string
+	var resourceCeiling string
+	var resourceCeilingMode string
+	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the health and readiness probe endpoints bind to.")
+	flag.BoolVar(&enableDebugEndpoints, "enable-debug-endpoints", false,
+		"Serve debug endpoints on the metrics server, such as "+controllers.DebugCPAPath+"{namespace}/{name}. "+
+			"These expose CustomPodAutoscaler configuration so should only be enabled while debugging.")
+	flag.StringVar(&fieldManager, "field-manager", "custom-pod-autoscaler-operator",
+		"The field manager name used when creating and updating resources, changes made by the operator are "+
+			"attributed to this name in the managed fields of the resources.")
+	flag.StringVar(&otelEndpoint, "otel-endpoint", "",
+		"The OTLP gRPC endpoint (host:port) to export reconcile traces to using OpenTelemetry, tracing is disabled "+
+			"if not set.")
+	flag.BoolVar(&otelInsecure, "otel-insecure", false, "Disable TLS when exporting traces to the OTLP endpoint.")
+	flag.StringVar(&requiredLabels, "required-labels", "",
+		"Comma separated list of label keys every CustomPodAutoscaler must have before it is provisioned, the "+
+			"label values are copied onto all provisioned resources.")
+	flag.StringVar(&allowedImageRegistries, "allowed-image-registries", "",
+		"Comma separated list of registries (for example docker.io,ghcr.io) that CustomPodAutoscaler images must be "+
+			"pulled from, CustomPodAutoscalers using images from other registries are not provisioned. Images "+
+			"from any registry are allowed if not set.")
+	flag.StringVar(&defaultAnnotations, "default-annotations", "",
+		"Comma separated list of key=value annotations added to all provisioned resources, annotations set in the "+
+			"CustomPodAutoscaler Pod template take precedence.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Serve the CustomPodAutoscaler validating webhook, requires a serving certificate in the webhook cert dir.")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "",
+		"The directory containing the webhook serving certificate (tls.crt and tls.key), defaults to "+
+			"<temp-dir>/k8s-webhook-server/serving-certs.")
+	flag.BoolVar(&webhookStrictValidation, "webhook-strict-validation", false,
+		"Reject CustomPodAutoscalers in the validating webhook if their runtimeClassName does not exist or their "+
+			"overhead does not match the RuntimeClass, requires permission to get RuntimeClasses.")
+	flag.StringVar(&maintenanceWindowSchedule, "maintenance-window-schedule", "",
+		"Cron expression (for example \"0 22 * * 5\") for when a maintenance window opens, during the window "+
+			"provisioning changes are deferred until the window closes. Disabled if not set.")
+	flag.DurationVar(&maintenanceWindowDuration, "maintenance-window-duration", time.Hour,
+		"How long each maintenance window stays open for.")
+	flag.StringVar(&auditLogPath, "audit-log", "",
+		"File to write JSON audit records of the changes made by the operator to, set to - to write to stdout. "+
+			"Disabled if not set.")
+	flag.BoolVar(&serverSideApply, "server-side-apply", false,
+		"Provision resources other than the Pod using server-side apply with the field manager, leaving fields "+
+			"managed by other field managers unchanged.")
+	flag.BoolVar(&forceOwnership, "force-ownership", false,
+		"Take ownership of fields managed by other field managers when using server-side apply, if not set "+
+			"conflicts are reported as reconcile errors.")
+	flag.IntVar(&envVarsSizeThreshold, "env-vars-size-threshold", 32768,
+		"Size in bytes above which the environment variables of a provisioned container are reported as too large "+
+			"with the LargeEnvVars condition and a warning event, set to 0 to disable.")
+	flag.DurationVar(&fullReconcileInterval, "full-reconcile-interval", 0,
+		"Interval between full reconciles of a CPA's provisioned resources, between full reconciles resources are "+
+			"skipped if they are unchanged and the Pod is ready. If not set all resources are always reconciled.")
+	flag.StringVar(&environment, "environment", "",
+		"The environment the operator is running in (for example \"staging\"), the configOverlays entry of each "+
+			"CustomPodAutoscaler for this environment is merged onto its config. No overlay is applied if not set.")
+	flag.IntVar(&reconcileLogLines, "reconcile-log-lines", 0,
+		"Number of recent reconcile log lines captured in memory for each CustomPodAutoscaler, served at "+
+			controllers.DebugCPAPath+"{namespace}/{name}/logs. Requires --enable-debug-endpoints, disabled if 0.")
+	flag.StringVar(&shardSelector, "shard-selector", "",
+		"Label selector (for example \"shard=a\") limiting the CustomPodAutoscalers reconciled by this operator "+
+			"instance to those with matching labels, allowing CustomPodAutoscalers to be split between multiple "+
+			"operator instances. Every CustomPodAutoscaler is reconciled if not set.")
+	flag.StringVar(&httpProxy, "http-proxy", "",
+		"Proxy injected into every provisioned autoscaler container as the HTTP_PROXY environment variable, "+
+			"CustomPodAutoscalers can override it with an HTTP_PROXY config option. Not injected if not set.")
+	flag.StringVar(&httpsProxy, "https-proxy", "",
+		"Proxy injected into every provisioned autoscaler container as the HTTPS_PROXY environment variable, "+
+			"CustomPodAutoscalers can override it with an HTTPS_PROXY config option. Not injected if not set.")
+	flag.StringVar(&noProxy, "no-proxy", "",
+		"Comma separated hosts injected into every provisioned autoscaler container as the NO_PROXY environment "+
+			"variable, CustomPodAutoscalers can override it with a NO_PROXY config option. Not injected if not set.")
+	flag.IntVar(&maxReconcileFailures, "max-reconcile-failures", 0,
+		"Number of consecutive failed reconciles after which a CustomPodAutoscaler is parked, a parked "+
+			"CustomPodAutoscaler is not retried until its spec changes. CustomPodAutoscalers are never parked if 0.")
+	flag.BoolVar(&checkResourceQuota, "check-resource-quota", false,
+		"Check the ResourceQuotas of the namespace before creating the autoscaler Pod, if creating the Pod would "+
+			"exceed a quota the Pod is not created and the QuotaExceeded condition is set on the CustomPodAutoscaler.")
+	flag.BoolVar(&scaleTargetRoleRules, "scale-target-role-rules", false,
+		"Add rules to the Role provisioned for a CustomPodAutoscaler granting access to its scale target and the "+
+			"scale subresource, if the default Role does not already allow it, for example for scale targets in other "+
+			"API groups such as Knative Services.")
+	flag.Float64Var(&kubeAPIQPS, "kube-api-qps", 0,
+		"Maximum queries per second from the operator to the Kubernetes API, used by both the manager client and the "+
+			"scaling client. Uses the client defaults if 0.")
+	flag.IntVar(&kubeAPIBurst, "kube-api-burst", 0,
+		"Maximum burst of queries from the operator to the Kubernetes API above the QPS, used by both the manager "+
+			"client and the scaling client. Uses the client defaults if 0.")
+	flag.StringVar(&namespaceSecurityProfiles, "namespace-security-profiles", "",
+		"Semicolon separated list of namespace label selectors mapped to the securityContext profile (baseline or "+
+			"restricted) applied by default to autoscaler Pods in matching namespaces, in the form selector:profile, "+
+			"for example 'kubernetes.io/metadata.name=team-a:restricted'. The first matching selector is used.")
+	flag.StringVar(&environmentFilter, "environment-filter", "",
+		"Only reconcile CustomPodAutoscalers with the v1.custompodautoscaler.com/environment annotation set to this "+
+			"value, allowing operators for different environments to share a cluster. Every CustomPodAutoscaler is "+
+			"reconciled if not set.")
+	flag.DurationVar(&rbacPropagationDelay, "rbac-propagation-delay", 0,
+		"How long to wait after creating the RBAC resources of a CustomPodAutoscaler before creating its Pod, for "+
+			"clusters where RBAC changes take time to propagate. The Pod is created without waiting if zero.")
+	flag.StringVar(&debugContainerImage, "debug-container-image", "",
+		"Image of the ephemeral debug container attached to the autoscaler Pod when the "+controllers.DebugAnnotation+
+			" annotation of a CustomPodAutoscaler changes. Debug containers run with the permissions of the autoscaler "+
+			"Pod so should only be enabled while debugging, debug requests are ignored if not set.")
+	flag.StringVar(&podDiscoveryLabels, "pod-discovery-labels", "",
+		"Comma separated list of key=value labels added to every provisioned autoscaler Pod, for example "+
+			"autoscaling.custompodautoscaler.com/role=autoscaler, so dashboards and service discovery can select "+
+			"autoscaler Pods across CustomPodAutoscalers. These take precedence over labels set in the "+
+			"CustomPodAutoscaler Pod template.")
+	flag.StringVar(&metricLabels, "metric-labels", "",
+		"Comma separated list of CustomPodAutoscaler label keys, for example team, whose values are added as labels to "+
+			"the cpa_by_target_kind_total metric. Only the listed keys are added, limiting the cardinality of the "+
+			"metric. Reconciles are only labelled by the kind of the scale target if not set.")
+	flag.StringVar(&resourceCeiling, "resource-ceiling", "",
+		"Comma separated list of the maximum resources the autoscaler container of a CustomPodAutoscaler may request "+
+			"or be limited to, in the form resource=quantity, for example cpu=1,memory=1Gi. Resources are not limited if "+
+			"not set.")
+	flag.StringVar(&resourceCeilingMode, "resource-ceiling-mode", string(controllers.ResourceCeilingModeClamp),
+		"How autoscaler containers with resources above the --resource-ceiling are handled, one of clamp (lower the "+
+			"resources to the ceiling) or reject (do not provision the Pod, reported with the ResourcesAboveCeiling "+
+			"condition).")
+	flag.Parse()
+
 	namespace := os.Getenv(watchNamespaceEnvVar)
 
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
 
+	ctx := ctrl.SetupSignalHandler()
+
+	if otelEndpoint != "" {
+		setupLog.Info("tracing enabled", "endpoint", otelEndpoint)
+		tracerProvider, err := controllers.SetupTracerProvider(ctx, otelEndpoint, otelInsecure)
+		if err != nil {
+			setupLog.Error(err, "unable to set up tracing")
+			os.Exit(1)
+		}
+		defer func() {
+			if err := tracerProvider.Shutdown(context.Background()); err != nil {
+				setupLog.Error(err, "problem shutting down tracing")
+			}
+		}()
+		otel.SetTracerProvider(tracerProvider)
+	}
+
 	var namespacedCache = cache.Options{}
 	if namespace != "" {
 		namespacedCache.DefaultNamespaces = map[string]cache.Config{
@@ -61,12 +249,58 @@ func main() {
 		}
 	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme: scheme,
-		Metrics: server.Options{
-			BindAddress: ":8000",
-		},
-		Cache: namespacedCache,
+	metricsOptions := server.Options{
+		BindAddress: ":8000",
+	}
+
+	debugHandler := &controllers.DebugHandler{}
+	var reconcileLogs *controllers.ReconcileLogs
+	if enableDebugEndpoints {
+		setupLog.Info("debug endpoints enabled", "path", controllers.DebugCPAPath)
+		if reconcileLogLines > 0 {
+			reconcileLogs = controllers.NewReconcileLogs(reconcileLogLines, clock.RealClock{})
+			debugHandler.ReconcileLogs = reconcileLogs
+		}
+		metricsOptions.ExtraHandlers = map[string]http.Handler{
+			controllers.DebugCPAPath: debugHandler,
+		}
+	}
+
+	config := ctrl.GetConfigOrDie()
+	rateLimits := controllers.ClientRateLimits{
+		QPS:   float32(kubeAPIQPS),
+		Burst: kubeAPIBurst,
+	}
+	rateLimits.Apply(config)
+
+	// Make sure the CRD version reconciled by the operator is installed, otherwise the operator would silently never
+	// reconcile anything
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		setupLog.Error(err, "unable to set up discovery client")
+		os.Exit(1)
+	}
+	err = controllers.CheckCRDServed(discoveryClient)
+	if err != nil {
+		setupLog.Error(err, "CustomPodAutoscaler CRD check failed")
+		os.Exit(1)
+	}
+
+	// ServiceMonitors are only provisioned if the Prometheus Operator CRDs are installed
+	serviceMonitorServed, err := controllers.ServiceMonitorServed(discoveryClient)
+	if err != nil {
+		setupLog.Error(err, "unable to check if the ServiceMonitor CRD is installed")
+		os.Exit(1)
+	}
+
+	mgr, err := ctrl.NewManager(config, ctrl.Options{
+		Scheme:                 scheme,
+		Metrics:                metricsOptions,
+		HealthProbeBindAddress: probeAddr,
+		Cache:                  namespacedCache,
+		WebhookServer: webhook.NewServer(webhook.Options{
+			CertDir: webhookCertDir,
+		}),
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
@@ -75,13 +309,100 @@ func main() {
 
 	client := mgr.GetClient()
 	scheme := mgr.GetScheme()
-	scalingClient, err := controllers.SetupScalingClient()
+	debugHandler.Client = client
+	scalingClient, err := controllers.SetupScalingClient(rateLimits)
 	if err != nil {
 		setupLog.Error(err, "unable to set up scaling client")
 		os.Exit(1)
 	}
+	dynamicClient, err := controllers.SetupDynamicClient(rateLimits)
+	if err != nil {
+		setupLog.Error(err, "unable to set up dynamic client")
+		os.Exit(1)
+	}
+
+	var auditLogger *audit.Logger
+	if auditLogPath != "" {
+		auditWriter := os.Stdout
+		if auditLogPath != "-" {
+			auditWriter, err = os.OpenFile(auditLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+			if err != nil {
+				setupLog.Error(err, "unable to open audit log", "path", auditLogPath)
+				os.Exit(1)
+			}
+			defer auditWriter.Close()
+		}
+		auditLogger = audit.NewLogger(auditWriter, clock.RealClock{}, ctrl.Log.WithName("audit"))
+	}
+
+	var maintenanceWindow *controllers.MaintenanceWindow
+	if maintenanceWindowSchedule != "" {
+		maintenanceWindow, err = controllers.ParseMaintenanceWindow(maintenanceWindowSchedule, maintenanceWindowDuration)
+		if err != nil {
+			setupLog.Error(err, "unable to set up maintenance window")
+			os.Exit(1)
+		}
+	}
+
+	parsedDefaultAnnotations, err := parseAnnotations(defaultAnnotations)
+	if err != nil {
+		setupLog.Error(err, "unable to parse default annotations")
+		os.Exit(1)
+	}
+
+	parsedPodDiscoveryLabels, err := labels.ConvertSelectorToLabelsMap(podDiscoveryLabels)
+	if err != nil {
+		setupLog.Error(err, "unable to parse pod discovery labels")
+		os.Exit(1)
+	}
+
+	parsedResourceCeiling, err := controllers.ParseResourceCeiling(resourceCeiling)
+	if err != nil {
+		setupLog.Error(err, "unable to parse resource ceiling")
+		os.Exit(1)
+	}
 
-	if err = (&controllers.CustomPodAutoscalerReconciler{
+	parsedResourceCeilingMode, err := controllers.ParseResourceCeilingMode(resourceCeilingMode)
+	if err != nil {
+		setupLog.Error(err, "unable to parse resource ceiling mode")
+		os.Exit(1)
+	}
+
+	// Reconciles labelled with CPA labels are counted in place of the default reconcile counter, which has the same
+	// name
+	parsedMetricLabels := parseList(metricLabels)
+	targetKindReconciles := controllers.ReconcilesByTargetKind
+	if len(parsedMetricLabels) > 0 {
+		targetKindReconciles, err = controllers.NewReconcilesByTargetKind(parsedMetricLabels)
+		if err != nil {
+			setupLog.Error(err, "unable to parse metric labels")
+			os.Exit(1)
+		}
+		metrics.Registry.Unregister(controllers.ReconcilesByTargetKind)
+		metrics.Registry.MustRegister(targetKindReconciles)
+	}
+
+	var parsedShardSelector labels.Selector
+	if shardSelector != "" {
+		parsedShardSelector, err = labels.Parse(shardSelector)
+		if err != nil {
+			setupLog.Error(err, "unable to parse shard selector")
+			os.Exit(1)
+		}
+		setupLog.Info("reconciling CustomPodAutoscalers in shard", "selector", parsedShardSelector.String())
+	}
+
+	if environmentFilter != "" {
+		setupLog.Info("reconciling CustomPodAutoscalers in environment", "environment", environmentFilter)
+	}
+
+	parsedNamespaceSecurityProfiles, err := controllers.ParseNamespaceSecurityProfiles(namespaceSecurityProfiles)
+	if err != nil {
+		setupLog.Error(err, "unable to parse namespace security profiles")
+		os.Exit(1)
+	}
+
+	reconciler := &controllers.CustomPodAutoscalerReconciler{
 		Client: client,
 		Log:    ctrl.Log.WithName("controllers").WithName("CustomPodAutoscaler"),
 		Scheme: scheme,
@@ -89,17 +410,149 @@ func main() {
 			Client:               client,
 			Scheme:               scheme,
 			ControllerReferencer: controllerutil.SetControllerReference,
+			FieldManager:         fieldManager,
+			AuditLogger:          auditLogger,
+			ServerSideApply:      serverSideApply,
+			ForceOwnership:       forceOwnership,
 		},
-		ScalingClient: scalingClient,
-	}).SetupWithManager(mgr); err != nil {
+		ScalingClient:             scalingClient,
+		DynamicClient:             dynamicClient,
+		FieldManager:              fieldManager,
+		Tracer:                    otel.Tracer(controllers.TracerName),
+		RequiredLabels:            parseList(requiredLabels),
+		Environment:               environment,
+		DefaultAnnotations:        parsedDefaultAnnotations,
+		MaintenanceWindow:         maintenanceWindow,
+		AuditLogger:               auditLogger,
+		Recorder:                  mgr.GetEventRecorderFor("custompodautoscaler-controller"),
+		EnvVarsSizeThreshold:      envVarsSizeThreshold,
+		ReconcileLogs:             reconcileLogs,
+		FullReconcileInterval:     fullReconcileInterval,
+		ShardSelector:             parsedShardSelector,
+		ProxyEnvVars:              proxyEnvVars(httpProxy, httpsProxy, noProxy),
+		MaxReconcileFailures:      maxReconcileFailures,
+		ServiceMonitorServed:      serviceMonitorServed,
+		AllowedImageRegistries:    parseList(allowedImageRegistries),
+		PauseMetrics:              controllers.NewPauseMetrics(controllers.PausedCustomPodAutoscalers, controllers.PauseDurationSeconds),
+		CheckResourceQuota:        checkResourceQuota,
+		ScaleTargetRoleRules:      scaleTargetRoleRules,
+		NamespaceSecurityProfiles: parsedNamespaceSecurityProfiles,
+		NamespaceReader:           mgr.GetAPIReader(),
+		EnvironmentFilter:         environmentFilter,
+		RBACPropagationDelay:      rbacPropagationDelay,
+		DebugContainerImage:       debugContainerImage,
+		DiscoveryClient:           discoveryClient,
+		PodDiscoveryLabels:        parsedPodDiscoveryLabels,
+		TargetKindReconciles:      targetKindReconciles,
+		MetricLabels:              parsedMetricLabels,
+		ResourceCeiling:           parsedResourceCeiling,
+		ResourceCeilingMode:       parsedResourceCeilingMode,
+	}
+	debugHandler.Reconciler = reconciler
+	if err = reconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CustomPodAutoscaler")
 		os.Exit(1)
 	}
+	if err = (&controllers.PodStatusReconciler{
+		Client:            client,
+		Log:               ctrl.Log.WithName("controllers").WithName("PodStatus"),
+		ShardSelector:     parsedShardSelector,
+		EnvironmentFilter: environmentFilter,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PodStatus")
+		os.Exit(1)
+	}
+	if err = (&controllers.APIHealthReconciler{
+		Client:            client,
+		Log:               ctrl.Log.WithName("controllers").WithName("APIHealth"),
+		ShardSelector:     parsedShardSelector,
+		EnvironmentFilter: environmentFilter,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "APIHealth")
+		os.Exit(1)
+	}
+	if enableWebhooks {
+		validator := &controllers.CustomPodAutoscalerValidator{
+			Client: mgr.GetClient(),
+		}
+		if webhookStrictValidation {
+			validator.RuntimeClassReader = mgr.GetAPIReader()
+		}
+		if err = validator.SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "CustomPodAutoscaler")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
+	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+		setupLog.Error(err, "unable to set up health check")
+		os.Exit(1)
+	}
+	if err := mgr.AddReadyzCheck("readyz", controllers.ReadyzCheck(mgr.GetCache(), scalingClient)); err != nil {
+		setupLog.Error(err, "unable to set up ready check")
+		os.Exit(1)
+	}
+
+	if err := mgr.Add(&controllers.FleetSummaryLogger{
+		Reader:            mgr.GetAPIReader(),
+		Log:               ctrl.Log.WithName("fleet-summary"),
+		Namespace:         namespace,
+		ShardSelector:     parsedShardSelector,
+		EnvironmentFilter: environmentFilter,
+	}); err != nil {
+		setupLog.Error(err, "unable to set up fleet summary")
+		os.Exit(1)
+	}
+
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(ctx); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// parseAnnotations parses a comma separated list of key=value annotations, ignoring any empty entries
+func parseAnnotations(annotations string) (map[string]string, error) {
+	parsed := map[string]string{}
+	for _, annotation := range strings.Split(annotations, ",") {
+		annotation = strings.TrimSpace(annotation)
+		if annotation == "" {
+			continue
+		}
+		key, value, found := strings.Cut(annotation, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid annotation %q, must be in the form key=value", annotation)
+		}
+		parsed[key] = strings.TrimSpace(value)
+	}
+	return parsed, nil
+}
+
+// parseList parses a comma separated list, such as label keys, ignoring any empty entries
+func parseList(list string) []string {
+	parsed := []string{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry != "" {
+			parsed = append(parsed, entry)
+		}
+	}
+	return parsed
+}
+
+// proxyEnvVars returns the standard proxy environment variables for each proxy setting provided
+func proxyEnvVars(httpProxy string, httpsProxy string, noProxy string) []corev1.EnvVar {
+	envVars := []corev1.EnvVar{}
+	for _, envVar := range []corev1.EnvVar{
+		{Name: "HTTP_PROXY", Value: httpProxy},
+		{Name: "HTTPS_PROXY", Value: httpsProxy},
+		{Name: "NO_PROXY", Value: noProxy},
+	} {
+		if envVar.Value != "" {
+			envVars = append(envVars, envVar)
+		}
+	}
+	return envVars
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2024 The Custom Pod Autoscaler Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcile
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// ResourceApplyDuration is a histogram of how long each resource reconcile against the API server takes, labelled
+// with the kind of the resource
+var ResourceApplyDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "cpa_resource_apply_duration_seconds",
+	Help:    "Duration of reconciling a resource provisioned for a CustomPodAutoscaler against the API server",
+	Buckets: prometheus.DefBuckets,
+}, []string{"kind"})
+
+func init() {
+	metrics.Registry.MustRegister(ResourceApplyDuration)
+}
+
+// applyDuration returns the histogram that resource reconciles are observed in, falling back to the
+// ResourceApplyDuration histogram if none is set
+func (k *KubernetesResourceReconciler) applyDuration() prometheus.ObserverVec {
+	if k.ApplyDuration == nil {
+		return ResourceApplyDuration
+	}
+	return k.ApplyDuration
+}
@@ -18,16 +18,22 @@ package reconcile
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/go-logr/logr"
 	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/audit"
 	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
+	"github.com/prometheus/client_golang/prometheus"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
@@ -38,6 +44,20 @@ type KubernetesResourceReconciler struct {
 	Scheme               *runtime.Scheme
 	Client               client.Client
 	ControllerReferencer controllerReferencer
+	// FieldManager is the name used to attribute changes made by the operator in the managed fields of the
+	// resources it creates and updates
+	FieldManager string
+	// AuditLogger records the changes made to resources, if not set no audit records are written
+	AuditLogger *audit.Logger
+	// ApplyDuration observes how long each resource reconcile takes, labelled by kind, if not set the
+	// ResourceApplyDuration histogram is used
+	ApplyDuration prometheus.ObserverVec
+	// ServerSideApply provisions updatable resources using server-side apply with the FieldManager, so the operator
+	// only owns the fields it sets and fields set by other field managers are left unchanged
+	ServerSideApply bool
+	// ForceOwnership takes ownership of fields managed by other field managers when using server-side apply, if not
+	// set conflicts with other field managers are reported as errors rather than overwritten
+	ForceOwnership bool
 }
 
 // Reconcile manages k8s objects, making sure that the supplied object exists, and if it
@@ -49,17 +69,49 @@ func (k *KubernetesResourceReconciler) Reconcile(
 	shouldProvision bool,
 	updatable bool,
 	kind string,
+) (reconcile.Result, error) {
+	timer := prometheus.NewTimer(k.applyDuration().WithLabelValues(kind))
+	defer timer.ObserveDuration()
+	return k.reconcile(reqLogger, instance, obj, shouldProvision, updatable, kind)
+}
+
+func (k *KubernetesResourceReconciler) reconcile(
+	reqLogger logr.Logger,
+	instance *custompodautoscalercomv1.CustomPodAutoscaler,
+	obj metav1.Object,
+	shouldProvision bool,
+	updatable bool,
+	kind string,
 ) (reconcile.Result, error) {
 	runtimeObj := obj.(client.Object)
+	// The existing object is read into the same object, so keep the hash of the desired Pod to compare against
+	desiredPodSpecHash := obj.GetAnnotations()[controllers.PodSpecHashAnnotation]
 	// Set CustomPodAutoscaler instance as the owner and controller
 	err := k.ControllerReferencer(instance, obj, k.Scheme)
 	if err != nil {
 		return reconcile.Result{}, err
 	}
 
-	// Check if k8s object already exists
+	// The existing object is read into the same object, so keep a copy of the desired object to apply or update
+	var applyObj client.Object
+	var desiredObj client.Object
+	if k.ServerSideApply && updatable {
+		applyObj, err = k.applyObject(runtimeObj)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+	} else if updatable {
+		desiredObj = runtimeObj.DeepCopyObject().(client.Object)
+	}
+
+	// Check if k8s object already exists, an object using a generated name that has not been assigned a name yet
+	// can't already exist
 	existingObject := runtimeObj
-	err = k.Client.Get(context.Background(), types.NamespacedName{Name: obj.GetName(), Namespace: obj.GetNamespace()}, existingObject)
+	if obj.GetName() == "" && obj.GetGenerateName() != "" {
+		err = errors.NewNotFound(schema.GroupResource{}, obj.GetGenerateName())
+	} else {
+		err = k.Client.Get(context.Background(), types.NamespacedName{Name: obj.GetName(), Namespace: obj.GetNamespace()}, existingObject)
+	}
 	if err != nil {
 		if !errors.IsNotFound(err) {
 			return reconcile.Result{}, err
@@ -72,7 +124,12 @@ func (k *KubernetesResourceReconciler) Reconcile(
 		}
 		// Should provision, create a new object
 		reqLogger.Info("Creating a new k8s object ", "Kind", kind, "Namespace", obj.GetNamespace(), "Name", obj.GetName())
-		err = k.Client.Create(context.Background(), runtimeObj)
+		if applyObj != nil {
+			err = k.apply(applyObj, kind)
+		} else {
+			err = k.Client.Create(context.Background(), runtimeObj, client.FieldOwner(k.FieldManager))
+		}
+		k.AuditLogger.Record(instance, audit.ActionCreate, kind, obj.GetName(), err)
 		if err != nil {
 			return reconcile.Result{}, err
 		}
@@ -95,26 +152,44 @@ func (k *KubernetesResourceReconciler) Reconcile(
 		// Only update if object should be provisioned
 		if updatable {
 			reqLogger.Info("Updating k8s object ", "Kind", kind, "Namespace", obj.GetNamespace(), "Name", obj.GetName())
-			if existingObject.GetObjectKind().GroupVersionKind().Group == "" &&
-				existingObject.GetObjectKind().GroupVersionKind().Version == "v1" &&
-				existingObject.GetObjectKind().GroupVersionKind().Kind == "ServiceAccount" {
+			if applyObj != nil {
+				// Only the fields set by the operator are applied, fields managed by others (such as the secrets
+				// of a Service Account) are left unchanged
+				err = k.apply(applyObj, kind)
+				k.AuditLogger.Record(instance, audit.ActionUpdate, kind, obj.GetName(), err)
+				if err != nil {
+					return reconcile.Result{}, err
+				}
+				// Successful apply, don't requeue
+				return reconcile.Result{}, nil
+			}
+			// Update the existing object to the desired state, such as changed ConfigMap or Secret data
+			desiredObj.SetResourceVersion(existingObject.GetResourceVersion())
+			if serviceAccount, ok := existingObject.(*corev1.ServiceAccount); ok {
 				reqLogger.Info("Service Account update, retaining secrets ", "Kind", kind, "Namespace", obj.GetNamespace(), "Name", obj.GetName())
-				serviceAccount := existingObject.(*corev1.ServiceAccount)
-				updatedServiceAccount := runtimeObj.(*corev1.ServiceAccount)
+				updatedServiceAccount := desiredObj.(*corev1.ServiceAccount)
 				updatedServiceAccount.Secrets = serviceAccount.Secrets
 			}
 			// If object can be updated
-			err = k.Client.Update(context.Background(), runtimeObj)
+			err = k.Client.Update(context.Background(), desiredObj, client.FieldOwner(k.FieldManager))
+			k.AuditLogger.Record(instance, audit.ActionUpdate, kind, obj.GetName(), err)
 			if err != nil {
 				return reconcile.Result{}, err
 			}
 			// Successful update, don't requeue
 			return reconcile.Result{}, nil
 		}
+		// Only recreate an existing Pod if it has changed
+		if desiredPodSpecHash != "" && existingObject.GetAnnotations()[controllers.PodSpecHashAnnotation] == desiredPodSpecHash {
+			reqLogger.Info("Skip reconcile: k8s object already exists and is unchanged", "Kind", kind, "Namespace", obj.GetNamespace(), "Name", obj.GetName())
+			return reconcile.Result{}, nil
+		}
+
 		reqLogger.Info("Deleting k8s object ", "Kind", kind, "Namespace", obj.GetNamespace(), "Name", obj.GetName())
 
 		// If object can't be updated, delete and make new
 		err = k.Client.Delete(context.Background(), existingObject)
+		k.AuditLogger.Record(instance, audit.ActionDelete, kind, obj.GetName(), err)
 		if err != nil {
 			return reconcile.Result{}, err
 		}
@@ -125,26 +200,41 @@ func (k *KubernetesResourceReconciler) Reconcile(
 	// Object should not be provisioned, instead update owner reference of
 	// existing object
 	obj = existingObject.(metav1.Object)
+	// The CPA is set as the controller of the K8s object, unless the object is already controlled by something else,
+	// in which case the CPA is only added as an owner to avoid the object having multiple controllers
+	isController := true
+	if controller := metav1.GetControllerOf(obj); controller != nil && controller.UID != instance.UID {
+		isController = false
+	}
+	blockOwnerDeletion := true
+	cpaOwnerReference := metav1.OwnerReference{
+		APIVersion:         instance.APIVersion,
+		Kind:               instance.Kind,
+		Name:               instance.Name,
+		UID:                instance.UID,
+		Controller:         &isController,
+		BlockOwnerDeletion: &blockOwnerDeletion,
+	}
 	// Check if CPA set as K8s object owner
 	ownerReferences := obj.GetOwnerReferences()
-	cpaOwner := false
-	for _, owner := range ownerReferences {
+	cpaOwner := -1
+	for i, owner := range ownerReferences {
 		if owner.Kind == instance.Kind && owner.APIVersion == instance.APIVersion && owner.Name == instance.Name {
-			cpaOwner = true
+			cpaOwner = i
 			break
 		}
 	}
 
-	if !cpaOwner {
+	if cpaOwner == -1 || !equality.Semantic.DeepEqual(ownerReferences[cpaOwner], cpaOwnerReference) {
 		reqLogger.Info("CPA not set as owner, updating owner reference", "Kind", kind, "Namespace", obj.GetNamespace(), "Name", obj.GetName())
-		ownerReferences = append(ownerReferences, metav1.OwnerReference{
-			APIVersion: instance.APIVersion,
-			Kind:       instance.Kind,
-			Name:       instance.Name,
-			UID:        instance.UID,
-		})
+		if cpaOwner == -1 {
+			ownerReferences = append(ownerReferences, cpaOwnerReference)
+		} else {
+			ownerReferences[cpaOwner] = cpaOwnerReference
+		}
 		obj.SetOwnerReferences(ownerReferences)
-		err = k.Client.Update(context.Background(), existingObject)
+		err = k.Client.Update(context.Background(), existingObject, client.FieldOwner(k.FieldManager))
+		k.AuditLogger.Record(instance, audit.ActionAdopt, kind, obj.GetName(), err)
 		if err != nil {
 			return reconcile.Result{}, err
 		}
@@ -155,10 +245,39 @@ func (k *KubernetesResourceReconciler) Reconcile(
 	return reconcile.Result{}, nil
 }
 
+// applyObject returns a copy of the object to apply with server-side apply, with the type set as required by
+// server-side apply
+func (k *KubernetesResourceReconciler) applyObject(obj client.Object) (client.Object, error) {
+	applyObj := obj.DeepCopyObject().(client.Object)
+	gvk, err := apiutil.GVKForObject(applyObj, k.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	applyObj.GetObjectKind().SetGroupVersionKind(gvk)
+	return applyObj, nil
+}
+
+// apply applies the object using server-side apply as the FieldManager, a conflict with fields managed by another
+// field manager is reported as an error rather than overwritten unless ForceOwnership is set
+func (k *KubernetesResourceReconciler) apply(obj client.Object, kind string) error {
+	options := []client.PatchOption{client.FieldOwner(k.FieldManager)}
+	if k.ForceOwnership {
+		options = append(options, client.ForceOwnership)
+	}
+
+	err := k.Client.Patch(context.Background(), obj, client.Apply, options...)
+	if errors.IsConflict(err) {
+		return fmt.Errorf("failed to apply %s %s, fields are managed by another field manager, force ownership to "+
+			"take ownership of these fields: %w", kind, obj.GetName(), err)
+	}
+	return err
+}
+
 // PodCleanup will look for any Pods that have the v1.custompodautoscaler.com/owned-by label set to the name of the CPA
 // and delete any 'orphaned' Pods, these are Pods that are owned by the CPA but are no longer defined in the CPA
 // PodTemplateSpec (for example if the PodTemplateSpec has renamed the Pod, it should delete the old Pod as it
-// provisions a new Pod so there aren't two Pods for the CPA)
+// provisions a new Pod so there aren't two Pods for the CPA). If the CPA uses a generated Pod name, any Pod that is
+// not the Pod tracked in the CPA status is an orphan
 func (k *KubernetesResourceReconciler) PodCleanup(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler) error {
 	pods := &corev1.PodList{}
 	err := k.Client.List(context.Background(), pods,
@@ -183,13 +302,26 @@ func (k *KubernetesResourceReconciler) PodCleanup(reqLogger logr.Logger, instanc
 			continue
 		}
 
+		if instance.Spec.GeneratePodName != nil && *instance.Spec.GeneratePodName {
+			// Using a generated name, delete any pod that isn't the pod tracked in the CPA status
+			if pod.Name == instance.Status.PodName {
+				continue
+			}
+
+			err = k.deleteOrphan(reqLogger, instance, pod)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
 		if instance.Spec.Template.ObjectMeta.Name == "" {
 			// Using instance name, delete any pod that isn't using the instance name
 			if pod.Name == instance.Name {
 				continue
 			}
 
-			err = k.deleteOrphan(reqLogger, pod)
+			err = k.deleteOrphan(reqLogger, instance, pod)
 			if err != nil {
 				return err
 			}
@@ -198,7 +330,7 @@ func (k *KubernetesResourceReconciler) PodCleanup(reqLogger logr.Logger, instanc
 
 		// Using name defined in template, delete any pod that doesn't match that name
 		if pod.Name != instance.Spec.Template.ObjectMeta.Name {
-			err = k.deleteOrphan(reqLogger, pod)
+			err = k.deleteOrphan(reqLogger, instance, pod)
 			if err != nil {
 				return err
 			}
@@ -208,7 +340,9 @@ func (k *KubernetesResourceReconciler) PodCleanup(reqLogger logr.Logger, instanc
 	return nil
 }
 
-func (k *KubernetesResourceReconciler) deleteOrphan(reqLogger logr.Logger, pod corev1.Pod) error {
+func (k *KubernetesResourceReconciler) deleteOrphan(reqLogger logr.Logger, instance *custompodautoscalercomv1.CustomPodAutoscaler, pod corev1.Pod) error {
 	reqLogger.Info("Found orphaned Pod (owned by CPA but not currently defined), deleting", "Kind", pod.GetObjectKind().GroupVersionKind(), "Namespace", pod.GetNamespace(), "Name", pod.GetName())
-	return k.Client.Delete(context.Background(), &pod)
+	err := k.Client.Delete(context.Background(), &pod)
+	k.AuditLogger.Record(instance, audit.ActionDelete, "v1/Pod", pod.GetName(), err)
+	return err
 }
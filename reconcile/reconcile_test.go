@@ -17,6 +17,7 @@ limitations under the License.
 package reconcile_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"testing"
@@ -27,13 +28,19 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	custompodautoscalercomv1 "github.com/jthomperoo/custom-pod-autoscaler-operator/api/v1"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/audit"
+	"github.com/jthomperoo/custom-pod-autoscaler-operator/controllers"
 	k8sreconcile "github.com/jthomperoo/custom-pod-autoscaler-operator/reconcile"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clocktesting "k8s.io/utils/clock/testing"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
@@ -447,6 +454,45 @@ func TestReconcile(t *testing.T) {
 			false,
 			"v1/ServiceAccount",
 		},
+		{
+			"Pod already exists and is unchanged, not recreated",
+			reconcile.Result{},
+			nil,
+			&k8sreconcile.KubernetesResourceReconciler{
+				Client: func() *fakeClient {
+					fclient := &fakeClient{}
+					fclient.get = func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+						obj.SetAnnotations(map[string]string{
+							controllers.PodSpecHashAnnotation: "test-hash",
+						})
+						return nil
+					}
+					// Pod is unchanged so should not be deleted
+					fclient.delete = func(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+						return errors.New("Pod deleted")
+					}
+					return fclient
+				}(),
+				Scheme: &runtime.Scheme{},
+				ControllerReferencer: func(owner, object metav1.Object, scheme *runtime.Scheme) error {
+					return nil
+				},
+			},
+			log.WithValues("Request.Namespace", "test", "Request.Name", "test"),
+			&custompodautoscalercomv1.CustomPodAutoscaler{},
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test pod",
+					Namespace: "test namespace",
+					Annotations: map[string]string{
+						controllers.PodSpecHashAnnotation: "test-hash",
+					},
+				},
+			},
+			true,
+			false,
+			"v1/Pod",
+		},
 		{
 			"Object already exists with owner not set, fail to update",
 			reconcile.Result{},
@@ -1216,6 +1262,67 @@ func TestPodCleanup(t *testing.T) {
 				},
 			},
 		},
+		{
+			description: "Two pods found managed by CPA using generated name, delete pod not tracked in status",
+			expectedErr: nil,
+			reconciler: &k8sreconcile.KubernetesResourceReconciler{
+				Client: func() *fakeClient {
+					fclient := &fakeClient{}
+					fclient.list = func(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+						podList := list.(*corev1.PodList)
+						for _, name := range []string{"testcpa-abcde", "testcpa-fghij"} {
+							podList.Items = append(podList.Items, corev1.Pod{
+								ObjectMeta: metav1.ObjectMeta{
+									Name: name,
+									Labels: map[string]string{
+										"v1.custompodautoscaler.com/owned-by": "testcpa",
+									},
+									OwnerReferences: []metav1.OwnerReference{
+										{
+											Kind:       "custompodautoscaler",
+											APIVersion: "custompodautoscaler.com/v1",
+											Name:       "testcpa",
+										},
+									},
+								},
+							})
+						}
+						return nil
+					}
+					fclient.delete = func(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+						if obj.GetName() != "testcpa-fghij" {
+							return errors.New("deleted pod tracked in status")
+						}
+						return nil
+					}
+					return fclient
+				}(),
+				Scheme: &runtime.Scheme{},
+				ControllerReferencer: func(owner, object metav1.Object, scheme *runtime.Scheme) error {
+					return nil
+				},
+			},
+			logger: log.WithValues("Request.Namespace", "test", "Request.Name", "test"),
+			instance: &custompodautoscalercomv1.CustomPodAutoscaler{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "custompodautoscaler",
+					APIVersion: "custompodautoscaler.com/v1",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "testcpa",
+					UID:  "testuid",
+				},
+				Spec: custompodautoscalercomv1.CustomPodAutoscalerSpec{
+					GeneratePodName: func() *bool {
+						val := true
+						return &val
+					}(),
+				},
+				Status: custompodautoscalercomv1.CustomPodAutoscalerStatus{
+					PodName: "testcpa-abcde",
+				},
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
@@ -1227,3 +1334,789 @@ func TestPodCleanup(t *testing.T) {
 		})
 	}
 }
+
+func TestReconcileFieldManager(t *testing.T) {
+	var tests = []struct {
+		description     string
+		expected        string
+		client          func(fieldManager *string) *fakeClient
+		shouldProvision bool
+		updatable       bool
+	}{
+		{
+			"Create new object with field manager",
+			"test-field-manager",
+			func(fieldManager *string) *fakeClient {
+				fclient := &fakeClient{}
+				fclient.get = func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+				}
+				fclient.create = func(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+					createOpts := &client.CreateOptions{}
+					createOpts.ApplyOptions(opts)
+					*fieldManager = createOpts.FieldManager
+					return nil
+				}
+				return fclient
+			},
+			true,
+			true,
+		},
+		{
+			"Update existing object with field manager",
+			"test-field-manager",
+			func(fieldManager *string) *fakeClient {
+				fclient := &fakeClient{}
+				fclient.get = func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					return nil
+				}
+				fclient.update = func(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+					updateOpts := &client.UpdateOptions{}
+					updateOpts.ApplyOptions(opts)
+					*fieldManager = updateOpts.FieldManager
+					return nil
+				}
+				return fclient
+			},
+			true,
+			true,
+		},
+		{
+			"Update owner reference of existing object with field manager",
+			"test-field-manager",
+			func(fieldManager *string) *fakeClient {
+				fclient := &fakeClient{}
+				fclient.get = func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					return nil
+				}
+				fclient.update = func(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+					updateOpts := &client.UpdateOptions{}
+					updateOpts.ApplyOptions(opts)
+					*fieldManager = updateOpts.FieldManager
+					return nil
+				}
+				return fclient
+			},
+			false,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var fieldManager string
+			reconciler := &k8sreconcile.KubernetesResourceReconciler{
+				Client: test.client(&fieldManager),
+				Scheme: &runtime.Scheme{},
+				ControllerReferencer: func(owner, object metav1.Object, scheme *runtime.Scheme) error {
+					return nil
+				},
+				FieldManager: "test-field-manager",
+			}
+			_, err := reconciler.Reconcile(log, &custompodautoscalercomv1.CustomPodAutoscaler{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test",
+				},
+			}, &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test",
+				},
+			}, test.shouldProvision, test.updatable, "v1/ServiceAccount")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !cmp.Equal(test.expected, fieldManager) {
+				t.Errorf("Field manager mismatch (-want +got):\n%s", cmp.Diff(test.expected, fieldManager))
+			}
+		})
+	}
+}
+
+func TestReconcileUpdateChanged(t *testing.T) {
+	var tests = []struct {
+		description string
+		expected    client.Object
+		existing    client.Object
+		desired     client.Object
+		kind        string
+	}{
+		{
+			"Secret with changed data, data updated",
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "test-secret-config",
+					Namespace:       "test",
+					ResourceVersion: "1000",
+				},
+				Data: map[string][]byte{
+					"apiToken": []byte("new-token"),
+				},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-secret-config",
+					Namespace: "test",
+				},
+				Data: map[string][]byte{
+					"apiToken": []byte("old-token"),
+					"removed":  []byte("removed"),
+				},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-secret-config",
+					Namespace: "test",
+				},
+				Data: map[string][]byte{
+					"apiToken": []byte("new-token"),
+				},
+			},
+			"v1/Secret",
+		},
+		{
+			"Service Account with changed labels, labels updated and secrets retained",
+			&corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "test",
+					Namespace:       "test",
+					ResourceVersion: "1000",
+					Labels: map[string]string{
+						"new": "label",
+					},
+				},
+				Secrets: []corev1.ObjectReference{
+					{
+						Name: "test-token",
+					},
+				},
+			},
+			&corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test",
+					Labels: map[string]string{
+						"old": "label",
+					},
+				},
+				Secrets: []corev1.ObjectReference{
+					{
+						Name: "test-token",
+					},
+				},
+			},
+			&corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test",
+					Labels: map[string]string{
+						"new": "label",
+					},
+				},
+			},
+			"v1/ServiceAccount",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			fclient := fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+				s := runtime.NewScheme()
+				s.AddKnownTypes(schema.GroupVersion{
+					Group:   "",
+					Version: "v1",
+				}, &corev1.Secret{}, &corev1.ServiceAccount{})
+				return s
+			}()).WithObjects(test.existing).Build()
+
+			reconciler := &k8sreconcile.KubernetesResourceReconciler{
+				Client: fclient,
+				Scheme: &runtime.Scheme{},
+				ControllerReferencer: func(owner, object metav1.Object, scheme *runtime.Scheme) error {
+					return nil
+				},
+			}
+			_, err := reconciler.Reconcile(log, &custompodautoscalercomv1.CustomPodAutoscaler{}, test.desired, true, true, test.kind)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			actual := test.expected.DeepCopyObject().(client.Object)
+			err = fclient.Get(context.Background(), client.ObjectKeyFromObject(test.expected), actual)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			actual.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{})
+
+			if !cmp.Equal(test.expected, actual) {
+				t.Errorf("Object mismatch (-want +got):\n%s", cmp.Diff(test.expected, actual))
+			}
+		})
+	}
+}
+
+func TestReconcileOwnerReferences(t *testing.T) {
+	boolPtr := func(b bool) *bool {
+		return &b
+	}
+
+	instance := &custompodautoscalercomv1.CustomPodAutoscaler{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "CustomPodAutoscaler",
+			APIVersion: "custompodautoscaler.com/v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "testcpa",
+			Namespace: "test-namespace",
+			UID:       "testuid",
+		},
+	}
+
+	var tests = []struct {
+		description string
+		expected    []metav1.OwnerReference
+		existing    []metav1.OwnerReference
+	}{
+		{
+			"No owner references, CPA set as controller",
+			[]metav1.OwnerReference{
+				{
+					APIVersion:         "custompodautoscaler.com/v1",
+					Kind:               "CustomPodAutoscaler",
+					Name:               "testcpa",
+					UID:                "testuid",
+					Controller:         boolPtr(true),
+					BlockOwnerDeletion: boolPtr(true),
+				},
+			},
+			nil,
+		},
+		{
+			"CPA owner reference without controller, standardized to controller",
+			[]metav1.OwnerReference{
+				{
+					APIVersion:         "custompodautoscaler.com/v1",
+					Kind:               "CustomPodAutoscaler",
+					Name:               "testcpa",
+					UID:                "testuid",
+					Controller:         boolPtr(true),
+					BlockOwnerDeletion: boolPtr(true),
+				},
+			},
+			[]metav1.OwnerReference{
+				{
+					APIVersion: "custompodautoscaler.com/v1",
+					Kind:       "CustomPodAutoscaler",
+					Name:       "testcpa",
+					UID:        "testuid",
+				},
+			},
+		},
+		{
+			"Already controlled by a different owner, CPA added as non-controller owner",
+			[]metav1.OwnerReference{
+				{
+					APIVersion: "apps/v1",
+					Kind:       "Deployment",
+					Name:       "other",
+					UID:        "otheruid",
+					Controller: boolPtr(true),
+				},
+				{
+					APIVersion:         "custompodautoscaler.com/v1",
+					Kind:               "CustomPodAutoscaler",
+					Name:               "testcpa",
+					UID:                "testuid",
+					Controller:         boolPtr(false),
+					BlockOwnerDeletion: boolPtr(true),
+				},
+			},
+			[]metav1.OwnerReference{
+				{
+					APIVersion: "apps/v1",
+					Kind:       "Deployment",
+					Name:       "other",
+					UID:        "otheruid",
+					Controller: boolPtr(true),
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			fclient := fake.NewClientBuilder().WithScheme(func() *runtime.Scheme {
+				s := runtime.NewScheme()
+				s.AddKnownTypes(schema.GroupVersion{
+					Group:   "",
+					Version: "v1",
+				}, &corev1.ServiceAccount{})
+				return s
+			}()).WithRuntimeObjects(
+				&corev1.ServiceAccount{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:            "test-sa",
+						Namespace:       "test-namespace",
+						OwnerReferences: test.existing,
+					},
+				},
+			).Build()
+
+			reconciler := &k8sreconcile.KubernetesResourceReconciler{
+				Client: fclient,
+				Scheme: &runtime.Scheme{},
+				ControllerReferencer: func(owner, object metav1.Object, scheme *runtime.Scheme) error {
+					return nil
+				},
+			}
+			_, err := reconciler.Reconcile(log, instance, &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-sa",
+					Namespace: "test-namespace",
+				},
+			}, false, true, "v1/ServiceAccount")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			serviceAccount := &corev1.ServiceAccount{}
+			err = fclient.Get(context.Background(), client.ObjectKey{Name: "test-sa", Namespace: "test-namespace"}, serviceAccount)
+			if err != nil {
+				t.Fatalf("Unexpected error getting service account: %v", err)
+			}
+
+			if !cmp.Equal(test.expected, serviceAccount.OwnerReferences) {
+				t.Errorf("Owner references mismatch (-want +got):\n%s", cmp.Diff(test.expected, serviceAccount.OwnerReferences))
+			}
+		})
+	}
+}
+
+func TestReconcileServerSideApply(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(corev1.AddToScheme(scheme))
+
+	var tests = []struct {
+		description     string
+		expectedErr     string
+		expectedApplied client.Object
+		expectedOptions *client.PatchOptions
+		expectedCreated bool
+		forceOwnership  bool
+		get             func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error
+		patchErr        error
+		obj             client.Object
+		updatable       bool
+	}{
+		{
+			"New object, create using server-side apply",
+			"",
+			&corev1.ServiceAccount{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "v1",
+					Kind:       "ServiceAccount",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test",
+					Labels: map[string]string{
+						"v1.custompodautoscaler.com/owned-by": "test",
+					},
+				},
+			},
+			&client.PatchOptions{
+				FieldManager: "test-manager",
+			},
+			false,
+			false,
+			func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+			},
+			nil,
+			&corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test",
+					Labels: map[string]string{
+						"v1.custompodautoscaler.com/owned-by": "test",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"Existing object, apply only the fields set by the operator leaving fields managed by others",
+			"",
+			&corev1.ServiceAccount{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "v1",
+					Kind:       "ServiceAccount",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test",
+					Labels: map[string]string{
+						"v1.custompodautoscaler.com/owned-by": "test",
+					},
+				},
+			},
+			&client.PatchOptions{
+				FieldManager: "test-manager",
+			},
+			false,
+			false,
+			func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				// Existing object has a label and secrets set by another field manager
+				serviceAccount := obj.(*corev1.ServiceAccount)
+				serviceAccount.Labels = map[string]string{
+					"v1.custompodautoscaler.com/owned-by": "test",
+					"gitops.example.com/app":              "test",
+				}
+				serviceAccount.Secrets = []corev1.ObjectReference{
+					{
+						Name: "test-secret",
+					},
+				}
+				return nil
+			},
+			nil,
+			&corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test",
+					Labels: map[string]string{
+						"v1.custompodautoscaler.com/owned-by": "test",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"Existing object, conflict with another field manager reported",
+			"failed to apply v1/ServiceAccount test, fields are managed by another field manager, force ownership to " +
+				`take ownership of these fields: Apply failed with 1 conflict: conflict with "gitops" using v1: ` +
+				".metadata.labels.v1.custompodautoscaler.com/owned-by",
+			nil,
+			nil,
+			false,
+			false,
+			func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				return nil
+			},
+			apierrors.NewApplyConflict([]metav1.StatusCause{
+				{
+					Type:    metav1.CauseTypeFieldManagerConflict,
+					Message: `conflict with "gitops" using v1`,
+					Field:   ".metadata.labels.v1.custompodautoscaler.com/owned-by",
+				},
+			}, `Apply failed with 1 conflict: conflict with "gitops" using v1: .metadata.labels.v1.custompodautoscaler.com/owned-by`),
+			&corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test",
+					Labels: map[string]string{
+						"v1.custompodautoscaler.com/owned-by": "test",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"Existing object, force ownership of conflicting fields",
+			"",
+			&corev1.ServiceAccount{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "v1",
+					Kind:       "ServiceAccount",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test",
+					Labels: map[string]string{
+						"v1.custompodautoscaler.com/owned-by": "test",
+					},
+				},
+			},
+			&client.PatchOptions{
+				FieldManager: "test-manager",
+				Force: func() *bool {
+					val := true
+					return &val
+				}(),
+			},
+			false,
+			true,
+			func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				return nil
+			},
+			nil,
+			&corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test",
+					Labels: map[string]string{
+						"v1.custompodautoscaler.com/owned-by": "test",
+					},
+				},
+			},
+			true,
+		},
+		{
+			"New Pod, not updatable so created without server-side apply",
+			"",
+			nil,
+			nil,
+			true,
+			false,
+			func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+			},
+			nil,
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test",
+				},
+			},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var applied client.Object
+			var options *client.PatchOptions
+			created := false
+
+			fclient := &fakeClient{}
+			fclient.get = test.get
+			fclient.patch = func(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				if patch != client.Apply {
+					t.Fatalf("Expected server-side apply patch, got %s", patch.Type())
+				}
+				if test.patchErr != nil {
+					return test.patchErr
+				}
+				applied = obj
+				options = (&client.PatchOptions{}).ApplyOptions(opts)
+				return nil
+			}
+			fclient.create = func(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+				created = true
+				return nil
+			}
+			fclient.update = func(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+				t.Fatalf("Unexpected update, server-side apply should be used")
+				return nil
+			}
+
+			reconciler := &k8sreconcile.KubernetesResourceReconciler{
+				Client: fclient,
+				Scheme: scheme,
+				ControllerReferencer: func(owner, object metav1.Object, scheme *runtime.Scheme) error {
+					return nil
+				},
+				FieldManager:    "test-manager",
+				ServerSideApply: true,
+				ForceOwnership:  test.forceOwnership,
+			}
+
+			kind := "v1/ServiceAccount"
+			if !test.updatable {
+				kind = "v1/Pod"
+			}
+			_, err := reconciler.Reconcile(log, &custompodautoscalercomv1.CustomPodAutoscaler{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test",
+				},
+			}, test.obj, true, test.updatable, kind)
+			errMessage := ""
+			if err != nil {
+				errMessage = err.Error()
+			}
+			if !cmp.Equal(test.expectedErr, errMessage) {
+				t.Errorf("Error mismatch (-want +got):\n%s", cmp.Diff(test.expectedErr, errMessage))
+			}
+
+			if !cmp.Equal(test.expectedApplied, applied) {
+				t.Errorf("Applied object mismatch (-want +got):\n%s", cmp.Diff(test.expectedApplied, applied))
+			}
+
+			if !cmp.Equal(test.expectedOptions, options) {
+				t.Errorf("Apply options mismatch (-want +got):\n%s", cmp.Diff(test.expectedOptions, options))
+			}
+
+			if !cmp.Equal(test.expectedCreated, created) {
+				t.Errorf("Created mismatch (-want +got):\n%s", cmp.Diff(test.expectedCreated, created))
+			}
+		})
+	}
+}
+
+func TestReconcileApplyDuration(t *testing.T) {
+	fclient := &fakeClient{}
+	fclient.get = func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+		if key.Name == "fail" {
+			return errors.New("fail to get")
+		}
+		return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+	}
+	fclient.create = func(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+		return nil
+	}
+
+	applyDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "test_apply_duration_seconds",
+	}, []string{"kind"})
+
+	reconciler := &k8sreconcile.KubernetesResourceReconciler{
+		Client: fclient,
+		Scheme: &runtime.Scheme{},
+		ControllerReferencer: func(owner, object metav1.Object, scheme *runtime.Scheme) error {
+			return nil
+		},
+		ApplyDuration: applyDuration,
+	}
+
+	instance := &custompodautoscalercomv1.CustomPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "test",
+		},
+	}
+
+	// Every apply should be observed, including failed applies
+	for _, name := range []string{"test", "fail"} {
+		reconciler.Reconcile(log, instance, &corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "test",
+			},
+		}, true, true, "v1/ServiceAccount")
+	}
+	reconciler.Reconcile(log, instance, &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "test",
+		},
+	}, true, false, "v1/Pod")
+
+	expected := map[string]uint64{
+		"v1/ServiceAccount": 2,
+		"v1/Pod":            1,
+		"v1/Role":           0,
+	}
+	for kind, expectedCount := range expected {
+		metric := &dto.Metric{}
+		err := applyDuration.WithLabelValues(kind).(prometheus.Histogram).Write(metric)
+		if err != nil {
+			t.Fatalf("Unexpected error reading histogram: %v", err)
+		}
+		count := metric.GetHistogram().GetSampleCount()
+		if !cmp.Equal(expectedCount, count) {
+			t.Errorf("Observation count mismatch for %s (-want +got):\n%s", kind, cmp.Diff(expectedCount, count))
+		}
+	}
+}
+
+func TestReconcileAuditRecords(t *testing.T) {
+	var tests = []struct {
+		description     string
+		expected        string
+		client          *fakeClient
+		shouldProvision bool
+		updatable       bool
+	}{
+		{
+			"Create new object, record create",
+			`{"timestamp":"2024-03-01T22:30:00Z","actor":"operator","cpa":{"namespace":"test","name":"test"},"action":"create","resource":{"kind":"v1/ServiceAccount","name":"test"},"result":"success"}` + "\n",
+			func() *fakeClient {
+				fclient := &fakeClient{}
+				fclient.get = func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+				}
+				fclient.create = func(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+					return nil
+				}
+				return fclient
+			}(),
+			true,
+			true,
+		},
+		{
+			"Fail to update existing object, record update error",
+			`{"timestamp":"2024-03-01T22:30:00Z","actor":"operator","cpa":{"namespace":"test","name":"test"},"action":"update","resource":{"kind":"v1/ServiceAccount","name":"test"},"result":"error","error":"fail to update"}` + "\n",
+			func() *fakeClient {
+				fclient := &fakeClient{}
+				fclient.get = func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					return nil
+				}
+				fclient.update = func(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+					return errors.New("fail to update")
+				}
+				return fclient
+			}(),
+			true,
+			true,
+		},
+		{
+			"Delete existing object that can't be updated, record delete",
+			`{"timestamp":"2024-03-01T22:30:00Z","actor":"operator","cpa":{"namespace":"test","name":"test"},"action":"delete","resource":{"kind":"v1/ServiceAccount","name":"test"},"result":"success"}` + "\n",
+			func() *fakeClient {
+				fclient := &fakeClient{}
+				fclient.get = func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					return nil
+				}
+				fclient.delete = func(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+					return nil
+				}
+				return fclient
+			}(),
+			true,
+			false,
+		},
+		{
+			"Adopt existing object, record adopt",
+			`{"timestamp":"2024-03-01T22:30:00Z","actor":"operator","cpa":{"namespace":"test","name":"test"},"action":"adopt","resource":{"kind":"v1/ServiceAccount","name":"test"},"result":"success"}` + "\n",
+			func() *fakeClient {
+				fclient := &fakeClient{}
+				fclient.get = func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					return nil
+				}
+				fclient.update = func(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+					return nil
+				}
+				return fclient
+			}(),
+			false,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var buf bytes.Buffer
+			reconciler := &k8sreconcile.KubernetesResourceReconciler{
+				Client: test.client,
+				Scheme: &runtime.Scheme{},
+				ControllerReferencer: func(owner, object metav1.Object, scheme *runtime.Scheme) error {
+					return nil
+				},
+				AuditLogger: audit.NewLogger(&buf, clocktesting.NewFakePassiveClock(time.Date(2024, time.March, 1, 22, 30, 0, 0, time.UTC)), logr.Discard()),
+			}
+			reconciler.Reconcile(log, &custompodautoscalercomv1.CustomPodAutoscaler{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test",
+				},
+			}, &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "test",
+				},
+			}, test.shouldProvision, test.updatable, "v1/ServiceAccount")
+
+			if !cmp.Equal(test.expected, buf.String()) {
+				t.Errorf("Audit records mismatch (-want +got):\n%s", cmp.Diff(test.expected, buf.String()))
+			}
+		})
+	}
+}